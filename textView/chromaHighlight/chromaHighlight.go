@@ -69,11 +69,17 @@ type ChromaHighlight struct {
 	TextTagList map[string]*gtk.TextTag // Used to store list of used tags in textBuffer
 	Formatter   int
 
-	formatter        string
-	tagDefList       map[string]bool // Used to create tags definition to RTF textBuffer format
-	preExistsTagList map[string]bool // store tags that exists before using highlighter
-	intStyles        map[string]bool // internal usage to check if exists
-	intLexers        map[string]bool // internal usage to check if exists
+	// Prefix of the tags names, followed by the name of the style,
+	// see tagFunc.go.
+	TagNamespace string
+
+	formatter   string
+	tagDefList  map[string]bool             // Used to create tags definition to RTF textBuffer format
+	prevTagList map[string]*gtk.TextTag     // tags used by the previous run, released if not used again
+	tagTokens   map[string]chroma.TokenType // token type of each tag, used to re-colour them
+	intStyles   map[string]bool             // internal usage to check if exists
+	intLexers   map[string]bool             // internal usage to check if exists
+	outputBody  []byte                      // RTF textBuffer text part, used to rebuild 'Output'
 
 	tagDefinition string
 	textTagTable  *gtk.TextTagTable
@@ -82,14 +88,18 @@ type ChromaHighlight struct {
 	txtBuff *gtk.TextBuffer
 	srcBuff *source.SourceBuffer
 
-	priority int
+	priority    int        // priority given to the highlighter tags, lowest by default
+	overlays    []*Overlay // semantic overlays, see AddOverlay
+	overlayTags map[OverlayKind]*gtk.TextTag
+	overlayPrio int // -1: the overlay tags get the highest priority when created
 	defaultLexerName,
 	defaultStyleName,
 	lexerName,
 	styleName,
 	lastMd5 string
 	md5SizeAnalyze  int
-	initialised     bool // TagList has been initialyzed
+	inputText       string // last highlighted text, used by export functions
+	initialised     bool   // TagList has been initialyzed
 	errAlreadyExist error
 
 	// chroma style, used by reset background function.
@@ -146,6 +156,9 @@ func ChromaHighlightNew(buff interface{}, formatter ...int) (c *ChromaHighlight,
 	// Set default values
 	c.defaultLexerName = "Go"
 	c.defaultStyleName = "pygments"
+	c.TagNamespace = DefaultTagNamespace
+	c.overlayTags = make(map[OverlayKind]*gtk.TextTag)
+	c.overlayPrio = -1
 
 	c.errAlreadyExist = errors.New("Already exist !")
 
@@ -186,8 +199,6 @@ func (c *ChromaHighlight) init() (err error) {
 	c.regBG = regexp.MustCompile(`bg:#[a-fA-F|0-9]{6}`)
 	c.regFG = regexp.MustCompile(`#[a-fA-F|0-9]{6}`)
 
-	c.RemoveTags()
-
 	// To check if source text have been modified.
 	c.md5SizeAnalyze = 1024 // Set to 0 means there is no limit
 
@@ -197,6 +208,9 @@ func (c *ChromaHighlight) init() (err error) {
 	default:
 		c.textTagTable, err = c.srcBuff.GetTagTable()
 	}
+
+	// Keep previous tags, they will be reused if possible.
+	c.beginTagsRun()
 	return
 }
 
@@ -205,6 +219,8 @@ func (c *ChromaHighlight) init() (err error) {
 func (c *ChromaHighlight) Highlight(inputString, lexerName, styleName string) (err error) {
 	var yes bool
 
+	c.inputText = inputString
+
 	// don't care if error occure, it will be
 	// handled by the caller.
 	if yes, err = c.sameAsPrevious(&inputString, lexerName, styleName); yes {
@@ -245,16 +261,8 @@ func (c *ChromaHighlight) Highlight(inputString, lexerName, styleName string) (e
 	switch c.formatter {
 	case "gtkTextBuffer":
 		err = c.tagsRegistration(c.tagDefinition)
-
-		mime := "GTKTEXTBUFFERCONTENTS-0001"
-		header := "<text_view_markup>\n <tags>"
-		endTags := "\n </tags>\n"
-		startText := "<text>"
-		footer := "</text>\n</text_view_markup>"
-
-		defPart := header + c.tagDefinition + endTags + startText + string(buff.Bytes()) + footer
-		c.Output = []byte(mime + string(glfs.SizeToBytes(uint32(len(defPart)))) + defPart)
-		// Register new tags
+		c.outputBody = buff.Bytes()
+		c.buildOutput()
 
 	case "gtkDirectToTextBuffer":
 		// Nothing to do since the output is only
@@ -263,11 +271,27 @@ func (c *ChromaHighlight) Highlight(inputString, lexerName, styleName string) (e
 		c.Output = buff.Bytes()
 	}
 
+	// Release the tags that are no longer used.
+	c.endTagsRun()
 	return
 }
 
-// ClrBuffer:Clear TextBuffer or SourceBuffer
+// buildOutput: build TextBuffer rich text format using
+// tags definitions and the text part.
+func (c *ChromaHighlight) buildOutput() {
+	mime := "GTKTEXTBUFFERCONTENTS-0001"
+	header := "<text_view_markup>\n <tags>"
+	endTags := "\n </tags>\n"
+	startText := "<text>"
+	footer := "</text>\n</text_view_markup>"
+
+	defPart := header + c.tagDefinition + endTags + startText + string(c.outputBody) + footer
+	c.Output = []byte(mime + string(glfs.SizeToBytes(uint32(len(defPart)))) + defPart)
+}
+
+// ClrBuffer:Clear TextBuffer or SourceBuffer, the overlays are removed too.
 func (c *ChromaHighlight) ClrBuffer() {
+	c.ClearOverlays()
 	switch c.srcBuff {
 	case nil:
 		c.txtBuff.Delete(c.txtBuff.GetStartIter(), c.txtBuff.GetEndIter())
@@ -311,6 +335,51 @@ func (c *ChromaHighlight) ToTextBuff() (err error) {
 	return
 }
 
+// BeginInsert: start a series of InsertHighlighted, used to highlight
+// several parts of a text (i.e: the code blocks of a document). The
+// tags of the previous series are kept if they are used again.
+func (c *ChromaHighlight) BeginInsert() (err error) {
+	c.initialised = false
+	return c.init()
+}
+
+// InsertHighlighted: highlight 'inputString' and insert it at 'iter'
+// without clearing the buffer, 'iter' is moved after the inserted text.
+// An unknown lexer gives plain text. Must be called between
+// BeginInsert and EndInsert.
+func (c *ChromaHighlight) InsertHighlighted(iter *gtk.TextIter, inputString, lexerName, styleName string) (err error) {
+	var it chroma.Iterator
+
+	l := lexerFromName(lexerName)
+	if l == nil {
+		l = lexers.Fallback
+	}
+	if c.chromaStyle = styles.Get(styleName); c.chromaStyle == nil {
+		return errors.New("styles.Get")
+	}
+	c.styleName = styleName
+	if it, err = chroma.Coalesce(l).Tokenise(nil, inputString); err != nil {
+		return
+	}
+	style := c.chromaClearBackground(c.chromaStyle)
+	buff := c.buffer()
+	for tkn := it(); tkn != chroma.EOF; tkn = it() {
+		if entry := style.Get(tkn.Type); !entry.IsZero() {
+			buff.InsertWithTag(iter, tkn.Value,
+				c.buildOneTagDefDirectToTextBuffer(c.tagName(tkn.Type), tkn.Type, &entry))
+		} else {
+			buff.Insert(iter, tkn.Value)
+		}
+	}
+	return
+}
+
+// EndInsert: end of the series, the unused tags are released.
+func (c *ChromaHighlight) EndInsert() {
+	c.endTagsRun()
+	c.initialised = true
+}
+
 // ToFile: output to file, cannot be used with (0).
 func (c *ChromaHighlight) ToFile(filename string) (err error) {
 	return ioutil.WriteFile(filename, c.Output, os.ModePerm)
@@ -0,0 +1,186 @@
+// detect.go
+
+/*
+	This library use:
+	- gotk3 that is licensed under the ISC License:
+	  https://github.com/gotk3/gotk3/blob/master/LICENSE
+
+	- Chroma — A general purpose syntax highlighter in pure Go, under the MIT License:
+	  https://github.com/alecthomas/chroma/LICENSE
+
+	Copyright ©2019 H.F.M gotk3_chroma_syntax_highlighter library "https://github/hfmrow"
+	This library comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+*/
+
+package chromaHighlight
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/alecthomas/chroma"
+	"github.com/alecthomas/chroma/lexers"
+)
+
+// Confidence levels returned by DetectLexer, content analysis
+// returns the weight given by the Chroma analyser (0.0 to 1.0).
+const (
+	CONFIDENCE_NONE      float32 = 0.0
+	CONFIDENCE_SHEBANG   float32 = 0.85
+	CONFIDENCE_ALIAS     float32 = 0.8
+	CONFIDENCE_FILENAME  float32 = 0.9
+	CONFIDENCE_MODELINE  float32 = 0.95
+	modelineLinesToCheck         = 5
+)
+
+var (
+	// Vim: "vim: set ft=python:", "vi: filetype=sh", "ex: syntax=c"
+	regModelineVim = regexp.MustCompile(`\b(?:vi|vim|ex)(?:[<=>]?\d+)?:.*?\b(?:ft|filetype|syntax)=([\w+#.-]+)`)
+	// Emacs: "-*- mode: python; -*-", "-*- python -*-"
+	regModelineEmacs      = regexp.MustCompile(`-\*-.*?\bmode:\s*([\w+#.-]+)`)
+	regModelineEmacsShort = regexp.MustCompile(`-\*-\s*([\w+#.-]+)\s*-\*-`)
+	// Version numbers at the end of interpreter names (python3.8)
+	regInterpreterVersion = regexp.MustCompile(`[\d.]+$`)
+
+	// interpreterAliases: interpreters whose name is not a lexer alias.
+	interpreterAliases = map[string]string{
+		"node":   "javascript",
+		"nodejs": "javascript",
+		"pwsh":   "powershell",
+		"tclsh":  "tcl",
+		"wish":   "tcl",
+		"runghc": "haskell",
+	}
+)
+
+// HighlightAuto: same as Highlight but the lexer is automatically
+// determined, see DetectLexer for more information. Return the
+// chosen lexer name and the confidence, so the caller can display
+// it and let the user override it using Highlight.
+func (c *ChromaHighlight) HighlightAuto(inputString, filename, styleName string) (lexerName string, confidence float32, err error) {
+	if lexerName, confidence = DetectLexer(inputString, filename); confidence == CONFIDENCE_NONE {
+		lexerName = c.defaultLexerName
+	}
+	err = c.Highlight(inputString, lexerName, styleName)
+	return
+}
+
+// DetectLexer: determine the lexer name to use with the given text.
+// The order is: modelines (vim/emacs), filename globs, shebang and
+// as last chance, Chroma content analysis. 'filename' can be empty.
+// An empty lexer name with CONFIDENCE_NONE is returned when nothing
+// matches.
+func DetectLexer(text, filename string) (lexerName string, confidence float32) {
+	var lexer chroma.Lexer
+
+	if lexer = lexerFromModeline(text); lexer != nil {
+		confidence = CONFIDENCE_MODELINE
+	}
+	if lexer == nil && len(filename) > 0 {
+		lexer, confidence = lexerFromFilename(filename)
+	}
+	if lexer == nil {
+		if lexer = lexerFromShebang(text); lexer != nil {
+			confidence = CONFIDENCE_SHEBANG
+		}
+	}
+	if lexer == nil {
+		lexer, confidence = lexerFromContent(text)
+	}
+
+	if lexer != nil {
+		lexerName = lexer.Config().Name
+	}
+	return
+}
+
+// lexerFromFilename: primary filenames globs are checked
+// before the aliases ones, same as chroma's "lexers.Match".
+func lexerFromFilename(filename string) (lexer chroma.Lexer, confidence float32) {
+	if lexer = lexers.Match(filename); lexer != nil {
+		confidence = CONFIDENCE_ALIAS
+		base := filepath.Base(filename)
+		for _, glob := range lexer.Config().Filenames {
+			if ok, _ := filepath.Match(glob, base); ok {
+				confidence = CONFIDENCE_FILENAME
+				break
+			}
+		}
+	}
+	return
+}
+
+// lexerFromShebang: "#!/usr/bin/env python3", "#!/bin/sh -e" ...
+func lexerFromShebang(text string) chroma.Lexer {
+	if !strings.HasPrefix(text, "#!") {
+		return nil
+	}
+	firstLine := strings.SplitN(text[2:], "\n", 2)[0]
+	fields := strings.Fields(firstLine)
+	if len(fields) == 0 {
+		return nil
+	}
+	interpreter := filepath.Base(fields[0])
+	if interpreter == "env" {
+		interpreter = ""
+		// Skip options and variables assignment: env -S VAR=1 python
+		for _, field := range fields[1:] {
+			if !strings.HasPrefix(field, "-") && !strings.Contains(field, "=") {
+				interpreter = filepath.Base(field)
+				break
+			}
+		}
+	}
+	return lexerFromName(interpreter)
+}
+
+// lexerFromModeline: vim or emacs modelines, only the
+// first and last lines of the text are checked.
+func lexerFromModeline(text string) chroma.Lexer {
+	lines := strings.Split(text, "\n")
+	if len(lines) > modelineLinesToCheck*2 {
+		lines = append(lines[:modelineLinesToCheck], lines[len(lines)-modelineLinesToCheck:]...)
+	}
+	for _, line := range lines {
+		for _, reg := range []*regexp.Regexp{regModelineVim, regModelineEmacs, regModelineEmacsShort} {
+			if match := reg.FindStringSubmatch(line); match != nil {
+				if lexer := lexerFromName(match[1]); lexer != nil {
+					return lexer
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// lexerFromContent: ask each Chroma analyser, keep the highest weight.
+func lexerFromContent(text string) (lexer chroma.Lexer, confidence float32) {
+	for _, l := range lexers.Registry.Lexers {
+		if analyser, ok := l.(chroma.Analyser); ok {
+			if weight := analyser.AnalyseText(text); weight > confidence {
+				lexer, confidence = l, weight
+			}
+		}
+	}
+	return
+}
+
+// lexerFromName: get lexer using name or alias, then try
+// without version number and finally known interpreters.
+func lexerFromName(name string) (lexer chroma.Lexer) {
+	name = strings.ToLower(name)
+	if len(name) == 0 {
+		return
+	}
+	if lexer = lexers.Get(name); lexer == nil {
+		name = regInterpreterVersion.ReplaceAllString(name, "")
+		if lexer = lexers.Get(name); lexer == nil {
+			if alias, ok := interpreterAliases[name]; ok {
+				lexer = lexers.Get(alias)
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,278 @@
+// export.go
+
+/*
+	This library use:
+	- gotk3 that is licensed under the ISC License:
+	  https://github.com/gotk3/gotk3/blob/master/LICENSE
+
+	- Chroma — A general purpose syntax highlighter in pure Go, under the MIT License:
+	  https://github.com/alecthomas/chroma/LICENSE
+
+	Copyright ©2019 H.F.M gotk3_chroma_syntax_highlighter library "https://github/hfmrow"
+	This library comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+*/
+
+package chromaHighlight
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/alecthomas/chroma"
+	"github.com/alecthomas/chroma/formatters/html"
+	"github.com/alecthomas/chroma/lexers"
+)
+
+// Export formats, used with ExportToFile.
+const (
+	EXPORT_HTML = iota
+	EXPORT_HTML_CLASSES
+	EXPORT_RTF
+	EXPORT_ANSI
+)
+
+// ToHTML: export the last highlighted text as a standalone HTML
+// document. 'classes' set to true use CSS classes (the stylesheet
+// is embedded into the document header), otherwise, inline styles
+// are used. 'lineNumbers' add line numbers at the beginning of each
+// line.
+func (c *ChromaHighlight) ToHTML(classes, lineNumbers bool) (out []byte, err error) {
+	var buff = new(bytes.Buffer)
+	f := html.New(
+		html.Standalone(true),
+		html.WithClasses(classes),
+		html.WithLineNumbers(lineNumbers),
+		html.TabWidth(4))
+
+	err = c.export(buff, f.Format)
+	return buff.Bytes(), err
+}
+
+// ToRTF: export the last highlighted text as RTF document, it can
+// be pasted into office applications (LibreOffice, Word, ...).
+func (c *ChromaHighlight) ToRTF(lineNumbers bool) (out []byte, err error) {
+	var buff = new(bytes.Buffer)
+	err = c.export(buff, func(w io.Writer, style *chroma.Style, it chroma.Iterator) error {
+		return c.rtfFormatter(w, style, it, lineNumbers)
+	})
+	return buff.Bytes(), err
+}
+
+// ToANSI: export the last highlighted text using 24-bit ANSI
+// escape sequences to be displayed in a terminal.
+func (c *ChromaHighlight) ToANSI(lineNumbers bool) (out []byte, err error) {
+	var buff = new(bytes.Buffer)
+	err = c.export(buff, func(w io.Writer, style *chroma.Style, it chroma.Iterator) error {
+		return c.ansiFormatter(w, style, it, lineNumbers)
+	})
+	return buff.Bytes(), err
+}
+
+// ExportToFile: export the last highlighted text to file using
+// one of the EXPORT_* formats.
+func (c *ChromaHighlight) ExportToFile(filename string, format int, lineNumbers bool) (err error) {
+	var out []byte
+	switch format {
+	case EXPORT_HTML:
+		out, err = c.ToHTML(false, lineNumbers)
+	case EXPORT_HTML_CLASSES:
+		out, err = c.ToHTML(true, lineNumbers)
+	case EXPORT_RTF:
+		out, err = c.ToRTF(lineNumbers)
+	case EXPORT_ANSI:
+		out, err = c.ToANSI(lineNumbers)
+	default:
+		err = fmt.Errorf("Unknown export format: %d", format)
+	}
+	if err == nil {
+		err = ioutil.WriteFile(filename, out, os.ModePerm)
+	}
+	return
+}
+
+// export: tokenise again the last highlighted text using the
+// resolved lexer & style then give the result to 'format'.
+func (c *ChromaHighlight) export(w io.Writer, format chroma.FormatterFunc) (err error) {
+	if c.chromaStyle == nil {
+		return errors.New("export: nothing has been highlighted yet")
+	}
+	if l := lexers.Get(strings.ToLower(c.lexerName)); l != nil {
+		var it chroma.Iterator
+		if it, err = chroma.Coalesce(l).Tokenise(nil, c.inputText); err == nil {
+			err = format(w, c.chromaStyle, it)
+		}
+	} else {
+		err = errors.New("lexers.Get")
+	}
+	return
+}
+
+// Tokens: tokenise again the last highlighted text, used by the
+// callers that need to know the structure of the text (i.e: code
+// folding in TextViewNumbered).
+func (c *ChromaHighlight) Tokens() (tokens []chroma.Token, err error) {
+	if l := lexers.Get(strings.ToLower(c.lexerName)); l != nil {
+		var it chroma.Iterator
+		if it, err = chroma.Coalesce(l).Tokenise(nil, c.inputText); err == nil {
+			tokens = it.Tokens()
+		}
+	} else {
+		err = errors.New("lexers.Get")
+	}
+	return
+}
+
+// ansiFormatter: 24-bit ANSI version, with line numbers if requested.
+func (c *ChromaHighlight) ansiFormatter(w io.Writer, style *chroma.Style, it chroma.Iterator, lineNumbers bool) error {
+	style = c.chromaClearBackground(style)
+	lines := chroma.SplitTokensIntoLines(it.Tokens())
+	digits := len(fmt.Sprintf("%d", len(lines)))
+	numEntry := style.Get(chroma.LineNumbers)
+
+	for idx, tokens := range lines {
+		if lineNumbers {
+			fmt.Fprint(w, ansiOpen(numEntry)+fmt.Sprintf("%*d ", digits, idx+1)+"\033[0m")
+		}
+		for _, tkn := range tokens {
+			entry := style.Get(tkn.Type)
+			if entry.IsZero() {
+				fmt.Fprint(w, tkn.Value)
+				continue
+			}
+			// Do not colourise the line ending.
+			value := strings.TrimSuffix(tkn.Value, "\n")
+			fmt.Fprint(w, ansiOpen(entry)+value+"\033[0m")
+			if len(value) != len(tkn.Value) {
+				fmt.Fprint(w, "\n")
+			}
+		}
+	}
+	return nil
+}
+
+// ansiOpen: build escape sequence corresponding to the style entry.
+func ansiOpen(entry chroma.StyleEntry) (out string) {
+	if entry.Bold == chroma.Yes {
+		out += "\033[1m"
+	}
+	if entry.Underline == chroma.Yes {
+		out += "\033[4m"
+	}
+	if entry.Italic == chroma.Yes {
+		out += "\033[3m"
+	}
+	if entry.Colour.IsSet() {
+		out += fmt.Sprintf("\033[38;2;%d;%d;%dm",
+			entry.Colour.Red(),
+			entry.Colour.Green(),
+			entry.Colour.Blue())
+	}
+	if entry.Background.IsSet() {
+		out += fmt.Sprintf("\033[48;2;%d;%d;%dm",
+			entry.Background.Red(),
+			entry.Background.Green(),
+			entry.Background.Blue())
+	}
+	return
+}
+
+// rtfFormatter: RTF version, colours are stored into the colour table
+// and referenced by their index inside the text.
+func (c *ChromaHighlight) rtfFormatter(w io.Writer, style *chroma.Style, it chroma.Iterator, lineNumbers bool) error {
+	var colours []chroma.Colour
+	var body = new(bytes.Buffer)
+
+	style = c.chromaClearBackground(style)
+	lines := chroma.SplitTokensIntoLines(it.Tokens())
+	digits := len(fmt.Sprintf("%d", len(lines)))
+
+	// Get index of the colour in the table, first index (0) is
+	// reserved by RTF for the 'auto' colour.
+	var colourIdx = func(col chroma.Colour) int {
+		for idx, existing := range colours {
+			if existing == col {
+				return idx + 1
+			}
+		}
+		colours = append(colours, col)
+		return len(colours)
+	}
+
+	var writeEntry = func(entry chroma.StyleEntry, value string) {
+		if entry.IsZero() {
+			body.WriteString(rtfEscape(value))
+			return
+		}
+		body.WriteString("{")
+		if entry.Bold == chroma.Yes {
+			body.WriteString(`\b`)
+		}
+		if entry.Italic == chroma.Yes {
+			body.WriteString(`\i`)
+		}
+		if entry.Underline == chroma.Yes {
+			body.WriteString(`\ul`)
+		}
+		if entry.Colour.IsSet() {
+			fmt.Fprintf(body, `\cf%d`, colourIdx(entry.Colour))
+		}
+		if entry.Background.IsSet() {
+			fmt.Fprintf(body, `\highlight%d`, colourIdx(entry.Background))
+		}
+		body.WriteString(" " + rtfEscape(value) + "}")
+	}
+
+	numEntry := style.Get(chroma.LineNumbers)
+	for idx, tokens := range lines {
+		if lineNumbers {
+			writeEntry(numEntry, fmt.Sprintf("%*d ", digits, idx+1))
+		}
+		for _, tkn := range tokens {
+			value := strings.TrimSuffix(tkn.Value, "\n")
+			writeEntry(style.Get(tkn.Type), value)
+			if len(value) != len(tkn.Value) {
+				body.WriteString("\\par\n")
+			}
+		}
+	}
+
+	fmt.Fprint(w, `{\rtf1\ansi\deff0{\fonttbl{\f0\fmodern Courier New;}}`+"\n")
+	fmt.Fprint(w, `{\colortbl;`)
+	for _, col := range colours {
+		fmt.Fprintf(w, `\red%d\green%d\blue%d;`, col.Red(), col.Green(), col.Blue())
+	}
+	fmt.Fprint(w, "}\n"+`\f0\fs20`+"\n")
+	_, err := body.WriteTo(w)
+	fmt.Fprint(w, "}\n")
+	return err
+}
+
+// rtfEscape: escape RTF control characters, non-ASCII characters
+// are converted to their unicode form.
+func rtfEscape(in string) string {
+	var out strings.Builder
+	for _, r := range in {
+		switch {
+		case r == '\\' || r == '{' || r == '}':
+			out.WriteString(`\` + string(r))
+		case r == '\t':
+			out.WriteString(`\tab `)
+		case r == '\n':
+			out.WriteString("\\line\n")
+		case r > 0x7F && r <= 0xFFFF:
+			fmt.Fprintf(&out, `\u%d?`, int16(r))
+		case r > 0xFFFF: // Surrogate pair
+			r -= 0x10000
+			fmt.Fprintf(&out, `\u%d?\u%d?`, int16(0xD800+(r>>10)), int16(0xDC00+(r&0x3FF)))
+		default:
+			out.WriteRune(r)
+		}
+	}
+	return out.String()
+}
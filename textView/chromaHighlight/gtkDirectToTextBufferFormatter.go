@@ -16,14 +16,11 @@
 package chromaHighlight
 
 import (
-	"fmt"
 	"io"
-	"strings"
 
 	"github.com/gotk3/gotk3/gtk"
 
 	"github.com/alecthomas/chroma"
-	"github.com/gotk3/gotk3/pango"
 )
 
 // gtkTextBufferFormatter: is a part of "ChromaHighlight" function.
@@ -32,9 +29,8 @@ func (c *ChromaHighlight) gtkDirectToTextBufferFormatter(w io.Writer, style *chr
 	var tag *gtk.TextTag
 	for tkn := it(); tkn != chroma.EOF; tkn = it() {
 		entry := style.Get(tkn.Type)
-		tokenName := strings.ToLower(tkn.Type.String())
 		if !entry.IsZero() {
-			tag = c.buildOneTagDefDirectToTextBuffer(tokenName, &entry)
+			tag = c.buildOneTagDefDirectToTextBuffer(c.tagName(tkn.Type), tkn.Type, &entry)
 			// Insert RTF tag direct to TextBuffer
 			switch c.srcBuff {
 			case nil:
@@ -58,41 +54,6 @@ func (c *ChromaHighlight) gtkDirectToTextBufferFormatter(w io.Writer, style *chr
 }
 
 // buildOneTagDefDirectToBuff: create tag and apply to TextBuffer
-func (c *ChromaHighlight) buildOneTagDefDirectToTextBuffer(name string, styleEntry *chroma.StyleEntry) (tag *gtk.TextTag) {
-	tagProp := map[string]interface{}{}
-	if styleEntry.Bold == chroma.Yes {
-		tagProp["weight"] = pango.WEIGHT_BOLD
-	}
-	if styleEntry.Italic == chroma.Yes {
-		tagProp["style"] = pango.STYLE_ITALIC
-	}
-	if styleEntry.Underline == chroma.Yes {
-		tagProp["underline"] = pango.UNDERLINE_SINGLE
-	}
-	if styleEntry.Colour.IsSet() {
-		tagProp["foreground"] = fmt.Sprintf("#%02X%02X%02X",
-			styleEntry.Colour.Red(),
-			styleEntry.Colour.Green(),
-			styleEntry.Colour.Blue())
-	}
-	if styleEntry.Background.IsSet() {
-		tagProp["background"] = fmt.Sprintf("#%02X%02X%02X",
-			styleEntry.Background.Red(),
-			styleEntry.Background.Green(),
-			styleEntry.Background.Blue())
-	}
-	if styleEntry.Border.IsSet() {
-		tagProp["background"] = fmt.Sprintf("#%02X%02X%02X",
-			styleEntry.Border.Red(),
-			styleEntry.Border.Green(),
-			styleEntry.Border.Blue())
-	}
-	tag = c.createTag(name, tagProp)
-	// store it for further usage
-	if !c.preExistsTagList[name] { // check wether did not exist before.
-		if c.TextTagList[name] == nil {
-			c.TextTagList[name] = tag // add wether not actually exist.
-		}
-	}
-	return
+func (c *ChromaHighlight) buildOneTagDefDirectToTextBuffer(name string, tokenType chroma.TokenType, styleEntry *chroma.StyleEntry) (tag *gtk.TextTag) {
+	return c.acquireTag(name, tokenType, c.tagPropsFromEntry(styleEntry))
 }
@@ -20,6 +20,7 @@ import (
 	"html"
 	"io"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -106,12 +107,7 @@ func (c *ChromaHighlight) buildTag(def tagDef) (tag *gtk.TextTag, err error) {
 				tagProp["background"] = getColor(prop.Value)
 			}
 		}
-		switch c.srcBuff {
-		case nil:
-			c.TextTagList[def.Name] = c.txtBuff.CreateTag(def.Name, tagProp)
-		default:
-			c.TextTagList[def.Name] = c.srcBuff.CreateTag(def.Name, tagProp)
-		}
+		tag = c.acquireTag(def.Name, c.tagTokens[def.Name], tagProp)
 	}
 	return
 }
@@ -123,12 +119,13 @@ func (c *ChromaHighlight) gtkTextBufferFormatter(w io.Writer, style *chroma.Styl
 	style = c.chromaClearBackground(style)
 	// Seek tokens
 	for tkn := it(); tkn != chroma.EOF; tkn = it() {
-		name = strings.ToLower(tkn.Type.String())
+		name = c.tagName(tkn.Type)
 		entry = style.Get(tkn.Type)
 
 		if !entry.IsZero() {
 			// The tag does not already exist, so, create it
 			if !c.tagDefList[name] {
+				c.tagTokens[name] = tkn.Type
 				c.tagDefinition += c.buildOneTagDef(name, &entry)
 			}
 			// Create RTF tag
@@ -189,3 +186,28 @@ func (c *ChromaHighlight) buildOneTagDef(name string, entry *chroma.StyleEntry)
 	}
 	return
 }
+
+// rebuildOutputTagDefs: build again tags definitions and
+// 'Output' using the given style, used after SwitchStyle.
+func (c *ChromaHighlight) rebuildOutputTagDefs(style *chroma.Style) {
+	var names []string
+	for name := range c.TextTagList {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	c.tagDefinition = ""
+	c.tagDefList = make(map[string]bool)
+	for _, name := range names {
+		entry := style.Get(c.tagTokens[name])
+		if def := c.buildOneTagDef(name, &entry); len(def) > 0 {
+			c.tagDefinition += def
+		} else {
+			// Still used in the text part, keep an empty definition.
+			c.tagDefList[name] = true
+			c.tagDefinition += "\n" + `  <tag name="` + name + `" priority="` + fmt.Sprintf("%d", len(c.tagDefList)) + `">
+  </tag>`
+		}
+	}
+	c.buildOutput()
+}
@@ -0,0 +1,439 @@
+// loader.go
+
+/*
+	This library use:
+	- gotk3 that is licensed under the ISC License:
+	  https://github.com/gotk3/gotk3/blob/master/LICENSE
+
+	- Chroma — A general purpose syntax highlighter in pure Go, under the MIT License:
+	  https://github.com/alecthomas/chroma/LICENSE
+
+	Copyright ©2019 H.F.M gotk3_chroma_syntax_highlighter library "https://github/hfmrow"
+	This library comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+
+	Load user defined styles and lexers at runtime.
+
+	Styles, XML format:
+	<style name="mystyle">
+	  <entry type="Keyword" style="bold #000080"/>
+	  <entry type="Comment" style="italic #D94B00"/>
+	</style>
+
+	Styles, JSON format:
+	{"name": "mystyle", "entries": {"Keyword": "bold #000080", "Comment": "italic #D94B00"}}
+
+	Lexers, Chroma XML format:
+	<lexer>
+	  <config>
+	    <name>MyLang</name>
+	    <alias>mylang</alias>
+	    <filename>*.myl</filename>
+	    <mime_type>text/x-mylang</mime_type>
+	    <case_insensitive>true</case_insensitive>
+	  </config>
+	  <rules>
+	    <state name="root">
+	      <rule pattern="#.*$"><token type="Comment"/></rule>
+	      <rule pattern="(\w+)(\s*)(=)">
+	        <bygroups><token type="NameVariable"/><token type="Text"/><token type="Operator"/></bygroups>
+	      </rule>
+	      <rule pattern="&quot;"><token type="LiteralString"/><push state="string"/></rule>
+	      <rule><include state="common"/></rule>
+	    </state>
+	    ...
+	  </rules>
+	</lexer>
+	Emitters: token, bygroups, using (lexer attr), usingself (state attr).
+	Mutators: push (state attr, none means current state), pop (depth attr), include, combined.
+*/
+
+package chromaHighlight
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/chroma"
+	"github.com/alecthomas/chroma/lexers"
+	"github.com/alecthomas/chroma/styles"
+)
+
+// xmlNode: generic xml element, used to read the lexer rules
+// where the children order matter.
+type xmlNode struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Content  string     `xml:",chardata"`
+	Children []xmlNode  `xml:",any"`
+}
+
+// attr: get attribute value, 'ok' is false when not found.
+func (n *xmlNode) attr(name string) (value string, ok bool) {
+	for _, a := range n.Attrs {
+		if a.Name.Local == name {
+			return a.Value, true
+		}
+	}
+	return
+}
+
+// childs: get all children with the given name.
+func (n *xmlNode) childs(name string) (out []xmlNode) {
+	for _, child := range n.Children {
+		if child.XMLName.Local == name {
+			out = append(out, child)
+		}
+	}
+	return
+}
+
+// jsonStyle: JSON style file format.
+type jsonStyle struct {
+	Name    string            `json:"name"`
+	Entries map[string]string `json:"entries"`
+}
+
+// LoadStyleFile: load a style from XML or JSON file (determined by the
+// file extension), register it to chroma and add it to the available
+// styles list. Return the name of the style.
+func (c *ChromaHighlight) LoadStyleFile(filename string) (name string, err error) {
+	var data []byte
+	var entries map[string]string
+
+	if data, err = ioutil.ReadFile(filename); err != nil {
+		return
+	}
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		var js jsonStyle
+		if err = json.Unmarshal(data, &js); err != nil {
+			return "", fmt.Errorf("%s: %v", filename, err)
+		}
+		name, entries = js.Name, js.Entries
+	default:
+		var root xmlNode
+		if err = xml.Unmarshal(data, &root); err != nil {
+			return "", fmt.Errorf("%s: %v", filename, err)
+		}
+		if root.XMLName.Local != "style" {
+			return "", fmt.Errorf("%s: <style> root element expected, got <%s>", filename, root.XMLName.Local)
+		}
+		name, _ = root.attr("name")
+		entries = make(map[string]string)
+		for idx, entry := range root.childs("entry") {
+			typ, _ := entry.attr("type")
+			if _, exist := entries[typ]; exist {
+				return "", fmt.Errorf("%s: entry %d: type %q is defined twice", filename, idx+1, typ)
+			}
+			entries[typ], _ = entry.attr("style")
+		}
+	}
+
+	if len(name) == 0 {
+		return "", fmt.Errorf("%s: the style name is missing", filename)
+	}
+
+	// Sorted, to always report the same error first.
+	var types []string
+	for typ := range entries {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+
+	builder := chroma.NewStyleBuilder(name)
+	for _, typ := range types {
+		var tokenType chroma.TokenType
+		if tokenType, err = tokenTypeFromString(typ); err != nil {
+			return "", fmt.Errorf("%s: style %q: entry %q: %v", filename, name, typ, err)
+		}
+		if _, err = chroma.ParseStyleEntry(entries[typ]); err != nil {
+			return "", fmt.Errorf("%s: style %q: entry %q: %v", filename, name, typ, err)
+		}
+		builder.Add(tokenType, entries[typ])
+	}
+
+	var style *chroma.Style
+	if style, err = builder.Build(); err != nil {
+		return "", fmt.Errorf("%s: style %q: %v", filename, name, err)
+	}
+	styles.Register(style)
+
+	if !c.intStyles[name] {
+		c.intStyles[name] = true
+		c.Styles = append(c.Styles, name)
+		sort.Strings(c.Styles)
+	}
+	return
+}
+
+// LoadLexerFile: load a lexer from a Chroma XML lexer file, register
+// it to chroma and add it to the available lexers list. Return the
+// name of the lexer. Regular expressions are compiled at load time
+// so errors are reported immediately.
+func (c *ChromaHighlight) LoadLexerFile(filename string) (name string, err error) {
+	var data []byte
+	var root xmlNode
+
+	if data, err = ioutil.ReadFile(filename); err != nil {
+		return
+	}
+	if err = xml.Unmarshal(data, &root); err != nil {
+		return "", fmt.Errorf("%s: %v", filename, err)
+	}
+	if root.XMLName.Local != "lexer" {
+		return "", fmt.Errorf("%s: <lexer> root element expected, got <%s>", filename, root.XMLName.Local)
+	}
+
+	var config *chroma.Config
+	var rules chroma.Rules
+	if config, err = xmlLexerConfig(&root); err == nil {
+		rules, err = xmlLexerRules(&root)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", filename, err)
+	}
+	name = config.Name
+
+	var lexer *chroma.RegexLexer
+	if lexer, err = chroma.NewLexer(config, rules); err == nil {
+		// Force rules compilation to check the regular expressions.
+		_, err = lexer.Tokenise(nil, "")
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: lexer %q: %v", filename, name, err)
+	}
+	lexers.Register(lexer)
+
+	if !c.intLexers[name] {
+		c.intLexers[name] = true
+		c.Lexers = append(c.Lexers, name)
+		sort.Strings(c.Lexers)
+	}
+	return
+}
+
+// LoadFromDir: load all styles (.xml, .json) and lexers (.xml) found in
+// the directory. The type of the XML files is determined by the root
+// element. Files that cannot be loaded are reported in 'errs', they do
+// not stop the process.
+func (c *ChromaHighlight) LoadFromDir(dir string) (errs []error) {
+	var err error
+	var files []string
+
+	if files, err = filepath.Glob(filepath.Join(dir, "*")); err != nil {
+		return []error{err}
+	}
+	for _, filename := range files {
+		switch strings.ToLower(filepath.Ext(filename)) {
+		case ".json":
+			_, err = c.LoadStyleFile(filename)
+		case ".xml":
+			var data []byte
+			var root struct{ XMLName xml.Name }
+			if data, err = ioutil.ReadFile(filename); err == nil {
+				if err = xml.Unmarshal(data, &root); err == nil {
+					switch root.XMLName.Local {
+					case "lexer":
+						_, err = c.LoadLexerFile(filename)
+					default:
+						_, err = c.LoadStyleFile(filename)
+					}
+				}
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return
+}
+
+// xmlLexerConfig: read <config> part.
+func xmlLexerConfig(root *xmlNode) (config *chroma.Config, err error) {
+	var cfgs = root.childs("config")
+	if len(cfgs) != 1 {
+		return nil, fmt.Errorf("exactly one <config> element expected, got %d", len(cfgs))
+	}
+	config = new(chroma.Config)
+	for _, node := range cfgs[0].Children {
+		value := strings.TrimSpace(node.Content)
+		switch node.XMLName.Local {
+		case "name":
+			config.Name = value
+		case "alias":
+			config.Aliases = append(config.Aliases, value)
+		case "filename":
+			config.Filenames = append(config.Filenames, value)
+		case "alias_filename":
+			config.AliasFilenames = append(config.AliasFilenames, value)
+		case "mime_type":
+			config.MimeTypes = append(config.MimeTypes, value)
+		case "case_insensitive":
+			config.CaseInsensitive, err = strconv.ParseBool(value)
+		case "dot_all":
+			config.DotAll, err = strconv.ParseBool(value)
+		case "not_multiline":
+			config.NotMultiline, err = strconv.ParseBool(value)
+		case "ensure_nl":
+			config.EnsureNL, err = strconv.ParseBool(value)
+		case "priority":
+			var prio float64
+			prio, err = strconv.ParseFloat(value, 32)
+			config.Priority = float32(prio)
+		default:
+			err = fmt.Errorf("unknown element")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("<config> <%s>: %v", node.XMLName.Local, err)
+		}
+	}
+	if len(config.Name) == 0 {
+		err = fmt.Errorf("<config> <name> is missing")
+	}
+	return
+}
+
+// xmlLexerRules: read <rules> part.
+func xmlLexerRules(root *xmlNode) (rules chroma.Rules, err error) {
+	var rls = root.childs("rules")
+	if len(rls) != 1 {
+		return nil, fmt.Errorf("exactly one <rules> element expected, got %d", len(rls))
+	}
+	rules = make(chroma.Rules)
+	for _, state := range rls[0].childs("state") {
+		name, _ := state.attr("name")
+		if len(name) == 0 {
+			return nil, fmt.Errorf("<state> without name")
+		}
+		for idx, node := range state.childs("rule") {
+			var rule chroma.Rule
+			if rule, err = xmlLexerRule(&node); err != nil {
+				return nil, fmt.Errorf("state %q: rule %d: %v", name, idx+1, err)
+			}
+			rules[name] = append(rules[name], rule)
+		}
+	}
+	if _, ok := rules["root"]; !ok {
+		err = fmt.Errorf("no \"root\" state")
+	}
+	return
+}
+
+// xmlLexerRule: read one <rule>, emitter and mutators.
+func xmlLexerRule(node *xmlNode) (rule chroma.Rule, err error) {
+	var mutators []chroma.Mutator
+
+	rule.Pattern, _ = node.attr("pattern")
+	for _, child := range node.Children {
+		switch child.XMLName.Local {
+		case "include":
+			state, _ := child.attr("state")
+			include := chroma.Include(state)
+			mutators = append(mutators, include.Mutator)
+		case "combined":
+			var states []string
+			for _, a := range child.Attrs {
+				states = append(states, a.Value)
+			}
+			mutators = append(mutators, chroma.Combined(states...))
+		case "push":
+			var states []string
+			if state, ok := child.attr("state"); ok {
+				states = append(states, state)
+			}
+			mutators = append(mutators, chroma.Push(states...))
+		case "pop":
+			depth := 1
+			if value, ok := child.attr("depth"); ok {
+				if depth, err = strconv.Atoi(value); err != nil {
+					return rule, fmt.Errorf("<pop> depth: %v", err)
+				}
+			}
+			mutators = append(mutators, chroma.Pop(depth))
+		default:
+			if rule.Type != nil {
+				return rule, fmt.Errorf("only one emitter is allowed, got <%s>", child.XMLName.Local)
+			}
+			if rule.Type, err = xmlLexerEmitter(&child); err != nil {
+				return
+			}
+		}
+	}
+
+	switch len(mutators) {
+	case 0:
+	case 1:
+		rule.Mutator = mutators[0]
+	default:
+		// LexerMutator (include, combined) cannot be mixed.
+		for _, m := range mutators {
+			if _, ok := m.(chroma.LexerMutator); ok {
+				return rule, fmt.Errorf("<include> and <combined> must be used alone")
+			}
+		}
+		rule.Mutator = chroma.Mutators(mutators...)
+	}
+	return
+}
+
+// xmlLexerEmitter: token, bygroups, using, usingself.
+func xmlLexerEmitter(node *xmlNode) (emitter chroma.Emitter, err error) {
+	switch node.XMLName.Local {
+	case "token":
+		typ, _ := node.attr("type")
+		var tokenType chroma.TokenType
+		if tokenType, err = tokenTypeFromString(typ); err == nil {
+			emitter = tokenType
+		}
+	case "bygroups":
+		var emitters []chroma.Emitter
+		for _, child := range node.Children {
+			var e chroma.Emitter
+			if e, err = xmlLexerEmitter(&child); err != nil {
+				return
+			}
+			emitters = append(emitters, e)
+		}
+		emitter = chroma.ByGroups(emitters...)
+	case "using":
+		name, _ := node.attr("lexer")
+		// The lexer is retrieved at run time since it may
+		// be loaded after this one.
+		emitter = chroma.EmitterFunc(func(groups []string, lexer chroma.Lexer) chroma.Iterator {
+			if l := lexers.Get(name); l != nil {
+				return chroma.Using(l).Emit(groups, lexer)
+			}
+			return chroma.Error.Emit(groups, lexer)
+		})
+	case "usingself":
+		state, ok := node.attr("state")
+		if !ok {
+			state = "root"
+		}
+		emitter = chroma.UsingSelf(state)
+	default:
+		err = fmt.Errorf("unknown element <%s>", node.XMLName.Local)
+	}
+	return
+}
+
+// tokenTypeFromString: i.e "KeywordType" give chroma.KeywordType
+func tokenTypeFromString(name string) (tokenType chroma.TokenType, err error) {
+	if len(name) == 0 {
+		return tokenType, fmt.Errorf("token type is missing")
+	}
+	if err = json.Unmarshal([]byte(strconv.Quote(name)), &tokenType); err != nil {
+		err = fmt.Errorf("unknown token type %q", name)
+	}
+	return
+}
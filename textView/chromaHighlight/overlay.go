@@ -0,0 +1,257 @@
+// overlay.go
+
+/*
+	This library use:
+	- gotk3 that is licensed under the ISC License:
+	  https://github.com/gotk3/gotk3/blob/master/LICENSE
+
+	- Chroma — A general purpose syntax highlighter in pure Go, under the MIT License:
+	  https://github.com/alecthomas/chroma/LICENSE
+
+	Copyright ©2019 H.F.M gotk3_chroma_syntax_highlighter library "https://github/hfmrow"
+	This library comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+
+	Semantic overlays: diagnostics, TODOs, search hits ... displayed over the lexical
+	colouring. The tags created by the highlighter are set to the lowest priority
+	('priority' field) so the overlay tags are drawn over them, their own priority
+	can be set with SetOverlayPriority. Overlays use marks to follow the text when the
+	buffer is edited.
+*/
+
+package chromaHighlight
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gotk3/gotk3/gtk"
+	"github.com/gotk3/gotk3/pango"
+)
+
+// OverlayKind: kind of overlay, each kind has its own style.
+type OverlayKind int
+
+const (
+	OVERLAY_ERROR OverlayKind = iota
+	OVERLAY_WARNING
+	OVERLAY_TODO
+	OVERLAY_SEARCH
+)
+
+// OverlayStyles: tags properties used for each kind of overlay,
+// can be modified before the first overlay of a kind is added.
+var OverlayStyles = map[OverlayKind]map[string]interface{}{
+	OVERLAY_ERROR:   {"underline": pango.UNDERLINE_ERROR},
+	OVERLAY_WARNING: {"underline": pango.UNDERLINE_ERROR, "background": "#FFF6D0"},
+	OVERLAY_TODO:    {"background": "#E0EEFF"},
+	OVERLAY_SEARCH:  {"background": "#FFFF80"},
+}
+
+// overlayMarkSeq: used to name the marks of the overlays, gotk3 gives ""
+// instead of NULL for an anonymous mark.
+var overlayMarkSeq int
+
+// Overlay: a marked range of text.
+type Overlay struct {
+	Kind    OverlayKind
+	Message string
+
+	startMark,
+	endMark *gtk.TextMark
+}
+
+// AddOverlay: apply the overlay tag corresponding to 'kind' between
+// 'start' and 'end', 'message' is displayed as tooltip (see
+// AttachTooltips), it can be empty.
+func (c *ChromaHighlight) AddOverlay(start, end *gtk.TextIter, kind OverlayKind, message string) (ov *Overlay, err error) {
+	var tag *gtk.TextTag
+
+	if tag, err = c.overlayTag(kind); err != nil {
+		return
+	}
+	buff := c.buffer()
+	ov = &Overlay{Kind: kind, Message: message}
+	// Text inserted at the boundaries is not part of the overlay. The
+	// sequence is shared by all highlighters, names of marks are unique
+	// in a buffer.
+	overlayMarkSeq++
+	name := fmt.Sprintf("%soverlay:%d", c.TagNamespace, overlayMarkSeq)
+	ov.startMark = buff.CreateMark(name+":start", start, false)
+	ov.endMark = buff.CreateMark(name+":end", end, true)
+	buff.ApplyTag(tag, start, end)
+	c.overlays = append(c.overlays, ov)
+	return
+}
+
+// RemoveOverlay: remove one overlay.
+func (c *ChromaHighlight) RemoveOverlay(ov *Overlay) {
+	for idx, o := range c.overlays {
+		if o == ov {
+			c.overlays = append(c.overlays[:idx], c.overlays[idx+1:]...)
+			c.unapplyOverlay(ov)
+			break
+		}
+	}
+}
+
+// ClearOverlays: remove all overlays of the given kinds,
+// or all overlays if no kind is given.
+func (c *ChromaHighlight) ClearOverlays(kinds ...OverlayKind) {
+	var kept []*Overlay
+	var match = func(kind OverlayKind) bool {
+		if len(kinds) == 0 {
+			return true
+		}
+		for _, k := range kinds {
+			if k == kind {
+				return true
+			}
+		}
+		return false
+	}
+	buff := c.buffer()
+	for _, ov := range c.overlays {
+		if match(ov.Kind) {
+			if tag := c.overlayTags[ov.Kind]; tag != nil {
+				buff.RemoveTag(tag, buff.GetIterAtMark(ov.startMark), buff.GetIterAtMark(ov.endMark))
+			}
+			buff.DeleteMark(ov.startMark)
+			buff.DeleteMark(ov.endMark)
+			continue
+		}
+		kept = append(kept, ov)
+	}
+	c.overlays = kept
+}
+
+// Overlays: get overlays of the given kinds, or all if none given.
+func (c *ChromaHighlight) Overlays(kinds ...OverlayKind) (out []*Overlay) {
+	for _, ov := range c.overlays {
+		if len(kinds) == 0 {
+			out = append(out, ov)
+			continue
+		}
+		for _, k := range kinds {
+			if k == ov.Kind {
+				out = append(out, ov)
+				break
+			}
+		}
+	}
+	return
+}
+
+// OverlaysAtIter: get the overlays that contain 'iter'.
+func (c *ChromaHighlight) OverlaysAtIter(iter *gtk.TextIter) (out []*Overlay) {
+	buff := c.buffer()
+	for _, ov := range c.overlays {
+		start, end := buff.GetIterAtMark(ov.startMark), buff.GetIterAtMark(ov.endMark)
+		if iter.InRange(start, end) {
+			out = append(out, ov)
+		}
+	}
+	return
+}
+
+// Bounds: get the current position of the overlay.
+func (ov *Overlay) Bounds(buff *gtk.TextBuffer) (start, end *gtk.TextIter) {
+	return buff.GetIterAtMark(ov.startMark), buff.GetIterAtMark(ov.endMark)
+}
+
+// AttachTooltips: display overlays messages as tooltip when the
+// mouse hovers them. With a SourceView, use: &sourceView.TextView
+func (c *ChromaHighlight) AttachTooltips(view *gtk.TextView) {
+	view.SetProperty("has-tooltip", true)
+	view.Connect("query-tooltip", func(tv *gtk.TextView, x, y int, keyboardMode bool, tooltip *gtk.Tooltip) bool {
+		var iter *gtk.TextIter
+		if keyboardMode {
+			buff := c.buffer()
+			iter = buff.GetIterAtMark(buff.GetInsert())
+		} else {
+			bx, by := tv.WindowToBufferCoords(gtk.TEXT_WINDOW_WIDGET, x, y)
+			iter = tv.GetIterAtLocation(bx, by)
+		}
+		var messages []string
+		for _, ov := range c.OverlaysAtIter(iter) {
+			if len(ov.Message) > 0 {
+				messages = append(messages, ov.Message)
+			}
+		}
+		if len(messages) == 0 {
+			return false
+		}
+		tooltip.SetText(strings.Join(messages, "\n"))
+		return true
+	})
+}
+
+// SetOverlayPriority: priority of the overlay tags, it must be lower than
+// the number of tags in the TextTagTable (see gtk_text_tag_set_priority).
+// By default, they get the highest priority when they are created.
+func (c *ChromaHighlight) SetOverlayPriority(priority int) {
+	c.overlayPrio = priority
+	for _, tag := range c.overlayTags {
+		tag.SetPriority(priority)
+	}
+}
+
+// overlayTag: get or create the tag corresponding to the kind.
+// Created last, they get the highest priority unless another
+// one has been set.
+func (c *ChromaHighlight) overlayTag(kind OverlayKind) (tag *gtk.TextTag, err error) {
+	if tag = c.overlayTags[kind]; tag != nil {
+		return
+	}
+	props, ok := OverlayStyles[kind]
+	if !ok {
+		return nil, fmt.Errorf("AddOverlay: unknown overlay kind: %d", kind)
+	}
+	if c.textTagTable == nil {
+		switch c.srcBuff {
+		case nil:
+			c.textTagTable, err = c.txtBuff.GetTagTable()
+		default:
+			c.textTagTable, err = c.srcBuff.GetTagTable()
+		}
+		if err != nil {
+			return
+		}
+	}
+	name := fmt.Sprintf("%soverlay:%d", c.TagNamespace, kind)
+	if tag, ok = c.lookupExistingTag(name); ok {
+		c.setTagProps(tag, props)
+	} else {
+		tag = c.buffer().CreateTag(name, props)
+	}
+	if c.overlayPrio >= 0 {
+		tag.SetPriority(c.overlayPrio)
+	}
+	c.overlayTags[kind] = tag
+	return
+}
+
+// unapplyOverlay: remove tag from the overlay range then apply
+// it again to the others overlays of the same kind that may
+// overlap it.
+func (c *ChromaHighlight) unapplyOverlay(ov *Overlay) {
+	buff := c.buffer()
+	if tag := c.overlayTags[ov.Kind]; tag != nil {
+		buff.RemoveTag(tag, buff.GetIterAtMark(ov.startMark), buff.GetIterAtMark(ov.endMark))
+		for _, o := range c.overlays {
+			if o.Kind == ov.Kind {
+				buff.ApplyTag(tag, buff.GetIterAtMark(o.startMark), buff.GetIterAtMark(o.endMark))
+			}
+		}
+	}
+	buff.DeleteMark(ov.startMark)
+	buff.DeleteMark(ov.endMark)
+}
+
+// buffer: get the underlying TextBuffer.
+func (c *ChromaHighlight) buffer() *gtk.TextBuffer {
+	if c.srcBuff != nil {
+		return &c.srcBuff.TextBuffer
+	}
+	return c.txtBuff
+}
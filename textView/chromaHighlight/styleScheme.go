@@ -0,0 +1,276 @@
+// styleScheme.go
+
+/*
+	This library use:
+	- gotk3 that is licensed under the ISC License:
+	  https://github.com/gotk3/gotk3/blob/master/LICENSE
+
+	- Chroma — A general purpose syntax highlighter in pure Go, under the MIT License:
+	  https://github.com/alecthomas/chroma/LICENSE
+
+	Copyright ©2019 H.F.M gotk3_chroma_syntax_highlighter library "https://github/hfmrow"
+	This library comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+
+	Conversion between Chroma styles and GtkSourceView style-scheme files, this way,
+	the same theme definition can be used by "ChromaHighlight" and "SourceViewStruct".
+*/
+
+package chromaHighlight
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/alecthomas/chroma"
+	"github.com/alecthomas/chroma/styles"
+)
+
+// SchemeIdPrefix: prepended to the chroma style name to build the
+// style-scheme id, avoid conflicts with GtkSourceView built-in schemes
+// that may have the same name (i.e: "solarized-dark").
+var SchemeIdPrefix = "chroma-"
+
+// schemeMap: GtkSourceView 'def:*' styles and their corresponding
+// chroma token type. When the reverse conversion is done, the first
+// occurrence of a token type is used.
+var schemeMap = []struct {
+	Name  string
+	Token chroma.TokenType
+}{
+	{"text", chroma.Background},
+	{"line-numbers", chroma.LineNumbers},
+	{"current-line", chroma.LineHighlight},
+	{"def:comment", chroma.Comment},
+	{"def:shebang", chroma.CommentHashbang},
+	{"def:doc-comment", chroma.CommentSpecial},
+	{"def:note", chroma.CommentSpecial},
+	{"def:preprocessor", chroma.CommentPreproc},
+	{"def:keyword", chroma.Keyword},
+	{"def:statement", chroma.Keyword},
+	{"def:type", chroma.KeywordType},
+	{"def:special-constant", chroma.KeywordConstant},
+	{"def:boolean", chroma.KeywordConstant},
+	{"def:builtin", chroma.NameBuiltin},
+	{"def:function", chroma.NameFunction},
+	{"def:identifier", chroma.NameVariable},
+	{"def:constant", chroma.NameConstant},
+	{"def:string", chroma.LiteralString},
+	{"def:character", chroma.LiteralStringChar},
+	{"def:special-char", chroma.LiteralStringEscape},
+	{"def:number", chroma.LiteralNumber},
+	{"def:decimal", chroma.LiteralNumberInteger},
+	{"def:floating-point", chroma.LiteralNumberFloat},
+	{"def:base-n-integer", chroma.LiteralNumberHex},
+	{"def:operator", chroma.Operator},
+	{"def:error", chroma.Error},
+	{"def:heading", chroma.GenericHeading},
+	{"def:emphasis", chroma.GenericEmph},
+	{"def:strong", chroma.GenericStrong},
+	{"def:underlined", chroma.GenericUnderline},
+	{"def:insertion", chroma.GenericInserted},
+	{"def:deletion", chroma.GenericDeleted},
+}
+
+// xmlScheme: GtkSourceView style-scheme file structure.
+type xmlScheme struct {
+	XMLName     xml.Name        `xml:"style-scheme"`
+	Id          string          `xml:"id,attr"`
+	Name        string          `xml:"name,attr"`
+	Version     string          `xml:"version,attr"`
+	Authors     []string        `xml:"author"`
+	Description string          `xml:"description"`
+	Colors      []xmlSchemeColr `xml:"color"`
+	Styles      []xmlSchemeStyl `xml:"style"`
+}
+
+type xmlSchemeColr struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type xmlSchemeStyl struct {
+	Name          string `xml:"name,attr"`
+	Foreground    string `xml:"foreground,attr,omitempty"`
+	Background    string `xml:"background,attr,omitempty"`
+	Bold          string `xml:"bold,attr,omitempty"`
+	Italic        string `xml:"italic,attr,omitempty"`
+	Underline     string `xml:"underline,attr,omitempty"`
+	Strikethrough string `xml:"strikethrough,attr,omitempty"`
+}
+
+// StyleToSourceScheme: convert a registered chroma style (including
+// "hfmrow" and "hfmrow-github") to GtkSourceView style-scheme XML
+// format. The scheme id is made with 'SchemeIdPrefix' + style name.
+func StyleToSourceScheme(styleName string) (out []byte, err error) {
+	var style *chroma.Style
+	if style = styles.Registry[styleName]; style == nil {
+		return nil, fmt.Errorf("StyleToSourceScheme: unknown style: %s", styleName)
+	}
+
+	var getColour = func(col chroma.Colour) string {
+		if col.IsSet() {
+			return fmt.Sprintf("#%02X%02X%02X", col.Red(), col.Green(), col.Blue())
+		}
+		return ""
+	}
+	var getBool = func(t chroma.Trilean) string {
+		switch t {
+		case chroma.Yes:
+			return "true"
+		case chroma.No:
+			return "false"
+		}
+		return ""
+	}
+
+	scheme := xmlScheme{
+		Id:          SchemeIdPrefix + styleName,
+		Name:        styleName,
+		Version:     "1.0",
+		Authors:     []string{"chromaHighlight"},
+		Description: "Converted from the Chroma style: " + styleName}
+
+	for _, def := range schemeMap {
+		entry := style.Get(def.Token)
+		styl := xmlSchemeStyl{
+			Name:       def.Name,
+			Foreground: getColour(entry.Colour),
+			Background: getColour(entry.Background),
+			Bold:       getBool(entry.Bold),
+			Italic:     getBool(entry.Italic),
+		}
+		if entry.Underline == chroma.Yes {
+			styl.Underline = "single"
+		}
+		switch def.Token {
+		case chroma.Background:
+		case chroma.LineHighlight:
+			// Only the background is meaningful for the current line.
+			styl = xmlSchemeStyl{Name: def.Name, Background: styl.Background}
+		default:
+			// Use the text colours by default, so skip the
+			// background when it's the same as the text one.
+			if styl.Background == getColour(style.Get(chroma.Background).Background) {
+				styl.Background = ""
+			}
+			// Error uses border only.
+			if def.Token == chroma.Error && entry.Border.IsSet() {
+				styl.Underline = "error"
+			}
+		}
+		if styl != (xmlSchemeStyl{Name: def.Name}) {
+			scheme.Styles = append(scheme.Styles, styl)
+		}
+	}
+
+	if out, err = xml.MarshalIndent(scheme, "", "  "); err == nil {
+		out = append([]byte(xml.Header), append(out, '\n')...)
+	}
+	return
+}
+
+// InstallSourceScheme: convert chroma style to GtkSourceView
+// style-scheme and write it into the 'dir' directory, usually
+// the 'SourceViewStruct.UserStylePath'. Return the scheme id.
+func InstallSourceScheme(styleName, dir string) (id string, err error) {
+	var out []byte
+	if out, err = StyleToSourceScheme(styleName); err == nil {
+		if err = os.MkdirAll(dir, 0755); err == nil {
+			id = SchemeIdPrefix + styleName
+			err = ioutil.WriteFile(filepath.Join(dir, id+".xml"), out, 0644)
+		}
+	}
+	return
+}
+
+// SourceSchemeToStyle: reverse conversion, read a GtkSourceView
+// style-scheme file and build the corresponding chroma style.
+// The style is not registered, use 'styles.Register' to do it.
+func SourceSchemeToStyle(filename string) (style *chroma.Style, err error) {
+	var data []byte
+	var scheme xmlScheme
+
+	if data, err = ioutil.ReadFile(filename); err != nil {
+		return
+	}
+	if err = xml.Unmarshal(data, &scheme); err != nil {
+		return nil, fmt.Errorf("SourceSchemeToStyle: %s: %v", filename, err)
+	}
+
+	// Named colours
+	palette := make(map[string]string)
+	for _, col := range scheme.Colors {
+		palette[col.Name] = col.Value
+	}
+	var getColour = func(value string) string {
+		if strings.HasPrefix(value, "#") {
+			return value
+		}
+		// Not a colour specification, look at the palette.
+		if col, ok := palette[value]; ok && strings.HasPrefix(col, "#") {
+			return col
+		}
+		return ""
+	}
+
+	schemeStyles := make(map[string]xmlSchemeStyl)
+	for _, styl := range scheme.Styles {
+		schemeStyles[styl.Name] = styl
+	}
+
+	name := strings.TrimPrefix(scheme.Id, SchemeIdPrefix)
+	if len(name) == 0 {
+		name = strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	}
+	builder := chroma.NewStyleBuilder(name)
+	done := make(map[chroma.TokenType]bool)
+
+	for _, def := range schemeMap {
+		styl, ok := schemeStyles[def.Name]
+		if !ok || done[def.Token] {
+			continue
+		}
+		var entry []string
+		switch styl.Bold {
+		case "true":
+			entry = append(entry, "bold")
+		case "false":
+			entry = append(entry, "nobold")
+		}
+		switch styl.Italic {
+		case "true":
+			entry = append(entry, "italic")
+		case "false":
+			entry = append(entry, "noitalic")
+		}
+		switch styl.Underline {
+		case "", "false", "none":
+		case "error":
+			if col := getColour(styl.Foreground); len(col) > 0 {
+				entry = append(entry, "border:"+col)
+			}
+		default:
+			entry = append(entry, "underline")
+		}
+		if col := getColour(styl.Foreground); len(col) > 0 {
+			entry = append(entry, col)
+		}
+		if col := getColour(styl.Background); len(col) > 0 {
+			entry = append(entry, "bg:"+col)
+		}
+		if len(entry) > 0 {
+			builder.Add(def.Token, strings.Join(entry, " "))
+			done[def.Token] = true
+		}
+	}
+
+	if style, err = builder.Build(); err != nil {
+		err = fmt.Errorf("SourceSchemeToStyle: %s: %v", filename, err)
+	}
+	return
+}
@@ -11,41 +11,336 @@
 	Copyright ©2019 H.F.M gotk3_chroma_syntax_highlighter library "https://github/hfmrow"
 	This library comes with absolutely no warranty. See the The MIT License (MIT) for details:
 	https://opensource.org/licenses/mit-license.php
+
+	Tags handling: tags are named '<TagNamespace><style>:<token type>', their colours
+	never change, when the style change, the text is moved to the tags of the new style.
+	Tags are reference-counted per TextTagTable, so several highlighters sharing the same
+	namespace and the same style on the same buffer can share them. A tag is removed from
+	the TextTagTable as soon as it's no longer used. The TextTagTable is identified with
+	a marker tag it contains, never applied to the text.
 */
 
 package chromaHighlight
 
-import "github.com/gotk3/gotk3/gtk"
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/alecthomas/chroma"
+	"github.com/alecthomas/chroma/styles"
+	"github.com/gotk3/gotk3/gtk"
+	"github.com/gotk3/gotk3/pango"
+)
+
+// DefaultTagNamespace: used to name tags created by the highlighter,
+// avoid conflicts with the user-defined tags.
+var DefaultTagNamespace = "chroma:"
+
+// tagTableMarker: name of the tag that identifies a TextTagTable in
+// sharedTags.
+const tagTableMarker = "chromaHighlight:tag-table"
+
+// sharedTags: references count of the tags in use by the highlighters,
+// per TextTagTable (identified with the native pointer of its marker).
+// The entry of a table and its marker are removed with its last tag. A
+// table destroyed with its tags leaves only counts, a new marker at the
+// same address replaces them.
+var sharedTags = make(map[uintptr]map[string]int)
+
+// TagStats: tag table statistics, for debugging purpose.
+type TagStats struct {
+	Namespace string
+	Style     string
+	Owned     int            // Tags used by this highlighter.
+	Shared    int            // Owned tags also used by others highlighters.
+	Table     int            // Tags created by all highlighters in the TextTagTable.
+	Refs      map[string]int // References count of the owned tags.
+}
+
+// String: human readable version.
+func (s TagStats) String() string {
+	var names []string
+	for name := range s.Refs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out := fmt.Sprintf("namespace: %q, style: %q, owned: %d, shared: %d, table: %d\n",
+		s.Namespace, s.Style, s.Owned, s.Shared, s.Table)
+	for _, name := range names {
+		out += fmt.Sprintf("  %s: %d\n", name, s.Refs[name])
+	}
+	return out
+}
+
+// TagStats: get tag table statistics.
+func (c *ChromaHighlight) TagStats() (stats TagStats) {
+	stats = TagStats{
+		Namespace: c.TagNamespace,
+		Style:     c.styleName,
+		Owned:     len(c.TextTagList),
+		Refs:      make(map[string]int),
+	}
+	table := c.sharedTable(false)
+	stats.Table = len(table)
+	for name := range c.TextTagList {
+		if refs, ok := table[name]; ok {
+			stats.Refs[name] = refs
+			if refs > 1 {
+				stats.Shared++
+			}
+		}
+	}
+	return
+}
+
+// SwitchStyle: move the text to the tags of the given style, the text
+// is not inserted again, only the ranges of the tags are visited. Useful
+// to quickly change the style of a large text. The tags shared with other
+// highlighters still using the previous style can't be moved, the text
+// can't be told apart, it keeps its colours until highlighted again.
+func (c *ChromaHighlight) SwitchStyle(styleName string) (err error) {
+	if !c.intStyles[styleName] {
+		return fmt.Errorf("SwitchStyle: unknown style: %s", styleName)
+	}
+	if c.chromaStyle = styles.Get(styleName); c.chromaStyle == nil {
+		return fmt.Errorf("SwitchStyle: styles.Get: %s", styleName)
+	}
+	c.styleName = styleName
+	style := c.chromaClearBackground(c.chromaStyle)
+	table := c.sharedTable(false)
+	owned := c.TextTagList
+	c.TextTagList = make(map[string]*gtk.TextTag)
+	for name, tag := range owned {
+		tokenType := c.tagTokens[name]
+		newName := c.tagName(tokenType)
+		if newName == name || table[name] > 1 {
+			c.TextTagList[name] = tag
+			continue
+		}
+		entry := style.Get(tokenType)
+		c.moveTag(tag, c.acquireTag(newName, tokenType, c.tagPropsFromEntry(&entry)))
+		c.releaseTag(name)
+		delete(c.tagTokens, name)
+		// The serialized text refers to the tags by name.
+		c.outputBody = bytes.ReplaceAll(c.outputBody,
+			[]byte(`<apply_tag name="`+name+`">`), []byte(`<apply_tag name="`+newName+`">`))
+	}
+	// The serialized tags definitions are no longer valid.
+	if c.formatter == "gtkTextBuffer" {
+		c.rebuildOutputTagDefs(style)
+	}
+	return
+}
+
+// moveTag: apply 'to' where 'from' is applied in the buffer, 'from'
+// is removed when released.
+func (c *ChromaHighlight) moveTag(from, to *gtk.TextTag) {
+	if from.Native() == to.Native() {
+		return
+	}
+	buff := c.buffer()
+	iter := buff.GetStartIter()
+	for iter.HasTag(from) || iter.ForwardToTagToggle(from) {
+		offset := iter.GetOffset()
+		iter.ForwardToTagToggle(from)
+		buff.ApplyTag(to, buff.GetIterAtOffset(offset), iter)
+	}
+}
+
+// tagName: build namespaced tag name for the token type in the
+// current style.
+func (c *ChromaHighlight) tagName(tokenType chroma.TokenType) string {
+	return c.TagNamespace + c.styleName + ":" + strings.ToLower(tokenType.String())
+}
 
-// RemoveTags: reset all tags and maps
+// IsCommentOrString: the character at 'iter' is a part of a comment or a
+// string, used by the spell checker. The tokens without style have no tag.
+func (c *ChromaHighlight) IsCommentOrString(iter *gtk.TextIter) bool {
+	for name, tag := range c.TextTagList {
+		tokenType := c.tagTokens[name]
+		switch {
+		case tokenType.InSubCategory(chroma.CommentPreproc), tokenType == chroma.LiteralStringRegex:
+		case tokenType.InCategory(chroma.Comment), tokenType.InSubCategory(chroma.LiteralString):
+			if iter.HasTag(tag) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RemoveTags: release all tags and reset maps
 func (c *ChromaHighlight) RemoveTags() {
-	for tagName, _ := range c.TextTagList {
-		c.removeExistingTag(tagName)
+	for tagName := range c.TextTagList {
+		c.releaseTag(tagName)
+	}
+	for tagName := range c.prevTagList {
+		c.releaseTag(tagName)
 	}
 	c.initTagsMaps()
 }
 
 // initTagsMaps: Initialyze/reset tags maps
 func (c *ChromaHighlight) initTagsMaps() {
+	c.TextTagList = make(map[string]*gtk.TextTag)
+	c.prevTagList = make(map[string]*gtk.TextTag)
+	c.tagTokens = make(map[string]chroma.TokenType)
+	c.tagDefList = make(map[string]bool)
+}
+
+// beginTagsRun: Called before each highlighting, previously used
+// tags are kept to be reused (and re-coloured) if needed.
+func (c *ChromaHighlight) beginTagsRun() {
+	if c.TextTagList == nil {
+		c.initTagsMaps()
+	}
+	for name, tag := range c.TextTagList {
+		c.prevTagList[name] = tag
+	}
 	c.TextTagList = make(map[string]*gtk.TextTag)
 	c.tagDefList = make(map[string]bool)
-	c.preExistsTagList = make(map[string]bool)
 }
 
-// createTag: create tag with properties and add it to buffer.
-// Check wether the tag already exist in this case, return it.
-func (c *ChromaHighlight) createTag(tagName string, props map[string]interface{}) (tag *gtk.TextTag) {
-	if tag = c.TextTagList[tagName]; tag == nil {
+// endTagsRun: Called after each highlighting, release tags that
+// are not used anymore.
+func (c *ChromaHighlight) endTagsRun() {
+	for name := range c.prevTagList {
+		if _, ok := c.TextTagList[name]; !ok {
+			c.releaseTag(name)
+		}
+	}
+	c.prevTagList = make(map[string]*gtk.TextTag)
+}
+
+// acquireTag: get tag with properties, create it if needed. The
+// properties are only applied when the tag is created or adopted,
+// the name of a tag gives its style, so its colours don't change.
+func (c *ChromaHighlight) acquireTag(tagName string, tokenType chroma.TokenType, props map[string]interface{}) (tag *gtk.TextTag) {
+	if tag = c.TextTagList[tagName]; tag != nil {
+		return
+	}
+	c.tagTokens[tagName] = tokenType
+
+	if tag = c.prevTagList[tagName]; tag != nil {
+		// Already owned.
+		delete(c.prevTagList, tagName)
+		c.TextTagList[tagName] = tag
+		return
+	}
+
+	table := c.sharedTable(true)
+	tag, ok := c.lookupExistingTag(tagName)
+	switch {
+	case ok && table[tagName] > 0:
+		// Used by another highlighter with the same style.
+	case ok:
+		// Created outside, adopt it
+		c.setTagProps(tag, props)
+	default:
 		switch c.srcBuff {
 		case nil:
 			tag = c.txtBuff.CreateTag(tagName, props) // add tag & properties
 		default:
 			tag = c.srcBuff.CreateTag(tagName, props) // add tag & properties
 		}
+		// Under the others tags, overlays and user tags take precedence.
+		tag.SetPriority(c.priority)
+	}
+	table[tagName]++
+	c.TextTagList[tagName] = tag
+	return
+}
+
+// releaseTag: decrease reference count, remove it from the buffer
+// and the TextTagTable when it's no longer used.
+func (c *ChromaHighlight) releaseTag(tagName string) {
+	table := c.sharedTable(false)
+	if refs, ok := table[tagName]; ok {
+		if table[tagName] = refs - 1; refs > 1 {
+			return
+		}
+		if delete(table, tagName); len(table) == 0 {
+			if marker, ok := c.lookupExistingTag(tagTableMarker); ok {
+				delete(sharedTags, marker.Native())
+				c.textTagTable.Remove(marker)
+			}
+		}
 	}
+	c.removeExistingTag(tagName)
+}
+
+// sharedTable: get the references count of the tags of the current
+// TextTagTable, the marker and the entry of the table are created if
+// 'create' is set, otherwise the returned map may be nil.
+func (c *ChromaHighlight) sharedTable(create bool) (table map[string]int) {
+	marker, ok := c.lookupExistingTag(tagTableMarker)
+	if ok {
+		table = sharedTags[marker.Native()]
+	}
+	switch {
+	case table != nil || !create:
+		return
+	case c.textTagTable == nil:
+		return make(map[string]int)
+	}
+	if !ok {
+		var err error
+		if marker, err = gtk.TextTagNew(tagTableMarker); err != nil {
+			return make(map[string]int)
+		}
+		c.textTagTable.Add(marker)
+	}
+	table = make(map[string]int)
+	sharedTags[marker.Native()] = table
 	return
 }
 
+// tagPropsFromEntry: convert chroma style entry to tag properties.
+func (c *ChromaHighlight) tagPropsFromEntry(styleEntry *chroma.StyleEntry) map[string]interface{} {
+	tagProp := map[string]interface{}{}
+	if styleEntry.Bold == chroma.Yes {
+		tagProp["weight"] = pango.WEIGHT_BOLD
+	}
+	if styleEntry.Italic == chroma.Yes {
+		tagProp["style"] = pango.STYLE_ITALIC
+	}
+	if styleEntry.Underline == chroma.Yes {
+		tagProp["underline"] = pango.UNDERLINE_SINGLE
+	}
+	if styleEntry.Colour.IsSet() {
+		tagProp["foreground"] = fmt.Sprintf("#%02X%02X%02X",
+			styleEntry.Colour.Red(),
+			styleEntry.Colour.Green(),
+			styleEntry.Colour.Blue())
+	}
+	if styleEntry.Background.IsSet() {
+		tagProp["background"] = fmt.Sprintf("#%02X%02X%02X",
+			styleEntry.Background.Red(),
+			styleEntry.Background.Green(),
+			styleEntry.Background.Blue())
+	}
+	if styleEntry.Border.IsSet() {
+		tagProp["background"] = fmt.Sprintf("#%02X%02X%02X",
+			styleEntry.Border.Red(),
+			styleEntry.Border.Green(),
+			styleEntry.Border.Blue())
+	}
+	return tagProp
+}
+
+// setTagProps: reset then set properties of an existing tag.
+func (c *ChromaHighlight) setTagProps(tag *gtk.TextTag, props map[string]interface{}) {
+	for _, name := range []string{"weight-set", "style-set", "underline-set",
+		"strikethrough-set", "foreground-set", "background-set"} {
+		tag.SetProperty(name, false)
+	}
+	for name, value := range props {
+		tag.SetProperty(name, value)
+	}
+}
+
 // removeExistingTag: from buffer & TextTagTable if exists.
 func (c *ChromaHighlight) removeExistingTag(tagName string) {
 	if tag, ok := c.lookupExistingTag(tagName); ok {
@@ -64,6 +359,9 @@ func (c *ChromaHighlight) removeExistingTag(tagName string) {
 
 // LookupExistingTag:
 func (c *ChromaHighlight) lookupExistingTag(tagName string) (tag *gtk.TextTag, ok bool) {
+	if c.textTagTable == nil {
+		return
+	}
 	if tag, _ := c.textTagTable.Lookup(tagName); tag != nil { // Check wether tag exists
 		return tag, true
 	}
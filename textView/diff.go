@@ -0,0 +1,266 @@
+// diff.go
+
+/*
+	Copyright ©2019 H.F.M - TextView Numbered  library "https//github/hfmrow"
+	This program comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+
+	Lines comparison using the Myers' algorithm, the common prefix and suffix are
+	removed before the comparison. When there is too many differences, the whole
+	remaining part is reported as a single hunk to keep the memory usage low.
+
+	DiffWords compares two lines the same way, word by word, and UnifiedDiff gives
+	the "diff -u" output of two texts.
+*/
+
+package textView
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// DIFF_MAX_EDITS: maximum number of edits computed by DiffLines.
+const DIFF_MAX_EDITS = 1000
+
+// DiffHunk: range of lines that differ, 'ALen' lines of the original
+// text, starting at 'AStart', are replaced by the 'BLen' lines of the
+// new one, starting at 'BStart'. 0 based.
+type DiffHunk struct {
+	AStart, ALen,
+	BStart, BLen int
+}
+
+// DiffLines: compare two lists of lines and return the hunks that
+// transform 'a' into 'b'.
+func DiffLines(a, b []string) (hunks []DiffHunk) {
+	var prefix, suffix int
+
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	for suffix < len(a)-prefix && suffix < len(b)-prefix &&
+		a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	a, b = a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	matches, ok := diffMatches(a, b)
+	if !ok {
+		return []DiffHunk{{AStart: prefix, ALen: len(a), BStart: prefix, BLen: len(b)}}
+	}
+	// Hunks are between the matching lines.
+	prevA, prevB := -1, -1
+	for _, match := range append(matches, [2]int{len(a), len(b)}) {
+		if match[0] > prevA+1 || match[1] > prevB+1 {
+			hunks = append(hunks, DiffHunk{
+				AStart: prefix + prevA + 1, ALen: match[0] - prevA - 1,
+				BStart: prefix + prevB + 1, BLen: match[1] - prevB - 1})
+		}
+		prevA, prevB = match[0], match[1]
+	}
+	return
+}
+
+// diffMatches: get the matching lines indexes, sorted. 'ok' is
+// false when DIFF_MAX_EDITS is reached.
+func diffMatches(a, b []string) (matches [][2]int, ok bool) {
+	var trace [][]int
+
+	n, m := len(a), len(b)
+	max := n + m
+	if max == 0 {
+		return nil, true
+	}
+	v := make([]int, 2*max+2)
+	offset := max + 1
+
+	for d := 0; d <= max && d <= DIFF_MAX_EDITS; d++ {
+		// Keep a copy of the furthest points of the previous step.
+		trace = append(trace, append([]int{}, v[offset-d:offset+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1] // insertion
+			} else {
+				x = v[offset+k-1] + 1 // deletion
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return diffBacktrack(trace, n, m), true
+			}
+		}
+	}
+	return nil, false
+}
+
+// diffBacktrack: walk back the trace to find the matching lines.
+func diffBacktrack(trace [][]int, x, y int) (matches [][2]int) {
+	for d := len(trace) - 1; d > 0; d-- {
+		v := trace[d] // indexed by k+d
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[k-1+d] < v[k+1+d]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[prevK+d]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			matches = append(matches, [2]int{x, y})
+		}
+		x, y = prevX, prevY
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		matches = append(matches, [2]int{x, y})
+	}
+	for i, j := 0, len(matches)-1; i < j; i, j = i+1, j-1 {
+		matches[i], matches[j] = matches[j], matches[i]
+	}
+	return
+}
+
+// DiffWords: compare two lines word by word, whitespace runs and
+// punctuation characters are words too. The changed parts are returned
+// as ranges of characters (runes), [start, end), of each line.
+func DiffWords(a, b string) (aRanges, bRanges [][2]int) {
+	aWords, aOffsets := diffTokens(a)
+	bWords, bOffsets := diffTokens(b)
+	for _, hunk := range DiffLines(aWords, bWords) {
+		if hunk.ALen > 0 {
+			aRanges = append(aRanges, [2]int{aOffsets[hunk.AStart], aOffsets[hunk.AStart+hunk.ALen]})
+		}
+		if hunk.BLen > 0 {
+			bRanges = append(bRanges, [2]int{bOffsets[hunk.BStart], bOffsets[hunk.BStart+hunk.BLen]})
+		}
+	}
+	return
+}
+
+// diffTokens: split the line into words, 'offsets' are the
+// positions, in runes, of the words plus the end of the line.
+func diffTokens(line string) (words []string, offsets []int) {
+	class := func(r rune) int {
+		switch {
+		case r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r):
+			return 1
+		case unicode.IsSpace(r):
+			return 2
+		}
+		return 0 // Each punctuation character is a word.
+	}
+	runes := []rune(line)
+	for start, idx := 0, 0; idx < len(runes); start = idx {
+		c := class(runes[idx])
+		for idx++; c != 0 && idx < len(runes) && class(runes[idx]) == c; idx++ {
+		}
+		words = append(words, string(runes[start:idx]))
+		offsets = append(offsets, start)
+	}
+	offsets = append(offsets, len(runes))
+	return
+}
+
+// DiffSplit: split a text into lines, 'finalNewline' is true when
+// the last line is terminated.
+func DiffSplit(text string) (lines []string, finalNewline bool) {
+	if len(text) == 0 {
+		return nil, false
+	}
+	lines = strings.Split(text, "\n")
+	if finalNewline = lines[len(lines)-1] == ""; finalNewline {
+		lines = lines[:len(lines)-1]
+	}
+	return
+}
+
+// diffUnterminated: copy of 'lines' where the last one is marked
+// with "\n" if the text has no final newline.
+func diffUnterminated(lines []string, final bool) []string {
+	if final || len(lines) == 0 {
+		return lines
+	}
+	marked := append([]string{}, lines...)
+	marked[len(marked)-1] += "\n"
+	return marked
+}
+
+// UnifiedDiff: "diff -u" output of the texts with 'context' lines
+// around the changes, empty if they are identical.
+func UnifiedDiff(a, b, nameA, nameB string, context int) string {
+	var out strings.Builder
+
+	aLines, aFinal := DiffSplit(a)
+	bLines, bFinal := DiffSplit(b)
+	// Like diff, a line without newline only matches another one, so
+	// the final newline is a difference of the last line.
+	hunks := DiffLines(diffUnterminated(aLines, aFinal), diffUnterminated(bLines, bFinal))
+	if len(hunks) == 0 {
+		return ""
+	}
+
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", nameA, nameB)
+	line := func(prefix string, lines []string, idx int, final bool) {
+		out.WriteString(prefix + lines[idx] + "\n")
+		if idx == len(lines)-1 && !final {
+			out.WriteString("\\ No newline at end of file\n")
+		}
+	}
+	rangeStr := func(start, length int) string {
+		if length == 0 {
+			return fmt.Sprintf("%d,0", start)
+		}
+		if length == 1 {
+			return fmt.Sprintf("%d", start+1)
+		}
+		return fmt.Sprintf("%d,%d", start+1, length)
+	}
+	for first := 0; first < len(hunks); {
+		// Merge the hunks whose contexts overlap.
+		last := first
+		for last+1 < len(hunks) && hunks[last+1].AStart-(hunks[last].AStart+hunks[last].ALen) <= 2*context {
+			last++
+		}
+		aStart := hunks[first].AStart - context
+		if aStart < 0 {
+			aStart = 0
+		}
+		bStart := hunks[first].BStart - (hunks[first].AStart - aStart)
+		aEnd := hunks[last].AStart + hunks[last].ALen + context
+		if aEnd > len(aLines) {
+			aEnd = len(aLines)
+		}
+		bEnd := hunks[last].BStart + hunks[last].BLen + (aEnd - hunks[last].AStart - hunks[last].ALen)
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", rangeStr(aStart, aEnd-aStart), rangeStr(bStart, bEnd-bStart))
+
+		aIdx := aStart
+		for _, hunk := range hunks[first : last+1] {
+			for ; aIdx < hunk.AStart; aIdx++ {
+				line(" ", aLines, aIdx, aFinal)
+			}
+			for idx := hunk.AStart; idx < hunk.AStart+hunk.ALen; idx++ {
+				line("-", aLines, idx, aFinal)
+			}
+			for idx := hunk.BStart; idx < hunk.BStart+hunk.BLen; idx++ {
+				line("+", bLines, idx, bFinal)
+			}
+			aIdx = hunk.AStart + hunk.ALen
+		}
+		for ; aIdx < aEnd; aIdx++ {
+			line(" ", aLines, aIdx, aFinal)
+		}
+		first = last + 1
+	}
+	return out.String()
+}
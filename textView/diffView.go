@@ -0,0 +1,510 @@
+// diffView.go
+
+/*
+	This software use gotk3 that is licensed under the ISC License:
+	https://github.com/gotk3/gotk3/blob/master/LICENSE
+
+	Copyright ©2019 H.F.M - TextView Numbered  library "https//github/hfmrow"
+	This program comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+
+	Diff viewer: two texts compared line by line (see diff.go), the modified lines are
+	compared word by word. They are displayed side by side in two TextViewNumbered with
+	synchronised scrolling, or inline in a single one with the old and new line numbers
+	and the +/- signs in the gutter. The hunks can be applied to the original text (left)
+	or reverted in the new one (right), the result is exported as an unified diff.
+*/
+
+package textView
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gotk3/gotk3/cairo"
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+
+	gitvtt "github.com/hfmrow/gtk3_import/textView/textTag"
+)
+
+// DiffViewMode: how the texts are displayed.
+type DiffViewMode int
+
+const (
+	DIFF_VIEW_SIDE_BY_SIDE DiffViewMode = iota
+	DIFF_VIEW_INLINE
+)
+
+// DiffView: the widget, 'Box' is added to the container.
+type DiffView struct {
+	Left,
+	Right,
+	Inline *TextViewNumbered
+	Box   *gtk.Box
+	Paned *gtk.Paned
+
+	// Names used in the unified diff header.
+	NameA,
+	NameB string
+	// Context: lines around the changes in the unified diff.
+	Context int
+
+	RemovedBgCol,
+	AddedBgCol,
+	RemovedWordBgCol,
+	AddedWordBgCol string
+
+	// ChangedCallback: called when a hunk has been applied or reverted.
+	ChangedCallback func()
+
+	mode      DiffViewMode
+	a, b      []string
+	aFinal    bool
+	bFinal    bool
+	hunks     []DiffHunk
+	current   int
+	rows      []diffRow
+	hunkRows  []int // First inline row of each hunk
+	syncing   bool
+	inlineBox *gtk.Box
+}
+
+// diffRow: line of the inline view, 'aLine' or 'bLine' is -1
+// when the line doesn't exist in the text.
+type diffRow struct {
+	sign byte // ' ', '-' or '+'
+	aLine,
+	bLine int
+}
+
+// DiffViewNew: create the viewer and add it to the container.
+func DiffViewNew(container gtk.Container) (dv *DiffView, err error) {
+	dv = new(DiffView)
+	err = dv.Init(container)
+	return
+}
+
+// Init: build the widgets.
+func (dv *DiffView) Init(container gtk.Container) (err error) {
+	var leftBox, rightBox *gtk.Box
+
+	dv.Context = 3
+	dv.current = -1
+	dv.RemovedBgCol = "#FFE4E4"
+	dv.AddedBgCol = "#E4FFE4"
+	dv.RemovedWordBgCol = "#FFB4B4"
+	dv.AddedWordBgCol = "#AEF0AE"
+
+	if dv.Box, err = gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 0); err != nil {
+		return
+	}
+	if dv.Paned, err = gtk.PanedNew(gtk.ORIENTATION_HORIZONTAL); err != nil {
+		return
+	}
+	for _, box := range []**gtk.Box{&leftBox, &rightBox, &dv.inlineBox} {
+		if *box, err = gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 0); err != nil {
+			return
+		}
+	}
+	if dv.Left, err = TextViewNumberedNew(leftBox.Container); err != nil {
+		return
+	}
+	if dv.Right, err = TextViewNumberedNew(rightBox.Container); err != nil {
+		return
+	}
+	if dv.Inline, err = TextViewNumberedNew(dv.inlineBox.Container); err != nil {
+		return
+	}
+	for _, tvn := range []*TextViewNumbered{dv.Left, dv.Right, dv.Inline} {
+		tvn.Editable = false
+		tvn.Update()
+	}
+	dv.Inline.ShowNumbers = false
+	dv.Inline.AddGutterRenderer(&diffInlineRenderer{dv: dv})
+
+	dv.Paned.Pack1(leftBox, true, true)
+	dv.Paned.Pack2(rightBox, true, true)
+	dv.Box.PackStart(dv.Paned, true, true, 0)
+	dv.Box.PackStart(dv.inlineBox, true, true, 0)
+	dv.Box.ShowAll()
+	dv.inlineBox.SetNoShowAll(true)
+	dv.inlineBox.Hide()
+	container.Add(dv.Box)
+
+	// Synchronised scrolling
+	dv.Left.vAdj.Connect("value-changed", func() { dv.syncScroll(dv.Left, dv.Right, true) })
+	dv.Right.vAdj.Connect("value-changed", func() { dv.syncScroll(dv.Right, dv.Left, false) })
+	dv.Left.hAdj.Connect("value-changed", func() { dv.syncHScroll(dv.Left, dv.Right) })
+	dv.Right.hAdj.Connect("value-changed", func() { dv.syncHScroll(dv.Right, dv.Left) })
+	return
+}
+
+// SetTexts: compare the original text 'a' to the new one 'b'.
+func (dv *DiffView) SetTexts(a, b string) {
+	dv.a, dv.aFinal = DiffSplit(a)
+	dv.b, dv.bFinal = DiffSplit(b)
+	dv.current = -1
+	dv.refresh()
+}
+
+// SetFiles: compare the files, they are used as names.
+func (dv *DiffView) SetFiles(fileA, fileB string) (err error) {
+	var a, b string
+	if a, _, err = ReadTextFile(fileA, ENC_AUTO); err != nil {
+		return
+	}
+	if b, _, err = ReadTextFile(fileB, ENC_AUTO); err != nil {
+		return
+	}
+	dv.NameA, dv.NameB = fileA, fileB
+	dv.SetTexts(a, b)
+	return
+}
+
+// Texts: get the compared texts, with the applied or reverted hunks.
+func (dv *DiffView) Texts() (a, b string) {
+	return diffJoin(dv.a, dv.aFinal), diffJoin(dv.b, dv.bFinal)
+}
+
+// SetMode: side by side or inline.
+func (dv *DiffView) SetMode(mode DiffViewMode) {
+	dv.mode = mode
+	dv.Paned.SetVisible(mode == DIFF_VIEW_SIDE_BY_SIDE)
+	dv.inlineBox.SetVisible(mode == DIFF_VIEW_INLINE)
+	if dv.current >= 0 {
+		dv.GotoHunk(dv.current)
+	}
+}
+
+// Mode: current display mode.
+func (dv *DiffView) Mode() DiffViewMode {
+	return dv.mode
+}
+
+// Hunks: get the differences.
+func (dv *DiffView) Hunks() []DiffHunk {
+	return append([]DiffHunk{}, dv.hunks...)
+}
+
+// CurrentHunk: index of the hunk selected by the navigation, -1 if none.
+func (dv *DiffView) CurrentHunk() int {
+	return dv.current
+}
+
+// NextHunk: go to the next hunk, false if there is none.
+func (dv *DiffView) NextHunk() bool {
+	if dv.current+1 < len(dv.hunks) {
+		return dv.GotoHunk(dv.current + 1)
+	}
+	return false
+}
+
+// PrevHunk: go to the previous hunk, false if there is none.
+func (dv *DiffView) PrevHunk() bool {
+	if dv.current > 0 {
+		return dv.GotoHunk(dv.current - 1)
+	}
+	return false
+}
+
+// GotoHunk: select and show the hunk.
+func (dv *DiffView) GotoHunk(idx int) bool {
+	if idx < 0 || idx >= len(dv.hunks) {
+		return false
+	}
+	dv.current = idx
+	hunk := dv.hunks[idx]
+	show := func(tvn *TextViewNumbered, line int) {
+		iter := tvn.BuffTxt.GetIterAtLine(line)
+		tvn.BuffTxt.PlaceCursor(iter)
+		tvn.TextView.ScrollToIter(iter, 0.0, true, 0.0, 0.3)
+	}
+	if dv.mode == DIFF_VIEW_INLINE {
+		show(dv.Inline, dv.hunkRows[idx])
+	} else {
+		dv.Left.BuffTxt.PlaceCursor(dv.Left.BuffTxt.GetIterAtLine(hunk.AStart))
+		show(dv.Right, hunk.BStart)
+	}
+	return true
+}
+
+// ApplyHunk: copy the changes of the hunk to the original text.
+func (dv *DiffView) ApplyHunk(idx int) bool {
+	if idx < 0 || idx >= len(dv.hunks) {
+		return false
+	}
+	h := dv.hunks[idx]
+	if h.AStart+h.ALen == len(dv.a) && h.BStart+h.BLen == len(dv.b) {
+		dv.aFinal = dv.bFinal
+	}
+	dv.a = diffReplace(dv.a, h.AStart, h.ALen, dv.b[h.BStart:h.BStart+h.BLen])
+	dv.changed(idx)
+	return true
+}
+
+// RevertHunk: restore the original lines of the hunk in the new text.
+func (dv *DiffView) RevertHunk(idx int) bool {
+	if idx < 0 || idx >= len(dv.hunks) {
+		return false
+	}
+	h := dv.hunks[idx]
+	if h.AStart+h.ALen == len(dv.a) && h.BStart+h.BLen == len(dv.b) {
+		dv.bFinal = dv.aFinal
+	}
+	dv.b = diffReplace(dv.b, h.BStart, h.BLen, dv.a[h.AStart:h.AStart+h.ALen])
+	dv.changed(idx)
+	return true
+}
+
+// UnifiedDiff: "diff -u" output of the current texts.
+func (dv *DiffView) UnifiedDiff() string {
+	a, b := dv.Texts()
+	return UnifiedDiff(a, b, dv.NameA, dv.NameB, dv.Context)
+}
+
+// changed: a hunk has been applied or reverted, the next one
+// takes its index.
+func (dv *DiffView) changed(idx int) {
+	dv.current = idx - 1
+	dv.refresh()
+	if dv.ChangedCallback != nil {
+		dv.ChangedCallback()
+	}
+}
+
+// refresh: compare the texts and display them.
+func (dv *DiffView) refresh() {
+	// Like UnifiedDiff, the final newline is a difference of the last line.
+	dv.hunks = DiffLines(diffUnterminated(dv.a, dv.aFinal), diffUnterminated(dv.b, dv.bFinal))
+	if dv.current >= len(dv.hunks) {
+		dv.current = len(dv.hunks) - 1
+	}
+	dv.refreshSideBySide()
+	dv.refreshInline()
+}
+
+// refreshSideBySide: the original text at left, the new one at right.
+func (dv *DiffView) refreshSideBySide() {
+	a, b := dv.Texts()
+	dv.Left.SetText(a)
+	dv.Right.SetText(b)
+	dv.Right.DiffBars.SetBaseline(a)
+
+	removed, _ := dv.tags(dv.Left)
+	_, added := dv.tags(dv.Right)
+	for _, h := range dv.hunks {
+		diffTagLines(dv.Left, removed, h.AStart, h.ALen)
+		diffTagLines(dv.Right, added, h.BStart, h.BLen)
+		for i := 0; i < h.ALen && i < h.BLen; i++ {
+			aRanges, bRanges := DiffWords(dv.a[h.AStart+i], dv.b[h.BStart+i])
+			diffTagWords(dv.Left, "diffView:removed-word", dv.RemovedWordBgCol, h.AStart+i, aRanges)
+			diffTagWords(dv.Right, "diffView:added-word", dv.AddedWordBgCol, h.BStart+i, bRanges)
+		}
+	}
+}
+
+// refreshInline: the common lines, then for each hunk, the
+// removed and the added lines.
+func (dv *DiffView) refreshInline() {
+	var lines []string
+
+	dv.rows, dv.hunkRows = dv.rows[:0], dv.hunkRows[:0]
+	aIdx, bIdx := 0, 0
+	common := func(aEnd int) {
+		for ; aIdx < aEnd; aIdx, bIdx = aIdx+1, bIdx+1 {
+			dv.rows = append(dv.rows, diffRow{sign: ' ', aLine: aIdx, bLine: bIdx})
+			lines = append(lines, dv.a[aIdx])
+		}
+	}
+	for _, h := range dv.hunks {
+		common(h.AStart)
+		dv.hunkRows = append(dv.hunkRows, len(dv.rows))
+		for ; aIdx < h.AStart+h.ALen; aIdx++ {
+			dv.rows = append(dv.rows, diffRow{sign: '-', aLine: aIdx, bLine: -1})
+			lines = append(lines, dv.a[aIdx])
+		}
+		for ; bIdx < h.BStart+h.BLen; bIdx++ {
+			dv.rows = append(dv.rows, diffRow{sign: '+', aLine: -1, bLine: bIdx})
+			lines = append(lines, dv.b[bIdx])
+		}
+	}
+	common(len(dv.a))
+	dv.Inline.SetText(diffJoin(lines, dv.bFinal))
+
+	removed, added := dv.tags(dv.Inline)
+	for idx, h := range dv.hunks {
+		row := dv.hunkRows[idx]
+		diffTagLines(dv.Inline, removed, row, h.ALen)
+		diffTagLines(dv.Inline, added, row+h.ALen, h.BLen)
+		for i := 0; i < h.ALen && i < h.BLen; i++ {
+			aRanges, bRanges := DiffWords(dv.a[h.AStart+i], dv.b[h.BStart+i])
+			diffTagWords(dv.Inline, "diffView:removed-word", dv.RemovedWordBgCol, row+i, aRanges)
+			diffTagWords(dv.Inline, "diffView:added-word", dv.AddedWordBgCol, row+h.ALen+i, bRanges)
+		}
+	}
+	dv.Inline.QueueGutterDraw()
+}
+
+// tags: get the lines tags of the view.
+func (dv *DiffView) tags(tvn *TextViewNumbered) (removed, added *gtk.TextTag) {
+	removed = gitvtt.TagCreateIfNotExists(tvn.BuffTxt, "diffView:removed",
+		map[string]interface{}{"paragraph-background": dv.RemovedBgCol})
+	added = gitvtt.TagCreateIfNotExists(tvn.BuffTxt, "diffView:added",
+		map[string]interface{}{"paragraph-background": dv.AddedBgCol})
+	return
+}
+
+// diffTagLines: apply the tag to the lines.
+func diffTagLines(tvn *TextViewNumbered, tag *gtk.TextTag, start, count int) {
+	if count > 0 {
+		end := tvn.BuffTxt.GetIterAtLine(start + count - 1)
+		if !end.EndsLine() {
+			end.ForwardToLineEnd()
+		}
+		tvn.BuffTxt.ApplyTag(tag, tvn.BuffTxt.GetIterAtLine(start), end)
+	}
+}
+
+// diffTagWords: apply the tag to the ranges of characters of the line.
+func diffTagWords(tvn *TextViewNumbered, name, col string, line int, ranges [][2]int) {
+	tag := gitvtt.TagCreateIfNotExists(tvn.BuffTxt, name, map[string]interface{}{"background": col})
+	for _, r := range ranges {
+		start, end := tvn.BuffTxt.GetIterAtLine(line), tvn.BuffTxt.GetIterAtLine(line)
+		start.SetLineOffset(r[0])
+		end.SetLineOffset(r[1])
+		tvn.BuffTxt.ApplyTag(tag, start, end)
+	}
+}
+
+// syncScroll: align the line at the top of 'src' with the corresponding
+// line of 'dst', 'fromA' is set when 'src' displays the original text.
+func (dv *DiffView) syncScroll(src, dst *TextViewNumbered, fromA bool) {
+	if dv.syncing || dv.mode != DIFF_VIEW_SIDE_BY_SIDE {
+		return
+	}
+	dv.syncing = true
+	defer func() { dv.syncing = false }()
+
+	value := src.vAdj.GetValue()
+	iter := src.lineAtY(int(value))
+	y, height := src.TextView.GetLineYrange(iter)
+	var frac float64
+	if height > 0 {
+		frac = (value - float64(y)) / float64(height)
+	}
+	y, height = dst.TextView.GetLineYrange(dst.BuffTxt.GetIterAtLine(dv.mapLine(iter.GetLine(), fromA)))
+	dst.vAdj.SetValue(float64(y) + frac*float64(height))
+}
+
+// syncHScroll: same horizontal position.
+func (dv *DiffView) syncHScroll(src, dst *TextViewNumbered) {
+	if !dv.syncing {
+		dv.syncing = true
+		dst.hAdj.SetValue(src.hAdj.GetValue())
+		dv.syncing = false
+	}
+}
+
+// mapLine: get the line of the other text corresponding to 'line'.
+func (dv *DiffView) mapLine(line int, fromA bool) int {
+	var delta int
+	for _, h := range dv.hunks {
+		start, length, other, otherLength := h.AStart, h.ALen, h.BStart, h.BLen
+		if !fromA {
+			start, length, other, otherLength = h.BStart, h.BLen, h.AStart, h.ALen
+		}
+		if line < start {
+			break
+		}
+		if line < start+length {
+			if offset := line - start; offset < otherLength {
+				return other + offset
+			}
+			if otherLength > 0 {
+				return other + otherLength - 1
+			}
+			return other
+		}
+		delta = other + otherLength - start - length
+	}
+	return line + delta
+}
+
+// diffJoin: inverse of DiffSplit.
+func diffJoin(lines []string, finalNewline bool) string {
+	text := strings.Join(lines, "\n")
+	if finalNewline && len(lines) > 0 {
+		text += "\n"
+	}
+	return text
+}
+
+// diffReplace: replace 'count' lines at 'start' with a copy of 'with'.
+func diffReplace(lines []string, start, count int, with []string) []string {
+	result := make([]string, 0, len(lines)-count+len(with))
+	result = append(result, lines[:start]...)
+	result = append(result, with...)
+	return append(result, lines[start+count:]...)
+}
+
+// diffInlineRenderer: gutter of the inline view, the old and the
+// new line numbers followed by the sign of the line.
+type diffInlineRenderer struct {
+	dv        *DiffView
+	charWidth float64
+}
+
+func (r *diffInlineRenderer) digits() int {
+	count := len(r.dv.a)
+	if len(r.dv.b) > count {
+		count = len(r.dv.b)
+	}
+	return len(strconv.Itoa(count))
+}
+
+func (r *diffInlineRenderer) Width() int {
+	charWidth := r.charWidth
+	if charWidth == 0 {
+		charWidth = float64(r.dv.Inline.FontSze) * 0.6 // until the first drawing
+	}
+	return numbersLeftPadding + int(float64(2*r.digits()+3)*charWidth+0.5) + numbersRightPadding
+}
+
+func (r *diffInlineRenderer) Draw(cr *cairo.Context, line int, cell *GutterCell) {
+	if line >= len(r.dv.rows) {
+		return
+	}
+	tvn := r.dv.Inline
+	tvn.setCairoFont(cr)
+	if charWidth := cr.TextExtents("0").XAdvance; charWidth != r.charWidth {
+		r.charWidth = charWidth
+		glib.IdleAdd(tvn.QueueGutterDraw)
+	}
+	extents := cr.FontExtents()
+	baseline := cell.Y + (cell.RowHeight-extents.Height)/2 + extents.Ascent
+	column := float64(r.digits()+1) * r.charWidth
+
+	row := r.dv.rows[line]
+	setCairoColour(cr, tvn.NumFgCol)
+	for idx, number := range []int{row.aLine, row.bLine} {
+		if number >= 0 {
+			text := strconv.Itoa(number + 1)
+			cr.MoveTo(cell.X+numbersLeftPadding+float64(idx+1)*column-r.charWidth-cr.TextExtents(text).XAdvance, baseline)
+			cr.ShowText(text)
+		}
+	}
+	switch row.sign {
+	case '-':
+		setCairoColour(cr, GutterDiffColours[DIFF_DELETED])
+	case '+':
+		setCairoColour(cr, GutterDiffColours[DIFF_ADDED])
+	}
+	cr.MoveTo(cell.X+numbersLeftPadding+2*column, baseline)
+	cr.ShowText(string(row.sign))
+}
+
+func (r *diffInlineRenderer) Activate(line int, button gdk.Button) bool {
+	return false
+}
@@ -0,0 +1,145 @@
+// diff_test.go
+
+/*
+	Copyright ©2019 H.F.M - TextView Numbered  library "https//github/hfmrow"
+	This program comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+*/
+
+package textView
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// diffNumbered: 'count' lines "<prefix><n>".
+func diffNumbered(prefix string, count int) (lines []string) {
+	for idx := 0; idx < count; idx++ {
+		lines = append(lines, fmt.Sprintf("%s%d", prefix, idx))
+	}
+	return
+}
+
+func TestDiffLines(t *testing.T) {
+	split := func(text string) []string {
+		lines, _ := DiffSplit(text)
+		return lines
+	}
+	for _, test := range []struct {
+		a, b string
+		want []DiffHunk
+	}{
+		{"", "", nil},
+		{"a\nb\n", "a\nb\n", nil},
+		{"", "a\nb\n", []DiffHunk{{0, 0, 0, 2}}},
+		{"a\nb\n", "", []DiffHunk{{0, 2, 0, 0}}},
+		{"a\nb\nc\n", "a\nx\nc\n", []DiffHunk{{1, 1, 1, 1}}},
+		{"a\nb\nc\nd\n", "b\nc\ne\nd\n", []DiffHunk{{0, 1, 0, 0}, {3, 0, 2, 1}}},
+		{"a\nb\nc\n", "a\nb\nx\ny\nc\n", []DiffHunk{{2, 0, 2, 2}}},
+	} {
+		if got := DiffLines(split(test.a), split(test.b)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("DiffLines(%q, %q): got %v, want %v", test.a, test.b, got, test.want)
+		}
+	}
+
+	// Under DIFF_MAX_EDITS, the common line splits the hunks. Over it, the
+	// part between the common prefix and suffix is a single hunk.
+	for count, want := range map[int][]DiffHunk{
+		DIFF_MAX_EDITS / 4: {{1, DIFF_MAX_EDITS / 4, 1, DIFF_MAX_EDITS / 4},
+			{DIFF_MAX_EDITS/4 + 2, DIFF_MAX_EDITS / 4, DIFF_MAX_EDITS/4 + 2, DIFF_MAX_EDITS / 4}},
+		DIFF_MAX_EDITS: {{1, 2*DIFF_MAX_EDITS + 1, 1, 2*DIFF_MAX_EDITS + 1}},
+	} {
+		a := append(append(append([]string{"prefix"}, diffNumbered("a", count)...), "common"), diffNumbered("c", count)...)
+		b := append(append(append([]string{"prefix"}, diffNumbered("b", count)...), "common"), diffNumbered("d", count)...)
+		a, b = append(a, "suffix"), append(b, "suffix")
+		if got := DiffLines(a, b); !reflect.DeepEqual(got, want) {
+			t.Errorf("DiffLines(%d changed lines): got %v, want %v", 2*count, got, want)
+		}
+	}
+}
+
+func TestDiffMatches(t *testing.T) {
+	for _, test := range []struct {
+		a, b  string
+		count int // Length of the longest common subsequence
+	}{
+		{"", "", 0},
+		{"abc", "abc", 3},
+		{"abc", "", 0},
+		{"", "abc", 0},
+		{"abcabba", "cbabac", 4},
+		{"xaxbxc", "abc", 3},
+		{"abc", "def", 0},
+	} {
+		a, b := strings.Split(test.a, ""), strings.Split(test.b, "")
+		matches, ok := diffMatches(a, b)
+		if !ok || len(matches) != test.count {
+			t.Errorf("diffMatches(%q, %q): got %v, %v, want %d matches", test.a, test.b, matches, ok, test.count)
+			continue
+		}
+		for idx, match := range matches {
+			if a[match[0]] != b[match[1]] ||
+				idx > 0 && (match[0] <= matches[idx-1][0] || match[1] <= matches[idx-1][1]) {
+				t.Errorf("diffMatches(%q, %q): invalid matches %v", test.a, test.b, matches)
+				break
+			}
+		}
+	}
+}
+
+func TestDiffWords(t *testing.T) {
+	for _, test := range []struct {
+		a, b         string
+		aWant, bWant [][2]int
+	}{
+		{"", "", nil, nil},
+		{"same line", "same line", nil, nil},
+		{"", "ab", nil, [][2]int{{0, 2}}},
+		{"the quick fox", "the slow fox", [][2]int{{4, 9}}, [][2]int{{4, 8}}},
+		{"café noir", "café blanc", [][2]int{{5, 9}}, [][2]int{{5, 10}}},
+		{"f(a, b)", "f(a,  c)", [][2]int{{4, 6}}, [][2]int{{4, 7}}},
+	} {
+		aGot, bGot := DiffWords(test.a, test.b)
+		if !reflect.DeepEqual(aGot, test.aWant) || !reflect.DeepEqual(bGot, test.bWant) {
+			t.Errorf("DiffWords(%q, %q): got %v %v, want %v %v", test.a, test.b, aGot, bGot, test.aWant, test.bWant)
+		}
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	for _, test := range []struct {
+		a, b    string
+		context int
+		want    string
+	}{
+		{"", "", 3, ""},
+		{"a\nb\n", "a\nb\n", 3, ""},
+		{"a\nb", "a\nb", 3, ""},
+		{"", "a\n", 3, "@@ -0,0 +1 @@\n+a\n"},
+		// No newline at end of file
+		{"a\nb", "a\nb\n", 3, "@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n"},
+		{"a\nb\n", "a\nb", 3, "@@ -1,2 +1,2 @@\n a\n-b\n+b\n\\ No newline at end of file\n"},
+		{"a\nb", "a\nc", 3, "@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n\\ No newline at end of file\n"},
+		// The contexts touch, the hunks are merged.
+		{"1\n2\n3\n4\n5\n6\n7\n8\n", "1\nx\n3\n4\ny\n6\n7\n8\n", 1,
+			"@@ -1,6 +1,6 @@\n 1\n-2\n+x\n 3\n 4\n-5\n+y\n 6\n"},
+		// One more line between them.
+		{"1\n2\n3\n4\n5\n6\n7\n8\n", "1\nx\n3\n4\n5\ny\n7\n8\n", 1,
+			"@@ -1,3 +1,3 @@\n 1\n-2\n+x\n 3\n@@ -5,3 +5,3 @@\n 5\n-6\n+y\n 7\n"},
+		// Without context
+		{"1\n2\n3\n4\n5\n", "1\nx\n3\n4\n5\n6\n", 0, "@@ -2 +2 @@\n-2\n+x\n@@ -5,0 +6 @@\n+6\n"},
+		{"1\n2\n3\n4\n5\n", "2\n3\n5\n", 0, "@@ -1 +0,0 @@\n-1\n@@ -4 +2,0 @@\n-4\n"},
+		{"1\n2\n3\n", "x\n2\ny\n", 0, "@@ -1 +1 @@\n-1\n+x\n@@ -3 +3 @@\n-3\n+y\n"},
+	} {
+		want := test.want
+		if len(want) > 0 {
+			want = "--- a\n+++ b\n" + want
+		}
+		if got := UnifiedDiff(test.a, test.b, "a", "b", test.context); got != want {
+			t.Errorf("UnifiedDiff(%q, %q, %d):\ngot:\n%s\nwant:\n%s", test.a, test.b, test.context, got, want)
+		}
+	}
+}
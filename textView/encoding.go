@@ -0,0 +1,306 @@
+// encoding.go
+
+/*
+	Copyright ©2019 H.F.M - TextView Numbered  library "https//github/hfmrow"
+	This program comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+
+	Text encoding & line-ending detection. The TextBuffer always contains UTF-8 text
+	with "\n" line-endings, the original encoding & line-ending are detected when the
+	text is loaded, so they can be restored when it's saved.
+*/
+
+package textView
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// TextEncoding: supported encodings.
+type TextEncoding int
+
+const (
+	ENC_UTF8 TextEncoding = iota
+	ENC_UTF8_BOM
+	ENC_UTF16LE
+	ENC_UTF16BE
+	ENC_LATIN1
+)
+
+var textEncodingNames = map[TextEncoding]string{
+	ENC_UTF8:     "UTF-8",
+	ENC_UTF8_BOM: "UTF-8 BOM",
+	ENC_UTF16LE:  "UTF-16LE",
+	ENC_UTF16BE:  "UTF-16BE",
+	ENC_LATIN1:   "ISO-8859-1",
+}
+
+// String: human readable name.
+func (e TextEncoding) String() string {
+	return textEncodingNames[e]
+}
+
+// EOLStyle: line-ending style.
+type EOLStyle int
+
+const (
+	EOL_LF EOLStyle = iota
+	EOL_CRLF
+	EOL_CR
+)
+
+var eolNames = map[EOLStyle]string{EOL_LF: "LF", EOL_CRLF: "CRLF", EOL_CR: "CR"}
+var eolChars = map[EOLStyle]string{EOL_LF: "\n", EOL_CRLF: "\r\n", EOL_CR: "\r"}
+
+// String: human readable name.
+func (e EOLStyle) String() string {
+	return eolNames[e]
+}
+
+// Chars: line-ending characters.
+func (e EOLStyle) Chars() string {
+	return eolChars[e]
+}
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// DetectEncoding: determine the encoding of the text using the BOM, the
+// distribution of the zero bytes for UTF-16 without BOM, then the UTF-8
+// validity. Latin-1 is used when nothing else matches. 'truncated' must
+// be set when 'sample' is the beginning of a larger text, a sequence cut
+// at its end is then ignored.
+func DetectEncoding(sample []byte, truncated ...bool) TextEncoding {
+	switch {
+	case bytes.HasPrefix(sample, bomUTF8):
+		return ENC_UTF8_BOM
+	case bytes.HasPrefix(sample, bomUTF16LE):
+		return ENC_UTF16LE
+	case bytes.HasPrefix(sample, bomUTF16BE):
+		return ENC_UTF16BE
+	}
+	// Mostly ASCII UTF-16 text has a zero byte every other byte.
+	var even, odd int
+	for idx, b := range sample {
+		if b == 0 {
+			if idx%2 == 0 {
+				even++
+			} else {
+				odd++
+			}
+		}
+	}
+	switch {
+	case odd > len(sample)/4 && even == 0:
+		return ENC_UTF16LE
+	case even > len(sample)/4 && odd == 0:
+		return ENC_UTF16BE
+	}
+	if len(truncated) > 0 && truncated[0] {
+		sample = sample[:incompleteRuneStart(sample)]
+	}
+	if utf8.Valid(sample) {
+		return ENC_UTF8
+	}
+	return ENC_LATIN1
+}
+
+// DetectEOL: get the most used line-ending, LF by default.
+func DetectEOL(text string) EOLStyle {
+	crlf := strings.Count(text, "\r\n")
+	cr := strings.Count(text, "\r") - crlf
+	lf := strings.Count(text, "\n") - crlf
+	switch {
+	case crlf > lf && crlf >= cr && crlf > 0:
+		return EOL_CRLF
+	case cr > lf && cr > crlf:
+		return EOL_CR
+	}
+	return EOL_LF
+}
+
+// encodingBOM: byte order mark of the encoding, nil if none.
+func encodingBOM(enc TextEncoding) []byte {
+	switch enc {
+	case ENC_UTF8, ENC_UTF8_BOM:
+		return bomUTF8
+	case ENC_UTF16LE:
+		return bomUTF16LE
+	case ENC_UTF16BE:
+		return bomUTF16BE
+	}
+	return nil
+}
+
+// incompleteRuneStart: get the position of the incomplete
+// UTF-8 sequence at the end of 'data', or its length.
+func incompleteRuneStart(data []byte) int {
+	for idx := len(data) - 1; idx >= 0 && idx >= len(data)-utf8.UTFMax; idx-- {
+		if utf8.RuneStart(data[idx]) {
+			if !utf8.FullRune(data[idx:]) {
+				return idx
+			}
+			break
+		}
+	}
+	return len(data)
+}
+
+// InvalidSequence: bytes that can't be decoded, 'Offset' is
+// their position in the original data. They are replaced by
+// U+FFFD in the text.
+type InvalidSequence struct {
+	Offset int64
+	Bytes  []byte
+}
+
+// textDecoder: convert chunks of encoded data to UTF-8 text with
+// "\n" line-endings. Incomplete sequences at the end of a chunk
+// are kept for the next one.
+type textDecoder struct {
+	encoding  TextEncoding
+	pending   []byte
+	pendingCR bool
+	started   bool
+	bom       bool  // The data starts with a BOM.
+	offset    int64 // Position in the original data of the next byte.
+	invalid   []InvalidSequence
+}
+
+// decodeRaw: convert to UTF-8, line-endings are not modified.
+func (d *textDecoder) decodeRaw(data []byte, final bool) string {
+	data = append(d.pending, data...)
+	d.pending = nil
+
+	if !d.started {
+		// Wait for enough data to check the BOM.
+		if len(data) < len(bomUTF8) && !final {
+			d.pending = data
+			return ""
+		}
+		d.started = true
+		if bom := encodingBOM(d.encoding); bom != nil && bytes.HasPrefix(data, bom) {
+			data = data[len(bom):]
+			d.offset += int64(len(bom))
+			d.bom = true
+		}
+	}
+
+	var text string
+	count := len(data)
+	switch d.encoding {
+	case ENC_UTF16LE, ENC_UTF16BE:
+		text, count = d.decodeUTF16(data, final)
+
+	case ENC_LATIN1:
+		runes := make([]rune, len(data))
+		for idx, b := range data {
+			runes[idx] = rune(b)
+		}
+		text = string(runes)
+
+	default:
+		if !final {
+			count = incompleteRuneStart(data)
+		}
+		text = d.decodeUTF8(data[:count])
+	}
+	if count < len(data) {
+		d.pending = append([]byte{}, data[count:]...)
+	}
+	d.offset += int64(count)
+	return text
+}
+
+// decodeUTF8: invalid sequences are replaced by U+FFFD.
+func (d *textDecoder) decodeUTF8(data []byte) string {
+	if utf8.Valid(data) {
+		return string(data)
+	}
+	var sb strings.Builder
+	sb.Grow(len(data))
+	for idx := 0; idx < len(data); {
+		r, size := utf8.DecodeRune(data[idx:])
+		if r == utf8.RuneError && size == 1 {
+			d.addInvalid(idx, data[idx:idx+1])
+		}
+		sb.WriteRune(r)
+		idx += size
+	}
+	return sb.String()
+}
+
+// decodeUTF16: lone surrogates and odd trailing byte are replaced by
+// U+FFFD, 'count' is the number of bytes used, the others are kept for
+// the next chunk.
+func (d *textDecoder) decodeUTF16(data []byte, final bool) (text string, count int) {
+	var unit = func(idx int) uint16 {
+		if d.encoding == ENC_UTF16LE {
+			return uint16(data[idx]) | uint16(data[idx+1])<<8
+		}
+		return uint16(data[idx])<<8 | uint16(data[idx+1])
+	}
+	count = len(data) &^ 1
+	// Keep a high surrogate, its pair is in the next chunk.
+	if !final && count >= 2 {
+		if u := unit(count - 2); u >= 0xD800 && u < 0xDC00 {
+			count -= 2
+		}
+	}
+	runes := make([]rune, 0, count/2)
+	for idx := 0; idx < count; idx += 2 {
+		u := rune(unit(idx))
+		switch {
+		case u >= 0xD800 && u < 0xDC00 && idx+2 < count:
+			if u2 := rune(unit(idx + 2)); u2 >= 0xDC00 && u2 < 0xE000 {
+				runes = append(runes, utf16.DecodeRune(u, u2))
+				idx += 2
+				continue
+			}
+			fallthrough
+		case u >= 0xD800 && u < 0xE000:
+			d.addInvalid(idx, data[idx:idx+2])
+			u = utf8.RuneError
+		}
+		runes = append(runes, u)
+	}
+	if final && count < len(data) {
+		d.addInvalid(count, data[count:])
+		runes = append(runes, utf8.RuneError)
+		count = len(data)
+	}
+	return string(runes), count
+}
+
+// addInvalid: record an invalid sequence, 'idx' is relative
+// to the data being decoded.
+func (d *textDecoder) addInvalid(idx int, seq []byte) {
+	d.invalid = append(d.invalid, InvalidSequence{
+		Offset: d.offset + int64(idx),
+		Bytes:  append([]byte{}, seq...)})
+}
+
+// normalizeEOL: convert line-endings to "\n", a CR at the end
+// of the chunk may be followed by a LF in the next one.
+func (d *textDecoder) normalizeEOL(text string, final bool) string {
+	if d.pendingCR {
+		text = "\r" + text
+		d.pendingCR = false
+	}
+	if !final && strings.HasSuffix(text, "\r") {
+		text = text[:len(text)-1]
+		d.pendingCR = true
+	}
+	return strings.ReplaceAll(strings.ReplaceAll(text, "\r\n", "\n"), "\r", "\n")
+}
+
+// decode: convert chunk, 'final' must be set for the last one.
+func (d *textDecoder) decode(data []byte, final bool) string {
+	return d.normalizeEOL(d.decodeRaw(data, final), final)
+}
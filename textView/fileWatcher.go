@@ -0,0 +1,84 @@
+// fileWatcher.go
+
+/*
+	Copyright ©2019 H.F.M - TextView Numbered  library "https//github/hfmrow"
+	This program comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+
+	Report the files modified, replaced or removed on disk. Inotify is used on Linux
+	(the directories are watched so the files saved by renaming a temporary one are
+	followed), the files are polled on the other systems.
+*/
+
+package textView
+
+import (
+	"path/filepath"
+	"sync"
+)
+
+// FILE_WATCHER_POLL: polling interval when inotify isn't available, in ms.
+const FILE_WATCHER_POLL = 1000
+
+// FileWatcher:
+type FileWatcher struct {
+	// Callback: called on the watcher goroutine with the absolute
+	// name of the file, GTK users have to go through glib.IdleAdd.
+	Callback func(filename string)
+
+	mu    sync.Mutex
+	files map[string]bool
+	fileWatcherSys
+}
+
+// FileWatcherNew: start watching, 'callback' may be nil and set later.
+func FileWatcherNew(callback func(filename string)) (fw *FileWatcher, err error) {
+	fw = &FileWatcher{Callback: callback, files: make(map[string]bool)}
+	if err = fw.sysInit(); err != nil {
+		fw = nil
+	}
+	return
+}
+
+// Add: watch the file, it doesn't have to exist.
+func (fw *FileWatcher) Add(filename string) (err error) {
+	if filename, err = filepath.Abs(filename); err != nil {
+		return
+	}
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	if !fw.files[filename] {
+		if err = fw.sysAdd(filename); err == nil {
+			fw.files[filename] = true
+		}
+	}
+	return
+}
+
+// Remove: stop watching the file.
+func (fw *FileWatcher) Remove(filename string) {
+	if abs, err := filepath.Abs(filename); err == nil {
+		filename = abs
+	}
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	if fw.files[filename] {
+		delete(fw.files, filename)
+		fw.sysRemove(filename)
+	}
+}
+
+// Close: stop the watcher.
+func (fw *FileWatcher) Close() error {
+	return fw.sysClose()
+}
+
+// notify: a file has changed, called by the system part.
+func (fw *FileWatcher) notify(filename string) {
+	fw.mu.Lock()
+	watched := fw.files[filename]
+	fw.mu.Unlock()
+	if watched && fw.Callback != nil {
+		fw.Callback(filename)
+	}
+}
@@ -0,0 +1,116 @@
+// fileWatcher_linux.go
+
+//go:build linux
+// +build linux
+
+/*
+	Copyright ©2019 H.F.M - TextView Numbered  library "https//github/hfmrow"
+	This program comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+
+	Inotify part of the FileWatcher.
+*/
+
+package textView
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+const inotifyMask = syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_CREATE |
+	syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_ATTRIB
+
+type fileWatcherSys struct {
+	fd      int
+	file    *os.File
+	dirs    map[string]int32 // Watch descriptor of the directories
+	wds     map[int32]string
+	dirRefs map[string]int
+}
+
+func (fw *FileWatcher) sysInit() (err error) {
+	if fw.fd, err = syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK); err != nil {
+		return os.NewSyscallError("inotify_init1", err)
+	}
+	// Non-blocking, the reading is handled by the runtime poller
+	// and is interrupted by Close.
+	fw.file = os.NewFile(uintptr(fw.fd), "inotify")
+	fw.dirs = make(map[string]int32)
+	fw.wds = make(map[int32]string)
+	fw.dirRefs = make(map[string]int)
+	go fw.read()
+	return
+}
+
+func (fw *FileWatcher) sysAdd(filename string) (err error) {
+	dir := filepath.Dir(filename)
+	if fw.dirRefs[dir] == 0 {
+		var wd int
+		if wd, err = syscall.InotifyAddWatch(fw.fd, dir, inotifyMask); err != nil {
+			return os.NewSyscallError("inotify_add_watch", err)
+		}
+		fw.dirs[dir] = int32(wd)
+		fw.wds[int32(wd)] = dir
+	}
+	fw.dirRefs[dir]++
+	return
+}
+
+func (fw *FileWatcher) sysRemove(filename string) {
+	dir := filepath.Dir(filename)
+	if fw.dirRefs[dir]--; fw.dirRefs[dir] <= 0 {
+		delete(fw.dirRefs, dir)
+		if wd, ok := fw.dirs[dir]; ok {
+			syscall.InotifyRmWatch(fw.fd, uint32(wd))
+			delete(fw.dirs, dir)
+			delete(fw.wds, wd)
+		}
+	}
+}
+
+func (fw *FileWatcher) sysClose() error {
+	return fw.file.Close()
+}
+
+// read: read and dispatch the events until the watcher is closed.
+func (fw *FileWatcher) read() {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := fw.file.Read(buf)
+		if err != nil {
+			return
+		}
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			name := string(bytes.TrimRight(buf[nameStart:nameStart+int(event.Len)], "\x00"))
+			offset = nameStart + int(event.Len)
+
+			fw.mu.Lock()
+			dir, ok := fw.wds[event.Wd]
+			// The watch is gone (directory removed or unmounted), its files
+			// are forgotten so that adding them again creates a new one. The
+			// event may come after a new watch of the same directory.
+			if event.Mask&syscall.IN_IGNORED != 0 && ok {
+				delete(fw.wds, event.Wd)
+				if fw.dirs[dir] == event.Wd {
+					delete(fw.dirs, dir)
+					delete(fw.dirRefs, dir)
+					for filename := range fw.files {
+						if filepath.Dir(filename) == dir {
+							delete(fw.files, filename)
+						}
+					}
+				}
+			}
+			fw.mu.Unlock()
+			if ok && len(name) > 0 {
+				fw.notify(filepath.Join(dir, name))
+			}
+		}
+	}
+}
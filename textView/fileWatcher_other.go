@@ -0,0 +1,83 @@
+// fileWatcher_other.go
+
+//go:build !linux
+// +build !linux
+
+/*
+	Copyright ©2019 H.F.M - TextView Numbered  library "https//github/hfmrow"
+	This program comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+
+	Polling part of the FileWatcher.
+*/
+
+package textView
+
+import (
+	"os"
+	"time"
+)
+
+type fileStat struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+}
+
+type fileWatcherSys struct {
+	stats map[string]fileStat
+	done  chan struct{}
+}
+
+func (fw *FileWatcher) sysInit() (err error) {
+	fw.stats = make(map[string]fileStat)
+	fw.done = make(chan struct{})
+	go fw.poll()
+	return
+}
+
+func (fw *FileWatcher) sysAdd(filename string) (err error) {
+	fw.stats[filename] = statFile(filename)
+	return
+}
+
+func (fw *FileWatcher) sysRemove(filename string) {
+	delete(fw.stats, filename)
+}
+
+func (fw *FileWatcher) sysClose() error {
+	close(fw.done)
+	return nil
+}
+
+// poll: compare the files with their last state.
+func (fw *FileWatcher) poll() {
+	ticker := time.NewTicker(FILE_WATCHER_POLL * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-fw.done:
+			return
+		case <-ticker.C:
+		}
+		var changed []string
+		fw.mu.Lock()
+		for filename, stat := range fw.stats {
+			if current := statFile(filename); current != stat {
+				fw.stats[filename] = current
+				changed = append(changed, filename)
+			}
+		}
+		fw.mu.Unlock()
+		for _, filename := range changed {
+			fw.notify(filename)
+		}
+	}
+}
+
+func statFile(filename string) (stat fileStat) {
+	if info, err := os.Stat(filename); err == nil {
+		stat = fileStat{exists: true, size: info.Size(), modTime: info.ModTime()}
+	}
+	return
+}
@@ -0,0 +1,495 @@
+// fold.go
+
+/*
+	This software use gotk3 that is licensed under the ISC License:
+	https://github.com/gotk3/gotk3/blob/master/LICENSE
+
+	Copyright ©2019 H.F.M - TextView Numbered  library "https//github/hfmrow"
+	This program comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+
+	Code folding for TextViewNumbered: the foldable regions are computed from the
+	indentation, the braces matching, or the Chroma tokens when a highlighter is
+	attached. Markers are drawn in the last column of the gutter (see gutter.go),
+	a click on a marker collapses/expands the region.
+
+	Folded lines are hidden with an invisible tag, the numbers column skips them since
+	it's drawn from the lines positions (see gutter.go). A placeholder is drawn over
+	the view after the end of the first line of the region, the text of the buffer
+	is not modified.
+*/
+
+package textView
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/alecthomas/chroma"
+	"github.com/gotk3/gotk3/cairo"
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/gtk"
+
+	gitvtt "github.com/hfmrow/gtk3_import/textView/textTag"
+)
+
+// FoldMethod: how the foldable regions are computed.
+type FoldMethod int
+
+const (
+	FOLD_NONE   FoldMethod = iota // No folding, the gutter is hidden.
+	FOLD_AUTO                     // Tokens if a highlighter is attached, then braces, then indentation.
+	FOLD_INDENT                   // Lines more indented than the previous one.
+	FOLD_BRACES                   // Matching {}, [] and () on different lines.
+	FOLD_TOKENS                   // Same as braces, but strings and comments are skipped using Chroma tokens.
+)
+
+const (
+	foldHiddenTagName = "textViewNumbered:fold-hidden"
+	foldGutterWidth   = 14
+	foldTabWidth      = 4
+)
+
+// FoldRegion: range of lines that can be collapsed, 'Start' stays
+// visible, 'Start'+1 to 'End' are hidden when folded. 0 based.
+type FoldRegion struct {
+	Start, End int
+	Folded     bool
+}
+
+// fold: collapsed region, the marks follow the text when edited.
+type fold struct {
+	startMark,
+	endMark *gtk.TextMark
+}
+
+// SetFoldMethod: enable/disable code folding, FOLD_NONE hides the gutter
+// and expands all regions.
+func (tvn *TextViewNumbered) SetFoldMethod(method FoldMethod) {
+	tvn.FoldMethod = method
+	tvn.refreshFolds()
+	tvn.QueueGutterDraw()
+}
+
+// FoldRegions: get the current foldable regions.
+func (tvn *TextViewNumbered) FoldRegions() []FoldRegion {
+	return append([]FoldRegion{}, tvn.foldRegions...)
+}
+
+// Fold: collapse the region starting at 'line'. Return false
+// if there is no region there or if it's already folded.
+func (tvn *TextViewNumbered) Fold(line int) bool {
+	var region FoldRegion
+	var ok bool
+
+	if region, ok = tvn.foldRegionAt(line); !ok || region.Folded {
+		return false
+	}
+	modified := tvn.BuffTxt.GetModified()
+	defer tvn.BuffTxt.SetModified(modified)
+
+	tvn.foldSeq++
+	name := fmt.Sprintf("textViewNumbered:fold:%d", tvn.foldSeq)
+	f := &fold{
+		startMark: tvn.BuffTxt.CreateMark(name+":start", tvn.BuffTxt.GetIterAtLine(region.Start), true),
+		endMark:   tvn.BuffTxt.CreateMark(name+":end", tvn.BuffTxt.GetIterAtLine(region.End+1), true)}
+	tvn.folds = append(tvn.folds, f)
+	tvn.applyFold(f)
+	tvn.setFolded(region.Start, true)
+	return true
+}
+
+// Unfold: expand the region starting at 'line'. Return
+// false if there is no folded region there.
+func (tvn *TextViewNumbered) Unfold(line int) bool {
+	for _, f := range tvn.folds {
+		if tvn.BuffTxt.GetIterAtMark(f.startMark).GetLine() == line {
+			tvn.unfold(f)
+			return true
+		}
+	}
+	return false
+}
+
+// ToggleFold: fold/unfold the region starting at 'line'.
+func (tvn *TextViewNumbered) ToggleFold(line int) bool {
+	if tvn.Unfold(line) {
+		return true
+	}
+	return tvn.Fold(line)
+}
+
+// UnfoldLine: expand all the regions that hide 'line'.
+func (tvn *TextViewNumbered) UnfoldLine(line int) {
+	for _, f := range append([]*fold{}, tvn.folds...) {
+		if start, end := tvn.foldLines(f); line > start && line <= end {
+			tvn.unfold(f)
+		}
+	}
+}
+
+// FoldAll: collapse all regions, the outer ones first.
+func (tvn *TextViewNumbered) FoldAll() {
+	for _, region := range tvn.FoldRegions() {
+		tvn.Fold(region.Start)
+	}
+}
+
+// UnfoldAll: expand all regions.
+func (tvn *TextViewNumbered) UnfoldAll() {
+	for len(tvn.folds) > 0 {
+		tvn.unfold(tvn.folds[len(tvn.folds)-1])
+	}
+}
+
+// initFolding: default values, the placeholders are drawn over the text.
+func (tvn *TextViewNumbered) initFolding() {
+	tvn.FoldFgCol = "#777777"
+	tvn.FoldPlaceholder = " ⋯ "
+	tvn.TextView.ConnectAfter("draw", tvn.drawFoldPlaceholders)
+}
+
+// refreshFolds: compute the foldable regions, the folds that no
+// longer match a region are expanded.
+func (tvn *TextViewNumbered) refreshFolds() {
+	tvn.foldRegions = nil
+	if tvn.FoldMethod != FOLD_NONE {
+		tvn.foldRegions = computeFoldRegions(tvn.GetText(), tvn.FoldMethod, tvn.foldTokens())
+	}
+	for _, f := range append([]*fold{}, tvn.folds...) {
+		start := tvn.BuffTxt.GetIterAtMark(f.startMark).GetLine()
+		if !tvn.setFolded(start, true) {
+			tvn.unfold(f)
+		}
+	}
+	tvn.gutter.QueueDraw()
+}
+
+// resetFolds: forget the folds, used when the buffer is cleared/replaced.
+func (tvn *TextViewNumbered) resetFolds() {
+	for _, f := range tvn.folds {
+		tvn.BuffTxt.DeleteMark(f.startMark)
+		tvn.BuffTxt.DeleteMark(f.endMark)
+	}
+	tvn.folds = nil
+	tvn.foldRegions = nil
+	tvn.gutterChanged()
+}
+
+// foldTokens: tokens of the attached highlighter, if any.
+func (tvn *TextViewNumbered) foldTokens() (tokens []chroma.Token) {
+	if tvn.Highlighter != nil && (tvn.FoldMethod == FOLD_AUTO || tvn.FoldMethod == FOLD_TOKENS) {
+		tokens, _ = tvn.Highlighter.Tokens()
+	}
+	return
+}
+
+// foldRegionAt: get the region starting at 'line'.
+func (tvn *TextViewNumbered) foldRegionAt(line int) (region FoldRegion, ok bool) {
+	idx := sort.Search(len(tvn.foldRegions), func(i int) bool { return tvn.foldRegions[i].Start >= line })
+	if idx < len(tvn.foldRegions) && tvn.foldRegions[idx].Start == line {
+		return tvn.foldRegions[idx], true
+	}
+	return
+}
+
+// setFolded: set the state of the region starting at 'line'.
+func (tvn *TextViewNumbered) setFolded(line int, folded bool) bool {
+	idx := sort.Search(len(tvn.foldRegions), func(i int) bool { return tvn.foldRegions[i].Start >= line })
+	if idx < len(tvn.foldRegions) && tvn.foldRegions[idx].Start == line {
+		tvn.foldRegions[idx].Folded = folded
+		return true
+	}
+	return false
+}
+
+// applyFold: hide the whole lines of the region, except the first one.
+// The line delimiters are hidden too, otherwise empty rows remain.
+func (tvn *TextViewNumbered) applyFold(f *fold) {
+	tag := gitvtt.TagCreateIfNotExists(tvn.BuffTxt, foldHiddenTagName, map[string]interface{}{"invisible": true})
+	start, _ := tvn.foldLines(f)
+	tvn.BuffTxt.ApplyTag(tag, tvn.BuffTxt.GetIterAtLine(start+1), tvn.BuffTxt.GetIterAtMark(f.endMark))
+}
+
+// unfold: show the hidden text again, the folds nested
+// in this one are kept hidden.
+func (tvn *TextViewNumbered) unfold(f *fold) {
+	modified := tvn.BuffTxt.GetModified()
+	defer tvn.BuffTxt.SetModified(modified)
+
+	for idx, fld := range tvn.folds {
+		if fld == f {
+			tvn.folds = append(tvn.folds[:idx], tvn.folds[idx+1:]...)
+			break
+		}
+	}
+	line, _ := tvn.foldLines(f)
+	tvn.BuffTxt.RemoveTagByName(foldHiddenTagName, tvn.BuffTxt.GetIterAtLine(line+1), tvn.BuffTxt.GetIterAtMark(f.endMark))
+	tvn.BuffTxt.DeleteMark(f.startMark)
+	tvn.BuffTxt.DeleteMark(f.endMark)
+	for _, fld := range tvn.folds {
+		tvn.applyFold(fld)
+	}
+	tvn.setFolded(line, false)
+	tvn.gutter.QueueDraw()
+}
+
+// foldLines: get the current first and last lines of the fold.
+func (tvn *TextViewNumbered) foldLines(f *fold) (start, end int) {
+	start = tvn.BuffTxt.GetIterAtMark(f.startMark).GetLine()
+	iter := tvn.BuffTxt.GetIterAtMark(f.endMark)
+	if end = iter.GetLine(); iter.StartsLine() && end > start {
+		end--
+	}
+	return
+}
+
+// drawFoldPlaceholders: "draw" handler, the placeholder of a fold is drawn
+// after the end of the last display row of its first line, unless it's
+// hidden by another fold.
+func (tvn *TextViewNumbered) drawFoldPlaceholders(view *gtk.TextView, cr *cairo.Context) {
+	if len(tvn.folds) == 0 || len(tvn.FoldPlaceholder) == 0 {
+		return
+	}
+	hidden, _ := gitvtt.TagLookupIfExists(tvn.BuffTxt, foldHiddenTagName)
+	tvn.setCairoFont(cr)
+	setCairoColour(cr, tvn.FoldFgCol)
+	extents := cr.FontExtents()
+	height := view.GetAllocatedHeight()
+	for _, f := range tvn.folds {
+		line, _ := tvn.foldLines(f)
+		end := tvn.lineEndIter(line)
+		if hidden != nil && end.HasTag(hidden) {
+			continue
+		}
+		top, lineHeight := view.GetLineYrange(end)
+		rowHeight := int(extents.Height + 0.5)
+		if rowHeight > lineHeight {
+			rowHeight = lineHeight
+		}
+		y := top + lineHeight - rowHeight
+		_, wy := view.BufferToWindowCoords(gtk.TEXT_WINDOW_WIDGET, 0, y)
+		if lineHeight == 0 || wy+rowHeight < 0 || wy > height {
+			continue
+		}
+		// TextView.GetIterLocation is not used, gotk3 returns a dangling rectangle.
+		offset := end.GetOffset()
+		x := sort.Search(1<<15, func(x int) bool {
+			return view.GetIterAtLocation(x, y+rowHeight/2).GetOffset() >= offset
+		})
+		wx, _ := view.BufferToWindowCoords(gtk.TEXT_WINDOW_WIDGET, x, y)
+		cr.MoveTo(float64(wx), float64(wy)+(float64(rowHeight)-extents.Height)/2+extents.Ascent)
+		cr.ShowText(tvn.FoldPlaceholder)
+	}
+}
+
+// lineEndIter: get iter before the line delimiter.
+func (tvn *TextViewNumbered) lineEndIter(line int) (iter *gtk.TextIter) {
+	if iter = tvn.BuffTxt.GetIterAtLine(line); !iter.EndsLine() {
+		iter.ForwardToLineEnd()
+	}
+	return
+}
+
+// foldRenderer: gutter column of the fold markers.
+type foldRenderer struct {
+	tvn *TextViewNumbered
+}
+
+func (fr *foldRenderer) Width() int {
+	if fr.tvn.FoldMethod == FOLD_NONE {
+		return 0
+	}
+	return foldGutterWidth
+}
+
+// Draw: triangle pointing right when folded, down otherwise.
+func (fr *foldRenderer) Draw(cr *cairo.Context, line int, cell *GutterCell) {
+	region, ok := fr.tvn.foldRegionAt(line)
+	if !ok {
+		return
+	}
+	setCairoColour(cr, fr.tvn.FoldFgCol)
+	size := cell.Width / 2
+	x, cy := cell.X+(cell.Width-size)/2, cell.Y+cell.RowHeight/2
+	if region.Folded {
+		cr.MoveTo(x, cy-size/2)
+		cr.LineTo(x+size, cy)
+		cr.LineTo(x, cy+size/2)
+	} else {
+		cr.MoveTo(x, cy-size/4)
+		cr.LineTo(x+size, cy-size/4)
+		cr.LineTo(x+size/2, cy+size/2)
+	}
+	cr.ClosePath()
+	cr.Fill()
+}
+
+func (fr *foldRenderer) Activate(line int, button gdk.Button) bool {
+	return button == gdk.BUTTON_PRIMARY && fr.tvn.ToggleFold(line)
+}
+
+// computeFoldRegions: get the foldable regions of 'text' sorted by
+// first line. 'tokens' are only used if they match the text.
+func computeFoldRegions(text string, method FoldMethod, tokens []chroma.Token) (regions []FoldRegion) {
+	var ends = make(map[int]int)
+
+	if method == FOLD_AUTO || method == FOLD_TOKENS {
+		var tokensText strings.Builder
+		for _, token := range tokens {
+			tokensText.WriteString(token.Value)
+		}
+		if len(tokens) > 0 && strings.TrimRight(tokensText.String(), "\n") == strings.TrimRight(text, "\n") {
+			foldsFromTokens(tokens, ends)
+		} else {
+			foldsFromBraces(text, ends)
+		}
+		if method == FOLD_AUTO && len(ends) == 0 {
+			foldsFromIndent(text, ends)
+		}
+	}
+	switch method {
+	case FOLD_INDENT:
+		foldsFromIndent(text, ends)
+	case FOLD_BRACES:
+		foldsFromBraces(text, ends)
+	}
+
+	for start, end := range ends {
+		regions = append(regions, FoldRegion{Start: start, End: end})
+	}
+	sort.Slice(regions, func(i, j int) bool { return regions[i].Start < regions[j].Start })
+	return
+}
+
+// addFold: store region, the largest one is kept for a given line.
+func addFold(ends map[int]int, start, end int) {
+	if end > start && end > ends[start] {
+		ends[start] = end
+	}
+}
+
+// foldsFromIndent: a region starts at a line followed by more indented
+// lines, the trailing blank lines are not part of the region.
+func foldsFromIndent(text string, ends map[int]int) {
+	var indent = func(line string) (width int, blank bool) {
+		for _, r := range line {
+			switch r {
+			case ' ':
+				width++
+			case '\t':
+				width += foldTabWidth - width%foldTabWidth
+			default:
+				return width, unicode.IsSpace(r)
+			}
+		}
+		return width, true
+	}
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		width, blank := indent(line)
+		if blank {
+			continue
+		}
+		last := i
+		for j := i + 1; j < len(lines); j++ {
+			w, b := indent(lines[j])
+			if b {
+				continue
+			}
+			if w <= width {
+				break
+			}
+			last = j
+		}
+		addFold(ends, i, last)
+	}
+}
+
+// foldsFromBraces: a region starts at the line of an opening brace
+// and ends before the line of the matching closing one. Strings and
+// comments are roughly skipped (C-like syntax).
+func foldsFromBraces(text string, ends map[int]int) {
+	var stack []int
+	var line int
+	var inBlockComment bool
+	var quote rune
+
+	runes := []rune(text)
+	for idx := 0; idx < len(runes); idx++ {
+		r := runes[idx]
+		next := rune(0)
+		if idx+1 < len(runes) {
+			next = runes[idx+1]
+		}
+		switch {
+		case r == '\n':
+			line++
+			if quote != '`' {
+				quote = 0
+			}
+		case inBlockComment:
+			if r == '*' && next == '/' {
+				inBlockComment = false
+				idx++
+			}
+		case quote != 0:
+			if r == '\\' {
+				idx++
+			} else if r == quote {
+				quote = 0
+			}
+		case r == '/' && next == '*':
+			inBlockComment = true
+			idx++
+		case r == '/' && next == '/':
+			for idx+1 < len(runes) && runes[idx+1] != '\n' {
+				idx++
+			}
+		case r == '"' || r == '\'' || r == '`':
+			quote = r
+		default:
+			foldBrace(r, line, &stack, ends)
+		}
+	}
+}
+
+// foldsFromTokens: same as braces using the punctuation tokens,
+// multi-lines comments are foldable too.
+func foldsFromTokens(tokens []chroma.Token, ends map[int]int) {
+	var stack []int
+	var line int
+
+	for _, token := range tokens {
+		switch {
+		case token.Type.InCategory(chroma.Comment):
+			if count := strings.Count(strings.TrimRight(token.Value, "\n"), "\n"); count > 0 {
+				addFold(ends, line, line+count)
+			}
+		case token.Type.InCategory(chroma.Punctuation):
+			for _, r := range token.Value {
+				if r == '\n' {
+					line++
+				}
+				foldBrace(r, line, &stack, ends)
+			}
+			continue
+		}
+		line += strings.Count(token.Value, "\n")
+	}
+}
+
+// foldBrace: handle opening/closing braces.
+func foldBrace(r rune, line int, stack *[]int, ends map[int]int) {
+	switch r {
+	case '{', '[', '(':
+		*stack = append(*stack, line)
+	case '}', ']', ')':
+		if count := len(*stack); count > 0 {
+			addFold(ends, (*stack)[count-1], line-1)
+			*stack = (*stack)[:count-1]
+		}
+	}
+}
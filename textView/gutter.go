@@ -0,0 +1,292 @@
+// gutter.go
+
+/*
+	This software use gotk3 that is licensed under the ISC License:
+	https://github.com/gotk3/gotk3/blob/master/LICENSE
+
+	Copyright ©2019 H.F.M - TextView Numbered  library "https//github/hfmrow"
+	This program comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+
+	Gutter of TextViewNumbered: a DrawingArea at the left of the scrolled window,
+	made of columns drawn by renderers, from left to right in the order they have
+	been added, the numbers, the diff bars and the fold markers are always the last
+	columns. Renderers are called for each visible line with the position of the
+	line in the main view, so they stay aligned when the text is scrolled, wrapped
+	or folded.
+*/
+
+package textView
+
+import (
+	"strings"
+
+	"github.com/gotk3/gotk3/cairo"
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// GutterRenderer: draws a column of the gutter.
+type GutterRenderer interface {
+	// Width: width of the column in pixels, 0 hides it.
+	Width() int
+	// Draw: called for each visible line.
+	Draw(cr *cairo.Context, line int, cell *GutterCell)
+	// Activate: called when the column is clicked at 'line',
+	// return true if the event has been handled.
+	Activate(line int, button gdk.Button) bool
+}
+
+// GutterUpdater: optional, renderers that need to be notified
+// after the buffer changes.
+type GutterUpdater interface {
+	Update()
+}
+
+// GutterTooltiper: optional, renderers that give a tooltip for a line.
+type GutterTooltiper interface {
+	Tooltip(line int) string
+}
+
+// gutterAttacher: renderers of this package that need to
+// access the TextViewNumbered.
+type gutterAttacher interface {
+	attach(tvn *TextViewNumbered)
+}
+
+// GutterCell: area of a line in a gutter column. 'RowHeight' is
+// the height of the first row of the line when it's wrapped.
+type GutterCell struct {
+	X, Y,
+	Width, Height,
+	RowHeight float64
+	LastLine bool
+}
+
+// AddGutterRenderer: add a column at the left of the numbers.
+func (tvn *TextViewNumbered) AddGutterRenderer(renderer GutterRenderer) {
+	if a, ok := renderer.(gutterAttacher); ok {
+		a.attach(tvn)
+	}
+	for idx, r := range tvn.renderers {
+		if r == tvn.numbers {
+			tvn.renderers = append(tvn.renderers[:idx], append([]GutterRenderer{renderer}, tvn.renderers[idx:]...)...)
+			break
+		}
+	}
+	tvn.QueueGutterDraw()
+}
+
+// RemoveGutterRenderer: remove a column.
+func (tvn *TextViewNumbered) RemoveGutterRenderer(renderer GutterRenderer) {
+	for idx, r := range tvn.renderers {
+		if r == renderer {
+			tvn.renderers = append(tvn.renderers[:idx], tvn.renderers[idx+1:]...)
+			break
+		}
+	}
+	tvn.QueueGutterDraw()
+}
+
+// QueueGutterDraw: adjust the width of the gutter and redraw it,
+// renderers must call it when their content change.
+func (tvn *TextViewNumbered) QueueGutterDraw() {
+	var width int
+	for _, r := range tvn.renderers {
+		width += r.Width()
+	}
+	if width != tvn.gutterWidth {
+		tvn.gutterWidth = width
+		tvn.gutter.SetSizeRequest(width, -1)
+		tvn.gutter.SetVisible(width > 0)
+	}
+	tvn.gutter.QueueDraw()
+	if tvn.minimap != nil {
+		tvn.minimap.Area.QueueDraw()
+	}
+}
+
+// initGutter: build the gutter and the built-in renderers.
+func (tvn *TextViewNumbered) initGutter() (err error) {
+	if tvn.gutter, err = gtk.DrawingAreaNew(); err == nil {
+		tvn.gutter.SetNoShowAll(true)
+		tvn.gutter.AddEvents(int(gdk.BUTTON_PRESS_MASK))
+		tvn.gutter.SetProperty("has-tooltip", true)
+		tvn.gutter.Connect("draw", tvn.drawGutter)
+		tvn.gutter.Connect("button-press-event", tvn.gutterPressed)
+		tvn.gutter.Connect("query-tooltip", tvn.gutterTooltip)
+		// Lines positions change on scroll, resize (wrapped lines),
+		// font change and when the TextView validates its lines.
+		tvn.vAdj.Connect("value-changed", tvn.gutter.QueueDraw)
+		tvn.vAdj.Connect("changed", tvn.gutter.QueueDraw)
+		tvn.TextView.Connect("size-allocate", tvn.gutter.QueueDraw)
+		tvn.TextView.Connect("style-updated", tvn.QueueGutterDraw)
+
+		tvn.numbers = &numbersRenderer{tvn: tvn}
+		tvn.DiffBars = GutterDiffNew(GUTTER_DIFF_WIDTH)
+		tvn.DiffBars.attach(tvn)
+		tvn.renderers = []GutterRenderer{tvn.numbers, tvn.DiffBars, &foldRenderer{tvn: tvn}}
+
+		tvn.Bookmarks = GutterMarksNew(GUTTER_MARK_WIDTH)
+		tvn.Diagnostics = GutterMarksNew(GUTTER_MARK_WIDTH)
+		tvn.Breakpoints = GutterMarksNew(GUTTER_MARK_WIDTH)
+		tvn.Breakpoints.Clickable = true
+		tvn.Breakpoints.ClickKind = GUTTER_MARK_BREAKPOINT
+		for _, r := range []GutterRenderer{tvn.Bookmarks, tvn.Diagnostics, tvn.Breakpoints} {
+			tvn.AddGutterRenderer(r)
+		}
+	}
+	return
+}
+
+// gutterChanged: buffer "changed" callback, the folds and the renderers
+// are updated once the pending changes are done.
+func (tvn *TextViewNumbered) gutterChanged() {
+	if !tvn.gutterPending {
+		tvn.gutterPending = true
+		glib.IdleAdd(func() {
+			tvn.gutterPending = false
+			if tvn.FoldMethod != FOLD_NONE || len(tvn.folds) > 0 {
+				tvn.refreshFolds()
+			}
+			for _, r := range tvn.renderers {
+				if u, ok := r.(GutterUpdater); ok {
+					u.Update()
+				}
+			}
+			tvn.QueueGutterDraw()
+		})
+	}
+}
+
+// resetGutter: remove the marks, used when the text is cleared/replaced.
+func (tvn *TextViewNumbered) resetGutter() {
+	tvn.resetFolds()
+	for _, r := range tvn.renderers {
+		if gm, ok := r.(*GutterMarks); ok {
+			gm.Clear()
+		}
+	}
+}
+
+// drawGutter: call the renderers for each visible line.
+func (tvn *TextViewNumbered) drawGutter(da *gtk.DrawingArea, cr *cairo.Context) bool {
+	height := da.GetAllocatedHeight()
+	setCairoColour(cr, tvn.NumBgCol)
+	cr.Paint()
+
+	rowHeight := tvn.gutterRowHeight(cr)
+	lineCount := tvn.BuffTxt.GetLineCount()
+	_, top := tvn.TextView.WindowToBufferCoords(gtk.TEXT_WINDOW_WIDGET, 0, 0)
+	iter := tvn.lineAtY(top)
+	for {
+		line := iter.GetLine()
+		y, h := tvn.TextView.GetLineYrange(iter)
+		_, wy := tvn.TextView.BufferToWindowCoords(gtk.TEXT_WINDOW_WIDGET, 0, y)
+		if wy > height {
+			break
+		}
+		if h > 0 {
+			cell := GutterCell{
+				Y:         float64(wy),
+				Height:    float64(h),
+				RowHeight: rowHeight,
+				LastLine:  line == lineCount-1}
+			if cell.RowHeight > cell.Height {
+				cell.RowHeight = cell.Height
+			}
+			for _, r := range tvn.renderers {
+				if width := r.Width(); width > 0 {
+					cell.Width = float64(width)
+					cr.Save()
+					r.Draw(cr, line, &cell)
+					cr.Restore()
+					cell.X += cell.Width
+				}
+			}
+		}
+		// Folded lines are skipped.
+		if iter.ForwardVisibleLine(); iter.GetLine() == line {
+			break
+		}
+	}
+	return false
+}
+
+// gutterPressed: give the click to the renderer under the pointer.
+func (tvn *TextViewNumbered) gutterPressed(da *gtk.DrawingArea, event *gdk.Event) bool {
+	ev := gdk.EventButtonNewFromEvent(event)
+	if ev.Type() != gdk.EVENT_BUTTON_PRESS {
+		return false
+	}
+	if r, line, ok := tvn.gutterRendererAt(ev.X(), ev.Y()); ok {
+		return r.Activate(line, ev.Button())
+	}
+	return false
+}
+
+// gutterTooltip: ask the renderer under the pointer.
+func (tvn *TextViewNumbered) gutterTooltip(da *gtk.DrawingArea, x, y int, keyboardMode bool, tooltip *gtk.Tooltip) bool {
+	if r, line, ok := tvn.gutterRendererAt(float64(x), float64(y)); ok {
+		if t, ok := r.(GutterTooltiper); ok {
+			if text := t.Tooltip(line); len(text) > 0 {
+				tooltip.SetText(text)
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// gutterRendererAt: get the renderer and the line at the gutter position.
+func (tvn *TextViewNumbered) gutterRendererAt(x, y float64) (renderer GutterRenderer, line int, ok bool) {
+	_, by := tvn.TextView.WindowToBufferCoords(gtk.TEXT_WINDOW_WIDGET, 0, int(y))
+	iter := tvn.lineAtY(by)
+	if ly, lh := tvn.TextView.GetLineYrange(iter); by < ly || by >= ly+lh {
+		return // Under the last line
+	}
+	line = iter.GetLine()
+	var left float64
+	for _, renderer = range tvn.renderers {
+		width := float64(renderer.Width())
+		if x >= left && x < left+width {
+			return renderer, line, true
+		}
+		left += width
+	}
+	return nil, line, false
+}
+
+// lineAtY: get the start of the line at the buffer 'y' coordinate.
+// TextView.GetLineAtY is not used, gotk3 returns an unset iter.
+func (tvn *TextViewNumbered) lineAtY(y int) (iter *gtk.TextIter) {
+	iter = tvn.TextView.GetIterAtLocation(0, y)
+	iter.SetLineOffset(0)
+	return
+}
+
+// gutterRowHeight: height of a single row of text, computed
+// from the font of the TextView.
+func (tvn *TextViewNumbered) gutterRowHeight(cr *cairo.Context) float64 {
+	cr.Save()
+	defer cr.Restore()
+	tvn.setCairoFont(cr)
+	return cr.FontExtents().Height
+}
+
+// setCairoFont: use the font of the TextView, the first
+// family of the css specification is used.
+func (tvn *TextViewNumbered) setCairoFont(cr *cairo.Context) {
+	family := strings.Trim(strings.TrimSpace(strings.Split(tvn.FontFamily, ",")[0]), `"'`)
+	cr.SelectFontFace(family, cairo.FONT_SLANT_NORMAL, cairo.FONT_WEIGHT_NORMAL)
+	cr.SetFontSize(float64(tvn.FontSze))
+}
+
+// setCairoColour: set source colour using a css colour specification.
+func setCairoColour(cr *cairo.Context, col string) {
+	rgba := gdk.NewRGBA()
+	if rgba.Parse(col) {
+		cr.SetSourceRGBA(rgba.GetRed(), rgba.GetGreen(), rgba.GetBlue(), rgba.GetAlpha())
+	}
+}
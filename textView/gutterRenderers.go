@@ -0,0 +1,417 @@
+// gutterRenderers.go
+
+/*
+	This software use gotk3 that is licensed under the ISC License:
+	https://github.com/gotk3/gotk3/blob/master/LICENSE
+
+	Copyright ©2019 H.F.M - TextView Numbered  library "https//github/hfmrow"
+	This program comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+
+	Built-in gutter renderers:
+	- GutterMarks: bookmarks, error/warning icons, breakpoints ... attached to lines
+	  using TextMarks, so they move with the text when lines are inserted or deleted.
+	- GutterDiff: added/modified/deleted bars, computed from a line-diff between a
+	  baseline text and the current content of the buffer.
+*/
+
+package textView
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/gotk3/gotk3/cairo"
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+const (
+	GUTTER_MARK_WIDTH = 16
+	GUTTER_DIFF_WIDTH = 4
+)
+
+// GutterMarkKind: kind of mark, each kind has its own icon.
+type GutterMarkKind int
+
+const (
+	GUTTER_MARK_BOOKMARK GutterMarkKind = iota
+	GUTTER_MARK_ERROR
+	GUTTER_MARK_WARNING
+	GUTTER_MARK_BREAKPOINT
+)
+
+// GutterMarkColours: colours used to draw the marks icons.
+var GutterMarkColours = map[GutterMarkKind]string{
+	GUTTER_MARK_BOOKMARK:   "#3465A4",
+	GUTTER_MARK_ERROR:      "#CC0000",
+	GUTTER_MARK_WARNING:    "#EDA000",
+	GUTTER_MARK_BREAKPOINT: "#E02020",
+}
+
+// GutterMark: mark attached to a line.
+type GutterMark struct {
+	Kind    GutterMarkKind
+	Message string
+
+	mark *gtk.TextMark
+	buff *gtk.TextBuffer
+}
+
+// Line: get the current line of the mark.
+func (m *GutterMark) Line() int {
+	return m.buff.GetIterAtMark(m.mark).GetLine()
+}
+
+// GutterMarks: renderer that displays marks attached to lines.
+// Must be added to a TextViewNumbered before use.
+type GutterMarks struct {
+	ColWidth  int
+	Visible   bool           // Displayed even without marks, i.e: to be clickable.
+	Clickable bool           // A click toggles a mark of 'ClickKind'.
+	ClickKind GutterMarkKind // Kind of the marks created on click.
+
+	// Called when a mark has been toggled with a click.
+	ToggledCallback func(line int, set bool)
+	// Used instead of the default icons if not nil.
+	DrawFunc func(cr *cairo.Context, mark *GutterMark, cell *GutterCell)
+
+	tvn    *TextViewNumbered
+	marks  []*GutterMark
+	byLine map[int][]*GutterMark
+	seq    int
+}
+
+// GutterMarksNew: create a new marks renderer.
+func GutterMarksNew(width int) *GutterMarks {
+	return &GutterMarks{ColWidth: width, byLine: make(map[int][]*GutterMark)}
+}
+
+// Add: attach a mark to the line, 'message' is displayed as tooltip.
+func (gm *GutterMarks) Add(line int, kind GutterMarkKind, message string) (m *GutterMark) {
+	buff := gm.tvn.BuffTxt
+	gm.seq++
+	name := fmt.Sprintf("textViewNumbered:gutter:%p:%d", gm, gm.seq)
+	m = &GutterMark{
+		Kind:    kind,
+		Message: message,
+		mark:    buff.CreateMark(name, buff.GetIterAtLine(line), true),
+		buff:    buff}
+	gm.marks = append(gm.marks, m)
+	gm.changed()
+	return
+}
+
+// Remove: remove one mark.
+func (gm *GutterMarks) Remove(m *GutterMark) {
+	for idx, mrk := range gm.marks {
+		if mrk == m {
+			gm.marks = append(gm.marks[:idx], gm.marks[idx+1:]...)
+			m.buff.DeleteMark(m.mark)
+			break
+		}
+	}
+	gm.changed()
+}
+
+// RemoveLine: remove the marks of the line.
+func (gm *GutterMarks) RemoveLine(line int) {
+	for _, m := range gm.AtLine(line) {
+		gm.Remove(m)
+	}
+}
+
+// Toggle: remove the marks of 'kind' at line, or add one if there
+// is none. Return true if a mark has been added.
+func (gm *GutterMarks) Toggle(line int, kind GutterMarkKind) (set bool) {
+	set = true
+	for _, m := range gm.AtLine(line) {
+		if m.Kind == kind {
+			gm.Remove(m)
+			set = false
+		}
+	}
+	if set {
+		gm.Add(line, kind, "")
+	}
+	return
+}
+
+// Clear: remove all marks.
+func (gm *GutterMarks) Clear() {
+	for _, m := range gm.marks {
+		m.buff.DeleteMark(m.mark)
+	}
+	gm.marks = nil
+	gm.changed()
+}
+
+// Marks: get all marks, sorted by line.
+func (gm *GutterMarks) Marks() (marks []*GutterMark) {
+	for _, line := range gm.Lines() {
+		marks = append(marks, gm.byLine[line]...)
+	}
+	return
+}
+
+// Lines: get the lines that have marks, sorted.
+func (gm *GutterMarks) Lines() (lines []int) {
+	for line := range gm.byLine {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+	return
+}
+
+// AtLine: get the marks of the line.
+func (gm *GutterMarks) AtLine(line int) []*GutterMark {
+	return append([]*GutterMark{}, gm.byLine[line]...)
+}
+
+// Width: GutterRenderer interface.
+func (gm *GutterMarks) Width() int {
+	if gm.tvn != nil && (gm.Visible || len(gm.marks) > 0) {
+		return gm.ColWidth
+	}
+	return 0
+}
+
+// Draw: GutterRenderer interface.
+func (gm *GutterMarks) Draw(cr *cairo.Context, line int, cell *GutterCell) {
+	for _, m := range gm.byLine[line] {
+		if gm.DrawFunc != nil {
+			gm.DrawFunc(cr, m, cell)
+		} else {
+			drawGutterMark(cr, m.Kind, cell)
+		}
+	}
+}
+
+// Activate: GutterRenderer interface.
+func (gm *GutterMarks) Activate(line int, button gdk.Button) bool {
+	if !gm.Clickable || button != gdk.BUTTON_PRIMARY {
+		return false
+	}
+	set := gm.Toggle(line, gm.ClickKind)
+	if gm.ToggledCallback != nil {
+		gm.ToggledCallback(line, set)
+	}
+	return true
+}
+
+// Update: GutterUpdater interface, the marks may have been moved.
+func (gm *GutterMarks) Update() {
+	gm.byLine = make(map[int][]*GutterMark)
+	for _, m := range gm.marks {
+		line := m.Line()
+		gm.byLine[line] = append(gm.byLine[line], m)
+	}
+}
+
+// Tooltip: GutterTooltiper interface.
+func (gm *GutterMarks) Tooltip(line int) string {
+	var messages []string
+	for _, m := range gm.byLine[line] {
+		if len(m.Message) > 0 {
+			messages = append(messages, m.Message)
+		}
+	}
+	return strings.Join(messages, "\n")
+}
+
+func (gm *GutterMarks) attach(tvn *TextViewNumbered) {
+	gm.tvn = tvn
+}
+
+// changed: update lines then redraw.
+func (gm *GutterMarks) changed() {
+	gm.Update()
+	if gm.tvn != nil {
+		gm.tvn.QueueGutterDraw()
+	}
+}
+
+// drawGutterMark: default icons.
+func drawGutterMark(cr *cairo.Context, kind GutterMarkKind, cell *GutterCell) {
+	size := math.Min(cell.Width, cell.RowHeight) - 4
+	cx, cy := cell.X+cell.Width/2, cell.Y+cell.RowHeight/2
+
+	setCairoColour(cr, GutterMarkColours[kind])
+	switch kind {
+	case GUTTER_MARK_BOOKMARK:
+		// Ribbon
+		cr.MoveTo(cx-size/3, cy-size/2)
+		cr.LineTo(cx+size/3, cy-size/2)
+		cr.LineTo(cx+size/3, cy+size/2)
+		cr.LineTo(cx, cy+size/4)
+		cr.LineTo(cx-size/3, cy+size/2)
+		cr.ClosePath()
+		cr.Fill()
+	case GUTTER_MARK_ERROR:
+		cr.Arc(cx, cy, size/2, 0, 2*math.Pi)
+		cr.Fill()
+		cr.SetSourceRGB(1, 1, 1)
+		cr.SetLineWidth(1.5)
+		cr.MoveTo(cx-size/5, cy-size/5)
+		cr.LineTo(cx+size/5, cy+size/5)
+		cr.MoveTo(cx+size/5, cy-size/5)
+		cr.LineTo(cx-size/5, cy+size/5)
+		cr.Stroke()
+	case GUTTER_MARK_WARNING:
+		cr.MoveTo(cx, cy-size/2)
+		cr.LineTo(cx+size/2, cy+size/2)
+		cr.LineTo(cx-size/2, cy+size/2)
+		cr.ClosePath()
+		cr.Fill()
+		cr.SetSourceRGB(0, 0, 0)
+		cr.SetLineWidth(1.5)
+		cr.MoveTo(cx, cy-size/6)
+		cr.LineTo(cx, cy+size/6)
+		cr.MoveTo(cx, cy+size/4)
+		cr.LineTo(cx, cy+size/3)
+		cr.Stroke()
+	default:
+		cr.Arc(cx, cy, size/2-1, 0, 2*math.Pi)
+		cr.Fill()
+	}
+}
+
+// DiffState: state of a line compared to the baseline.
+type DiffState int
+
+const (
+	DIFF_NONE DiffState = iota
+	DIFF_ADDED
+	DIFF_MODIFIED
+	DIFF_DELETED // Lines have been deleted above this one.
+)
+
+// GutterDiffColours: colours used to draw the bars.
+var GutterDiffColours = map[DiffState]string{
+	DIFF_ADDED:    "#4E9A06",
+	DIFF_MODIFIED: "#EDA000",
+	DIFF_DELETED:  "#CC0000",
+}
+
+// GutterDiff: renderer that displays git-style bars, the current text
+// is compared to the baseline each time the buffer changes.
+type GutterDiff struct {
+	ColWidth int
+
+	tvn          *TextViewNumbered
+	baseline     []string
+	hasBaseline  bool
+	hunks        []DiffHunk
+	states       map[int]DiffState
+	deletedAtEnd bool
+}
+
+// GutterDiffNew: create a new diff renderer.
+func GutterDiffNew(width int) *GutterDiff {
+	return &GutterDiff{ColWidth: width, states: make(map[int]DiffState)}
+}
+
+// SetBaseline: set the reference text, i.e: the file content
+// at the last commit or the last save.
+func (gd *GutterDiff) SetBaseline(text string) {
+	gd.baseline = strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	gd.hasBaseline = true
+	gd.Update()
+	gd.tvn.QueueGutterDraw()
+}
+
+// ClearBaseline: remove the reference text, the column is hidden.
+func (gd *GutterDiff) ClearBaseline() {
+	gd.baseline, gd.hasBaseline = nil, false
+	gd.Update()
+	gd.tvn.QueueGutterDraw()
+}
+
+// Hunks: get the current differences.
+func (gd *GutterDiff) Hunks() []DiffHunk {
+	return append([]DiffHunk{}, gd.hunks...)
+}
+
+// LineState: get the state of the line.
+func (gd *GutterDiff) LineState(line int) DiffState {
+	return gd.states[line]
+}
+
+// Width: GutterRenderer interface.
+func (gd *GutterDiff) Width() int {
+	if gd.hasBaseline {
+		return gd.ColWidth
+	}
+	return 0
+}
+
+// Draw: GutterRenderer interface.
+func (gd *GutterDiff) Draw(cr *cairo.Context, line int, cell *GutterCell) {
+	var deletedMark = func(y float64) {
+		setCairoColour(cr, GutterDiffColours[DIFF_DELETED])
+		cr.MoveTo(cell.X, y-cell.Width)
+		cr.LineTo(cell.X+cell.Width, y)
+		cr.LineTo(cell.X, y+cell.Width)
+		cr.ClosePath()
+		cr.Fill()
+	}
+	switch state := gd.states[line]; state {
+	case DIFF_ADDED, DIFF_MODIFIED:
+		setCairoColour(cr, GutterDiffColours[state])
+		cr.Rectangle(cell.X, cell.Y, cell.Width, cell.Height)
+		cr.Fill()
+	case DIFF_DELETED:
+		deletedMark(cell.Y)
+	}
+	if gd.deletedAtEnd && cell.LastLine {
+		deletedMark(cell.Y + cell.Height)
+	}
+}
+
+// Activate: GutterRenderer interface.
+func (gd *GutterDiff) Activate(line int, button gdk.Button) bool {
+	return false
+}
+
+// Update: GutterUpdater interface, compare the text to the baseline.
+func (gd *GutterDiff) Update() {
+	gd.hunks, gd.states, gd.deletedAtEnd = nil, make(map[int]DiffState), false
+	if !gd.hasBaseline || gd.tvn == nil {
+		return
+	}
+	lines := strings.Split(gd.tvn.GetText(), "\n")
+	gd.hunks = DiffLines(gd.baseline, lines)
+	for _, hunk := range gd.hunks {
+		switch {
+		case hunk.BLen == 0 && hunk.BStart >= len(lines):
+			gd.deletedAtEnd = true
+		case hunk.BLen == 0:
+			gd.states[hunk.BStart] = DIFF_DELETED
+		default:
+			state := DIFF_MODIFIED
+			if hunk.ALen == 0 {
+				state = DIFF_ADDED
+			}
+			for line := hunk.BStart; line < hunk.BStart+hunk.BLen; line++ {
+				gd.states[line] = state
+			}
+		}
+	}
+}
+
+// Tooltip: GutterTooltiper interface, show the original lines.
+func (gd *GutterDiff) Tooltip(line int) string {
+	for _, hunk := range gd.hunks {
+		if hunk.ALen > 0 && (line >= hunk.BStart && line < hunk.BStart+hunk.BLen ||
+			hunk.BLen == 0 && line == hunk.BStart) {
+			return "- " + strings.Join(gd.baseline[hunk.AStart:hunk.AStart+hunk.ALen], "\n- ")
+		}
+	}
+	return ""
+}
+
+func (gd *GutterDiff) attach(tvn *TextViewNumbered) {
+	gd.tvn = tvn
+}
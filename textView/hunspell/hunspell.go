@@ -0,0 +1,801 @@
+// hunspell.go
+
+/*
+	Copyright ©2019 H.F.M - Hunspell dictionaries library "https//github/hfmrow"
+	This program comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+
+	Spell checking with the Hunspell (and MySpell) dictionaries, in pure Go, so it works
+	offline without the C library. The ".aff" file gives the affixes and the options, the
+	".dic" file the stems with their affix flags. Supported: the flag types (char, long,
+	num, UTF-8) and the aliases (AF), the prefixes and suffixes with the cross products,
+	the twofold suffixes, REP, TRY, WORDCHARS, IGNORE, NEEDAFFIX, ONLYINCOMPOUND,
+	FORBIDDENWORD, NOSUGGEST, KEEPCASE and the basic compounding (COMPOUNDFLAG,
+	COMPOUNDBEGIN, COMPOUNDMIDDLE, COMPOUNDEND, COMPOUNDMIN). The morphological fields
+	are ignored. Encodings: UTF-8, ISO8859-1 and ISO8859-15.
+
+Usage:
+	aff, dic, err := FindDictionary("en_US")
+	d, err := DictionaryNew(aff, dic)
+	err = d.LoadPersonal(filepath.Join(configDir, "personal.dic"))
+	if !d.Check("speling") {
+		fmt.Println(d.Suggest("speling", 8))
+	}
+*/
+
+package hunspell
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// HUNSPELL_DIRS: where FindDictionary looks for the dictionaries, after the
+// directories of the DICPATH environment variable.
+var HUNSPELL_DIRS = []string{
+	"~/.local/share/hunspell",
+	"/usr/share/hunspell",
+	"/usr/local/share/hunspell",
+	"/usr/share/myspell",
+	"/usr/share/myspell/dicts",
+	"/Library/Spelling",
+}
+
+// flag: affix or option flag, 0 is unset.
+type flag uint32
+
+// entry: flags of a stem, a stem may have several homonyms.
+type entry []flag
+
+func (e entry) has(f flag) bool {
+	if f == 0 {
+		return false
+	}
+	for _, ef := range e {
+		if ef == f {
+			return true
+		}
+	}
+	return false
+}
+
+// affix: prefix or suffix rule.
+type affix struct {
+	flag  flag
+	cross bool
+	strip,
+	text string
+	cond  condition
+	conts entry // Continuation classes
+}
+
+// rep: replacement used by the suggestions, "^" and "$" anchor it.
+type rep struct {
+	from, to   string
+	start, end bool
+}
+
+// Dictionary: Hunspell dictionary.
+type Dictionary struct {
+	// TryChars: characters used by the suggestions, the most frequent first.
+	TryChars string
+	// WordChars: characters, other than the letters, that are part of the words.
+	WordChars string
+	// Personal: file storing the words added with AddWord, see LoadPersonal.
+	Personal string
+
+	flagType string
+	aliases  []entry
+	ignore   string
+	reps     []rep
+	prefixes,
+	suffixes []*affix
+	cross map[string]bool // "PFX"/"SFX" + flag: cross product allowed
+	words map[string][]entry
+
+	needAffix,
+	onlyInCompound,
+	forbidden,
+	noSuggest,
+	keepCase,
+	compoundFlag,
+	compoundBegin,
+	compoundMiddle,
+	compoundEnd flag
+	compoundMin int
+}
+
+// DictionaryNew: load the ".aff" and ".dic" files.
+func DictionaryNew(affFile, dicFile string) (d *Dictionary, err error) {
+	var aff, dic []byte
+	var decode func([]byte) string
+	if aff, err = ioutil.ReadFile(affFile); err != nil {
+		return
+	}
+	if dic, err = ioutil.ReadFile(dicFile); err != nil {
+		return
+	}
+	if decode, err = decoder(affEncoding(aff)); err != nil {
+		return nil, fmt.Errorf("DictionaryNew: %s: %v", affFile, err)
+	}
+	d = &Dictionary{words: make(map[string][]entry), cross: make(map[string]bool), compoundMin: 3}
+	if err = d.parseAff(decode(aff)); err != nil {
+		return nil, fmt.Errorf("DictionaryNew: %s: %v", affFile, err)
+	}
+	if err = d.parseDic(decode(dic)); err != nil {
+		return nil, fmt.Errorf("DictionaryNew: %s: %v", dicFile, err)
+	}
+	return
+}
+
+// FindDictionary: ".aff" and ".dic" files of the language, i.e: "en_US",
+// searched in the 'dirs', then in DICPATH and HUNSPELL_DIRS.
+func FindDictionary(lang string, dirs ...string) (affFile, dicFile string, err error) {
+	dirs = append(dirs, filepath.SplitList(os.Getenv("DICPATH"))...)
+	dirs = append(dirs, HUNSPELL_DIRS...)
+	home, _ := os.UserHomeDir()
+	for _, dir := range dirs {
+		if strings.HasPrefix(dir, "~/") {
+			dir = filepath.Join(home, dir[2:])
+		}
+		affFile = filepath.Join(dir, lang+".aff")
+		dicFile = filepath.Join(dir, lang+".dic")
+		if _, err = os.Stat(affFile); err == nil {
+			if _, err = os.Stat(dicFile); err == nil {
+				return
+			}
+		}
+	}
+	return "", "", fmt.Errorf("FindDictionary: no dictionary for %q", lang)
+}
+
+// LoadPersonal: add the words of a personal dictionary, one per line, a
+// missing file is not an error. The words added with AddWord are stored
+// in 'filename'.
+func (d *Dictionary) LoadPersonal(filename string) (err error) {
+	d.Personal = filename
+	var data []byte
+	if data, err = ioutil.ReadFile(filename); err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if word := personalWord(line); len(word) > 0 {
+			d.words[word] = append(d.words[word], entry{})
+		}
+	}
+	return
+}
+
+// AddWord: add the word to the dictionary and to the personal one.
+func (d *Dictionary) AddWord(word string) (err error) {
+	word = strings.TrimSpace(word)
+	if len(word) == 0 || d.known(word) {
+		return
+	}
+	d.words[word] = append(d.words[word], entry{})
+	if len(d.Personal) > 0 {
+		var file *os.File
+		if err = os.MkdirAll(filepath.Dir(d.Personal), 0755); err != nil {
+			return
+		}
+		if file, err = os.OpenFile(d.Personal, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err != nil {
+			return
+		}
+		_, err = file.WriteString(word + "\n")
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return
+}
+
+// personalWord: the word of a line of a personal dictionary, the model
+// ("word/model") is ignored.
+func personalWord(line string) string {
+	line = strings.TrimSpace(line)
+	if idx := strings.Index(line, "/"); idx > 0 {
+		line = line[:idx]
+	}
+	return line
+}
+
+// known: the word is a stem that can be used alone.
+func (d *Dictionary) known(word string) bool {
+	for _, e := range d.words[word] {
+		if !e.has(d.needAffix) && !e.has(d.onlyInCompound) && !e.has(d.forbidden) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+ * Check
+ */
+
+// Check: the word is correctly spelled. The words in lower case may be
+// written in title or upper case, except the ones flagged with KEEPCASE.
+func (d *Dictionary) Check(word string) bool {
+	word = d.clean(word)
+	if len(word) == 0 || isNumber(word) {
+		return true
+	}
+	if d.checkCase(word) {
+		return true
+	}
+	if strings.ContainsRune(word, '’') {
+		return d.checkCase(strings.ReplaceAll(word, "’", "'"))
+	}
+	return false
+}
+
+// clean: remove the spaces and the IGNORE characters.
+func (d *Dictionary) clean(word string) string {
+	word = strings.TrimSpace(word)
+	if len(d.ignore) > 0 {
+		word = strings.Map(func(r rune) rune {
+			if strings.ContainsRune(d.ignore, r) {
+				return -1
+			}
+			return r
+		}, word)
+	}
+	return word
+}
+
+func (d *Dictionary) checkCase(word string) bool {
+	if d.isForbidden(word) {
+		return false
+	}
+	if d.checkWord(word, true) {
+		return true
+	}
+	switch caseOf(word) {
+	case CASE_UPPER:
+		lower := strings.ToLower(word)
+		title := toTitle(lower)
+		return (!d.isForbidden(title) && d.checkWord(title, false)) ||
+			(!d.isForbidden(lower) && d.checkWord(lower, false))
+	case CASE_TITLE:
+		lower := strings.ToLower(word)
+		return !d.isForbidden(lower) && d.checkWord(lower, false)
+	}
+	return false
+}
+
+func (d *Dictionary) isForbidden(word string) bool {
+	for _, e := range d.words[word] {
+		if e.has(d.forbidden) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkWord: 'keepCase' the stems flagged with KEEPCASE are allowed.
+func (d *Dictionary) checkWord(word string, keepCase bool) bool {
+	accept := func(e entry) bool {
+		return !e.has(d.forbidden) && (keepCase || !e.has(d.keepCase))
+	}
+	for _, e := range d.words[word] {
+		if accept(e) && !e.has(d.needAffix) && !e.has(d.onlyInCompound) {
+			return true
+		}
+	}
+	if d.checkAffixed(word, accept) {
+		return true
+	}
+	return d.compoundMin > 0 && d.checkCompound([]rune(word), 0, accept)
+}
+
+// checkAffixed: the word is a stem with its prefix and/or its suffixes.
+func (d *Dictionary) checkAffixed(word string, accept func(e entry) bool) bool {
+	if d.checkSuffixed(word, nil, nil, accept) {
+		return true
+	}
+	for _, pfx := range d.prefixes {
+		if !strings.HasPrefix(word, pfx.text) || len(word) == len(pfx.text) || pfx.conts.has(d.needAffix) {
+			continue
+		}
+		stem := pfx.strip + word[len(pfx.text):]
+		if !pfx.cond.matchStart([]rune(stem)) {
+			continue
+		}
+		for _, e := range d.words[stem] {
+			if e.has(pfx.flag) && !e.has(d.onlyInCompound) && accept(e) {
+				return true
+			}
+		}
+		if pfx.cross && d.checkSuffixed(stem, pfx, nil, accept) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSuffixed: remove a suffix, 'outer' is the suffix already removed
+// (twofold suffixes), 'pfx' the prefix removed.
+func (d *Dictionary) checkSuffixed(word string, pfx, outer *affix, accept func(e entry) bool) bool {
+	for _, sfx := range d.suffixes {
+		if !strings.HasSuffix(word, sfx.text) || len(word) == len(sfx.text) {
+			continue
+		}
+		if pfx != nil && !sfx.cross {
+			continue
+		}
+		if outer != nil && !sfx.conts.has(outer.flag) {
+			continue
+		}
+		if outer == nil && sfx.conts.has(d.needAffix) {
+			continue
+		}
+		stem := word[:len(word)-len(sfx.text)] + sfx.strip
+		if len(stem) == 0 || !sfx.cond.matchEnd([]rune(stem)) {
+			continue
+		}
+		for _, e := range d.words[stem] {
+			if e.has(sfx.flag) && !e.has(d.onlyInCompound) && accept(e) &&
+				(pfx == nil || e.has(pfx.flag) || sfx.conts.has(pfx.flag)) {
+				return true
+			}
+		}
+		if outer == nil && pfx == nil && d.checkSuffixed(stem, nil, sfx, accept) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkCompound: the word, from 'pos', is made of stems allowed in compounds.
+func (d *Dictionary) checkCompound(word []rune, pos int, accept func(e entry) bool) bool {
+	if d.compoundFlag == 0 && d.compoundBegin == 0 {
+		return false
+	}
+	for end := pos + d.compoundMin; end <= len(word); end++ {
+		if end == len(word) && pos == 0 {
+			break // Not a compound
+		}
+		if end < len(word) && len(word)-end < d.compoundMin {
+			continue
+		}
+		part := string(word[pos:end])
+		var position flag
+		switch {
+		case pos == 0:
+			position = d.compoundBegin
+		case end == len(word):
+			position = d.compoundEnd
+		default:
+			position = d.compoundMiddle
+		}
+		for _, e := range d.words[part] {
+			if !accept(e) || !(e.has(d.compoundFlag) || e.has(position)) {
+				continue
+			}
+			if end == len(word) || d.checkCompound(word, end, accept) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+/*
+ * Words
+ */
+
+// Word: word of a text, offsets of the characters.
+type Word struct {
+	Text string
+	Start,
+	End int
+}
+
+// Words: words of the text to check. The words that look like code, with
+// digits, underscores, dots or an upper case letter after a lower case
+// one (i.e: "camelCase", "file.go", "snake_case"), are skipped.
+func (d *Dictionary) Words(text string) (words []Word) {
+	runes := []rune(text)
+	isWordChar := func(r rune) bool {
+		return r == '\'' || r == '’' || strings.ContainsRune(d.WordChars, r)
+	}
+	isLetter := func(idx int) bool {
+		return idx >= 0 && idx < len(runes) && (unicode.IsLetter(runes[idx]) || unicode.IsMark(runes[idx]))
+	}
+	isCode := func(idx int) bool {
+		if idx < 0 || idx >= len(runes) {
+			return false
+		}
+		r := runes[idx]
+		return r == '_' || unicode.IsDigit(r) || strings.ContainsRune(`@/\#$`, r) ||
+			r == '.' && isLetter(idx-1) && isLetter(idx+1)
+	}
+	for idx := 0; idx < len(runes); {
+		if !isLetter(idx) {
+			idx++
+			continue
+		}
+		start := idx
+		for idx < len(runes) && (isLetter(idx) || isWordChar(runes[idx]) && isLetter(idx+1)) {
+			idx++
+		}
+		if isCode(start-1) || isCode(idx) {
+			continue
+		}
+		if camelCase(runes[start:idx]) {
+			continue
+		}
+		words = append(words, Word{Text: string(runes[start:idx]), Start: start, End: idx})
+	}
+	return
+}
+
+// Case: capitalization of a word.
+type Case int
+
+const (
+	CASE_LOWER Case = iota
+	CASE_TITLE
+	CASE_UPPER
+	CASE_MIXED
+)
+
+func caseOf(word string) Case {
+	var upper, lower int
+	first := true
+	title := false
+	for _, r := range word {
+		switch {
+		case unicode.IsUpper(r):
+			upper++
+			title = first
+		case unicode.IsLower(r):
+			lower++
+		default:
+			continue
+		}
+		first = false
+	}
+	switch {
+	case upper == 0:
+		return CASE_LOWER
+	case upper == 1 && title:
+		return CASE_TITLE
+	case lower == 0:
+		return CASE_UPPER
+	}
+	return CASE_MIXED
+}
+
+// camelCase: an upper case letter after a lower case one.
+func camelCase(word []rune) bool {
+	for idx := 1; idx < len(word); idx++ {
+		if unicode.IsUpper(word[idx]) && unicode.IsLower(word[idx-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+func toTitle(word string) string {
+	r, size := utf8.DecodeRuneInString(word)
+	return string(unicode.ToTitle(r)) + word[size:]
+}
+
+func isNumber(word string) bool {
+	for _, r := range word {
+		if !unicode.IsDigit(r) && !strings.ContainsRune(".,-", r) {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+ * Files
+ */
+
+// condition: condition of an affix, an element per character.
+type condition []condChar
+
+type condChar struct {
+	chars string
+	neg,
+	any bool
+}
+
+func parseCondition(cond string) (c condition) {
+	if cond == "." {
+		return nil
+	}
+	runes := []rune(cond)
+	for idx := 0; idx < len(runes); idx++ {
+		switch runes[idx] {
+		case '.':
+			c = append(c, condChar{any: true})
+		case '[':
+			end := idx + 1
+			neg := end < len(runes) && runes[end] == '^'
+			if neg {
+				end++
+			}
+			start := end
+			for end < len(runes) && runes[end] != ']' {
+				end++
+			}
+			c = append(c, condChar{chars: string(runes[start:end]), neg: neg})
+			idx = end
+		default:
+			c = append(c, condChar{chars: string(runes[idx])})
+		}
+	}
+	return
+}
+
+func (cc condChar) match(r rune) bool {
+	return cc.any || strings.ContainsRune(cc.chars, r) != cc.neg
+}
+
+func (c condition) matchStart(word []rune) bool {
+	if len(word) < len(c) {
+		return false
+	}
+	for idx, cc := range c {
+		if !cc.match(word[idx]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c condition) matchEnd(word []rune) bool {
+	if len(word) < len(c) {
+		return false
+	}
+	offset := len(word) - len(c)
+	for idx, cc := range c {
+		if !cc.match(word[offset+idx]) {
+			return false
+		}
+	}
+	return true
+}
+
+// affEncoding: value of the "SET" option.
+func affEncoding(aff []byte) string {
+	for _, line := range strings.Split(string(aff), "\n") {
+		if fields := strings.Fields(line); len(fields) > 1 && fields[0] == "SET" {
+			return fields[1]
+		}
+	}
+	return ""
+}
+
+// latin9: ISO8859-15 characters that differ from ISO8859-1.
+var latin9 = map[byte]rune{
+	0xA4: '€', 0xA6: 'Š', 0xA8: 'š', 0xB4: 'Ž', 0xB8: 'ž', 0xBC: 'Œ', 0xBD: 'œ', 0xBE: 'Ÿ'}
+
+func decoder(encoding string) (func([]byte) string, error) {
+	switch strings.ToUpper(encoding) {
+	case "", "UTF-8", "UTF8":
+		return func(data []byte) string {
+			return strings.TrimPrefix(string(data), "\uFEFF")
+		}, nil
+	case "ISO8859-1", "ISO-8859-1", "LATIN1":
+		return func(data []byte) string {
+			var sb strings.Builder
+			for _, b := range data {
+				sb.WriteRune(rune(b))
+			}
+			return sb.String()
+		}, nil
+	case "ISO8859-15", "ISO-8859-15", "LATIN9":
+		return func(data []byte) string {
+			var sb strings.Builder
+			for _, b := range data {
+				if r, ok := latin9[b]; ok {
+					sb.WriteRune(r)
+				} else {
+					sb.WriteRune(rune(b))
+				}
+			}
+			return sb.String()
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported encoding: %s", encoding)
+}
+
+// parseFlags: flags of a stem or an affix, or an alias number.
+func (d *Dictionary) parseFlags(text string) (flags entry) {
+	if len(d.aliases) > 0 {
+		if n, err := strconv.Atoi(text); err == nil {
+			if n > 0 && n <= len(d.aliases) {
+				return d.aliases[n-1]
+			}
+			return nil
+		}
+	}
+	return d.parseFlagList(text)
+}
+
+func (d *Dictionary) parseFlagList(text string) (flags entry) {
+	switch d.flagType {
+	case "long":
+		runes := []rune(text)
+		for idx := 0; idx+1 < len(runes); idx += 2 {
+			flags = append(flags, flag(runes[idx])<<16|flag(runes[idx+1]))
+		}
+	case "num":
+		for _, num := range strings.Split(text, ",") {
+			if n, err := strconv.Atoi(strings.TrimSpace(num)); err == nil && n > 0 {
+				flags = append(flags, flag(n))
+			}
+		}
+	default: // char, UTF-8
+		for _, r := range text {
+			flags = append(flags, flag(r))
+		}
+	}
+	return
+}
+
+func (d *Dictionary) parseFlag(text string) flag {
+	if flags := d.parseFlagList(text); len(flags) > 0 {
+		return flags[0]
+	}
+	return 0
+}
+
+func (d *Dictionary) parseAff(aff string) (err error) {
+	var remaining int // Lines of the current table
+	for num, line := range strings.Split(aff, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		bad := func() error {
+			return fmt.Errorf("line %d: malformed %s", num+1, fields[0])
+		}
+		table := remaining > 0
+		if table {
+			remaining--
+		}
+		switch fields[0] {
+		case "FLAG":
+			if len(fields) > 1 {
+				d.flagType = fields[1]
+			}
+		case "TRY":
+			if len(fields) > 1 {
+				d.TryChars = fields[1]
+			}
+		case "WORDCHARS":
+			if len(fields) > 1 {
+				d.WordChars = fields[1]
+			}
+		case "IGNORE":
+			if len(fields) > 1 {
+				d.ignore = fields[1]
+			}
+		case "NEEDAFFIX", "PSEUDOROOT":
+			d.needAffix = d.optionFlag(fields)
+		case "ONLYINCOMPOUND":
+			d.onlyInCompound = d.optionFlag(fields)
+		case "FORBIDDENWORD":
+			d.forbidden = d.optionFlag(fields)
+		case "NOSUGGEST":
+			d.noSuggest = d.optionFlag(fields)
+		case "KEEPCASE":
+			d.keepCase = d.optionFlag(fields)
+		case "COMPOUNDFLAG":
+			d.compoundFlag = d.optionFlag(fields)
+		case "COMPOUNDBEGIN":
+			d.compoundBegin = d.optionFlag(fields)
+		case "COMPOUNDMIDDLE":
+			d.compoundMiddle = d.optionFlag(fields)
+		case "COMPOUNDEND":
+			d.compoundEnd = d.optionFlag(fields)
+		case "COMPOUNDMIN":
+			if len(fields) > 1 {
+				if d.compoundMin, err = strconv.Atoi(fields[1]); err != nil || d.compoundMin < 1 {
+					return bad()
+				}
+			}
+		case "AF":
+			if !table {
+				remaining, _ = strconv.Atoi(fields[1])
+			} else if len(fields) > 1 {
+				d.aliases = append(d.aliases, d.parseFlagList(fields[1]))
+			}
+		case "REP":
+			if !table {
+				remaining, _ = strconv.Atoi(fields[1])
+			} else if len(fields) > 2 {
+				r := rep{from: fields[1], to: strings.ReplaceAll(fields[2], "_", " ")}
+				r.start = strings.HasPrefix(r.from, "^")
+				r.end = strings.HasSuffix(r.from, "$")
+				r.from = strings.ReplaceAll(strings.TrimSuffix(strings.TrimPrefix(r.from, "^"), "$"), "_", " ")
+				d.reps = append(d.reps, r)
+			}
+		case "PFX", "SFX":
+			if len(fields) < 4 {
+				return bad()
+			}
+			if !table {
+				if remaining, err = strconv.Atoi(fields[3]); err != nil {
+					return bad()
+				}
+				d.cross[fields[0]+fields[1]] = fields[2] == "Y"
+				continue
+			}
+			a := &affix{flag: d.parseFlag(fields[1]), strip: fields[2], text: fields[3]}
+			if a.strip == "0" {
+				a.strip = ""
+			}
+			if idx := strings.Index(a.text, "/"); idx >= 0 {
+				a.conts = d.parseFlags(a.text[idx+1:])
+				a.text = a.text[:idx]
+			}
+			if a.text == "0" {
+				a.text = ""
+			}
+			if len(fields) > 4 {
+				a.cond = parseCondition(fields[4])
+			}
+			a.cross = d.cross[fields[0]+fields[1]]
+			if fields[0] == "PFX" {
+				d.prefixes = append(d.prefixes, a)
+			} else {
+				d.suffixes = append(d.suffixes, a)
+			}
+		}
+	}
+	return nil
+}
+
+func (d *Dictionary) optionFlag(fields []string) flag {
+	if len(fields) > 1 {
+		return d.parseFlag(fields[1])
+	}
+	return 0
+}
+
+func (d *Dictionary) parseDic(dic string) error {
+	for num, line := range strings.Split(dic, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if num == 0 {
+			if _, err := strconv.Atoi(strings.TrimSpace(line)); err == nil {
+				continue // Approximate count of the words
+			}
+		}
+		// The morphological fields follow a tab or a space.
+		if idx := strings.IndexAny(line, "\t "); idx >= 0 {
+			line = line[:idx]
+		}
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		word, flags := line, ""
+		for idx := 0; idx < len(line); idx++ {
+			if line[idx] == '/' && idx > 0 && line[idx-1] != '\\' {
+				word, flags = line[:idx], line[idx+1:]
+				break
+			}
+		}
+		word = strings.ReplaceAll(word, "\\/", "/")
+		d.words[word] = append(d.words[word], d.parseFlags(flags))
+	}
+	if len(d.words) == 0 {
+		return fmt.Errorf("no words")
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+// hunspell_test.go
+
+/*
+	Copyright ©2019 H.F.M - Hunspell dictionaries library "https//github/hfmrow"
+	This program comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+*/
+
+package hunspell
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func testDictionary(t *testing.T) *Dictionary {
+	d, err := DictionaryNew(filepath.Join("testdata", "test.aff"), filepath.Join("testdata", "test.dic"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestCheck(t *testing.T) {
+	d := testDictionary(t)
+	for word, want := range map[string]bool{
+		// Stems, prefixes and suffixes
+		"lock": true, "locks": true, "locked": true, "unlock": true, "lockes": false,
+		"flies": true, "flys": false, "phones": true,
+		// Cross product
+		"unlocks": true, "reread": true, "reading": true, "rereading": false,
+		// FORBIDDENWORD
+		"unlocked": false, "Unlocked": false,
+		// NEEDAFFIX
+		"walk": false, "walks": true, "walked": true,
+		// KEEPCASE
+		"NASA": true, "nasa": false, "Nasa": false,
+		// Title and upper case
+		"Lock": true, "LOCK": true, "UNLOCKS": true, "LoCk": false,
+		"Paris": true, "PARIS": true, "paris": false, "ÉTÉ": true, "Été": true,
+		// COMPOUNDFLAG, COMPOUNDMIN
+		"football": true, "ballfootball": true, "Football": true, "footbal": false,
+		"oxfoot": false, "footox": false,
+		// Numbers, apostrophe
+		"1,234.5": true, "": true,
+	} {
+		if got := d.Check(word); got != want {
+			t.Errorf("Check(%q): got %v, want %v", word, got, want)
+		}
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	d := testDictionary(t)
+	for _, test := range []struct {
+		word, want string
+		first      bool
+	}{
+		{"fone", "phone", true},   // REP
+		{"fones", "phones", true}, // REP, then the suffix
+		{"alot", "a lot", true},   // Anchored REP
+		{"lcok", "lock", true},    // Swapped characters
+		{"lok", "lock", false},    // Forgotten character, TRY
+		{"lpck", "lock", true},    // Wrong character, TRY
+		{"lockk", "lock", false},  // Extra character
+		{"Lcok", "Lock", true},    // Case kept
+		{"LCOK", "LOCK", true},
+		{"nasa", "NASA", true}, // KEEPCASE
+		{"paris", "Paris", true},
+		{"footbal", "football", false},
+		{"lockunlock", "lock unlock", false}, // Two words
+	} {
+		got := d.Suggest(test.word, 4)
+		found := false
+		for idx, cand := range got {
+			if cand == test.want && (idx == 0 || !test.first) {
+				found = true
+			}
+			if cand == "unlocked" || cand == "walk" {
+				t.Errorf("Suggest(%q): got %q", test.word, got)
+			}
+		}
+		if !found {
+			t.Errorf("Suggest(%q): got %q, want %q (first: %v)", test.word, got, test.want, test.first)
+		}
+	}
+	if got := d.Suggest("lcok", 1); len(got) != 1 {
+		t.Errorf("Suggest max: got %q", got)
+	}
+}
+
+func TestWords(t *testing.T) {
+	d := testDictionary(t)
+	got := d.Words("L'été, naïve café_bar file.go x2 camelCase à-côté")
+	want := []Word{
+		{Text: "L'été", Start: 0, End: 5},
+		{Text: "naïve", Start: 7, End: 12},
+		{Text: "à", Start: 43, End: 44},
+		{Text: "côté", Start: 45, End: 49},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Words: got %+v, want %+v", got, want)
+	}
+}
+
+func TestPersonal(t *testing.T) {
+	d := testDictionary(t)
+	filename := filepath.Join(t.TempDir(), "dir", "personal.dic")
+	if err := d.LoadPersonal(filename); err != nil {
+		t.Fatalf("LoadPersonal: missing file: %v", err)
+	}
+	for _, word := range []string{"gotk", "lock", "gotk"} {
+		if err := d.AddWord(word); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !d.Check("gotk") {
+		t.Error("AddWord: not added")
+	}
+	if data, _ := ioutil.ReadFile(filename); string(data) != "gotk\n" {
+		t.Errorf("personal dictionary: got %q", data)
+	}
+	d = testDictionary(t)
+	if err := d.LoadPersonal(filename); err != nil || !d.Check("gotk") {
+		t.Errorf("LoadPersonal: %v", err)
+	}
+}
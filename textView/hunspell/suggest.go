@@ -0,0 +1,286 @@
+// suggest.go
+
+/*
+	Copyright ©2019 H.F.M - Hunspell dictionaries library "https//github/hfmrow"
+	This program comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+
+	Suggestions: the replacements of the REP table, then the words at an edit distance of
+	one (swapped, extra, forgotten and wrong characters, two words), the most similar ones
+	first. When there are few of them, the stems of the dictionary are compared using
+	n-grams, with their affixed forms.
+*/
+
+package hunspell
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// SUGGEST_NGRAM_STEMS: stems kept by the n-gram comparison, their affixed
+// forms are compared again.
+const SUGGEST_NGRAM_STEMS = 24
+
+// Suggest: corrections of the misspelled word, 'max' at most, the most
+// likely first. The capitalization of the word is kept.
+func (d *Dictionary) Suggest(word string, max int) (out []string) {
+	word = d.clean(word)
+	if len(word) == 0 || max <= 0 {
+		return
+	}
+	wCase := caseOf(word)
+	base := word
+	if wCase == CASE_TITLE || wCase == CASE_UPPER {
+		base = strings.ToLower(word)
+	}
+	seen := map[string]bool{word: true}
+	add := func(cand string) bool {
+		if len(out) >= max || seen[cand] {
+			return len(out) >= max
+		}
+		cased := applyCase(cand, wCase)
+		if !seen[cased] && d.suggestable(cand) {
+			out = append(out, cased)
+		}
+		seen[cand], seen[cased] = true, true
+		return len(out) >= max
+	}
+
+	// Wrong capitalization
+	for _, cand := range []string{toTitle(word), strings.ToUpper(word)} {
+		if cand != word && d.Check(cand) && d.suggestable(cand) {
+			out = append(out, cand)
+			seen[cand] = true
+			break
+		}
+	}
+	for _, cand := range d.repSuggestions(base) {
+		if add(cand) {
+			return
+		}
+	}
+	for _, cand := range d.editSuggestions(base) {
+		if add(cand) {
+			return
+		}
+	}
+	if len(out) < 2 {
+		for _, cand := range d.ngramSuggestions(base) {
+			if add(cand) {
+				return
+			}
+		}
+	}
+	return
+}
+
+// suggestable: correct word, not flagged with NOSUGGEST. The two words
+// suggestions are separated with a space.
+func (d *Dictionary) suggestable(cand string) bool {
+	for _, part := range strings.Split(cand, " ") {
+		if !d.Check(part) {
+			return false
+		}
+		for _, e := range d.words[part] {
+			if e.has(d.noSuggest) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func applyCase(word string, c Case) string {
+	switch c {
+	case CASE_UPPER:
+		return strings.ToUpper(word)
+	case CASE_TITLE:
+		return toTitle(word)
+	}
+	return word
+}
+
+// repSuggestions: replacements of the REP table.
+func (d *Dictionary) repSuggestions(word string) (cands []string) {
+	for _, r := range d.reps {
+		if len(r.from) == 0 {
+			continue
+		}
+		for idx := 0; idx <= len(word)-len(r.from); {
+			pos := strings.Index(word[idx:], r.from)
+			if pos < 0 {
+				break
+			}
+			pos += idx
+			if (!r.start || pos == 0) && (!r.end || pos+len(r.from) == len(word)) {
+				cands = append(cands, word[:pos]+r.to+word[pos+len(r.from):])
+			}
+			idx = pos + 1
+		}
+	}
+	return
+}
+
+// editSuggestions: words at an edit distance of one, the most similar first.
+func (d *Dictionary) editSuggestions(word string) (cands []string) {
+	runes := []rune(word)
+	try := []rune(d.TryChars)
+	if len(try) == 0 {
+		try = []rune("esianrtolcdugmphbyfvkwzxjq")
+	}
+	seen := make(map[string]bool)
+	add := func(cand string) {
+		if !seen[cand] {
+			seen[cand] = true
+			if d.Check(cand) {
+				cands = append(cands, cand)
+			}
+		}
+	}
+	edit := func(pos, remove int, insert ...rune) string {
+		out := make([]rune, 0, len(runes)+len(insert))
+		out = append(out, runes[:pos]...)
+		out = append(out, insert...)
+		return string(append(out, runes[pos+remove:]...))
+	}
+	// Swapped characters
+	for idx := 0; idx+1 < len(runes); idx++ {
+		if runes[idx] != runes[idx+1] {
+			add(edit(idx, 2, runes[idx+1], runes[idx]))
+		}
+	}
+	// Extra character
+	for idx := range runes {
+		add(edit(idx, 1))
+	}
+	// Forgotten character
+	for idx := 0; idx <= len(runes); idx++ {
+		for _, r := range try {
+			add(edit(idx, 0, r))
+		}
+	}
+	// Wrong character
+	for idx := range runes {
+		for _, r := range try {
+			if r != runes[idx] {
+				add(edit(idx, 1, r))
+			}
+		}
+	}
+	var twoWords []string
+	for idx := 1; idx < len(runes); idx++ {
+		first, second := string(runes[:idx]), string(runes[idx:])
+		if d.Check(first) && d.Check(second) {
+			twoWords = append(twoWords, first+" "+second)
+		}
+	}
+	sort.SliceStable(cands, func(i, j int) bool {
+		return similarity(word, cands[i]) > similarity(word, cands[j])
+	})
+	return append(cands, twoWords...)
+}
+
+// ngramSuggestions: the stems, and their affixed forms, the most similar
+// to the word.
+func (d *Dictionary) ngramSuggestions(word string) (cands []string) {
+	type scored struct {
+		word  string
+		score int
+	}
+	length := utf8.RuneCountInString(word)
+	if length < 3 {
+		return
+	}
+	threshold := ngram(word, word) / 2
+	best := func(words []scored, count int) []scored {
+		sort.Slice(words, func(i, j int) bool {
+			if words[i].score != words[j].score {
+				return words[i].score > words[j].score
+			}
+			return words[i].word < words[j].word
+		})
+		if len(words) > count {
+			words = words[:count]
+		}
+		return words
+	}
+
+	var stems []scored
+	for stem, entries := range d.words {
+		if diff := utf8.RuneCountInString(stem) - length; diff > 4 || diff < -4 {
+			continue
+		}
+		usable := false
+		for _, e := range entries {
+			if !e.has(d.forbidden) && !e.has(d.noSuggest) && !e.has(d.onlyInCompound) {
+				usable = true
+			}
+		}
+		if usable {
+			if score := similarity(word, strings.ToLower(stem)); score >= threshold {
+				stems = append(stems, scored{stem, score})
+			}
+		}
+	}
+	var forms []scored
+	for _, stem := range best(stems, SUGGEST_NGRAM_STEMS) {
+		forms = append(forms, stem)
+		for _, form := range d.affixedForms(stem.word) {
+			if score := similarity(word, strings.ToLower(form)); score >= threshold {
+				forms = append(forms, scored{form, score})
+			}
+		}
+	}
+	for _, form := range best(forms, SUGGEST_NGRAM_STEMS) {
+		cands = append(cands, form.word)
+	}
+	return
+}
+
+// affixedForms: the stem with one of its suffixes or prefixes.
+func (d *Dictionary) affixedForms(stem string) (forms []string) {
+	runes := []rune(stem)
+	for _, e := range d.words[stem] {
+		for _, sfx := range d.suffixes {
+			if e.has(sfx.flag) && strings.HasSuffix(stem, sfx.strip) && sfx.cond.matchEnd(runes) {
+				forms = append(forms, stem[:len(stem)-len(sfx.strip)]+sfx.text)
+			}
+		}
+		for _, pfx := range d.prefixes {
+			if e.has(pfx.flag) && strings.HasPrefix(stem, pfx.strip) && pfx.cond.matchStart(runes) {
+				forms = append(forms, pfx.text+stem[len(pfx.strip):])
+			}
+		}
+	}
+	return
+}
+
+// similarity: n-grams in common, plus the common prefix, minus the
+// difference of length.
+func similarity(a, b string) (score int) {
+	score = ngram(a, b)
+	ra, rb := []rune(a), []rune(b)
+	for idx := 0; idx < len(ra) && idx < len(rb) && ra[idx] == rb[idx]; idx++ {
+		score++
+	}
+	diff := len(ra) - len(rb)
+	if diff < 0 {
+		diff = -diff
+	}
+	return score - 2*diff
+}
+
+// ngram: count of the 1, 2 and 3-grams of 'a' found in 'b'.
+func ngram(a, b string) (count int) {
+	ra := []rune(a)
+	for n := 1; n <= 3; n++ {
+		for idx := 0; idx+n <= len(ra); idx++ {
+			if strings.Contains(b, string(ra[idx:idx+n])) {
+				count++
+			}
+		}
+	}
+	return
+}
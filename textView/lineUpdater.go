@@ -0,0 +1,106 @@
+// lineUpdater.go
+
+/*
+	This software use gotk3 that is licensed under the ISC License:
+	https://github.com/gotk3/gotk3/blob/master/LICENSE
+
+	Copyright ©2019 H.F.M - TextView Numbered  library "https//github/hfmrow"
+	This program comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+
+	Delayed update of the modified lines of a buffer, used by the Linkifier and the
+	SpellChecker. The range of lines to update follows the insertions and the deletions
+	made before the delay expires.
+*/
+
+package textView
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// lineUpdater: calls 'update' with the modified lines, 'delay' after
+// the last modification.
+type lineUpdater struct {
+	buff   *gtk.TextBuffer
+	delay  func() time.Duration
+	update func(first, last int)
+
+	handlers []glib.SignalHandle // Buffer: insert-text, delete-range
+	timer    glib.SourceHandle
+	dirty    bool
+	first,
+	last int
+}
+
+// connect: follow the modifications of the buffer.
+func (lu *lineUpdater) connect(buff *gtk.TextBuffer, delay func() time.Duration, update func(first, last int)) {
+	lu.buff, lu.delay, lu.update = buff, delay, update
+	lu.handlers = []glib.SignalHandle{
+		buff.ConnectAfter("insert-text", lu.inserted),
+		buff.Connect("delete-range", lu.deleting)}
+}
+
+// disconnect: stop following the modifications, the pending update
+// is canceled.
+func (lu *lineUpdater) disconnect() {
+	lu.stopTimer()
+	lu.dirty = false
+	for _, handle := range lu.handlers {
+		lu.buff.HandlerDisconnect(handle)
+	}
+	lu.handlers = nil
+}
+
+// inserted: "insert-text", 'iter' is at the end of the inserted text.
+// The buffer may be a GtkSourceBuffer, see SourceViewStruct.Linkify and
+// SourceViewStruct.SpellCheck.
+func (lu *lineUpdater) inserted(buff interface{}, iter *gtk.TextIter, text string) {
+	last := iter.GetLine()
+	count := strings.Count(text, "\n")
+	if lu.dirty && lu.last >= last-count {
+		lu.last += count
+	}
+	lu.setDirty(last-count, last)
+}
+
+// deleting: "delete-range", before the deletion.
+func (lu *lineUpdater) deleting(buff interface{}, start, end *gtk.TextIter) {
+	first := start.GetLine()
+	count := end.GetLine() - first
+	if lu.dirty && lu.last > first {
+		if lu.last -= count; lu.last < first {
+			lu.last = first
+		}
+	}
+	lu.setDirty(first, first)
+}
+
+// setDirty: add the lines to update and delay the update.
+func (lu *lineUpdater) setDirty(first, last int) {
+	if !lu.dirty || first < lu.first {
+		lu.first = first
+	}
+	if !lu.dirty || last > lu.last {
+		lu.last = last
+	}
+	lu.dirty = true
+	lu.stopTimer()
+	lu.timer = glib.TimeoutAdd(uint(lu.delay()/time.Millisecond), func() bool {
+		lu.timer = 0
+		lu.dirty = false
+		lu.update(lu.first, lu.last)
+		return false
+	})
+}
+
+func (lu *lineUpdater) stopTimer() {
+	if lu.timer != 0 {
+		glib.SourceRemove(lu.timer)
+		lu.timer = 0
+	}
+}
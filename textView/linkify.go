@@ -0,0 +1,380 @@
+// linkify.go
+
+/*
+	This software use gotk3 that is licensed under the ISC License:
+	https://github.com/gotk3/gotk3/blob/master/LICENSE
+
+	Copyright ©2019 H.F.M - TextView Numbered  library "https//github/hfmrow"
+	This program comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+
+	Hyperlinks in a TextView: the URLs, the e-mail addresses and the file paths, with an
+	optional ":line:column" as in the compilers messages, are tagged. The modified lines
+	are scanned again after 'Delay'. A click on a link calls ActivateFunc, then
+	OpenFileFunc for the files and finally opens the URI with the default application.
+	In an editable view, the links are activated with Ctrl+click.
+
+Usage:
+	lk, err := LinkifierNew(textView)
+	lk.OpenFileFunc = func(filename string, line, column int) bool {
+		...
+		return true
+	}
+	lk.Scan()
+*/
+
+package textView
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+	"github.com/gotk3/gotk3/pango"
+
+	gitvtt "github.com/hfmrow/gtk3_import/textView/textTag"
+)
+
+const (
+	// LINKIFY_TAG: name of the tag of the links.
+	LINKIFY_TAG = "linkify:link"
+	// LINKIFY_DELAY: delay between a modification and the scan of the lines.
+	LINKIFY_DELAY = 300 * time.Millisecond
+)
+
+// LinkKind:
+type LinkKind int
+
+const (
+	LINK_URL LinkKind = iota
+	LINK_EMAIL
+	LINK_FILE
+)
+
+// Link: detected link, offsets of the characters.
+type Link struct {
+	Kind LinkKind
+	// Text: as displayed.
+	Text string
+	// URI: "http://...", "mailto:..." or "file://...".
+	URI string
+	// Filename, Line, Column: files, the numbers are 1 based, 0 when not given.
+	Filename string
+	Line,
+	Column int
+	Start,
+	End int
+}
+
+// Linkifier: links of a TextView.
+type Linkifier struct {
+	View *gtk.TextView
+	Buff *gtk.TextBuffer
+	Tag  *gtk.TextTag
+
+	// URLs, Emails, Files: kinds of links to detect.
+	URLs,
+	Emails,
+	Files bool
+	// BaseDir: directory of the relative paths, the current one if empty.
+	BaseDir string
+	// CheckFiles: only the existing files are linked.
+	CheckFiles bool
+	// ActivateMask: modifiers required to activate a link, Ctrl for the
+	// editable views.
+	ActivateMask gdk.ModifierType
+	// Delay: between a modification and the scan of the modified lines.
+	Delay time.Duration
+
+	// ActivateFunc: a link has been clicked, return true if it's handled.
+	ActivateFunc func(link Link) bool
+	// OpenFileFunc: open a file link, return true if it's handled, i.e: see
+	// SourceViewStruct.GotoFileLine in sourceView/sourceView.go.
+	OpenFileFunc func(filename string, line, column int) bool
+	// ErrorFunc: errors of the default application.
+	ErrorFunc func(err error)
+
+	lines    lineUpdater
+	viewHdls []glib.SignalHandle // View: button-release-event, motion-notify-event
+
+	cursorLink,
+	cursorText *gdk.Cursor
+	onLink bool
+}
+
+var (
+	regLinkURL   = regexp.MustCompile(`(?i)\b(?:(?:https?|ftp|file)://|www\.)[^\s<>"'` + "`" + `\x{FFFC}]+`) // U+FFFC: embedded object
+	regLinkEmail = regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}\b`)
+	regLinkFile  = regexp.MustCompile(`((?:~|\.{1,2})?(?:/[\w.+@-]+)+|[\w.+@-]+(?:/[\w.+@-]+)+|[\w+@-][\w.+@-]*\.[A-Za-z]\w*)(?::(\d+))?(?::(\d+))?`)
+)
+
+// LinkifierNew: the links are tagged with LINKIFY_TAG, use Scan to
+// detect the ones of the current text.
+func LinkifierNew(view *gtk.TextView) (lk *Linkifier, err error) {
+	lk = &Linkifier{
+		View:       view,
+		URLs:       true,
+		Emails:     true,
+		Files:      true,
+		CheckFiles: true,
+		Delay:      LINKIFY_DELAY}
+	if lk.Buff, err = view.GetBuffer(); err != nil {
+		return nil, err
+	}
+	if view.GetEditable() {
+		lk.ActivateMask = gdk.CONTROL_MASK
+	}
+	lk.Tag = gitvtt.TagCreateIfNotExists(lk.Buff, LINKIFY_TAG, map[string]interface{}{
+		"foreground": "#3050FF", "underline": int(pango.UNDERLINE_SINGLE)})
+
+	if display, err := gdk.DisplayGetDefault(); err == nil {
+		lk.cursorLink, _ = gdk.CursorNewFromName(display, "pointer")
+		lk.cursorText, _ = gdk.CursorNewFromName(display, "text")
+	}
+	lk.lines.connect(lk.Buff, func() time.Duration { return lk.Delay }, lk.ScanLines)
+	lk.viewHdls = []glib.SignalHandle{
+		view.Connect("button-release-event", lk.buttonReleased),
+		view.Connect("motion-notify-event", lk.motion)}
+	return
+}
+
+// Detach: stop the detection and remove the links.
+func (lk *Linkifier) Detach() {
+	lk.lines.disconnect()
+	for _, handle := range lk.viewHdls {
+		lk.View.HandlerDisconnect(handle)
+	}
+	lk.viewHdls = nil
+	lk.Buff.RemoveTag(lk.Tag, lk.Buff.GetStartIter(), lk.Buff.GetEndIter())
+}
+
+// Scan: detect the links of the whole buffer.
+func (lk *Linkifier) Scan() {
+	lk.ScanLines(0, lk.Buff.GetLineCount()-1)
+}
+
+// ScanLines: detect the links of the lines, 0 based.
+func (lk *Linkifier) ScanLines(first, last int) {
+	if count := lk.Buff.GetLineCount(); last >= count {
+		last = count - 1
+	}
+	if first < 0 {
+		first = 0
+	}
+	if first > last {
+		return
+	}
+	start, end := lk.Buff.GetIterAtLine(first), lk.Buff.GetIterAtLine(last)
+	if !end.EndsLine() {
+		end.ForwardToLineEnd()
+	}
+	lk.Buff.RemoveTag(lk.Tag, start, end)
+	text := start.GetSlice(end)
+	for idx, line := range strings.Split(text, "\n") {
+		if links := lk.Detect(line); len(links) > 0 {
+			offset := lk.Buff.GetIterAtLine(first + idx).GetOffset()
+			for _, link := range links {
+				lk.Buff.ApplyTag(lk.Tag,
+					lk.Buff.GetIterAtOffset(offset+link.Start),
+					lk.Buff.GetIterAtOffset(offset+link.End))
+			}
+		}
+	}
+}
+
+// LinkAt: link at 'iter', the offsets are the ones of the buffer.
+func (lk *Linkifier) LinkAt(iter *gtk.TextIter) (link Link, ok bool) {
+	if !iter.HasTag(lk.Tag) {
+		return
+	}
+	start, end := lk.Buff.GetIterAtLine(iter.GetLine()), lk.Buff.GetIterAtLine(iter.GetLine())
+	if !end.EndsLine() {
+		end.ForwardToLineEnd()
+	}
+	text := start.GetSlice(end)
+	column := iter.GetLineOffset()
+	for _, link = range lk.Detect(text) {
+		if column >= link.Start && column < link.End {
+			link.Start += start.GetOffset()
+			link.End += start.GetOffset()
+			return link, true
+		}
+	}
+	return Link{}, false
+}
+
+// Activate: ActivateFunc, then OpenFileFunc for the files and finally
+// the default application.
+func (lk *Linkifier) Activate(link Link) {
+	if lk.ActivateFunc != nil && lk.ActivateFunc(link) {
+		return
+	}
+	if link.Kind == LINK_FILE && lk.OpenFileFunc != nil && lk.OpenFileFunc(link.Filename, link.Line, link.Column) {
+		return
+	}
+	if err := OpenURI(link.URI); err != nil && lk.ErrorFunc != nil {
+		lk.ErrorFunc(err)
+	}
+}
+
+// Detect: links of a line of text, the offsets are the ones of the characters.
+func (lk *Linkifier) Detect(line string) (links []Link) {
+	var taken [][2]int // Byte ranges
+	overlaps := func(start, end int) bool {
+		for _, r := range taken {
+			if start < r[1] && end > r[0] {
+				return true
+			}
+		}
+		return false
+	}
+	add := func(link Link, start, end int) {
+		taken = append(taken, [2]int{start, end})
+		link.Text = line[start:end]
+		link.Start = utf8.RuneCountInString(line[:start])
+		link.End = link.Start + utf8.RuneCountInString(link.Text)
+		links = append(links, link)
+	}
+
+	if lk.URLs {
+		for _, m := range regLinkURL.FindAllStringIndex(line, -1) {
+			start, end := m[0], m[0]+len(trimLinkEnd(line[m[0]:m[1]]))
+			uri := line[start:end]
+			if strings.HasPrefix(strings.ToLower(uri), "www.") {
+				uri = "http://" + uri
+			}
+			add(Link{Kind: LINK_URL, URI: uri}, start, end)
+		}
+	}
+	if lk.Emails {
+		for _, m := range regLinkEmail.FindAllStringIndex(line, -1) {
+			if !overlaps(m[0], m[1]) {
+				add(Link{Kind: LINK_EMAIL, URI: "mailto:" + line[m[0]:m[1]]}, m[0], m[1])
+			}
+		}
+	}
+	if lk.Files {
+		for _, m := range regLinkFile.FindAllStringSubmatchIndex(line, -1) {
+			start, end := m[0], m[1]
+			path := line[m[2]:m[3]]
+			if start > 0 && strings.IndexByte(`\/.:@`, line[start-1]) >= 0 {
+				continue // Part of another word
+			}
+			if m[4] < 0 {
+				// No line number, the final dots end the sentence.
+				path = strings.TrimRight(path, ".")
+				end = m[2] + len(path)
+			}
+			if len(path) == 0 || overlaps(start, end) || (m[4] < 0 && !strings.Contains(path, "/")) {
+				continue
+			}
+			filename := lk.filename(path)
+			if lk.CheckFiles {
+				if info, err := os.Stat(filename); err != nil || info.IsDir() {
+					continue
+				}
+			}
+			link := Link{Kind: LINK_FILE, URI: "file://" + filename, Filename: filename}
+			if m[4] >= 0 {
+				link.Line, _ = strconv.Atoi(line[m[4]:m[5]])
+			}
+			if m[6] >= 0 {
+				link.Column, _ = strconv.Atoi(line[m[6]:m[7]])
+			}
+			add(link, start, end)
+		}
+	}
+	return
+}
+
+// filename: absolute name of the path.
+func (lk *Linkifier) filename(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, path[2:])
+		}
+	}
+	if !filepath.IsAbs(path) && len(lk.BaseDir) > 0 {
+		path = filepath.Join(lk.BaseDir, path)
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return path
+}
+
+// trimLinkEnd: remove the punctuation ending the sentence, the closing
+// brackets are kept when they are balanced in the URL.
+func trimLinkEnd(uri string) string {
+	for len(uri) > 0 {
+		c := uri[len(uri)-1]
+		switch {
+		case c == ')' && strings.Count(uri, "(") >= strings.Count(uri, ")"),
+			c == ']' && strings.Count(uri, "[") >= strings.Count(uri, "]"):
+			return uri
+		case strings.IndexByte(".,;:!?'\")]}>", c) >= 0:
+			uri = uri[:len(uri)-1]
+		default:
+			return uri
+		}
+	}
+	return uri
+}
+
+/*
+ * Pointer
+ */
+
+func (lk *Linkifier) iterAtPointer(x, y float64) *gtk.TextIter {
+	bx, by := lk.View.WindowToBufferCoords(gtk.TEXT_WINDOW_WIDGET, int(x), int(y))
+	iter, trailing := lk.View.GetIterAtPosition(bx, by)
+	if trailing == 0 && iter.EndsLine() {
+		return nil
+	}
+	return iter
+}
+
+// buttonReleased: the view is a GtkTextView or a GtkSourceView.
+func (lk *Linkifier) buttonReleased(view interface{}, event *gdk.Event) bool {
+	ev := gdk.EventButtonNewFromEvent(event)
+	if ev.Button() != gdk.BUTTON_PRIMARY || lk.Buff.GetHasSelection() ||
+		gdk.ModifierType(ev.State())&lk.ActivateMask != lk.ActivateMask {
+		return false
+	}
+	if iter := lk.iterAtPointer(ev.X(), ev.Y()); iter != nil {
+		if link, ok := lk.LinkAt(iter); ok {
+			lk.Activate(link)
+			return true
+		}
+	}
+	return false
+}
+
+// motion: the pointer cursor over the links, when the modifiers are pressed.
+func (lk *Linkifier) motion(view interface{}, event *gdk.Event) bool {
+	ev := gdk.EventMotionNewFromEvent(event)
+	onLink := false
+	if ev.State()&lk.ActivateMask == lk.ActivateMask {
+		if iter := lk.iterAtPointer(ev.MotionVal()); iter != nil {
+			onLink = iter.HasTag(lk.Tag)
+		}
+	}
+	if onLink != lk.onLink {
+		lk.onLink = onLink
+		cursor := lk.cursorText
+		if onLink {
+			cursor = lk.cursorLink
+		}
+		if window := lk.View.GetWindow(gtk.TEXT_WINDOW_TEXT); window != nil && cursor != nil {
+			window.SetCursor(cursor)
+		}
+	}
+	return false
+}
@@ -0,0 +1,286 @@
+// client.go
+
+/*
+	Copyright ©2019 H.F.M - TextView Numbered  library "https//github/hfmrow"
+	This program comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+
+	Language Server Protocol client over stdio. The documents are synchronized with their
+	full text. The callbacks are run on the reading goroutine, GTK users have to go through
+	the main loop (glib.IdleAdd), see textView/sourceView/lsp.go.
+*/
+
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// LSP_TIMEOUT: default timeout of the requests.
+const LSP_TIMEOUT = 5 * time.Second
+
+// Client: connection to a language server.
+type Client struct {
+	Conn *Conn
+	// Capabilities: "capabilities" of the initialize result.
+	Capabilities map[string]json.RawMessage
+	Timeout      time.Duration
+
+	// OnDiagnostics: called with all the published diagnostics,
+	// see also WatchDiagnostics.
+	OnDiagnostics func(uri string, diagnostics []Diagnostic)
+	// OnMessage: "window/showMessage" & "window/logMessage",
+	// 'kind' is 1 error, 2 warning, 3 info, 4 log.
+	OnMessage func(kind int, message string)
+
+	cmd      *exec.Cmd
+	stdin    io.Closer
+	mu       sync.Mutex
+	watchers map[string]func(diagnostics []Diagnostic)
+}
+
+// ClientStart: start the server and initialize it with the root directory.
+func ClientStart(rootDir, command string, args ...string) (c *Client, err error) {
+	var stdin io.WriteCloser
+	var stdout io.ReadCloser
+
+	cmd := exec.Command(command, args...)
+	cmd.Dir = rootDir
+	cmd.Stderr = os.Stderr
+	if stdin, err = cmd.StdinPipe(); err != nil {
+		return
+	}
+	if stdout, err = cmd.StdoutPipe(); err != nil {
+		return
+	}
+	if err = cmd.Start(); err != nil {
+		return
+	}
+	c = ClientNew(stdout, stdin)
+	c.cmd, c.stdin = cmd, stdin
+	if err = c.Initialize(rootDir); err != nil {
+		c.Close()
+		c = nil
+	}
+	return
+}
+
+// ClientNew: client over an already established stream, Initialize
+// must be called before any other request.
+func ClientNew(r io.Reader, w io.Writer) (c *Client) {
+	c = &Client{Timeout: LSP_TIMEOUT, watchers: make(map[string]func([]Diagnostic))}
+	c.Conn = ConnNew(r, w, c.handle)
+	return
+}
+
+// Initialize: "initialize" request followed by the "initialized" notification.
+func (c *Client) Initialize(rootDir string) (err error) {
+	var result struct {
+		Capabilities map[string]json.RawMessage `json:"capabilities"`
+	}
+	params := map[string]interface{}{
+		"processId": os.Getpid(),
+		"rootUri":   FileURI(rootDir),
+		"capabilities": map[string]interface{}{
+			"textDocument": map[string]interface{}{
+				"synchronization":    map[string]interface{}{"didSave": true},
+				"publishDiagnostics": map[string]interface{}{},
+				"hover": map[string]interface{}{
+					"contentFormat": []string{"plaintext", "markdown"}},
+				"definition": map[string]interface{}{"linkSupport": true},
+				"completion": map[string]interface{}{
+					"completionItem": map[string]interface{}{"snippetSupport": false}},
+			},
+		},
+	}
+	ctx, cancel := c.context()
+	defer cancel()
+	if err = c.Conn.Call(ctx, "initialize", params, &result); err != nil {
+		return
+	}
+	c.Capabilities = result.Capabilities
+	return c.Conn.Notify("initialized", struct{}{})
+}
+
+// HasCapability: the server capability is set and not false.
+func (c *Client) HasCapability(name string) bool {
+	value, ok := c.Capabilities[name]
+	return ok && string(value) != "false" && string(value) != "null"
+}
+
+// Close: "shutdown" & "exit", then wait for the server process.
+func (c *Client) Close() (err error) {
+	ctx, cancel := c.context()
+	defer cancel()
+	if err = c.Conn.Call(ctx, "shutdown", nil, nil); err == nil {
+		err = c.Conn.Notify("exit", nil)
+	}
+	if c.stdin != nil {
+		c.stdin.Close()
+	}
+	if c.cmd != nil {
+		done := make(chan error, 1)
+		go func() { done <- c.cmd.Wait() }()
+		select {
+		case <-done:
+		case <-time.After(c.Timeout):
+			c.cmd.Process.Kill()
+		}
+	}
+	return
+}
+
+// WatchDiagnostics: call 'fn' with the diagnostics of the document, a nil
+// function removes the watcher.
+func (c *Client) WatchDiagnostics(uri string, fn func(diagnostics []Diagnostic)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if fn == nil {
+		delete(c.watchers, uri)
+		return
+	}
+	c.watchers[uri] = fn
+}
+
+// DidOpen: the document is opened.
+func (c *Client) DidOpen(uri, languageId string, version int, text string) error {
+	return c.Conn.Notify("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{
+			"uri": uri, "languageId": languageId, "version": version, "text": text}})
+}
+
+// DidChange: send the full text of the document.
+func (c *Client) DidChange(uri string, version int, text string) error {
+	return c.Conn.Notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   map[string]interface{}{"uri": uri, "version": version},
+		"contentChanges": []map[string]string{{"text": text}}})
+}
+
+// DidSave: the document has been saved.
+func (c *Client) DidSave(uri string) error {
+	return c.Conn.Notify("textDocument/didSave", map[string]interface{}{
+		"textDocument": textDocumentIdentifier{URI: uri}})
+}
+
+// DidClose: the document is closed.
+func (c *Client) DidClose(uri string) error {
+	return c.Conn.Notify("textDocument/didClose", map[string]interface{}{
+		"textDocument": textDocumentIdentifier{URI: uri}})
+}
+
+// Hover: text of the hover at the position, empty if none. The requests
+// are canceled with the context or after the client timeout.
+func (c *Client) Hover(ctx context.Context, uri string, pos Position) (text string, err error) {
+	var result *hover
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+	if err = c.Conn.Call(ctx, "textDocument/hover", positionParams(uri, pos), &result); err == nil && result != nil {
+		text = markupText(result.Contents)
+	}
+	return
+}
+
+// Definition: locations of the definition of the symbol at the position.
+func (c *Client) Definition(ctx context.Context, uri string, pos Position) (locations []Location, err error) {
+	var raw json.RawMessage
+	var links []locationLink
+	var location Location
+
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+	if err = c.Conn.Call(ctx, "textDocument/definition", positionParams(uri, pos), &raw); err != nil || len(raw) == 0 {
+		return
+	}
+	// Location | []Location | []LocationLink
+	if json.Unmarshal(raw, &location) == nil && len(location.URI) > 0 {
+		return []Location{location}, nil
+	}
+	if err = json.Unmarshal(raw, &links); err != nil {
+		return
+	}
+	for _, link := range links {
+		if len(link.TargetURI) > 0 {
+			locations = append(locations, Location{URI: link.TargetURI, Range: link.TargetSelectionRange})
+		}
+	}
+	if len(locations) == 0 {
+		err = json.Unmarshal(raw, &locations)
+	}
+	return
+}
+
+// Completion: completion items at the position, 'incomplete' means that
+// the list should be requested again while typing.
+func (c *Client) Completion(ctx context.Context, uri string, pos Position) (items []CompletionItem, incomplete bool, err error) {
+	var raw json.RawMessage
+	var list completionList
+
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+	if err = c.Conn.Call(ctx, "textDocument/completion", positionParams(uri, pos), &raw); err != nil || len(raw) == 0 {
+		return
+	}
+	// CompletionList | []CompletionItem
+	if err = json.Unmarshal(raw, &items); err != nil {
+		if err = json.Unmarshal(raw, &list); err == nil {
+			items, incomplete = list.Items, list.IsIncomplete
+		}
+	}
+	return
+}
+
+// context: request context with the client timeout.
+func (c *Client) context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), c.Timeout)
+}
+
+// handle: notifications and requests of the server.
+func (c *Client) handle(method string, params json.RawMessage) (result interface{}, err error) {
+	switch method {
+	case "textDocument/publishDiagnostics":
+		var p publishDiagnosticsParams
+		if err = json.Unmarshal(params, &p); err != nil {
+			return
+		}
+		if c.OnDiagnostics != nil {
+			c.OnDiagnostics(p.URI, p.Diagnostics)
+		}
+		c.mu.Lock()
+		fn := c.watchers[p.URI]
+		c.mu.Unlock()
+		if fn != nil {
+			fn(p.Diagnostics)
+		}
+	case "window/showMessage", "window/logMessage":
+		var p struct {
+			Type    int    `json:"type"`
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(params, &p) == nil && c.OnMessage != nil {
+			c.OnMessage(p.Type, p.Message)
+		}
+	case "window/workDoneProgress/create", "client/registerCapability",
+		"client/unregisterCapability", "workspace/configuration":
+		// Accepted, nothing to configure.
+		if method == "workspace/configuration" {
+			var p struct {
+				Items []json.RawMessage `json:"items"`
+			}
+			json.Unmarshal(params, &p)
+			result = make([]interface{}, len(p.Items))
+		}
+	default:
+		err = &ResponseError{Code: ERR_METHOD_NOT_FOUND, Message: "method not found: " + method}
+	}
+	return
+}
+
+func positionParams(uri string, pos Position) textDocumentPositionParams {
+	return textDocumentPositionParams{TextDocument: textDocumentIdentifier{URI: uri}, Position: pos}
+}
@@ -0,0 +1,259 @@
+// client_test.go
+
+/*
+	Copyright ©2019 H.F.M - TextView Numbered  library "https//github/hfmrow"
+	This program comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+*/
+
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// LSP_TEST_SERVER: set in the environment of the test binary started by
+// TestClientStart, it runs the server. "hang": the server doesn't stop on
+// "exit".
+const LSP_TEST_SERVER = "LSP_TEST_SERVER"
+
+func TestMain(m *testing.M) {
+	if mode := os.Getenv(LSP_TEST_SERVER); len(mode) > 0 {
+		serverProcess(mode)
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// serverProcess: language server over stdio, the hover gives the
+// working directory.
+func serverProcess(mode string) {
+	exit := make(chan struct{})
+	conn := ConnNew(os.Stdin, os.Stdout, func(method string, params json.RawMessage) (interface{}, error) {
+		switch method {
+		case "initialize":
+			return json.RawMessage(`{"capabilities":{"hoverProvider":true}}`), nil
+		case "textDocument/hover":
+			dir, err := os.Getwd()
+			return map[string]string{"contents": dir}, err
+		case "exit":
+			close(exit)
+		}
+		return nil, nil
+	})
+	select {
+	case <-exit:
+	case <-conn.Done():
+	}
+	if mode == "hang" {
+		time.Sleep(time.Minute)
+	}
+}
+
+// testServer: the client is connected to a Conn that replies with the
+// raw JSON results, by method. The received messages are sent to 'received'.
+func testServer(t *testing.T, results map[string]string) (c *Client, server *Conn, received chan string, closeAll func()) {
+	clientR, serverW := io.Pipe()
+	serverR, clientW := io.Pipe()
+	received = make(chan string, 16)
+	c = ClientNew(clientR, clientW)
+	server = ConnNew(serverR, serverW, func(method string, params json.RawMessage) (interface{}, error) {
+		received <- method + " " + string(params)
+		if result, ok := results[method]; ok {
+			return json.RawMessage(result), nil
+		}
+		return nil, nil
+	})
+	return c, server, received, func() {
+		serverW.Close()
+		clientW.Close()
+	}
+}
+
+func TestClientInitialize(t *testing.T) {
+	c, _, received, closeAll := testServer(t, map[string]string{
+		"initialize": `{"capabilities":{"hoverProvider":true,"definitionProvider":false,"completionProvider":{}}}`})
+	defer closeAll()
+
+	if err := c.Initialize("/tmp"); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	var params struct {
+		RootURI string `json:"rootUri"`
+	}
+	for _, method := range []string{"initialize", "initialized"} {
+		select {
+		case msg := <-received:
+			if got := msg[:len(method)]; got != method {
+				t.Errorf("got %s, want %s", msg, method)
+			} else if method == "initialize" {
+				json.Unmarshal([]byte(msg[len(method)+1:]), &params)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s not received", method)
+		}
+	}
+	if params.RootURI != "file:///tmp" {
+		t.Errorf("rootUri: got %q", params.RootURI)
+	}
+	for name, want := range map[string]bool{
+		"hoverProvider": true, "definitionProvider": false, "completionProvider": true, "renameProvider": false} {
+		if got := c.HasCapability(name); got != want {
+			t.Errorf("HasCapability(%s): got %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestClientDiagnostics(t *testing.T) {
+	c, server, _, closeAll := testServer(t, nil)
+	defer closeAll()
+
+	all := make(chan string, 2)
+	watched := make(chan []Diagnostic, 2)
+	c.OnDiagnostics = func(uri string, diagnostics []Diagnostic) { all <- uri }
+	c.WatchDiagnostics("file:///a.go", func(diagnostics []Diagnostic) { watched <- diagnostics })
+
+	server.Notify("textDocument/publishDiagnostics", json.RawMessage(`{"uri":"file:///b.go","diagnostics":[]}`))
+	server.Notify("textDocument/publishDiagnostics", json.RawMessage(`{"uri":"file:///a.go","diagnostics":[
+		{"range":{"start":{"line":1,"character":2},"end":{"line":1,"character":4}},"severity":2,"message":"unused"}]}`))
+	for _, want := range []string{"file:///b.go", "file:///a.go"} {
+		select {
+		case got := <-all:
+			if got != want {
+				t.Errorf("OnDiagnostics: got %s, want %s", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("OnDiagnostics: %s not received", want)
+		}
+	}
+	select {
+	case got := <-watched:
+		want := []Diagnostic{{Range: Range{Start: Position{1, 2}, End: Position{1, 4}},
+			Severity: SEVERITY_WARNING, Message: "unused"}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("watcher: got %+v, want %+v", got, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("watcher not called")
+	}
+	if len(watched) > 0 {
+		t.Error("watcher called for another document")
+	}
+}
+
+func TestClientRequests(t *testing.T) {
+	location := `{"uri":"file:///a.go","range":{"start":{"line":3,"character":1},"end":{"line":3,"character":5}}}`
+	want := []Location{{URI: "file:///a.go", Range: Range{Start: Position{3, 1}, End: Position{3, 5}}}}
+
+	for _, result := range []string{
+		location,
+		"[" + location + "]",
+		`[{"targetUri":"file:///a.go","targetRange":{"start":{"line":0,"character":0},"end":{"line":9,"character":0}},
+			"targetSelectionRange":{"start":{"line":3,"character":1},"end":{"line":3,"character":5}}}]`,
+	} {
+		c, _, received, closeAll := testServer(t, map[string]string{"textDocument/definition": result})
+		got, err := c.Definition(context.Background(), "file:///b.go", Position{Line: 7, Character: 4})
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("Definition(%s): got %+v, %v", result, got, err)
+		}
+		if msg, wantMsg := <-received, `textDocument/definition {"textDocument":{"uri":"file:///b.go"},"position":{"line":7,"character":4}}`; msg != wantMsg {
+			t.Errorf("Definition: sent %s, want %s", msg, wantMsg)
+		}
+		closeAll()
+	}
+
+	for result, wantHover := range map[string]string{
+		`null`:                "",
+		`{"contents":"text"}`: "text",
+		`{"contents":{"kind":"markdown","value":"*md*"}}`:  "*md*",
+		`{"contents":["a",{"language":"go","value":"b"}]}`: "a\n\nb",
+	} {
+		c, _, _, closeAll := testServer(t, map[string]string{"textDocument/hover": result})
+		if got, err := c.Hover(context.Background(), "file:///a.go", Position{}); err != nil || got != wantHover {
+			t.Errorf("Hover(%s): got %q, %v, want %q", result, got, err, wantHover)
+		}
+		closeAll()
+	}
+
+	for result, wantIncomplete := range map[string]bool{
+		`[{"label":"a"},{"label":"b"}]`:                               false,
+		`{"isIncomplete":true,"items":[{"label":"a"},{"label":"b"}]}`: true,
+	} {
+		c, _, _, closeAll := testServer(t, map[string]string{"textDocument/completion": result})
+		items, incomplete, err := c.Completion(context.Background(), "file:///a.go", Position{})
+		if err != nil || len(items) != 2 || items[0].Label != "a" || items[1].Label != "b" || incomplete != wantIncomplete {
+			t.Errorf("Completion(%s): got %+v, %v, %v", result, items, incomplete, err)
+		}
+		closeAll()
+	}
+}
+
+func TestClientClose(t *testing.T) {
+	c, server, received, closeAll := testServer(t, nil)
+	defer closeAll()
+
+	// Requests of the server.
+	var config []interface{}
+	if err := server.Call(context.Background(), "workspace/configuration",
+		json.RawMessage(`{"items":[{"section":"a"},{"section":"b"}]}`), &config); err != nil || len(config) != 2 {
+		t.Errorf("workspace/configuration: got %v, %v", config, err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	for _, want := range []string{"shutdown ", "exit "} {
+		select {
+		case got := <-received:
+			if got != want {
+				t.Errorf("Close: got %s, want %s", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Close: %s not received", want)
+		}
+	}
+}
+
+func TestClientStart(t *testing.T) {
+	// The server of the "exit" mode must not be killed, the binaries
+	// built with -race wait 1s before exiting.
+	for mode, timeout := range map[string]time.Duration{"exit": 3 * time.Second, "hang": 500 * time.Millisecond} {
+		os.Setenv(LSP_TEST_SERVER, mode)
+		rootDir, _ := filepath.EvalSymlinks(t.TempDir())
+		c, err := ClientStart(rootDir, os.Args[0], "-test.run=^$")
+		os.Unsetenv(LSP_TEST_SERVER)
+		if err != nil {
+			t.Fatalf("ClientStart(%s): %v", mode, err)
+		}
+		if !c.HasCapability("hoverProvider") {
+			t.Errorf("ClientStart(%s): capabilities: %v", mode, c.Capabilities)
+		}
+		if dir, err := c.Hover(context.Background(), FileURI(rootDir), Position{}); err != nil || dir != rootDir {
+			t.Errorf("ClientStart(%s): working directory: got %q, %v, want %q", mode, dir, err, rootDir)
+		}
+
+		c.Timeout = timeout
+		start := time.Now()
+		if err = c.Close(); err != nil {
+			t.Errorf("Close(%s): %v", mode, err)
+		}
+		elapsed := time.Since(start)
+		switch {
+		case mode == "exit" && elapsed >= c.Timeout:
+			t.Errorf("Close(%s): the server has been killed", mode)
+		case mode == "hang" && (elapsed < c.Timeout || elapsed > 5*c.Timeout):
+			t.Errorf("Close(%s): %v, the server should be killed after %v", mode, elapsed, c.Timeout)
+		}
+		select {
+		case <-c.Conn.Done():
+		case <-time.After(time.Second):
+			t.Errorf("Close(%s): the connection is still open", mode)
+		}
+	}
+}
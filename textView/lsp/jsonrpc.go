@@ -0,0 +1,266 @@
+// jsonrpc.go
+
+/*
+	Copyright ©2019 H.F.M - TextView Numbered  library "https//github/hfmrow"
+	This program comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+
+	JSON-RPC 2.0 connection with the LSP base protocol framing ("Content-Length" headers).
+	Calls may be made from any goroutine, the messages are read on a dedicated one.
+*/
+
+package lsp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"sync"
+)
+
+// JSON-RPC error codes
+const (
+	ERR_PARSE            = -32700
+	ERR_INVALID_REQUEST  = -32600
+	ERR_METHOD_NOT_FOUND = -32601
+	ERR_INVALID_PARAMS   = -32602
+	ERR_INTERNAL         = -32603
+	ERR_REQUEST_CANCELED = -32800
+)
+
+// LSP_MAX_MESSAGE: size limit of the received messages.
+const LSP_MAX_MESSAGE = 64 << 20
+
+// ErrClosed: the connection has been closed.
+var ErrClosed = errors.New("lsp: connection closed")
+
+// ResponseError: error returned by the server.
+type ResponseError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("lsp: %s (%d)", e.Message, e.Code)
+}
+
+// Handler: called with the notifications of the server on the reading
+// goroutine, in order, and with its requests on a new goroutine. The result
+// is the reply to a request, it's ignored for a notification.
+type Handler func(method string, params json.RawMessage) (result interface{}, err error)
+
+// message: any incoming message.
+type message struct {
+	ID     *json.RawMessage `json:"id"`
+	Method string           `json:"method"`
+	Params json.RawMessage  `json:"params"`
+	Result json.RawMessage  `json:"result"`
+	Error  *ResponseError   `json:"error"`
+}
+
+type request struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      int64       `json:"id"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+type notification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result"`
+}
+
+type errorResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Error   *ResponseError  `json:"error"`
+}
+
+// Conn: JSON-RPC connection.
+type Conn struct {
+	Handler Handler
+
+	r *bufio.Reader
+	w io.Writer
+
+	wMu     sync.Mutex
+	mu      sync.Mutex
+	seq     int64
+	pending map[int64]chan *message
+	err     error
+	done    chan struct{}
+}
+
+// ConnNew: start reading the messages.
+func ConnNew(r io.Reader, w io.Writer, handler Handler) *Conn {
+	c := &Conn{
+		Handler: handler,
+		r:       bufio.NewReader(r),
+		w:       w,
+		pending: make(map[int64]chan *message),
+		done:    make(chan struct{})}
+	go c.readLoop()
+	return c
+}
+
+// Done: closed when the reading stops, Err gives the reason.
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err: error that stopped the reading, ErrClosed at the end of the stream.
+func (c *Conn) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Call: send a request and wait for the response, a nil 'result'
+// discards it. The request is canceled with the context.
+func (c *Conn) Call(ctx context.Context, method string, params, result interface{}) (err error) {
+	c.mu.Lock()
+	if c.err != nil {
+		err = c.err
+		c.mu.Unlock()
+		return
+	}
+	c.seq++
+	id := c.seq
+	ch := make(chan *message, 1)
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	if err = c.write(&request{JSONRPC: "2.0", ID: id, Method: method, Params: params}); err != nil {
+		return
+	}
+	select {
+	case msg := <-ch:
+		if msg.Error != nil {
+			return msg.Error
+		}
+		if result != nil && len(msg.Result) > 0 && string(msg.Result) != "null" {
+			err = json.Unmarshal(msg.Result, result)
+		}
+	case <-ctx.Done():
+		c.Notify("$/cancelRequest", map[string]int64{"id": id})
+		err = ctx.Err()
+	case <-c.done:
+		err = c.Err()
+	}
+	return
+}
+
+// Notify: send a notification.
+func (c *Conn) Notify(method string, params interface{}) error {
+	return c.write(&notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// write: send a message with its header.
+func (c *Conn) write(msg interface{}) (err error) {
+	var data []byte
+	if data, err = json.Marshal(msg); err != nil {
+		return
+	}
+	c.wMu.Lock()
+	defer c.wMu.Unlock()
+	if _, err = fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n", len(data)); err == nil {
+		_, err = c.w.Write(data)
+	}
+	return
+}
+
+// read: read a message.
+func (c *Conn) read() (msg *message, err error) {
+	var header textproto.MIMEHeader
+	var length int
+
+	if header, err = textproto.NewReader(c.r).ReadMIMEHeader(); err != nil {
+		return
+	}
+	if length, err = strconv.Atoi(header.Get("Content-Length")); err != nil || length < 0 {
+		return nil, fmt.Errorf("lsp: invalid Content-Length: %q", header.Get("Content-Length"))
+	}
+	if length > LSP_MAX_MESSAGE {
+		return nil, fmt.Errorf("lsp: message too large: %d bytes", length)
+	}
+	data := make([]byte, length)
+	if _, err = io.ReadFull(c.r, data); err != nil {
+		return
+	}
+	msg = new(message)
+	err = json.Unmarshal(data, msg)
+	return
+}
+
+// readLoop: dispatch the responses, notifications and requests.
+func (c *Conn) readLoop() {
+	var err error
+	var msg *message
+
+	for {
+		if msg, err = c.read(); err != nil {
+			break
+		}
+		switch {
+		case len(msg.Method) == 0 && msg.ID != nil: // Response
+			var id int64
+			if json.Unmarshal(*msg.ID, &id) == nil {
+				c.mu.Lock()
+				ch, ok := c.pending[id]
+				c.mu.Unlock()
+				if ok {
+					ch <- msg
+				}
+			}
+		case msg.ID != nil: // Request, the reply must not block the reading.
+			go c.reply(*msg.ID, msg.Method, msg.Params)
+		case c.Handler != nil: // Notification
+			c.Handler(msg.Method, msg.Params)
+		}
+	}
+
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = ErrClosed
+	}
+	c.mu.Lock()
+	c.err = err
+	c.mu.Unlock()
+	close(c.done)
+}
+
+// reply: answer a request of the server.
+func (c *Conn) reply(id json.RawMessage, method string, params json.RawMessage) {
+	var result interface{}
+	err := error(&ResponseError{Code: ERR_METHOD_NOT_FOUND, Message: "method not found: " + method})
+	if c.Handler != nil {
+		result, err = c.Handler(method, params)
+	}
+	if err != nil {
+		respErr, ok := err.(*ResponseError)
+		if !ok {
+			respErr = &ResponseError{Code: ERR_INTERNAL, Message: err.Error()}
+		}
+		c.write(&errorResponse{JSONRPC: "2.0", ID: id, Error: respErr})
+		return
+	}
+	c.write(&response{JSONRPC: "2.0", ID: id, Result: result})
+}
@@ -0,0 +1,254 @@
+// jsonrpc_test.go
+
+/*
+	Copyright ©2019 H.F.M - TextView Numbered  library "https//github/hfmrow"
+	This program comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+*/
+
+package lsp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// pipeConns: two connections linked by pipes, 'client' calls the
+// 'server' handler and the other way around.
+func pipeConns(clientHandler, serverHandler Handler) (client, server *Conn, closeAll func()) {
+	clientR, serverW := io.Pipe()
+	serverR, clientW := io.Pipe()
+	client = ConnNew(clientR, clientW, clientHandler)
+	server = ConnNew(serverR, serverW, serverHandler)
+	return client, server, func() {
+		serverW.Close()
+		clientW.Close()
+	}
+}
+
+// readFrame: read a message written by a Conn, check its header.
+func readFrame(t *testing.T, r *bufio.Reader) (msg map[string]interface{}) {
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		t.Fatalf("header: %v", err)
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		t.Fatalf("Content-Length: %q", header.Get("Content-Length"))
+	}
+	data := make([]byte, length)
+	if _, err = io.ReadFull(r, data); err != nil {
+		t.Fatalf("body: %v", err)
+	}
+	if err = json.Unmarshal(data, &msg); err != nil {
+		t.Fatalf("body %q: %v", data, err)
+	}
+	return
+}
+
+func TestConnFraming(t *testing.T) {
+	clientR, serverW := io.Pipe()
+	serverR, clientW := io.Pipe()
+	defer serverW.Close()
+
+	params := make(chan string, 1)
+	conn := ConnNew(clientR, clientW, func(method string, p json.RawMessage) (interface{}, error) {
+		params <- method + " " + string(p)
+		return nil, nil
+	})
+	go conn.Notify("test/out", map[string]string{"text": "é€𝄞"})
+	msg := readFrame(t, bufio.NewReader(serverR))
+	if msg["jsonrpc"] != "2.0" || msg["method"] != "test/out" || msg["id"] != nil {
+		t.Errorf("notification: got %v", msg)
+	}
+	if p, _ := msg["params"].(map[string]interface{}); p["text"] != "é€𝄞" {
+		t.Errorf("notification params: got %v", msg["params"])
+	}
+
+	// The length is in bytes, other headers are allowed, two messages
+	// in the same write.
+	body := `{"jsonrpc":"2.0","method":"test/in","params":"é€𝄞"}`
+	frame := fmt.Sprintf("Content-Length: %d\r\nContent-Type: application/vscode-jsonrpc; charset=utf-8\r\n\r\n%s", len(body), body)
+	go serverW.Write([]byte(frame + frame))
+	for i := 0; i < 2; i++ {
+		select {
+		case got := <-params:
+			if want := `test/in "é€𝄞"`; got != want {
+				t.Errorf("received: got %s, want %s", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("notification not received")
+		}
+	}
+}
+
+func TestConnBadHeader(t *testing.T) {
+	for _, header := range []string{
+		"Content-Length: x",
+		"Content-Length: -1",
+		fmt.Sprintf("Content-Length: %d", LSP_MAX_MESSAGE+1),
+		"Content-Type: application/vscode-jsonrpc",
+	} {
+		clientR, serverW := io.Pipe()
+		_, clientW := io.Pipe()
+		conn := ConnNew(clientR, clientW, nil)
+		go serverW.Write([]byte(header + "\r\n\r\n{}"))
+		select {
+		case <-conn.Done():
+			if conn.Err() == nil || conn.Err() == ErrClosed {
+				t.Errorf("%s: got %v", header, conn.Err())
+			}
+		case <-time.After(time.Second):
+			t.Errorf("%s: accepted", header)
+		}
+		serverW.Close()
+	}
+}
+
+func TestConnCall(t *testing.T) {
+	client, _, closeAll := pipeConns(nil, func(method string, params json.RawMessage) (interface{}, error) {
+		var n int
+		json.Unmarshal(params, &n)
+		switch method {
+		case "double":
+			// Replied in reverse order.
+			time.Sleep(time.Duration(10-n) * 5 * time.Millisecond)
+			return n * 2, nil
+		case "fail":
+			return nil, &ResponseError{Code: ERR_INVALID_PARAMS, Message: "invalid"}
+		case "panic":
+			return nil, errors.New("internal")
+		}
+		return nil, &ResponseError{Code: ERR_METHOD_NOT_FOUND, Message: "method not found: " + method}
+	})
+	defer closeAll()
+
+	var wg sync.WaitGroup
+	for n := 0; n < 10; n++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			var result int
+			if err := client.Call(context.Background(), "double", n, &result); err != nil || result != n*2 {
+				t.Errorf("Call(double, %d): got %d, %v", n, result, err)
+			}
+		}(n)
+	}
+	wg.Wait()
+
+	for _, test := range []struct {
+		method string
+		code   int
+	}{
+		{"fail", ERR_INVALID_PARAMS},
+		{"panic", ERR_INTERNAL},
+		{"unknown", ERR_METHOD_NOT_FOUND},
+	} {
+		err := client.Call(context.Background(), test.method, nil, nil)
+		if respErr, ok := err.(*ResponseError); !ok || respErr.Code != test.code {
+			t.Errorf("Call(%s): got %v, want code %d", test.method, err, test.code)
+		}
+	}
+	if err := client.Call(context.Background(), "double", 1, nil); err != nil {
+		t.Errorf("Call with nil result: %v", err)
+	}
+}
+
+func TestConnNotifications(t *testing.T) {
+	var received []string
+	done := make(chan struct{})
+	client, server, closeAll := pipeConns(func(method string, params json.RawMessage) (interface{}, error) {
+		if received = append(received, method+" "+string(params)); len(received) == 3 {
+			close(done)
+		}
+		return nil, nil
+	}, nil)
+	defer closeAll()
+
+	for n := 1; n <= 3; n++ {
+		server.Notify(fmt.Sprintf("test/%d", n), n)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("notifications: got %v", received)
+	}
+	for idx, got := range received {
+		if want := fmt.Sprintf("test/%d %d", idx+1, idx+1); got != want {
+			t.Errorf("notification %d: got %q, want %q", idx, got, want)
+		}
+	}
+	// Without handler, the requests of the other side get an error.
+	err := client.Call(context.Background(), "test/request", nil, nil)
+	if respErr, ok := err.(*ResponseError); !ok || respErr.Code != ERR_METHOD_NOT_FOUND {
+		t.Errorf("request without handler: got %v", err)
+	}
+}
+
+func TestConnCancel(t *testing.T) {
+	canceled := make(chan string, 1)
+	release := make(chan struct{})
+	client, _, closeAll := pipeConns(nil, func(method string, params json.RawMessage) (interface{}, error) {
+		switch method {
+		case "$/cancelRequest":
+			canceled <- string(params)
+		case "wait":
+			<-release
+		}
+		return nil, nil
+	})
+	defer closeAll()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := client.Call(ctx, "wait", nil, nil); err != context.DeadlineExceeded {
+		t.Errorf("Call: got %v, want %v", err, context.DeadlineExceeded)
+	}
+	select {
+	case got := <-canceled:
+		if want := `{"id":1}`; got != want {
+			t.Errorf("$/cancelRequest: got %s, want %s", got, want)
+		}
+	case <-time.After(time.Second):
+		t.Error("$/cancelRequest not sent")
+	}
+}
+
+func TestConnClosed(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	client, _, closeAll := pipeConns(nil, func(method string, params json.RawMessage) (interface{}, error) {
+		<-release
+		return nil, nil
+	})
+	result := make(chan error, 1)
+	go func() { result <- client.Call(context.Background(), "wait", nil, nil) }()
+	time.Sleep(20 * time.Millisecond)
+	closeAll()
+
+	select {
+	case err := <-result:
+		if err != ErrClosed {
+			t.Errorf("pending Call: got %v, want %v", err, ErrClosed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("pending Call not ended")
+	}
+	<-client.Done()
+	if err := client.Err(); err != ErrClosed {
+		t.Errorf("Err: got %v, want %v", err, ErrClosed)
+	}
+	if err := client.Call(context.Background(), "after", nil, nil); err != ErrClosed {
+		t.Errorf("Call after close: got %v, want %v", err, ErrClosed)
+	}
+}
@@ -0,0 +1,213 @@
+// protocol.go
+
+/*
+	Copyright ©2019 H.F.M - TextView Numbered  library "https//github/hfmrow"
+	This program comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+
+	Language Server Protocol structures, only the parts used by the client. Positions are
+	0 based, 'Character' is counted in UTF-16 code units as required by the protocol, see
+	UTF16Column and RuneColumn for the conversions.
+*/
+
+package lsp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+)
+
+// Position: 0 based line and UTF-16 column.
+type Position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+// Range:
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+// Location:
+type Location struct {
+	URI   string `json:"uri"`
+	Range Range  `json:"range"`
+}
+
+// locationLink: alternative result of "textDocument/definition".
+type locationLink struct {
+	TargetURI            string `json:"targetUri"`
+	TargetRange          Range  `json:"targetRange"`
+	TargetSelectionRange Range  `json:"targetSelectionRange"`
+}
+
+// DiagnosticSeverity:
+type DiagnosticSeverity int
+
+const (
+	SEVERITY_ERROR DiagnosticSeverity = iota + 1
+	SEVERITY_WARNING
+	SEVERITY_INFORMATION
+	SEVERITY_HINT
+)
+
+func (s DiagnosticSeverity) String() string {
+	switch s {
+	case SEVERITY_ERROR:
+		return "error"
+	case SEVERITY_WARNING:
+		return "warning"
+	case SEVERITY_INFORMATION:
+		return "information"
+	case SEVERITY_HINT:
+		return "hint"
+	}
+	return fmt.Sprintf("DiagnosticSeverity(%d)", int(s))
+}
+
+// Diagnostic: a missing severity is to be taken as an error.
+type Diagnostic struct {
+	Range    Range              `json:"range"`
+	Severity DiagnosticSeverity `json:"severity,omitempty"`
+	Code     interface{}        `json:"code,omitempty"` // number or string
+	Source   string             `json:"source,omitempty"`
+	Message  string             `json:"message"`
+}
+
+type publishDiagnosticsParams struct {
+	URI         string       `json:"uri"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+// TextEdit:
+type TextEdit struct {
+	Range   Range  `json:"range"`
+	NewText string `json:"newText"`
+}
+
+// InsertTextFormat
+const (
+	INSERT_TEXT_PLAIN   = 1
+	INSERT_TEXT_SNIPPET = 2
+)
+
+// CompletionItem:
+type CompletionItem struct {
+	Label            string          `json:"label"`
+	Kind             int             `json:"kind,omitempty"`
+	Detail           string          `json:"detail,omitempty"`
+	Documentation    json.RawMessage `json:"documentation,omitempty"`
+	SortText         string          `json:"sortText,omitempty"`
+	FilterText       string          `json:"filterText,omitempty"`
+	InsertText       string          `json:"insertText,omitempty"`
+	InsertTextFormat int             `json:"insertTextFormat,omitempty"`
+	TextEdit         *TextEdit       `json:"textEdit,omitempty"`
+}
+
+// Doc: documentation as plain text.
+func (item *CompletionItem) Doc() string {
+	return markupText(item.Documentation)
+}
+
+type completionList struct {
+	IsIncomplete bool             `json:"isIncomplete"`
+	Items        []CompletionItem `json:"items"`
+}
+
+var completionKinds = []string{"", "text", "method", "function", "constructor", "field",
+	"variable", "class", "interface", "module", "property", "unit", "value", "enum",
+	"keyword", "snippet", "color", "file", "reference", "folder", "enum member",
+	"constant", "struct", "event", "operator", "type parameter"}
+
+// CompletionKindName: name of a CompletionItemKind.
+func CompletionKindName(kind int) string {
+	if kind > 0 && kind < len(completionKinds) {
+		return completionKinds[kind]
+	}
+	return ""
+}
+
+type textDocumentIdentifier struct {
+	URI string `json:"uri"`
+}
+
+type textDocumentPositionParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+	Position     Position               `json:"position"`
+}
+
+type hover struct {
+	Contents json.RawMessage `json:"contents"`
+}
+
+// markupText: text of a MarkupContent, a MarkedString or
+// a list of MarkedString.
+func markupText(raw json.RawMessage) string {
+	var text string
+	var content struct {
+		Value string `json:"value"`
+	}
+	var list []json.RawMessage
+
+	switch {
+	case len(raw) == 0:
+	case json.Unmarshal(raw, &text) == nil:
+		return text
+	case json.Unmarshal(raw, &list) == nil:
+		parts := make([]string, 0, len(list))
+		for _, item := range list {
+			if part := markupText(item); len(part) > 0 {
+				parts = append(parts, part)
+			}
+		}
+		return strings.Join(parts, "\n\n")
+	case json.Unmarshal(raw, &content) == nil:
+		return content.Value
+	}
+	return ""
+}
+
+// FileURI: "file://" URI of a path.
+func FileURI(filename string) string {
+	if abs, err := filepath.Abs(filename); err == nil {
+		filename = abs
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(filename)}).String()
+}
+
+// URIToPath: path of a "file://" URI.
+func URIToPath(uri string) (filename string, err error) {
+	var u *url.URL
+	if u, err = url.Parse(uri); err != nil {
+		return
+	}
+	if u.Scheme != "file" {
+		return "", fmt.Errorf("lsp: not a file URI: %s", uri)
+	}
+	return filepath.FromSlash(u.Path), nil
+}
+
+// UTF16Column: length of the text in UTF-16 code units.
+func UTF16Column(text string) (col int) {
+	for _, r := range text {
+		col += len(utf16.Encode([]rune{r}))
+	}
+	return
+}
+
+// RuneColumn: convert an UTF-16 column of the line to a column
+// in characters, clamped to the line length.
+func RuneColumn(line string, character int) (col int) {
+	for _, r := range line {
+		if character -= len(utf16.Encode([]rune{r})); character < 0 {
+			break
+		}
+		col++
+	}
+	return
+}
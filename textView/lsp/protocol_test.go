@@ -0,0 +1,76 @@
+// protocol_test.go
+
+/*
+	Copyright ©2019 H.F.M - TextView Numbered  library "https//github/hfmrow"
+	This program comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+*/
+
+package lsp
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestUTF16Column(t *testing.T) {
+	for _, test := range []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"abc", 3},
+		{"é€", 2},
+		{"a€𝄞", 4},
+		{"𝄞𝄞", 4},
+	} {
+		if got := UTF16Column(test.text); got != test.want {
+			t.Errorf("UTF16Column(%q): got %d, want %d", test.text, got, test.want)
+		}
+	}
+}
+
+func TestRuneColumn(t *testing.T) {
+	for _, test := range []struct {
+		line      string
+		character int
+		want      int
+	}{
+		{"abc", 0, 0},
+		{"abc", 2, 2},
+		{"a𝄞b", 1, 1},
+		{"a𝄞b", 3, 2},
+		{"a𝄞b", 4, 3},
+		// Inside the surrogate pair, before the character.
+		{"a𝄞b", 2, 1},
+		// Clamped to the line length.
+		{"a𝄞b", 10, 3},
+		{"", 1, 0},
+	} {
+		if got := RuneColumn(test.line, test.character); got != test.want {
+			t.Errorf("RuneColumn(%q, %d): got %d, want %d", test.line, test.character, got, test.want)
+		}
+	}
+	// Round trip.
+	line := "é€𝄞x"
+	for col, r := 0, []rune(line); col <= len(r); col++ {
+		if got := RuneColumn(line, UTF16Column(string(r[:col]))); got != col {
+			t.Errorf("RuneColumn(UTF16Column(%q)): got %d, want %d", string(r[:col]), got, col)
+		}
+	}
+}
+
+func TestFileURI(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix paths")
+	}
+	for _, filename := range []string{"/tmp/a.go", "/tmp/dir with space/é#.go"} {
+		uri := FileURI(filename)
+		if got, err := URIToPath(uri); err != nil || got != filename {
+			t.Errorf("URIToPath(%s): got %q, %v, want %q", uri, got, err, filename)
+		}
+	}
+	if _, err := URIToPath("http://host/a.go"); err == nil {
+		t.Error("URIToPath: no error for a http URI")
+	}
+}
@@ -0,0 +1,590 @@
+// markdown.go
+
+/*
+	This software use gotk3 that is licensed under the ISC License:
+	https://github.com/gotk3/gotk3/blob/master/LICENSE
+
+	Copyright ©2019 H.F.M - TextView Numbered  library "https//github/hfmrow"
+	This program comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+
+	Markdown rendering into a GtkTextBuffer. The tags are defined by a textTag style sheet
+	(MARKDOWN_STYLE_SHEET) that can be overridden by the user one, the fenced code blocks
+	are highlighted with chromaHighlight, the images are loaded with pixbuff.GetPixBuf and
+	the tables use a simple monospace layout. When a TextView is given, the links are
+	activated with a click: LinkFunc first, then the "#anchor" of the headings and finally
+	the default application (textView.OpenURI). The buffer is a display, it's not meant
+	to be edited.
+
+Usage:
+	md, err := RendererNew(textView.GetBuffer(), textView)
+	textView.SetEditable(false)
+	textView.SetWrapMode(gtk.WRAP_WORD)
+	md.ImageMaxWidth = 600
+	err = md.RenderFile("CHANGELOG.md")
+*/
+
+package markdown
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/gtk"
+
+	gipf "github.com/hfmrow/gtk3_import/pixbuff"
+	gitv "github.com/hfmrow/gtk3_import/textView"
+	gitvch "github.com/hfmrow/gtk3_import/textView/chromaHighlight"
+	gitvtt "github.com/hfmrow/gtk3_import/textView/textTag"
+
+	"github.com/hfmrow/gotk3_gtksource/source"
+)
+
+const (
+	// MARKDOWN_INDENT: left margin of each level of list or quote, in pixels.
+	MARKDOWN_INDENT = 24
+	// MARKDOWN_RULE_WIDTH: length of the thematic breaks, in characters.
+	MARKDOWN_RULE_WIDTH = 40
+	// MARKDOWN_CODE_STYLE: default Chroma style of the code blocks.
+	MARKDOWN_CODE_STYLE = "pygments"
+)
+
+// MARKDOWN_STYLE_SHEET: default tags, see textTag.StyleSheet.
+const MARKDOWN_STYLE_SHEET = `
+md-h1 { weight: bold; scale: xx-large; spacing-above: 10; spacing-below: 6 }
+md-h2 { weight: bold; scale: x-large; spacing-above: 8; spacing-below: 4 }
+md-h3 { weight: bold; scale: large; spacing-above: 6; spacing-below: 4 }
+md-h4 : md-h3 { scale: medium }
+md-h5 : md-h3 { scale: small }
+md-h6 : md-h3 { scale: small; foreground: #606060 }
+md-block { spacing-below: 8 }
+md-emphasis { style: italic }
+md-strong { weight: bold }
+md-strike { strikethrough: true }
+md-code { family: monospace; background: #EEEEEE }
+md-code-block { family: monospace; paragraph-background: #F4F4F4; wrap-mode: none }
+md-quote { foreground: #606060; style: italic }
+md-link { foreground: #3050FF; underline: single }
+md-image { foreground: #808080; style: italic }
+md-bullet { weight: bold }
+md-table { family: monospace; wrap-mode: none }
+md-rule { foreground: #A0A0A0 }
+md-html { family: monospace; foreground: #808080 }
+`
+
+var (
+	listBullets = []string{"•", "◦", "▪"}
+	regSlug     = regexp.MustCompile(`[^\p{L}\p{N}\- _]`)
+)
+
+// Renderer: Markdown to TextBuffer.
+type Renderer struct {
+	Buff *gtk.TextBuffer
+	View *gtk.TextView
+
+	// Sheet: user tags definitions, applied over MARKDOWN_STYLE_SHEET.
+	Sheet *gitvtt.StyleSheet
+	// BaseDir: directory of the relative images and links.
+	BaseDir string
+	// CodeStyle: Chroma style of the code blocks.
+	CodeStyle string
+	// Indent: left margin of each level of list or quote.
+	Indent int
+	// ImageMaxWidth: the larger images are scaled down, 0 = no limit.
+	ImageMaxWidth int
+
+	// ImageFunc: load the images, i.e: to fetch the remote ones.
+	// By default, only the local files are loaded.
+	ImageFunc func(dest string) (*gdk.Pixbuf, error)
+	// LinkFunc: a link has been clicked, return true if it's handled.
+	LinkFunc func(uri string) bool
+	// ErrorFunc: errors of the links activation.
+	ErrorFunc func(err error)
+
+	defaults    *gitvtt.StyleSheet
+	fileDir     string // BaseDir set by RenderFile, replaced by the next file.
+	highlighter *gitvch.ChromaHighlight
+	doc         *Document
+	links       []mdLink
+	anchors     map[string]int
+
+	depth, // Lists and quotes.
+	listDepth int
+	tight bool
+
+	cursorLink,
+	cursorText *gdk.Cursor
+	tooltip string
+}
+
+// mdLink: link of the rendered text, offsets in the buffer.
+type mdLink struct {
+	start, end int
+	uri, title string
+}
+
+// RendererNew: 'buff' is a *gtk.TextBuffer or a *source.SourceBuffer,
+// 'view' is optional, it's used to activate the links.
+func RendererNew(buff interface{}, view *gtk.TextView) (r *Renderer, err error) {
+	r = &Renderer{
+		View:      view,
+		CodeStyle: MARKDOWN_CODE_STYLE,
+		Indent:    MARKDOWN_INDENT,
+		anchors:   make(map[string]int)}
+
+	switch b := buff.(type) {
+	case *gtk.TextBuffer:
+		r.Buff = b
+	case *source.SourceBuffer:
+		r.Buff = &b.TextBuffer
+	default:
+		return nil, fmt.Errorf("RendererNew: unsupported buffer type %T", buff)
+	}
+	if r.defaults, err = gitvtt.StyleSheetParse([]byte(MARKDOWN_STYLE_SHEET), "markdown"); err != nil {
+		return nil, err
+	}
+	if r.highlighter, err = gitvch.ChromaHighlightNew(r.Buff, 0); err != nil {
+		return nil, err
+	}
+	r.highlighter.TagNamespace = "md-chroma:"
+
+	if view != nil {
+		if display, err := gdk.DisplayGetDefault(); err == nil {
+			r.cursorLink, _ = gdk.CursorNewFromName(display, "pointer")
+			r.cursorText, _ = gdk.CursorNewFromName(display, "text")
+		}
+		view.Connect("button-release-event", r.buttonReleased)
+		view.Connect("motion-notify-event", r.motion)
+	}
+	return
+}
+
+// RenderFile: render a Markdown file, BaseDir is set to its
+// directory unless the caller defined it.
+func (r *Renderer) RenderFile(filename string) (err error) {
+	var data []byte
+	if data, err = ioutil.ReadFile(filename); err != nil {
+		return
+	}
+	if len(r.BaseDir) == 0 || r.BaseDir == r.fileDir {
+		r.BaseDir = filepath.Dir(filename)
+		r.fileDir = r.BaseDir
+	}
+	return r.Render(string(data))
+}
+
+// Render: replace the content of the buffer with the rendered text.
+func (r *Renderer) Render(text string) (err error) {
+	if err = r.defaults.Apply(r.Buff); err != nil {
+		return
+	}
+	if r.Sheet != nil {
+		if err = r.Sheet.Apply(r.Buff); err != nil {
+			return
+		}
+	}
+	r.Buff.Delete(r.Buff.GetStartIter(), r.Buff.GetEndIter())
+	r.links, r.anchors = nil, make(map[string]int)
+	r.depth, r.listDepth, r.tight = 0, 0, false
+	r.doc = Parse(text)
+
+	if err = r.highlighter.BeginInsert(); err != nil {
+		return
+	}
+	r.renderBlocks(r.doc.Root.Children)
+	r.highlighter.EndInsert()
+
+	// The last block ends with a new line.
+	if count := r.offset(); count > 0 {
+		if last := r.Buff.GetIterAtOffset(count - 1); last.GetChar() == '\n' {
+			r.Buff.Delete(last, r.Buff.GetEndIter())
+		}
+	}
+	r.Buff.PlaceCursor(r.Buff.GetStartIter())
+	return
+}
+
+// Document: the last rendered document.
+func (r *Renderer) Document() *Document {
+	return r.doc
+}
+
+// LinkAt: destination of the link at the iter.
+func (r *Renderer) LinkAt(iter *gtk.TextIter) (uri, title string, ok bool) {
+	offset := iter.GetOffset()
+	for _, link := range r.links {
+		if offset >= link.start && offset < link.end {
+			return link.uri, link.title, true
+		}
+	}
+	return
+}
+
+// ScrollToAnchor: scroll to the heading, "#anchor" or "anchor", the
+// anchors are built as on GitHub: "## Hello World!" gives "hello-world".
+func (r *Renderer) ScrollToAnchor(anchor string) bool {
+	offset, ok := r.anchors[strings.TrimPrefix(anchor, "#")]
+	if ok && r.View != nil {
+		iter := r.Buff.GetIterAtOffset(offset)
+		r.Buff.PlaceCursor(iter)
+		r.View.ScrollToIter(iter, 0.0, true, 0.0, 0.0)
+	}
+	return ok
+}
+
+// ActivateLink: LinkFunc first, then the anchors of the document and
+// finally the default application.
+func (r *Renderer) ActivateLink(uri string) {
+	if r.LinkFunc != nil && r.LinkFunc(uri) {
+		return
+	}
+	if strings.HasPrefix(uri, "#") {
+		r.ScrollToAnchor(uri)
+		return
+	}
+	if !strings.Contains(uri, ":") && !filepath.IsAbs(uri) && len(r.BaseDir) > 0 {
+		uri = filepath.Join(r.BaseDir, uri)
+	}
+	if err := gitv.OpenURI(uri); err != nil && r.ErrorFunc != nil {
+		r.ErrorFunc(err)
+	}
+}
+
+/*
+ * Blocks
+ */
+
+func (r *Renderer) renderBlocks(blocks []*Block) {
+	for _, block := range blocks {
+		r.renderBlock(block)
+	}
+}
+
+func (r *Renderer) renderBlock(block *Block) {
+	start := r.offset()
+	switch block.Kind {
+	case BLOCK_PARAGRAPH:
+		r.renderInlines(r.doc.ParseInline(block.Text), nil)
+		r.insert("\n")
+		r.spaceAfter()
+
+	case BLOCK_HEADING:
+		inlines := r.doc.ParseInline(block.Text)
+		r.addAnchor(PlainText(inlines), start)
+		r.renderInlines(inlines, nil)
+		r.insert("\n")
+		r.applyTags(start, fmt.Sprintf("md-h%d", block.Level))
+
+	case BLOCK_CODE:
+		lang := strings.Fields(block.Info)
+		if len(lang) > 0 && len(block.Text) > 0 {
+			// Nothing is inserted on error.
+			if err := r.highlighter.InsertHighlighted(r.Buff.GetEndIter(), block.Text, lang[0], r.CodeStyle); err != nil {
+				r.insert(block.Text)
+			}
+		} else {
+			r.insert(block.Text)
+		}
+		if r.offset() == start {
+			r.insert("\n")
+		}
+		r.applyTags(start, "md-code-block")
+		r.spaceAfter()
+
+	case BLOCK_HTML:
+		r.insert(block.Text, "md-html")
+		r.spaceAfter()
+
+	case BLOCK_RULE:
+		r.insert(strings.Repeat("─", MARKDOWN_RULE_WIDTH)+"\n", "md-rule")
+		r.spaceAfter()
+
+	case BLOCK_TABLE:
+		r.renderTable(block)
+		r.spaceAfter()
+
+	case BLOCK_QUOTE:
+		tight := r.tight
+		r.depth++
+		r.tight = false
+		r.renderBlocks(block.Children)
+		r.depth--
+		r.tight = tight
+		r.applyTags(start, "md-quote")
+		return
+
+	case BLOCK_LIST:
+		r.renderList(block)
+		return
+	}
+	r.applyTags(start, r.indentTag())
+}
+
+// renderList: the bullet is on the first line of the item, with a
+// hanging indent.
+func (r *Renderer) renderList(list *Block) {
+	tight := r.tight
+	r.tight = list.Tight
+	r.listDepth++
+	for idx, item := range list.Children {
+		bullet := listBullets[(r.listDepth-1)%len(listBullets)]
+		if list.Ordered {
+			bullet = fmt.Sprintf("%d.", list.Start+idx)
+		}
+		r.depth++
+		start := r.offset()
+		r.insert(bullet+" ", "md-bullet")
+		r.applyTags(start, r.indentTag(), r.hangingTag())
+		if len(item.Children) == 0 {
+			r.insert("\n")
+		}
+		r.renderBlocks(item.Children)
+		r.depth--
+	}
+	r.listDepth--
+	r.tight = tight
+	r.spaceAfter()
+}
+
+// renderTable: monospace layout, the inline formatting is dropped.
+func (r *Renderer) renderTable(table *Block) {
+	start := r.offset()
+	widths := make([]int, len(table.Align))
+	cells := make([][]string, len(table.Rows))
+	for i, row := range table.Rows {
+		for j, cell := range row {
+			text := PlainText(r.doc.ParseInline(cell))
+			cells[i] = append(cells[i], text)
+			if w := utf8.RuneCountInString(text); w > widths[j] {
+				widths[j] = w
+			}
+		}
+	}
+	for i, row := range cells {
+		line := make([]string, len(row))
+		for j, text := range row {
+			line[j] = alignCell(text, widths[j], table.Align[j])
+		}
+		if i == 0 {
+			r.insert(strings.Join(line, " │ ")+"\n", "md-strong")
+			for j, w := range widths {
+				line[j] = strings.Repeat("─", w)
+			}
+			r.insert(strings.Join(line, "─┼─") + "\n")
+			continue
+		}
+		r.insert(strings.Join(line, " │ ") + "\n")
+	}
+	r.applyTags(start, "md-table")
+}
+
+func alignCell(text string, width int, align TableAlign) string {
+	pad := width - utf8.RuneCountInString(text)
+	switch align {
+	case ALIGN_RIGHT:
+		return strings.Repeat(" ", pad) + text
+	case ALIGN_CENTER:
+		return strings.Repeat(" ", pad/2) + text + strings.Repeat(" ", pad-pad/2)
+	}
+	return text + strings.Repeat(" ", pad)
+}
+
+/*
+ * Inline
+ */
+
+func (r *Renderer) renderInlines(nodes []*Inline, tags []string) {
+	for _, node := range nodes {
+		switch node.Kind {
+		case INLINE_TEXT:
+			r.insert(node.Text, tags...)
+		case INLINE_CODE:
+			r.insert(node.Text, withTag(tags, "md-code")...)
+		case INLINE_EMPHASIS:
+			r.renderInlines(node.Children, withTag(tags, "md-emphasis"))
+		case INLINE_STRONG:
+			r.renderInlines(node.Children, withTag(tags, "md-strong"))
+		case INLINE_STRIKE:
+			r.renderInlines(node.Children, withTag(tags, "md-strike"))
+		case INLINE_LINK:
+			start := r.offset()
+			r.renderInlines(node.Children, withTag(tags, "md-link"))
+			r.links = append(r.links, mdLink{start: start, end: r.offset(), uri: node.Dest, title: node.Title})
+		case INLINE_IMAGE:
+			r.insertImage(node, tags)
+		case INLINE_BREAK:
+			r.insert("\n", tags...)
+		case INLINE_SOFTBREAK:
+			r.insert(" ", tags...)
+		case INLINE_HTML:
+			r.insert(node.Text, withTag(tags, "md-html")...)
+		}
+	}
+}
+
+// insertImage: the alternative text is displayed if the image
+// can't be loaded.
+func (r *Renderer) insertImage(node *Inline, tags []string) {
+	pixbuf, err := r.loadImage(node.Dest)
+	if err != nil {
+		alt := PlainText(node.Children)
+		if len(alt) == 0 {
+			alt = node.Dest
+		}
+		r.insert(alt, withTag(tags, "md-image")...)
+		return
+	}
+	start := r.offset()
+	r.Buff.InsertPixbuf(r.Buff.GetEndIter(), pixbuf)
+	r.applyTags(start, tags...)
+}
+
+func (r *Renderer) loadImage(dest string) (pixbuf *gdk.Pixbuf, err error) {
+	if r.ImageFunc != nil {
+		pixbuf, err = r.ImageFunc(dest)
+	} else {
+		filename := strings.TrimPrefix(dest, "file://")
+		if strings.Contains(filename, "://") {
+			return nil, fmt.Errorf("remote image: %s", dest)
+		}
+		if !filepath.IsAbs(filename) && len(r.BaseDir) > 0 {
+			filename = filepath.Join(r.BaseDir, filename)
+		}
+		pixbuf, err = gipf.GetPixBuf(filename)
+	}
+	if err == nil && r.ImageMaxWidth > 0 && pixbuf.GetWidth() > r.ImageMaxWidth {
+		height := pixbuf.GetHeight() * r.ImageMaxWidth / pixbuf.GetWidth()
+		if height < 1 {
+			height = 1
+		}
+		pixbuf, err = pixbuf.ScaleSimple(r.ImageMaxWidth, height, gdk.INTERP_BILINEAR)
+	}
+	return
+}
+
+func withTag(tags []string, tag string) []string {
+	return append(append([]string{}, tags...), tag)
+}
+
+/*
+ * Buffer
+ */
+
+func (r *Renderer) offset() int {
+	return r.Buff.GetCharCount()
+}
+
+// insert: append the text with the tags.
+func (r *Renderer) insert(text string, tags ...string) {
+	if len(text) == 0 {
+		return
+	}
+	start := r.offset()
+	r.Buff.Insert(r.Buff.GetEndIter(), text)
+	r.applyTags(start, tags...)
+}
+
+// applyTags: from 'start' to the end of the buffer.
+func (r *Renderer) applyTags(start int, tags ...string) {
+	startIter, end := r.Buff.GetIterAtOffset(start), r.Buff.GetEndIter()
+	for _, tag := range tags {
+		if len(tag) > 0 {
+			r.Buff.ApplyTagByName(tag, startIter, end)
+		}
+	}
+}
+
+// spaceAfter: space below the last line, not in tight lists.
+func (r *Renderer) spaceAfter() {
+	if r.tight || r.offset() == 0 {
+		return
+	}
+	line := r.Buff.GetIterAtOffset(r.offset() - 1).GetLine()
+	r.applyTags(r.Buff.GetIterAtLine(line).GetOffset(), "md-block")
+}
+
+// indentTag: left margin of the current level, created on first use.
+func (r *Renderer) indentTag() string {
+	if r.depth == 0 {
+		return ""
+	}
+	name := fmt.Sprintf("md-indent-%d", r.depth)
+	gitvtt.TagCreateIfNotExists(r.Buff, name, map[string]interface{}{"left-margin": r.depth * r.Indent})
+	return name
+}
+
+// hangingTag: the first line of the list items starts one level left.
+func (r *Renderer) hangingTag() string {
+	gitvtt.TagCreateIfNotExists(r.Buff, "md-hanging", map[string]interface{}{"indent": -r.Indent})
+	return "md-hanging"
+}
+
+// addAnchor: GitHub like anchor of a heading, the duplicates get
+// a number.
+func (r *Renderer) addAnchor(title string, offset int) {
+	slug := strings.ReplaceAll(regSlug.ReplaceAllString(strings.ToLower(strings.TrimSpace(title)), ""), " ", "-")
+	anchor := slug
+	for count := 1; ; count++ {
+		if _, exists := r.anchors[anchor]; !exists {
+			break
+		}
+		anchor = fmt.Sprintf("%s-%d", slug, count)
+	}
+	r.anchors[anchor] = offset
+}
+
+/*
+ * Signals
+ */
+
+// iterAtPointer: iter under the pointer, nil after the end of the line.
+func (r *Renderer) iterAtPointer(x, y float64) *gtk.TextIter {
+	bx, by := r.View.WindowToBufferCoords(gtk.TEXT_WINDOW_WIDGET, int(x), int(y))
+	iter, trailing := r.View.GetIterAtPosition(bx, by)
+	if trailing == 0 && iter.EndsLine() {
+		return nil
+	}
+	return iter
+}
+
+func (r *Renderer) buttonReleased(view *gtk.TextView, event *gdk.Event) bool {
+	ev := gdk.EventButtonNewFromEvent(event)
+	if ev.Button() != gdk.BUTTON_PRIMARY || r.Buff.GetHasSelection() {
+		return false
+	}
+	if iter := r.iterAtPointer(ev.X(), ev.Y()); iter != nil {
+		if uri, _, ok := r.LinkAt(iter); ok {
+			r.ActivateLink(uri)
+			return true
+		}
+	}
+	return false
+}
+
+// motion: the pointer cursor over the links, the link is displayed as tooltip.
+func (r *Renderer) motion(view *gtk.TextView, event *gdk.Event) bool {
+	x, y := gdk.EventMotionNewFromEvent(event).MotionVal()
+	cursor := r.cursorText
+	tooltip := ""
+	if iter := r.iterAtPointer(x, y); iter != nil {
+		if uri, title, ok := r.LinkAt(iter); ok {
+			cursor, tooltip = r.cursorLink, uri
+			if len(title) > 0 {
+				tooltip = title + "\n" + uri
+			}
+		}
+	}
+	if window := view.GetWindow(gtk.TEXT_WINDOW_TEXT); window != nil && cursor != nil {
+		window.SetCursor(cursor)
+	}
+	if tooltip != r.tooltip {
+		r.tooltip = tooltip
+		view.SetTooltipText(tooltip)
+	}
+	return false
+}
@@ -0,0 +1,998 @@
+// parse.go
+
+/*
+	Copyright ©2019 H.F.M - TextView Numbered  library "https//github/hfmrow"
+	This program comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+
+	CommonMark parser, the blocks are parsed line by line then the inline content of the
+	paragraphs, headings and table cells. Supported: ATX and setext headings, paragraphs,
+	fenced and indented code blocks, block quotes, bullet and ordered lists (tight or loose),
+	thematic breaks, HTML blocks (kept as raw text), link reference definitions and GFM
+	tables. Inline: code spans, emphasis, strong emphasis, strikethrough (~~), links (inline,
+	reference and autolinks), images, hard and soft line breaks, backslash escapes and
+	entities.
+*/
+
+package markdown
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// BlockKind:
+type BlockKind int
+
+const (
+	BLOCK_DOCUMENT BlockKind = iota
+	BLOCK_PARAGRAPH
+	BLOCK_HEADING
+	BLOCK_CODE
+	BLOCK_QUOTE
+	BLOCK_LIST
+	BLOCK_ITEM
+	BLOCK_RULE
+	BLOCK_TABLE
+	BLOCK_HTML
+)
+
+// TableAlign: alignment of a table column.
+type TableAlign int
+
+const (
+	ALIGN_NONE TableAlign = iota
+	ALIGN_LEFT
+	ALIGN_CENTER
+	ALIGN_RIGHT
+)
+
+// Block: node of the document.
+type Block struct {
+	Kind BlockKind
+	// Level: heading level, 1 to 6.
+	Level int
+	// Info: info string of a fenced code block, the first word is the language.
+	Info string
+	// Text: inline source of a paragraph or a heading, content of a code or HTML block.
+	Text string
+	// Ordered, Start, Tight: lists.
+	Ordered bool
+	Start   int
+	Tight   bool
+	// Align, Rows: tables, the first row is the header.
+	Align []TableAlign
+	Rows  [][]string
+	// Blank: the block is preceded by a blank line.
+	Blank bool
+
+	Children []*Block
+}
+
+// InlineKind:
+type InlineKind int
+
+const (
+	INLINE_TEXT InlineKind = iota
+	INLINE_CODE
+	INLINE_EMPHASIS
+	INLINE_STRONG
+	INLINE_STRIKE
+	INLINE_LINK
+	INLINE_IMAGE
+	INLINE_BREAK     // Hard line break.
+	INLINE_SOFTBREAK // New line in a paragraph.
+	INLINE_HTML      // Raw inline HTML.
+)
+
+// Inline: inline content node.
+type Inline struct {
+	Kind InlineKind
+	Text string // Text, code, HTML.
+	Dest,
+	Title string // Links and images.
+	Children []*Inline
+}
+
+// Document: parsed Markdown.
+type Document struct {
+	Root *Block
+	// Refs: link reference definitions, the labels are normalized.
+	Refs map[string]linkRef
+}
+
+type linkRef struct {
+	dest, title string
+}
+
+var (
+	regAtxHeading  = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	regFence       = regexp.MustCompile("^( {0,3})(`{3,}|~{3,})[ \t]*(.*)$")
+	regRule        = regexp.MustCompile(`^ {0,3}(?:(?:\*[ \t]*){3,}|(?:-[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	regSetext      = regexp.MustCompile(`^ {0,3}(=+|-+)[ \t]*$`)
+	regBullet      = regexp.MustCompile(`^( {0,3})([-+*])([ \t]+|$)`)
+	regOrdered     = regexp.MustCompile(`^( {0,3})(\d{1,9})([.)])([ \t]+|$)`)
+	regQuote       = regexp.MustCompile(`^ {0,3}> ?`)
+	regHTMLRaw     = regexp.MustCompile(`^ {0,3}<(?i:script|pre|style|textarea)(?:[\s>]|$)`)
+	regHTMLSpecial = regexp.MustCompile(`^ {0,3}<(?:!--|\?|![a-zA-Z]|!\[CDATA\[)`)
+	regHTMLBlock   = regexp.MustCompile(`^ {0,3}</?(?i:address|article|aside|base|basefont|blockquote|body|caption|center|col|colgroup|dd|details|dialog|dir|div|dl|dt|fieldset|figcaption|figure|footer|form|frame|frameset|h[1-6]|head|header|hr|html|iframe|legend|li|link|main|menu|menuitem|nav|noframes|ol|optgroup|option|p|param|search|section|source|summary|table|tbody|td|tfoot|th|thead|title|tr|track|ul)(?:\s|/?>|$)`)
+	regHTMLTag     = regexp.MustCompile(`^ {0,3}(?:<[a-zA-Z][a-zA-Z0-9-]*(?:\s+[a-zA-Z_:][a-zA-Z0-9_.:-]*(?:\s*=\s*(?:[^\s"'=<>` + "`" + `]+|'[^']*'|"[^"]*"))?)*\s*/?>|</[a-zA-Z][a-zA-Z0-9-]*\s*>)[ \t]*$`)
+	regTableDelim  = regexp.MustCompile(`^ {0,3}\|?[ \t]*:?-+:?[ \t]*(?:\|[ \t]*:?-+:?[ \t]*)*\|?[ \t]*$`)
+	regRefDef      = regexp.MustCompile(`^ {0,3}\[((?:[^\]\\]|\\.)+)\]:[ \t]*(<[^>\n]*>|\S+)(?:[ \t]+("[^"]*"|'[^']*'|\([^)]*\)))?[ \t]*$`)
+	regEntity      = regexp.MustCompile(`^&(?:#[xX][0-9a-fA-F]{1,6}|#[0-9]{1,7}|[a-zA-Z][a-zA-Z0-9]{1,31});`)
+	regAutolink    = regexp.MustCompile(`^<([a-zA-Z][a-zA-Z0-9+.-]{1,31}:[^<>\s]*)>`)
+	regEmailLink   = regexp.MustCompile(`^<([a-zA-Z0-9.!#$%&'*+/=?^_{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*)>`)
+	regInlineHTML  = regexp.MustCompile(`^<(?:/?[a-zA-Z][a-zA-Z0-9-]*(?:\s+[a-zA-Z_:][a-zA-Z0-9_.:-]*(?:\s*=\s*(?:[^\s"'=<>` + "`" + `]+|'[^']*'|"[^"]*"))?)*\s*/?>|!--[\s\S]*?-->)`)
+	regLabelSpaces = regexp.MustCompile(`\s+`)
+)
+
+// Parse: parse the Markdown text.
+func Parse(text string) (doc *Document) {
+	doc = &Document{Refs: make(map[string]linkRef)}
+	text = strings.ReplaceAll(strings.ReplaceAll(text, "\r\n", "\n"), "\r", "\n")
+	doc.Root = &Block{Kind: BLOCK_DOCUMENT, Children: doc.parseBlocks(strings.Split(text, "\n"))}
+	return
+}
+
+func isBlank(line string) bool {
+	return len(strings.TrimSpace(line)) == 0
+}
+
+// indentOf: columns of the indentation, tab stops of 4.
+func indentOf(line string) (n int) {
+	for idx := 0; idx < len(line); idx++ {
+		switch line[idx] {
+		case ' ':
+			n++
+		case '\t':
+			n += 4 - n%4
+		default:
+			return
+		}
+	}
+	return
+}
+
+// unindent: remove up to 'n' columns of indentation. The tabs are kept,
+// i.e: in the code blocks, unless one of them is partially removed, then
+// the indentation is replaced with spaces to keep the columns.
+func unindent(line string, n int) string {
+	col := 0
+	for idx := 0; idx < len(line); idx++ {
+		switch {
+		case col >= n:
+			return line[idx:]
+		case line[idx] == ' ':
+			col++
+		case line[idx] == '\t':
+			if col += 4 - col%4; col > n {
+				indent := indentOf(line)
+				rest := strings.TrimLeft(line, " \t")
+				return strings.Repeat(" ", indent-n) + rest
+			}
+		default:
+			return line[idx:]
+		}
+	}
+	return ""
+}
+
+// htmlBlockKind: kind of the HTML block started by the line, 0 if none,
+// see the CommonMark specification. 1: raw text elements, 2: comment,
+// 3: processing instruction, 4: declaration, 5: CDATA, 6: block elements,
+// 7: any complete tag alone on its line, it can't interrupt a paragraph.
+func htmlBlockKind(line string) int {
+	switch {
+	case regHTMLRaw.MatchString(line):
+		return 1
+	case regHTMLSpecial.MatchString(line):
+		switch trimmed := strings.TrimLeft(line, " "); {
+		case strings.HasPrefix(trimmed, "<!--"):
+			return 2
+		case strings.HasPrefix(trimmed, "<?"):
+			return 3
+		case strings.HasPrefix(trimmed, "<![CDATA["):
+			return 5
+		}
+		return 4
+	case regHTMLBlock.MatchString(line):
+		return 6
+	case regHTMLTag.MatchString(line):
+		return 7
+	}
+	return 0
+}
+
+// htmlBlockEnds: the line holding one of them ends the HTML block, by kind.
+var htmlBlockEnds = map[int][]string{
+	1: {"</script>", "</pre>", "</style>", "</textarea>"},
+	2: {"-->"},
+	3: {"?>"},
+	4: {">"},
+	5: {"]]>"},
+}
+
+// endsHTMLBlock: the line is the last one of an HTML block of the kinds 1 to 5.
+func endsHTMLBlock(kind int, line string) bool {
+	if kind == 1 {
+		line = strings.ToLower(line)
+	}
+	for _, end := range htmlBlockEnds[kind] {
+		if strings.Contains(line, end) {
+			return true
+		}
+	}
+	return false
+}
+
+// fenceOpening: submatches of the opening line of a fenced code block, the
+// info string of a backtick fence can't hold backticks.
+func fenceOpening(line string) []string {
+	m := regFence.FindStringSubmatch(line)
+	if m != nil && m[2][0] == '`' && strings.Contains(m[3], "`") {
+		return nil
+	}
+	return m
+}
+
+// listMarker: parse a list item marker, 'width' is the indentation of its content.
+func listMarker(line string) (ok, ordered bool, marker byte, start, width int, empty bool) {
+	var content string
+	if m := regBullet.FindStringSubmatch(line); m != nil {
+		ok, marker = true, m[2][0]
+		width = len(m[1]) + 1
+		content = line[len(m[0]):]
+		if spaces := len(m[3]); spaces > 0 && spaces <= 4 && !isBlank(content) {
+			width += spaces
+		} else {
+			width++
+		}
+	} else if m := regOrdered.FindStringSubmatch(line); m != nil {
+		ok, ordered, marker = true, true, m[3][0]
+		start, _ = strconv.Atoi(m[2])
+		width = len(m[1]) + len(m[2]) + 1
+		content = line[len(m[0]):]
+		if spaces := len(m[4]); spaces > 0 && spaces <= 4 && !isBlank(content) {
+			width += spaces
+		} else {
+			width++
+		}
+	}
+	empty = ok && isBlank(content)
+	return
+}
+
+// interruptsParagraph: the line starts a block that can interrupt a paragraph.
+func interruptsParagraph(line string) bool {
+	if regAtxHeading.MatchString(line) || fenceOpening(line) != nil || regQuote.MatchString(line) ||
+		regRule.MatchString(line) || (htmlBlockKind(line) > 0 && htmlBlockKind(line) < 7) {
+		return true
+	}
+	// Only non-empty items, and ordered ones starting with 1.
+	if ok, ordered, _, start, _, empty := listMarker(line); ok && !empty && (!ordered || start == 1) {
+		return true
+	}
+	return false
+}
+
+// parseBlocks: parse the lines of a container.
+func (doc *Document) parseBlocks(lines []string) (blocks []*Block) {
+	count, blank := 0, false
+	for idx := 0; idx < len(lines); {
+		// One block at most per iteration.
+		if len(blocks) > count {
+			blocks[count].Blank = blank
+			count, blank = len(blocks), false
+		}
+		line := lines[idx]
+		switch {
+		case isBlank(line):
+			blank = true
+			idx++
+
+		case indentOf(line) >= 4:
+			// Indented code, trailing blank lines excluded.
+			end, last := idx, idx
+			for ; end < len(lines) && (isBlank(lines[end]) || indentOf(lines[end]) >= 4); end++ {
+				if !isBlank(lines[end]) {
+					last = end
+				}
+			}
+			var code []string
+			for _, l := range lines[idx : last+1] {
+				code = append(code, unindent(l, 4))
+			}
+			blocks = append(blocks, &Block{Kind: BLOCK_CODE, Text: strings.Join(code, "\n") + "\n"})
+			idx = last + 1
+
+		case fenceOpening(line) != nil:
+			m := fenceOpening(line)
+			indent, fence := len(m[1]), m[2]
+			block := &Block{Kind: BLOCK_CODE, Info: unescapeString(strings.TrimSpace(m[3]))}
+			var code []string
+			idx++
+			for ; idx < len(lines); idx++ {
+				trimmed := strings.TrimSpace(lines[idx])
+				if indentOf(lines[idx]) < 4 && strings.HasPrefix(trimmed, fence) &&
+					len(strings.Trim(trimmed, fence[:1])) == 0 {
+					idx++
+					break
+				}
+				code = append(code, unindent(lines[idx], indent))
+			}
+			if len(code) > 0 {
+				block.Text = strings.Join(code, "\n") + "\n"
+			}
+			blocks = append(blocks, block)
+
+		case regAtxHeading.MatchString(line):
+			m := regAtxHeading.FindStringSubmatch(line)
+			blocks = append(blocks, &Block{Kind: BLOCK_HEADING, Level: len(m[1]), Text: strings.TrimSpace(m[2])})
+			idx++
+
+		case regRule.MatchString(line):
+			blocks = append(blocks, &Block{Kind: BLOCK_RULE})
+			idx++
+
+		case regQuote.MatchString(line):
+			var content []string
+			for ; idx < len(lines); idx++ {
+				if loc := regQuote.FindStringIndex(lines[idx]); loc != nil {
+					content = append(content, lines[idx][loc[1]:])
+				} else if len(content) > 0 && !isBlank(lines[idx]) && !isBlank(content[len(content)-1]) &&
+					!interruptsParagraph(lines[idx]) && indentOf(content[len(content)-1]) < 4 {
+					content = append(content, lines[idx]) // Lazy continuation.
+				} else {
+					break
+				}
+			}
+			blocks = append(blocks, &Block{Kind: BLOCK_QUOTE, Children: doc.parseBlocks(content)})
+
+		case htmlBlockKind(line) > 0:
+			start, kind := idx, htmlBlockKind(line)
+			if kind < 6 {
+				// Up to the line holding the end condition.
+				for idx < len(lines) && !endsHTMLBlock(kind, lines[idx]) {
+					idx++
+				}
+				if idx++; idx > len(lines) {
+					idx = len(lines)
+				}
+			} else {
+				for idx < len(lines) && !isBlank(lines[idx]) {
+					idx++
+				}
+			}
+			blocks = append(blocks, &Block{Kind: BLOCK_HTML, Text: strings.Join(lines[start:idx], "\n") + "\n"})
+
+		default:
+			if ok, _, _, _, _, _ := listMarker(line); ok {
+				var list *Block
+				list, idx = doc.parseList(lines, idx)
+				blocks = append(blocks, list)
+				continue
+			}
+			var block *Block
+			block, idx = doc.parseParagraph(lines, idx)
+			if block != nil {
+				blocks = append(blocks, block)
+			}
+		}
+	}
+	if len(blocks) > count {
+		blocks[count].Blank = blank
+	}
+	return
+}
+
+// parseList: items with the same kind of marker.
+func (doc *Document) parseList(lines []string, idx int) (list *Block, next int) {
+	_, ordered, marker, start, _, _ := listMarker(lines[idx])
+	list = &Block{Kind: BLOCK_LIST, Ordered: ordered, Start: start, Tight: true}
+	blankBetween := false
+	for idx < len(lines) {
+		ok, o, m, _, width, empty := listMarker(lines[idx])
+		if !ok || o != ordered || m != marker || regRule.MatchString(lines[idx]) {
+			break
+		}
+		if blankBetween {
+			list.Tight = false
+		}
+		// The width of an empty item is larger than its line.
+		first := ""
+		if !empty {
+			first = lines[idx][width:]
+		}
+		content := []string{first}
+		idx++
+	collect:
+		for ; idx < len(lines); idx++ {
+			l := lines[idx]
+			switch {
+			case isBlank(l):
+				if empty && len(content) == 1 {
+					// An item can start with at most one blank line.
+					break collect
+				}
+				content = append(content, "")
+				continue
+			case indentOf(l) >= width:
+				content = append(content, unindent(l, width))
+				continue
+			case !isBlank(content[len(content)-1]) && !interruptsParagraph(l) && !regSetext.MatchString(l):
+				// Lazy continuation of a paragraph.
+				if last := content[len(content)-1]; indentOf(last) < 4 && fenceOpening(last) == nil {
+					content = append(content, l)
+					continue
+				}
+			}
+			break
+		}
+		// Trailing blank lines belong to the list, not to the item.
+		trailing := 0
+		for len(content) > 1 && isBlank(content[len(content)-1]) {
+			content = content[:len(content)-1]
+			trailing++
+		}
+		item := &Block{Kind: BLOCK_ITEM, Children: doc.parseBlocks(content)}
+		list.Children = append(list.Children, item)
+		if hasInnerBlank(content) && len(item.Children) > 1 {
+			list.Tight = false
+		}
+		blankBetween = trailing > 0
+	}
+	return list, idx
+}
+
+// hasInnerBlank: a blank line separates two blocks of the item
+// (blank lines inside fenced code don't count).
+func hasInnerBlank(content []string) bool {
+	fence := ""
+	for idx, line := range content {
+		if m := regFence.FindStringSubmatch(line); m != nil {
+			if len(fence) == 0 {
+				fence = m[2][:1]
+			} else if strings.HasPrefix(strings.TrimSpace(line), fence) {
+				fence = ""
+			}
+			continue
+		}
+		if len(fence) == 0 && idx > 0 && idx < len(content)-1 && isBlank(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseParagraph: paragraph, setext heading, table or link reference definitions.
+func (doc *Document) parseParagraph(lines []string, idx int) (block *Block, next int) {
+	// Table: header row followed by the delimiter row.
+	if idx+1 < len(lines) && strings.Contains(lines[idx], "|") && regTableDelim.MatchString(lines[idx+1]) {
+		header := splitTableRow(lines[idx])
+		delims := splitTableRow(lines[idx+1])
+		if len(header) == len(delims) {
+			block = &Block{Kind: BLOCK_TABLE, Rows: [][]string{header}}
+			for _, d := range delims {
+				d = strings.TrimSpace(d)
+				switch {
+				case strings.HasPrefix(d, ":") && strings.HasSuffix(d, ":"):
+					block.Align = append(block.Align, ALIGN_CENTER)
+				case strings.HasSuffix(d, ":"):
+					block.Align = append(block.Align, ALIGN_RIGHT)
+				case strings.HasPrefix(d, ":"):
+					block.Align = append(block.Align, ALIGN_LEFT)
+				default:
+					block.Align = append(block.Align, ALIGN_NONE)
+				}
+			}
+			for idx += 2; idx < len(lines) && !isBlank(lines[idx]) && !interruptsParagraph(lines[idx]); idx++ {
+				row := splitTableRow(lines[idx])
+				for len(row) < len(header) {
+					row = append(row, "")
+				}
+				block.Rows = append(block.Rows, row[:len(header)])
+			}
+			return block, idx
+		}
+	}
+
+	var content []string
+	for ; idx < len(lines); idx++ {
+		line := lines[idx]
+		if isBlank(line) {
+			break
+		}
+		if len(content) > 0 {
+			if m := regSetext.FindStringSubmatch(line); m != nil {
+				level := 2
+				if m[1][0] == '=' {
+					level = 1
+				}
+				if content = doc.extractRefs(content); len(content) > 0 {
+					return &Block{Kind: BLOCK_HEADING, Level: level, Text: joinParagraph(content)}, idx + 1
+				}
+			}
+			if interruptsParagraph(line) {
+				break
+			}
+		}
+		content = append(content, line)
+	}
+	if content = doc.extractRefs(content); len(content) > 0 {
+		block = &Block{Kind: BLOCK_PARAGRAPH, Text: joinParagraph(content)}
+	}
+	return block, idx
+}
+
+// joinParagraph: lines without their indentation, the last one
+// without trailing spaces.
+func joinParagraph(content []string) string {
+	for idx, line := range content {
+		content[idx] = strings.TrimLeft(line, " \t")
+	}
+	return strings.TrimRight(strings.Join(content, "\n"), " ")
+}
+
+// extractRefs: link reference definitions at the beginning of a paragraph.
+func (doc *Document) extractRefs(content []string) []string {
+	for len(content) > 0 {
+		m := regRefDef.FindStringSubmatch(content[0])
+		if m == nil {
+			break
+		}
+		label := normalizeLabel(m[1])
+		if _, exists := doc.Refs[label]; !exists {
+			dest := strings.TrimSuffix(strings.TrimPrefix(m[2], "<"), ">")
+			title := ""
+			if len(m[3]) > 1 {
+				title = unescapeString(m[3][1 : len(m[3])-1])
+			}
+			doc.Refs[label] = linkRef{dest: unescapeString(dest), title: title}
+		}
+		content = content[1:]
+	}
+	return content
+}
+
+func normalizeLabel(label string) string {
+	return strings.ToLower(regLabelSpaces.ReplaceAllString(strings.TrimSpace(label), " "))
+}
+
+// splitTableRow: cells of a table row, escaped pipes are kept.
+func splitTableRow(line string) (cells []string) {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = line[:len(line)-1]
+	}
+	var b strings.Builder
+	for idx := 0; idx < len(line); idx++ {
+		switch {
+		case line[idx] == '\\' && idx+1 < len(line) && line[idx+1] == '|':
+			b.WriteByte('|')
+			idx++
+		case line[idx] == '|':
+			cells = append(cells, strings.TrimSpace(b.String()))
+			b.Reset()
+		default:
+			b.WriteByte(line[idx])
+		}
+	}
+	return append(cells, strings.TrimSpace(b.String()))
+}
+
+/*
+ * Inline
+ */
+
+// delimiter: run of '*', '_' or '~' waiting to be matched.
+type delimiter struct {
+	char     byte
+	count    int
+	orig     int
+	canOpen  bool
+	canClose bool
+	isDelim  bool
+	node     *Inline
+}
+
+// ParseInline: parse the inline content of a block.
+func (doc *Document) ParseInline(text string) []*Inline {
+	var items []*delimiter
+	var buf strings.Builder
+
+	flush := func() {
+		if buf.Len() > 0 {
+			items = append(items, &delimiter{node: &Inline{Kind: INLINE_TEXT, Text: buf.String()}})
+			buf.Reset()
+		}
+	}
+	add := func(node *Inline) {
+		flush()
+		items = append(items, &delimiter{node: node})
+	}
+
+	for idx := 0; idx < len(text); {
+		c := text[idx]
+		switch {
+		case c == '\\' && idx+1 < len(text) && text[idx+1] == '\n':
+			add(&Inline{Kind: INLINE_BREAK})
+			idx += 2
+			continue
+		case c == '\\' && idx+1 < len(text) && isASCIIPunct(text[idx+1]):
+			buf.WriteByte(text[idx+1])
+			idx += 2
+			continue
+
+		case c == '\n':
+			// Two spaces or more before the new line make a hard break.
+			str := buf.String()
+			trimmed := strings.TrimRight(str, " ")
+			hard := len(str)-len(trimmed) >= 2
+			buf.Reset()
+			buf.WriteString(trimmed)
+			if hard {
+				add(&Inline{Kind: INLINE_BREAK})
+			} else {
+				add(&Inline{Kind: INLINE_SOFTBREAK})
+			}
+			idx++
+			for idx < len(text) && text[idx] == ' ' {
+				idx++
+			}
+			continue
+
+		case c == '`':
+			run := countRun(text[idx:], '`')
+			if end := findCodeEnd(text, idx+run, run); end >= 0 {
+				code := strings.ReplaceAll(text[idx+run:end], "\n", " ")
+				if len(code) > 2 && code[0] == ' ' && code[len(code)-1] == ' ' && len(strings.TrimSpace(code)) > 0 {
+					code = code[1 : len(code)-1]
+				}
+				add(&Inline{Kind: INLINE_CODE, Text: code})
+				idx = end + run
+			} else {
+				buf.WriteString(text[idx : idx+run])
+				idx += run
+			}
+			continue
+
+		case c == '<':
+			if m := regAutolink.FindStringSubmatch(text[idx:]); m != nil {
+				add(&Inline{Kind: INLINE_LINK, Dest: m[1], Children: []*Inline{{Kind: INLINE_TEXT, Text: m[1]}}})
+				idx += len(m[0])
+				continue
+			}
+			if m := regEmailLink.FindStringSubmatch(text[idx:]); m != nil {
+				add(&Inline{Kind: INLINE_LINK, Dest: "mailto:" + m[1], Children: []*Inline{{Kind: INLINE_TEXT, Text: m[1]}}})
+				idx += len(m[0])
+				continue
+			}
+			if m := regInlineHTML.FindString(text[idx:]); len(m) > 0 {
+				add(&Inline{Kind: INLINE_HTML, Text: m})
+				idx += len(m)
+				continue
+			}
+
+		case c == '&':
+			if m := regEntity.FindString(text[idx:]); len(m) > 0 {
+				buf.WriteString(html.UnescapeString(m))
+				idx += len(m)
+				continue
+			}
+
+		case c == '!' && idx+1 < len(text) && text[idx+1] == '[', c == '[':
+			start := idx
+			if c == '!' {
+				start++
+			}
+			if node, end := doc.parseLink(text, start); node != nil {
+				if c == '!' {
+					node.Kind = INLINE_IMAGE
+				}
+				add(node)
+				idx = end
+				continue
+			}
+
+		case c == '*' || c == '_' || c == '~':
+			run := countRun(text[idx:], c)
+			if c == '~' && run != 2 {
+				break
+			}
+			before, _ := utf8.DecodeLastRuneInString(text[:idx])
+			if idx == 0 {
+				before = ' '
+			}
+			after, _ := utf8.DecodeRuneInString(text[idx+run:])
+			if idx+run >= len(text) {
+				after = ' '
+			}
+			left := !unicode.IsSpace(after) && (!isPunct(after) || unicode.IsSpace(before) || isPunct(before))
+			right := !unicode.IsSpace(before) && (!isPunct(before) || unicode.IsSpace(after) || isPunct(after))
+			d := &delimiter{char: c, count: run, orig: run, isDelim: true,
+				node: &Inline{Kind: INLINE_TEXT, Text: text[idx : idx+run]}}
+			if c == '_' {
+				d.canOpen = left && (!right || isPunct(before))
+				d.canClose = right && (!left || isPunct(after))
+			} else {
+				d.canOpen, d.canClose = left, right
+			}
+			flush()
+			items = append(items, d)
+			idx += run
+			continue
+		}
+		buf.WriteByte(c)
+		idx++
+	}
+	flush()
+	return mergeText(processEmphasis(items))
+}
+
+// parseLink: '[text](dest "title")', '[text][ref]', '[text][]' or
+// '[ref]' starting at 'idx'. Return the node and the end of the link.
+func (doc *Document) parseLink(text string, idx int) (node *Inline, end int) {
+	close := findBracketEnd(text, idx)
+	if close < 0 {
+		return nil, 0
+	}
+	label := text[idx+1 : close]
+	rest := text[close+1:]
+
+	if strings.HasPrefix(rest, "(") {
+		if dest, title, n, ok := parseLinkDest(rest); ok {
+			return &Inline{Kind: INLINE_LINK, Dest: dest, Title: title,
+				Children: doc.ParseInline(label)}, close + 1 + n
+		}
+	}
+	ref, n := label, 0
+	if strings.HasPrefix(rest, "[") {
+		if refEnd := strings.IndexByte(rest, ']'); refEnd > 0 {
+			ref, n = rest[1:refEnd], refEnd+1
+		} else if refEnd == 1 {
+			n = 2
+		}
+	}
+	if r, ok := doc.Refs[normalizeLabel(ref)]; ok {
+		return &Inline{Kind: INLINE_LINK, Dest: r.dest, Title: r.title,
+			Children: doc.ParseInline(label)}, close + 1 + n
+	}
+	return nil, 0
+}
+
+// findBracketEnd: matching ']', the code spans and the escapes are skipped.
+func findBracketEnd(text string, idx int) int {
+	depth := 0
+	for i := idx; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case '`':
+			run := countRun(text[i:], '`')
+			if end := findCodeEnd(text, i+run, run); end >= 0 {
+				i = end + run - 1
+			} else {
+				i += run - 1
+			}
+		case '[':
+			depth++
+		case ']':
+			if depth--; depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// parseLinkDest: '(dest "title")', 'n' is the length consumed.
+func parseLinkDest(text string) (dest, title string, n int, ok bool) {
+	i := 1
+	skipSpaces := func() {
+		for i < len(text) && (text[i] == ' ' || text[i] == '\n') {
+			i++
+		}
+	}
+	skipSpaces()
+	if i < len(text) && text[i] == '<' {
+		end := strings.IndexAny(text[i+1:], ">\n")
+		if end < 0 || text[i+1+end] != '>' {
+			return
+		}
+		dest = text[i+1 : i+1+end]
+		i += end + 2
+	} else {
+		start, depth := i, 0
+		for ; i < len(text); i++ {
+			c := text[i]
+			if c == '\\' && i+1 < len(text) {
+				i++
+				continue
+			}
+			if c == '(' {
+				depth++
+			} else if c == ')' {
+				if depth == 0 {
+					break
+				}
+				depth--
+			} else if c == ' ' || c == '\n' || c < 0x20 {
+				break
+			}
+		}
+		dest = text[start:i]
+	}
+	skipSpaces()
+	if i < len(text) && (text[i] == '"' || text[i] == '\'' || text[i] == '(') {
+		closing := text[i]
+		if closing == '(' {
+			closing = ')'
+		}
+		end := strings.IndexByte(text[i+1:], closing)
+		if end < 0 {
+			return
+		}
+		title = unescapeString(text[i+1 : i+1+end])
+		i += end + 2
+		skipSpaces()
+	}
+	if i >= len(text) || text[i] != ')' {
+		return
+	}
+	return unescapeString(dest), title, i + 1, true
+}
+
+// processEmphasis: match the delimiters runs, CommonMark rules.
+func processEmphasis(items []*delimiter) []*Inline {
+	for c := 0; c < len(items); c++ {
+		closer := items[c]
+		if !closer.isDelim || !closer.canClose || closer.count == 0 {
+			continue
+		}
+		o := c - 1
+		for ; o >= 0; o-- {
+			opener := items[o]
+			if !opener.isDelim || opener.char != closer.char || !opener.canOpen || opener.count == 0 {
+				continue
+			}
+			// Rule of 3.
+			if (opener.canClose || closer.canOpen) && (opener.orig+closer.orig)%3 == 0 &&
+				!(opener.orig%3 == 0 && closer.orig%3 == 0) {
+				continue
+			}
+			break
+		}
+		if o < 0 {
+			continue
+		}
+		opener := items[o]
+		use, kind := 1, INLINE_EMPHASIS
+		switch {
+		case closer.char == '~':
+			use, kind = 2, INLINE_STRIKE
+		case opener.count >= 2 && closer.count >= 2:
+			use, kind = 2, INLINE_STRONG
+		}
+		node := &Inline{Kind: kind, Children: toInlines(items[o+1 : c])}
+		opener.count -= use
+		closer.count -= use
+		opener.node.Text = opener.node.Text[:opener.count]
+		closer.node.Text = closer.node.Text[:closer.count]
+
+		rebuilt := append([]*delimiter{}, items[:o+1]...)
+		rebuilt = append(rebuilt, &delimiter{node: node})
+		rebuilt = append(rebuilt, items[c:]...)
+		items = rebuilt
+		c = o + 2
+		if opener.count == 0 {
+			items = append(items[:o], items[o+1:]...)
+			c--
+		}
+		if closer.count == 0 {
+			items = append(items[:c], items[c+1:]...)
+		}
+		c-- // Same closer again, or the next item.
+	}
+	return toInlines(items)
+}
+
+// toInlines: the unmatched delimiters become text.
+func toInlines(items []*delimiter) (nodes []*Inline) {
+	for _, item := range items {
+		if item.isDelim && len(item.node.Text) == 0 {
+			continue
+		}
+		nodes = append(nodes, item.node)
+	}
+	return
+}
+
+// mergeText: join the adjacent text nodes.
+func mergeText(nodes []*Inline) (out []*Inline) {
+	for _, node := range nodes {
+		if len(node.Children) > 0 {
+			node.Children = mergeText(node.Children)
+		}
+		if node.Kind == INLINE_TEXT && len(out) > 0 && out[len(out)-1].Kind == INLINE_TEXT {
+			out[len(out)-1] = &Inline{Kind: INLINE_TEXT, Text: out[len(out)-1].Text + node.Text}
+			continue
+		}
+		out = append(out, node)
+	}
+	return
+}
+
+// PlainText: text of the inline nodes without formatting, the images
+// give their alternative text.
+func PlainText(nodes []*Inline) string {
+	var b strings.Builder
+	for _, node := range nodes {
+		switch node.Kind {
+		case INLINE_TEXT, INLINE_CODE:
+			b.WriteString(node.Text)
+		case INLINE_BREAK, INLINE_SOFTBREAK:
+			b.WriteString(" ")
+		default:
+			b.WriteString(PlainText(node.Children))
+		}
+	}
+	return b.String()
+}
+
+func countRun(text string, c byte) (n int) {
+	for n < len(text) && text[n] == c {
+		n++
+	}
+	return
+}
+
+// findCodeEnd: position of the closing backtick run of the same length.
+func findCodeEnd(text string, idx, run int) int {
+	for idx < len(text) {
+		next := strings.IndexByte(text[idx:], '`')
+		if next < 0 {
+			return -1
+		}
+		idx += next
+		if n := countRun(text[idx:], '`'); n == run {
+			return idx
+		} else {
+			idx += n
+		}
+	}
+	return -1
+}
+
+// unescapeString: backslash escapes and entities.
+func unescapeString(text string) string {
+	if !strings.ContainsAny(text, `\&`) {
+		return text
+	}
+	var b strings.Builder
+	for idx := 0; idx < len(text); idx++ {
+		if text[idx] == '\\' && idx+1 < len(text) && isASCIIPunct(text[idx+1]) {
+			idx++
+		} else if text[idx] == '&' {
+			if m := regEntity.FindString(text[idx:]); len(m) > 0 {
+				b.WriteString(html.UnescapeString(m))
+				idx += len(m) - 1
+				continue
+			}
+		}
+		b.WriteByte(text[idx])
+	}
+	return b.String()
+}
+
+func isASCIIPunct(c byte) bool {
+	return strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) >= 0
+}
+
+func isPunct(r rune) bool {
+	return unicode.IsPunct(r) || unicode.IsSymbol(r)
+}
@@ -0,0 +1,99 @@
+// parse_test.go
+
+/*
+	Copyright ©2019 H.F.M - TextView Numbered  library "https//github/hfmrow"
+	This program comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+*/
+
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+// kinds: kinds of the blocks of the tree, the children in brackets.
+func kinds(blocks []*Block) string {
+	names := map[BlockKind]string{
+		BLOCK_PARAGRAPH: "p", BLOCK_HEADING: "h", BLOCK_CODE: "code", BLOCK_QUOTE: "quote",
+		BLOCK_LIST: "list", BLOCK_ITEM: "item", BLOCK_RULE: "hr", BLOCK_TABLE: "table", BLOCK_HTML: "html"}
+	var out []string
+	for _, b := range blocks {
+		s := names[b.Kind]
+		if len(b.Children) > 0 {
+			s += "[" + kinds(b.Children) + "]"
+		}
+		out = append(out, s)
+	}
+	return strings.Join(out, " ")
+}
+
+func TestParseEmptyListItems(t *testing.T) {
+	for _, test := range []struct {
+		text, want string
+	}{
+		{"-", "list[item]"},
+		{"*", "list[item]"},
+		{"1.", "list[item]"},
+		{"2)", "list[item]"},
+		{"- a\n-", "list[item[p] item]"},
+		{"-\n  foo", "list[item[p]]"},
+		{"1.\n2. b", "list[item item[p]]"},
+		{"foo\n\n1.", "p list[item]"},
+		{"foo\n-", "h"}, // Setext heading
+	} {
+		if got := kinds(Parse(test.text).Root.Children); got != test.want {
+			t.Errorf("Parse(%q): got %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestParseHTMLBlocks(t *testing.T) {
+	for _, test := range []struct {
+		text, want string
+	}{
+		{"<strong>a</strong>b\n```\nx\n```", "p code"},
+		{"<span>\nfoo", "html"},
+		{"foo\n<span>\nbar", "p"}, // Kind 7 can't interrupt a paragraph.
+		{"foo\n</em>", "p"},
+		{"foo\n<div>\nbar", "p html"},
+		{"<DIV class=\"a\">\n*b*\n\nc", "html p"},
+		{"<!-- a\n\nb -->\nc", "html p"},
+		{"<pre>\n\nx\n</pre>\ny", "html p"},
+		{"<br>\n\n<br>", "html html"},
+		{"<a href=\"x\">b", "p"},
+		{"foo\n```` a``` ````", "p"}, // Code span, not a fence.
+	} {
+		if got := kinds(Parse(test.text).Root.Children); got != test.want {
+			t.Errorf("Parse(%q): got %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestParseTabs(t *testing.T) {
+	for _, test := range []struct {
+		text, want string
+	}{
+		{"```\n\tx\ty\n```", "\tx\ty\n"},
+		{"  ```\n\tx\n  ```", "  x\n"},
+		{"\tx\n\t\ty", "x\n\ty\n"},
+		{"- a\n\n\t\tb", "  b\n"},
+	} {
+		var code *Block
+		var find func(blocks []*Block)
+		find = func(blocks []*Block) {
+			for _, b := range blocks {
+				if b.Kind == BLOCK_CODE && code == nil {
+					code = b
+				}
+				find(b.Children)
+			}
+		}
+		if find(Parse(test.text).Root.Children); code == nil {
+			t.Errorf("Parse(%q): no code block", test.text)
+		} else if code.Text != test.want {
+			t.Errorf("Parse(%q): got %q, want %q", test.text, code.Text, test.want)
+		}
+	}
+}
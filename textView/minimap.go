@@ -0,0 +1,376 @@
+// minimap.go
+
+/*
+	This software use gotk3 that is licensed under the ISC License:
+	https://github.com/gotk3/gotk3/blob/master/LICENSE
+
+	Copyright ©2019 H.F.M - TextView Numbered  library "https//github/hfmrow"
+	This program comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+
+	Minimap of TextViewNumbered: a DrawingArea at the right of the scrollbar with a
+	scaled rendering of the whole document, the visible part is shaded. Coloured ticks
+	show the search hits, the bookmarks and the diagnostics. A click, or a drag, scrolls
+	the view to the pointed line. Without text (see ShowText), it's a narrow overview
+	ruler only showing the ticks.
+
+	The document is mapped on the height of the area: when there are too many lines,
+	each row of pixels shows a sample line, so the cost of the rendering only depends
+	on the size of the area, even for large logs. The rendering is cached and made
+	again 'Delay' after the buffer changes, the ticks and the visible part are drawn
+	each time.
+
+Usage:
+	mm := tvn.Minimap()
+	mm.ShowText = false // Overview ruler
+	mm.Refresh()
+	mm.SetVisible(false)
+*/
+
+package textView
+
+import (
+	"math"
+	"time"
+
+	"github.com/gotk3/gotk3/cairo"
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+const (
+	// MINIMAP_WIDTH, MINIMAP_RULER_WIDTH: width of the minimap and of the ruler.
+	MINIMAP_WIDTH       = 100
+	MINIMAP_RULER_WIDTH = 12
+	// MINIMAP_DELAY: delay between a modification and the rendering.
+	MINIMAP_DELAY = 250 * time.Millisecond
+)
+
+// MinimapTick: coloured tick at a line.
+type MinimapTick struct {
+	Line   int
+	Colour string
+}
+
+// Minimap: scaled rendering of the document of a TextViewNumbered.
+type Minimap struct {
+	Area *gtk.DrawingArea
+
+	// ShowText: render the text, otherwise only the ruler is displayed.
+	ShowText bool
+	// Width: of the area when the text is rendered, the ruler is at its right.
+	Width,
+	RulerWidth int
+	// LineHeight, CharWidth: size of the characters, in pixels, when the
+	// document is smaller than the area.
+	LineHeight,
+	CharWidth float64
+	TabWidth int
+	// Delay: between a modification and the rendering.
+	Delay time.Duration
+
+	TextCol,
+	BgCol,
+	ViewportCol,
+	SearchCol string
+	// Search hits, bookmarks and diagnostics (see GutterMarkColours).
+	ShowSearch,
+	ShowBookmarks,
+	ShowDiagnostics bool
+	// TicksFunc: optional, additional ticks.
+	TicksFunc func() []MinimapTick
+
+	tvn      *TextViewNumbered
+	surface  *cairo.Surface
+	surfW    int
+	surfH    int
+	surfLine int // Lines count of the rendering
+	dirty    bool
+	timer    glib.SourceHandle
+	dragging bool
+}
+
+// Minimap: get the minimap of the TextViewNumbered, created and displayed
+// on the first call.
+func (tvn *TextViewNumbered) Minimap() *Minimap {
+	if tvn.minimap == nil {
+		var err error
+		mm := &Minimap{
+			tvn:             tvn,
+			ShowText:        true,
+			Width:           MINIMAP_WIDTH,
+			RulerWidth:      MINIMAP_RULER_WIDTH,
+			LineHeight:      2,
+			CharWidth:       1,
+			TabWidth:        4,
+			Delay:           MINIMAP_DELAY,
+			TextCol:         tvn.TxtFgCol,
+			BgCol:           tvn.TxtBgCol,
+			ViewportCol:     "rgba(0, 0, 0, 0.12)",
+			SearchCol:       "#D4A000",
+			ShowSearch:      true,
+			ShowBookmarks:   true,
+			ShowDiagnostics: true,
+			dirty:           true}
+		if mm.Area, err = gtk.DrawingAreaNew(); err != nil {
+			return nil
+		}
+		mm.Area.AddEvents(int(gdk.BUTTON_PRESS_MASK | gdk.BUTTON_RELEASE_MASK | gdk.BUTTON1_MOTION_MASK | gdk.SCROLL_MASK))
+		mm.Area.Connect("draw", mm.draw)
+		mm.Area.Connect("button-press-event", mm.buttonPressed)
+		mm.Area.Connect("button-release-event", mm.buttonReleased)
+		mm.Area.Connect("motion-notify-event", mm.motion)
+		mm.Area.Connect("scroll-event", mm.scrolled)
+		tvn.vAdj.Connect("value-changed", mm.Area.QueueDraw)
+		tvn.vAdj.Connect("changed", mm.Area.QueueDraw)
+		tvn.BuffTxt.Connect("changed", mm.changed)
+		tvn.Search().changedFunc = mm.Area.QueueDraw
+
+		tvn.box.PackStart(mm.Area, false, true, 0)
+		tvn.minimap = mm
+		mm.Refresh()
+		mm.SetVisible(true)
+	}
+	return tvn.minimap
+}
+
+// SetVisible: show or hide the minimap.
+func (mm *Minimap) SetVisible(visible bool) {
+	mm.Area.SetVisible(visible)
+}
+
+// Refresh: render again, to be called after changing the options.
+func (mm *Minimap) Refresh() {
+	width := mm.RulerWidth
+	if mm.ShowText {
+		width = mm.Width
+	}
+	mm.Area.SetSizeRequest(width, -1)
+	mm.dirty = true
+	mm.Area.QueueDraw()
+}
+
+// changed: buffer "changed", render again after 'Delay'.
+func (mm *Minimap) changed() {
+	if mm.timer != 0 {
+		glib.SourceRemove(mm.timer)
+	}
+	mm.timer = glib.TimeoutAdd(uint(mm.Delay/time.Millisecond), func() bool {
+		mm.timer = 0
+		mm.dirty = true
+		mm.Area.QueueDraw()
+		return false
+	})
+}
+
+// lineHeight: height of a line in the area, less than one pixel when the
+// document is higher than the area.
+func (mm *Minimap) lineHeight(height, lineCount int) float64 {
+	lh := mm.LineHeight
+	if !mm.ShowText || float64(lineCount)*lh > float64(height) {
+		lh = float64(height) / float64(lineCount)
+	}
+	return lh
+}
+
+// lineAt: line at the 'y' position of the area.
+func (mm *Minimap) lineAt(y float64) int {
+	lineCount := mm.tvn.BuffTxt.GetLineCount()
+	line := int(y / mm.lineHeight(mm.Area.GetAllocatedHeight(), lineCount))
+	if line >= lineCount {
+		line = lineCount - 1
+	}
+	if line < 0 {
+		line = 0
+	}
+	return line
+}
+
+/*
+ * Drawing
+ */
+
+func (mm *Minimap) draw(da *gtk.DrawingArea, cr *cairo.Context) bool {
+	width, height := da.GetAllocatedWidth(), da.GetAllocatedHeight()
+	lineCount := mm.tvn.BuffTxt.GetLineCount()
+	if width <= 0 || height <= 0 {
+		return false
+	}
+	setCairoColour(cr, mm.BgCol)
+	cr.Paint()
+
+	lh := mm.lineHeight(height, lineCount)
+	textWidth := width
+	if mm.ShowText {
+		textWidth -= mm.RulerWidth
+		if mm.dirty || mm.surface == nil || mm.surfW != textWidth || mm.surfH != height || mm.surfLine != lineCount {
+			mm.render(textWidth, height, lineCount, lh)
+		}
+		cr.SetSourceSurface(mm.surface, 0, 0)
+		cr.PaintWithAlpha(0.6)
+	}
+
+	// Visible part
+	_, top := mm.tvn.TextView.WindowToBufferCoords(gtk.TEXT_WINDOW_WIDGET, 0, 0)
+	first := mm.tvn.lineAtY(top).GetLine()
+	last := mm.tvn.lineAtY(top + mm.tvn.TextView.GetAllocatedHeight()).GetLine()
+	setCairoColour(cr, mm.ViewportCol)
+	cr.Rectangle(0, float64(first)*lh, float64(width), math.Max(float64(last-first+1)*lh, 2))
+	cr.Fill()
+
+	// Ticks, at the right of the text.
+	left, tickHeight := float64(textWidth), math.Max(lh, 2)
+	if !mm.ShowText {
+		left = 0
+	}
+	for _, tick := range mm.Ticks() {
+		if tick.Line < lineCount {
+			setCairoColour(cr, tick.Colour)
+			cr.Rectangle(left, float64(tick.Line)*lh, float64(width)-left, tickHeight)
+			cr.Fill()
+		}
+	}
+	return false
+}
+
+// render: draw the text in the cache, a block per word. When the lines
+// are thinner than a pixel, a line is drawn per row of pixels.
+func (mm *Minimap) render(width, height, lineCount int, lh float64) {
+	if mm.surface != nil {
+		mm.surface.Close()
+	}
+	mm.surface = cairo.CreateImageSurface(cairo.FORMAT_ARGB32, width, height)
+	mm.surfW, mm.surfH, mm.surfLine, mm.dirty = width, height, lineCount, false
+	cr := cairo.Create(mm.surface)
+	setCairoColour(cr, mm.TextCol)
+
+	step, rowHeight := 1, lh*0.7
+	if lh < 1 {
+		step, rowHeight = int(math.Ceil(1/lh)), 1
+	}
+	for line := 0; line < lineCount; line += step {
+		y := math.Floor(float64(line) * lh)
+		if y >= float64(height) {
+			break
+		}
+		col, start := 0, -1
+		for _, r := range mm.lineText(line, int(float64(width)/mm.CharWidth)+1) + " " {
+			switch {
+			case r == ' ' || r == '\t':
+				if start >= 0 {
+					cr.Rectangle(float64(start)*mm.CharWidth, y, float64(col-start)*mm.CharWidth, rowHeight)
+					start = -1
+				}
+				if r == '\t' {
+					col += mm.TabWidth - col%mm.TabWidth
+					continue
+				}
+			case start < 0:
+				start = col
+			}
+			if col++; float64(col)*mm.CharWidth > float64(width) {
+				break
+			}
+		}
+		if start >= 0 {
+			cr.Rectangle(float64(start)*mm.CharWidth, y, float64(col-start)*mm.CharWidth, rowHeight)
+		}
+		cr.Fill()
+	}
+	mm.surface.Flush()
+}
+
+// lineText: the 'max' first characters of the line, the hidden (folded)
+// text is included.
+func (mm *Minimap) lineText(line, max int) string {
+	start := mm.tvn.BuffTxt.GetIterAtLine(line)
+	end := mm.tvn.BuffTxt.GetIterAtLine(line)
+	if end.GetCharsInLine() > max {
+		end.SetLineOffset(max)
+	} else if !end.EndsLine() {
+		end.ForwardToLineEnd()
+	}
+	text, _ := mm.tvn.BuffTxt.GetText(start, end, true)
+	return text
+}
+
+// Ticks: search hits, bookmarks, diagnostics and TicksFunc, in drawing order.
+func (mm *Minimap) Ticks() (ticks []MinimapTick) {
+	tvn := mm.tvn
+	if ts := tvn.search; mm.ShowSearch && ts != nil && len(ts.Text) > 0 {
+		for _, m := range ts.matches {
+			ticks = append(ticks, MinimapTick{Line: m.startLine, Colour: mm.SearchCol})
+		}
+	}
+	if mm.ShowBookmarks && tvn.Bookmarks != nil {
+		for _, line := range tvn.Bookmarks.Lines() {
+			ticks = append(ticks, MinimapTick{Line: line, Colour: GutterMarkColours[GUTTER_MARK_BOOKMARK]})
+		}
+	}
+	if mm.TicksFunc != nil {
+		ticks = append(ticks, mm.TicksFunc()...)
+	}
+	if mm.ShowDiagnostics && tvn.Diagnostics != nil {
+		// Warnings first, the errors are drawn over them.
+		for _, kind := range []GutterMarkKind{GUTTER_MARK_WARNING, GUTTER_MARK_ERROR} {
+			for _, m := range tvn.Diagnostics.Marks() {
+				if m.Kind == kind {
+					ticks = append(ticks, MinimapTick{Line: m.Line(), Colour: GutterMarkColours[kind]})
+				}
+			}
+		}
+	}
+	return
+}
+
+/*
+ * Pointer
+ */
+
+// scrollTo: center the view on the line at 'y'.
+func (mm *Minimap) scrollTo(y float64) {
+	iter := mm.tvn.BuffTxt.GetIterAtLine(mm.lineAt(y))
+	mm.tvn.TextView.ScrollToIter(iter, 0, true, 0, 0.5)
+}
+
+func (mm *Minimap) buttonPressed(da *gtk.DrawingArea, event *gdk.Event) bool {
+	ev := gdk.EventButtonNewFromEvent(event)
+	if ev.Type() != gdk.EVENT_BUTTON_PRESS || ev.Button() != gdk.BUTTON_PRIMARY {
+		return false
+	}
+	mm.dragging = true
+	mm.scrollTo(ev.Y())
+	return true
+}
+
+func (mm *Minimap) buttonReleased(da *gtk.DrawingArea, event *gdk.Event) bool {
+	mm.dragging = false
+	return false
+}
+
+func (mm *Minimap) motion(da *gtk.DrawingArea, event *gdk.Event) bool {
+	if mm.dragging {
+		_, y := gdk.EventMotionNewFromEvent(event).MotionVal()
+		mm.scrollTo(y)
+		return true
+	}
+	return false
+}
+
+// scrolled: the wheel scrolls the view.
+func (mm *Minimap) scrolled(da *gtk.DrawingArea, event *gdk.Event) bool {
+	ev := gdk.EventScrollNewFromEvent(event)
+	step := mm.tvn.vAdj.GetStepIncrement() * 3
+	switch ev.Direction() {
+	case gdk.SCROLL_UP:
+		step = -step
+	case gdk.SCROLL_DOWN:
+	case gdk.SCROLL_SMOOTH:
+		step *= ev.DeltaY()
+	default:
+		return false
+	}
+	mm.tvn.vAdj.SetValue(mm.tvn.vAdj.GetValue() + step)
+	return true
+}
@@ -14,6 +14,8 @@ package textView
 import (
 	"fmt"
 	"log"
+	"os/exec"
+	"runtime"
 	"strings"
 
 	glsg "github.com/hfmrow/gen_lib/strings"
@@ -79,7 +81,8 @@ func GetTextView(tv *gtk.TextView, removeEmpty ...bool) (out []string) {
 	return
 }
 
-// SetTextView: Set []string to TextView
+// SetTextView: Set []string to TextView, lines are joined with "\n",
+// see textFile.go to save the text with another line-ending.
 func SetTextView(tv *gtk.TextView, in []string, removeEmpty ...bool) {
 	var re bool
 	var err error
@@ -96,10 +99,28 @@ func SetTextView(tv *gtk.TextView, in []string, removeEmpty ...bool) {
 				}
 			}
 		}
-		buff.SetText(strings.Join(in, glsg.GetOsLineEnd()))
+		buff.SetText(strings.Join(in, "\n"))
 	}
 	if err != nil {
 		fmt.Printf("SetTextView: %s", err.Error())
 	}
 	return
 }
+
+// OpenURI: open the URI with the default application of the desktop,
+// "xdg-open" on Linux. The command isn't waited for.
+func OpenURI(uri string) (err error) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", uri)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", uri)
+	default:
+		cmd = exec.Command("xdg-open", uri)
+	}
+	if err = cmd.Start(); err == nil {
+		go cmd.Wait()
+	}
+	return
+}
@@ -0,0 +1,314 @@
+// positions.go
+
+/*
+	This software use gotk3 that is licensed under the ISC License:
+	https://github.com/gotk3/gotk3/blob/master/LICENSE
+
+	Copyright ©2019 H.F.M - TextView Numbered  library "https//github/hfmrow"
+	This program comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+
+	Per-file memory of the cursor, the scroll position, the bookmarks and the folds, stored
+	as JSON in the user config directory. The entries are keyed by the absolute name of the
+	file and are only restored when the content hash still matches, a file modified by
+	another program starts from the top. Bookmark navigation for TextViewNumbered.
+
+Usage:
+	tvn.Positions, err = PositionStoreDefault("myApp")
+	tvn.FromFile(filename) // position restored
+	...
+	tvn.StorePosition()    // before closing the file, saved in the JSON file
+*/
+
+package textView
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gotk3/gotk3/glib"
+
+	glco "github.com/hfmrow/gen_lib/crypto"
+)
+
+const (
+	POSITIONS_FILENAME    = "positions.json"
+	POSITIONS_MAX_ENTRIES = 500
+)
+
+// FilePosition: state of the view of a file, lines and columns are 0 based.
+type FilePosition struct {
+	Hash      string    `json:"hash"`
+	Line      int       `json:"line"`
+	Column    int       `json:"column"`
+	HScroll   float64   `json:"hscroll"`
+	VScroll   float64   `json:"vscroll"`
+	Bookmarks []int     `json:"bookmarks,omitempty"`
+	Folds     []int     `json:"folds,omitempty"` // First lines of the folded regions.
+	Time      time.Time `json:"time"`
+}
+
+// PositionStore: positions of the files, it can be shared by several views.
+type PositionStore struct {
+	Filename string
+	// MaxEntries: the oldest entries are removed above this count.
+	MaxEntries int
+	// AutoSave: write the file on each change, otherwise Save must be called.
+	AutoSave bool
+
+	mu      sync.Mutex
+	entries map[string]FilePosition
+}
+
+// PositionStoreNew: load the store from 'filename', a missing file isn't an error.
+func PositionStoreNew(filename string) (ps *PositionStore, err error) {
+	ps = &PositionStore{
+		Filename:   filename,
+		MaxEntries: POSITIONS_MAX_ENTRIES,
+		AutoSave:   true,
+		entries:    make(map[string]FilePosition)}
+	if err = ps.Load(); err != nil {
+		ps = nil
+	}
+	return
+}
+
+// PositionStoreDefault: store of the application in the user config
+// directory, i.e: "~/.config/appName/positions.json".
+func PositionStoreDefault(appName string) (ps *PositionStore, err error) {
+	var dir string
+	if dir, err = os.UserConfigDir(); err != nil {
+		return
+	}
+	return PositionStoreNew(filepath.Join(dir, appName, POSITIONS_FILENAME))
+}
+
+// ContentHash: hash of a text, used to check that a stored position
+// still matches the content of the file.
+func ContentHash(text string) string {
+	return glco.Md5String(text)
+}
+
+// Load: read the file, the current entries are replaced.
+func (ps *PositionStore) Load() (err error) {
+	var data []byte
+	entries := make(map[string]FilePosition)
+	if data, err = ioutil.ReadFile(ps.Filename); err == nil {
+		err = json.Unmarshal(data, &entries)
+	} else if os.IsNotExist(err) {
+		err = nil
+	}
+	if err == nil {
+		ps.mu.Lock()
+		ps.entries = entries
+		ps.mu.Unlock()
+	}
+	return
+}
+
+// Save: write the file, through a temporary one.
+func (ps *PositionStore) Save() (err error) {
+	var data []byte
+	ps.mu.Lock()
+	data, err = json.MarshalIndent(ps.entries, "", "\t")
+	ps.mu.Unlock()
+	if err != nil {
+		return
+	}
+	if err = os.MkdirAll(filepath.Dir(ps.Filename), 0755); err != nil {
+		return
+	}
+	tmp := ps.Filename + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0644); err == nil {
+		err = os.Rename(tmp, ps.Filename)
+	}
+	return
+}
+
+// Get: position of the file, only if 'hash' matches the stored one.
+func (ps *PositionStore) Get(filename, hash string) (pos FilePosition, ok bool) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	pos, ok = ps.entries[positionKey(filename)]
+	if ok && pos.Hash != hash {
+		return FilePosition{}, false
+	}
+	return
+}
+
+// Set: store the position of the file.
+func (ps *PositionStore) Set(filename string, pos FilePosition) error {
+	pos.Time = time.Now()
+	ps.mu.Lock()
+	ps.entries[positionKey(filename)] = pos
+	ps.prune()
+	ps.mu.Unlock()
+	if ps.AutoSave {
+		return ps.Save()
+	}
+	return nil
+}
+
+// Remove: forget the file.
+func (ps *PositionStore) Remove(filename string) error {
+	ps.mu.Lock()
+	delete(ps.entries, positionKey(filename))
+	ps.mu.Unlock()
+	if ps.AutoSave {
+		return ps.Save()
+	}
+	return nil
+}
+
+// prune: remove the oldest entries above MaxEntries.
+func (ps *PositionStore) prune() {
+	if ps.MaxEntries <= 0 || len(ps.entries) <= ps.MaxEntries {
+		return
+	}
+	keys := make([]string, 0, len(ps.entries))
+	for key := range ps.entries {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return ps.entries[keys[i]].Time.Before(ps.entries[keys[j]].Time)
+	})
+	for _, key := range keys[:len(keys)-ps.MaxEntries] {
+		delete(ps.entries, key)
+	}
+}
+
+func positionKey(filename string) string {
+	if abs, err := filepath.Abs(filename); err == nil {
+		return abs
+	}
+	return filename
+}
+
+// StorePosition: store the cursor, the scroll position, the bookmarks and
+// the folds of the file loaded with FromFile or LoadFile. Nothing is done
+// if 'Positions' isn't set.
+func (tvn *TextViewNumbered) StorePosition() error {
+	if tvn.Positions == nil || len(tvn.filename) == 0 {
+		return nil
+	}
+	iter := tvn.BuffTxt.GetIterAtMark(tvn.BuffTxt.GetInsert())
+	pos := FilePosition{
+		Hash:      ContentHash(tvn.GetText()),
+		Line:      iter.GetLine(),
+		Column:    iter.GetLineOffset(),
+		HScroll:   tvn.hAdj.GetValue(),
+		VScroll:   tvn.vAdj.GetValue(),
+		Bookmarks: tvn.BookmarkLines()}
+	for _, region := range tvn.foldRegions {
+		if region.Folded {
+			pos.Folds = append(pos.Folds, region.Start)
+		}
+	}
+	return tvn.Positions.Set(tvn.filename, pos)
+}
+
+// RestorePosition: restore the bookmarks and the folds of the file, and
+// the cursor and the scroll position if 'cursor' is set. Return false if
+// there is no stored position matching the content.
+func (tvn *TextViewNumbered) RestorePosition(cursor bool) bool {
+	if tvn.Positions == nil || len(tvn.filename) == 0 {
+		return false
+	}
+	pos, ok := tvn.Positions.Get(tvn.filename, ContentHash(tvn.GetText()))
+	if !ok {
+		return false
+	}
+	count := tvn.BuffTxt.GetLineCount()
+	tvn.Bookmarks.Clear()
+	for _, line := range pos.Bookmarks {
+		if line < count {
+			tvn.Bookmarks.Add(line, GUTTER_MARK_BOOKMARK, "")
+		}
+	}
+	if len(pos.Folds) > 0 && tvn.FoldMethod != FOLD_NONE {
+		tvn.refreshFolds()
+		for _, line := range pos.Folds {
+			tvn.Fold(line)
+		}
+	}
+	if cursor && pos.Line < count {
+		tvn.UnfoldLine(pos.Line)
+		iter, end := tvn.BuffTxt.GetIterAtLine(pos.Line), tvn.lineEndIter(pos.Line)
+		if pos.Column <= end.GetLineOffset() {
+			iter.SetLineOffset(pos.Column)
+		}
+		tvn.BuffTxt.PlaceCursor(iter)
+		// Same as ScrollToLine, the text must be laid out first.
+		glib.IdleAdd(func() {
+			var count int
+			glib.TimeoutAdd(uint(64), func() bool {
+				count++
+				tvn.hAdj.SetValue(pos.HScroll)
+				tvn.vAdj.SetValue(pos.VScroll)
+				return count <= 5
+			})
+		})
+	}
+	return true
+}
+
+// clearBookmarks: remove the bookmarks of the previous file.
+func (tvn *TextViewNumbered) clearBookmarks() {
+	if tvn.Bookmarks != nil {
+		tvn.Bookmarks.Clear()
+	}
+}
+
+// BookmarkLines: lines of the bookmarks, sorted.
+func (tvn *TextViewNumbered) BookmarkLines() []int {
+	return tvn.Bookmarks.Lines()
+}
+
+// ToggleBookmark: add or remove a bookmark at the line, true if added.
+func (tvn *TextViewNumbered) ToggleBookmark(line int) bool {
+	return tvn.Bookmarks.Toggle(line, GUTTER_MARK_BOOKMARK)
+}
+
+// NextBookmark: move the cursor to the next bookmark, the search wraps
+// around the end of the text. Return the line, -1 if there is no bookmark.
+func (tvn *TextViewNumbered) NextBookmark() int {
+	return tvn.gotoBookmark(false)
+}
+
+// PrevBookmark: same as NextBookmark, backward.
+func (tvn *TextViewNumbered) PrevBookmark() int {
+	return tvn.gotoBookmark(true)
+}
+
+func (tvn *TextViewNumbered) gotoBookmark(backward bool) int {
+	lines := tvn.BookmarkLines()
+	if len(lines) == 0 {
+		return -1
+	}
+	current := tvn.BuffTxt.GetIterAtMark(tvn.BuffTxt.GetInsert()).GetLine()
+	line := lines[0]
+	if backward {
+		line = lines[len(lines)-1]
+		for idx := len(lines) - 1; idx >= 0; idx-- {
+			if lines[idx] < current {
+				line = lines[idx]
+				break
+			}
+		}
+	} else {
+		for _, l := range lines {
+			if l > current {
+				line = l
+				break
+			}
+		}
+	}
+	tvn.SetCursorAtLine(line)
+	tvn.TextView.ScrollToIter(tvn.BuffTxt.GetIterAtLine(line), 0.0, true, 0.5, 0.5)
+	return line
+}
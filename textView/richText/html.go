@@ -0,0 +1,418 @@
+// html.go
+
+/*
+	Copyright ©2019 H.F.M - Rich text library "https//github/hfmrow"
+	This program comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+
+	HTML serialization of the lines: one element per line, <p> or <hN>, the consecutive
+	code lines are grouped in a <pre>, the quote lines in a <blockquote>. The reader is
+	tolerant, it accepts the usual markup of the web pages and keeps the text of the
+	unknown elements.
+*/
+
+package richText
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// LinesToHTML: HTML fragment.
+func LinesToHTML(lines []Line) string {
+	var sb strings.Builder
+	for idx := 0; idx < len(lines); idx++ {
+		line := lines[idx]
+		switch line.Block {
+		case "pre":
+			// Each line is terminated, the reader drops the final newline, not an
+			// empty last line.
+			sb.WriteString("<pre>\n")
+			for ; idx < len(lines) && lines[idx].Block == "pre"; idx++ {
+				writeHTMLSpans(&sb, lines[idx].Spans)
+				sb.WriteByte('\n')
+			}
+			idx--
+			sb.WriteString("</pre>\n")
+		case "blockquote":
+			sb.WriteString("<blockquote>\n")
+			for ; idx < len(lines) && lines[idx].Block == "blockquote"; idx++ {
+				writeHTMLLine(&sb, "p", lines[idx])
+			}
+			idx--
+			sb.WriteString("</blockquote>\n")
+		case "":
+			writeHTMLLine(&sb, "p", line)
+		default:
+			writeHTMLLine(&sb, line.Block, line)
+		}
+	}
+	return sb.String()
+}
+
+// writeHTMLLine: element holding the line.
+func writeHTMLLine(sb *strings.Builder, element string, line Line) {
+	sb.WriteString("<" + element)
+	if text := line.Text(); strings.TrimSpace(text) != text || strings.Contains(text, "  ") || strings.Contains(text, "\t") {
+		// The spaces would be collapsed.
+		sb.WriteString(` style="white-space: pre-wrap"`)
+	}
+	sb.WriteString(">")
+	writeHTMLSpans(sb, line.Spans)
+	sb.WriteString("</" + element + ">\n")
+}
+
+func writeHTMLSpans(sb *strings.Builder, spans []Span) {
+	walkMarks(spans,
+		func(mark string) {
+			switch kind, value := markKind(mark); kind {
+			case "a":
+				sb.WriteString(`<a href="` + html.EscapeString(value) + `">`)
+			case "style":
+				sb.WriteString(`<span style="` + html.EscapeString(value) + `">`)
+			default:
+				sb.WriteString("<" + kind + ">")
+			}
+		},
+		func(mark string) {
+			switch kind, _ := markKind(mark); kind {
+			case "style":
+				sb.WriteString("</span>")
+			default:
+				sb.WriteString("</" + kind + ">")
+			}
+		},
+		func(text string, marks []string) {
+			sb.WriteString(html.EscapeString(text))
+		})
+}
+
+/*
+ * Reader
+ */
+
+// htmlToken: text, start or end tag.
+type htmlToken struct {
+	text    string // Unescaped text
+	name    string // Lower case element name, "" for the text
+	end     bool
+	attrs   map[string]string
+	closing bool // <br/>
+}
+
+var (
+	regHTMLTag  = regexp.MustCompile(`^<(/?)([a-zA-Z][a-zA-Z0-9-]*)((?:\s+[^\s"'>/=]+(?:\s*=\s*(?:"[^"]*"|'[^']*'|[^\s"'=<>` + "`" + `]+))?)*)\s*(/?)>`)
+	regHTMLAttr = regexp.MustCompile(`([^\s"'>/=]+)(?:\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'=<>` + "`" + `]+)))?`)
+	regSpaces   = regexp.MustCompile(`[ \t\r\n\f]+`)
+)
+
+// tokenizeHTML: split the markup, comments, doctype and processing
+// instructions are dropped.
+func tokenizeHTML(text string) (tokens []htmlToken) {
+	var buf strings.Builder
+	flush := func() {
+		if buf.Len() > 0 {
+			tokens = append(tokens, htmlToken{text: html.UnescapeString(buf.String())})
+			buf.Reset()
+		}
+	}
+	for idx := 0; idx < len(text); {
+		if text[idx] != '<' {
+			end := strings.IndexByte(text[idx:], '<')
+			if end < 0 {
+				end = len(text) - idx
+			}
+			buf.WriteString(text[idx : idx+end])
+			idx += end
+			continue
+		}
+		rest := text[idx:]
+		switch {
+		case strings.HasPrefix(rest, "<!--"):
+			flush()
+			if end := strings.Index(rest[4:], "-->"); end >= 0 {
+				idx += 4 + end + 3
+			} else {
+				idx = len(text)
+			}
+		case strings.HasPrefix(rest, "<!"), strings.HasPrefix(rest, "<?"):
+			flush()
+			if end := strings.IndexByte(rest, '>'); end >= 0 {
+				idx += end + 1
+			} else {
+				idx = len(text)
+			}
+		default:
+			m := regHTMLTag.FindStringSubmatch(rest)
+			if m == nil {
+				buf.WriteByte('<')
+				idx++
+				continue
+			}
+			flush()
+			token := htmlToken{
+				name:    strings.ToLower(m[2]),
+				end:     len(m[1]) > 0,
+				closing: len(m[4]) > 0,
+				attrs:   make(map[string]string)}
+			for _, a := range regHTMLAttr.FindAllStringSubmatch(m[3], -1) {
+				token.attrs[strings.ToLower(a[1])] = html.UnescapeString(a[2] + a[3] + a[4])
+			}
+			tokens = append(tokens, token)
+			idx += len(m[0])
+		}
+	}
+	flush()
+	return
+}
+
+// htmlInlineMarks: inline elements and their mark.
+var htmlInlineMarks = map[string]string{
+	"strong": "strong", "b": "strong", "em": "em", "i": "em", "cite": "em", "var": "em",
+	"u": "u", "ins": "u", "s": "s", "strike": "s", "del": "s", "mark": "mark",
+	"sup": "sup", "sub": "sub", "code": "code", "tt": "code", "kbd": "code", "samp": "code",
+}
+
+// htmlMark: mark of an inline start tag, "" for the elements that only
+// hold text, ok is false for the block elements.
+func htmlMark(token htmlToken) (mark string, ok bool) {
+	if mark, ok = htmlInlineMarks[token.name]; ok {
+		return
+	}
+	switch token.name {
+	case "a":
+		if href, found := token.attrs["href"]; found && len(href) > 0 {
+			return "a:" + href, true
+		}
+		return "", true
+	case "span", "font", "small", "big", "abbr", "q", "label", "time", "dfn":
+		css := token.attrs["style"]
+		if color, found := token.attrs["color"]; found && token.name == "font" {
+			css = "color: " + color + ";" + css
+		}
+		if css = parseCSS(css).String(); len(css) > 0 {
+			return "style:" + css, true
+		}
+		return "", true
+	}
+	return
+}
+
+// htmlBlocks: elements starting a new line.
+var htmlBlocks = map[string]bool{
+	"p": true, "div": true, "li": true, "dt": true, "dd": true, "tr": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"pre": true, "blockquote": true, "ul": true, "ol": true, "dl": true, "table": true,
+	"section": true, "article": true, "header": true, "footer": true, "nav": true,
+	"aside": true, "main": true, "figure": true, "figcaption": true, "address": true,
+	"hr": true, "body": true, "html": true,
+}
+
+// htmlSkipped: elements whose content is dropped.
+var htmlSkipped = map[string]bool{
+	"head": true, "script": true, "style": true, "title": true, "template": true,
+}
+
+// htmlReader: build the lines from the tokens.
+type htmlReader struct {
+	lines    []Line
+	cur      Line
+	hasText, // The current line holds some text.
+	open bool // A block element is open, an empty one gives an empty line.
+	blocks   []string // Open "hN", "pre" and "blockquote".
+	marks    []openMark
+	cell     bool  // A table cell is already in the line.
+	list     []int // Numbering of the open lists, -1 for bullets.
+	skip     int
+	preStart bool
+	preWrap  bool // "white-space: pre..." style of the current block.
+}
+
+// openMark: inline element and its mark.
+type openMark struct {
+	name, mark string
+}
+
+// HTMLToLines: read an HTML document or fragment.
+func HTMLToLines(text string) []Line {
+	r := new(htmlReader)
+	for _, token := range tokenizeHTML(text) {
+		r.token(token)
+	}
+	r.flush(false)
+	return r.lines
+}
+
+func (r *htmlReader) block() string {
+	if n := len(r.blocks); n > 0 {
+		return r.blocks[n-1]
+	}
+	return ""
+}
+
+func (r *htmlReader) inPre() bool {
+	for _, b := range r.blocks {
+		if b == "pre" {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *htmlReader) currentMarks() (marks []string) {
+	pre := r.inPre()
+	for _, m := range r.marks {
+		// <pre><code> is the usual markup of the code blocks.
+		if len(m.mark) > 0 && !(pre && m.mark == "code") {
+			marks = append(marks, m.mark)
+		}
+	}
+	return sortMarks(marks)
+}
+
+// flush: end the current line, 'force' to keep it when empty.
+func (r *htmlReader) flush(force bool) {
+	if !(force || r.hasText || r.open) {
+		return
+	}
+	if n := len(r.cur.Spans); n > 0 && !r.inPre() && !r.preWrap {
+		last := &r.cur.Spans[n-1]
+		if last.Text = strings.TrimRight(last.Text, " "); len(last.Text) == 0 {
+			r.cur.Spans = r.cur.Spans[:n-1]
+		}
+	}
+	r.cur.Block = r.block()
+	r.lines = append(r.lines, r.cur)
+	r.cur = Line{}
+	r.hasText, r.open, r.cell, r.preWrap = false, false, false, false
+}
+
+func (r *htmlReader) text(text string) {
+	if r.skip > 0 {
+		return
+	}
+	if r.inPre() || r.preWrap {
+		if r.preStart {
+			text = strings.TrimPrefix(text, "\n")
+			r.preStart = false
+		}
+		for idx, part := range strings.Split(text, "\n") {
+			if idx > 0 {
+				r.flush(true)
+			}
+			if len(part) > 0 {
+				r.cur.add(part, r.currentMarks())
+				r.hasText = true
+			}
+		}
+		return
+	}
+	text = regSpaces.ReplaceAllString(text, " ")
+	if !r.hasText {
+		text = strings.TrimLeft(text, " ")
+	} else if n := len(r.cur.Spans); n > 0 && strings.HasSuffix(r.cur.Spans[n-1].Text, " ") {
+		text = strings.TrimLeft(text, " ")
+	}
+	if len(text) > 0 {
+		r.cur.add(text, r.currentMarks())
+		r.hasText = true
+	}
+}
+
+func (r *htmlReader) token(token htmlToken) {
+	if len(token.name) == 0 {
+		r.text(token.text)
+		return
+	}
+	r.preStart = false
+	if htmlSkipped[token.name] {
+		if token.end {
+			if r.skip > 0 {
+				r.skip--
+			}
+		} else if !token.closing {
+			r.skip++
+		}
+		return
+	}
+	if r.skip > 0 {
+		return
+	}
+	switch {
+	case token.name == "br":
+		r.flush(true)
+	case token.name == "img":
+		if alt := token.attrs["alt"]; len(alt) > 0 {
+			r.text(alt)
+		}
+	case token.name == "td" || token.name == "th":
+		if !token.end && r.cell {
+			r.text(" | ")
+		}
+		r.cell = true
+	case htmlBlocks[token.name]:
+		r.blockToken(token)
+	default:
+		if token.end {
+			for idx := len(r.marks) - 1; idx >= 0; idx-- {
+				if r.marks[idx].name == token.name {
+					r.marks = append(r.marks[:idx], r.marks[idx+1:]...)
+					break
+				}
+			}
+		} else if mark, ok := htmlMark(token); ok && !token.closing {
+			r.marks = append(r.marks, openMark{token.name, mark})
+		}
+	}
+}
+
+func (r *htmlReader) blockToken(token htmlToken) {
+	switch name := token.name; {
+	case token.end:
+		r.flush(false)
+		switch name {
+		case "ul", "ol":
+			if n := len(r.list); n > 0 {
+				r.list = r.list[:n-1]
+			}
+		default:
+			if blockElements[name] {
+				for idx := len(r.blocks) - 1; idx >= 0; idx-- {
+					if r.blocks[idx] == name {
+						r.blocks = append(r.blocks[:idx], r.blocks[idx+1:]...)
+						break
+					}
+				}
+			}
+		}
+	default:
+		r.flush(false)
+		switch name {
+		case "ul":
+			r.list = append(r.list, -1)
+		case "ol":
+			r.list = append(r.list, 1)
+		case "hr", "body", "html", "table", "dl":
+		default:
+			if blockElements[name] {
+				r.blocks = append(r.blocks, name)
+				r.preStart = name == "pre"
+			}
+			if name != "blockquote" {
+				r.open = true
+				r.preWrap = strings.Contains(token.attrs["style"], "white-space: pre")
+			}
+			if n := len(r.list); name == "li" && n > 0 {
+				prefix := strings.Repeat("  ", n-1) + "• "
+				if r.list[n-1] > 0 {
+					prefix = strings.Repeat("  ", n-1) + strconv.Itoa(r.list[n-1]) + ". "
+					r.list[n-1]++
+				}
+				r.cur.add(prefix, nil)
+				r.hasText = true
+			}
+		}
+	}
+}
@@ -0,0 +1,529 @@
+// markdown.go
+
+/*
+	Copyright ©2019 H.F.M - Rich text library "https//github/hfmrow"
+	This program comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+
+	Markdown serialization of the lines. The consecutive lines of text are written as one
+	paragraph with hard line breaks ('\' at the end of the line), an empty line of the
+	buffer gives a blank line, the next ones a "<br>" block. The empty quote lines are
+	"<br>" blocks in the quote, the empty headings have no text after the '#'. The inline
+	elements without Markdown syntax (u, mark, sup, sub and the inline styles) are written
+	as raw HTML. The reader uses the markdown package, the lists, rules and tables are
+	flattened to text lines.
+*/
+
+package richText
+
+import (
+	"html"
+	"reflect"
+	"strconv"
+	"strings"
+
+	gitvmd "github.com/hfmrow/gtk3_import/textView/markdown"
+)
+
+// mdDelimiters: marks with a Markdown delimiter, they can't hold the
+// surrounding spaces.
+var mdDelimiters = map[string]string{"strong": "**", "em": "*", "s": "~~"}
+
+// LinesToMarkdown: Markdown document.
+func LinesToMarkdown(lines []Line) string {
+	var sb strings.Builder
+	idx := 0
+	for idx < len(lines) && lines[idx].IsEmpty() {
+		idx++
+	}
+	if idx == len(lines) {
+		if len(lines) < 2 {
+			return ""
+		}
+		return strings.TrimSuffix(strings.Repeat("<br>\n\n", len(lines)), "\n")
+	}
+	sb.WriteString(strings.Repeat("<br>\n\n", idx))
+
+	for idx < len(lines) {
+		kind := lines[idx].Block
+		grouped := kind == "" || kind == "pre" || kind == "blockquote" // Not the headings
+		start := idx
+		for idx++; grouped && idx < len(lines) && lines[idx].Block == kind && !lines[idx].IsEmpty() &&
+			(kind != "blockquote" || len(lines[idx].Spans) == 0 == (len(lines[start].Spans) == 0)); idx++ {
+		}
+		writeMDGroup(&sb, lines[start:idx])
+
+		empty := 0
+		for ; idx < len(lines) && lines[idx].IsEmpty(); idx++ {
+			empty++
+		}
+		switch {
+		case idx == len(lines):
+			if empty > 0 {
+				sb.WriteString("\n\n" + strings.TrimSuffix(strings.Repeat("<br>\n\n", empty), "\n\n"))
+			}
+		case empty > 0:
+			sb.WriteString("\n\n" + strings.Repeat("<br>\n\n", empty-1))
+		case kind == "blockquote":
+			// The next line would be a lazy continuation of the quote.
+			sb.WriteString("\n<!-- -->\n")
+		default:
+			sb.WriteString("\n")
+		}
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+// writeMDGroup: lines of the same block.
+func writeMDGroup(sb *strings.Builder, lines []Line) {
+	switch kind := lines[0].Block; kind {
+	case "pre":
+		var text []string
+		for _, line := range lines {
+			text = append(text, line.Text())
+		}
+		code := strings.Join(text, "\n")
+		fence := strings.Repeat("`", maxRun(code, '`')+1)
+		if len(fence) < 3 {
+			fence = "```"
+		}
+		sb.WriteString(fence + "\n" + code + "\n" + fence)
+	case "blockquote":
+		if len(lines[0].Spans) == 0 {
+			// A hard line break can't end the paragraph, the empty lines are
+			// HTML blocks.
+			sb.WriteString(strings.TrimSuffix(strings.Repeat("> <br>\n", len(lines)), "\n"))
+			break
+		}
+		fallthrough
+	case "":
+		// The lines are checked again together, the context can change their
+		// meaning, i.e: a line taken as a table delimiter row.
+		text := mdParagraph(lines, false)
+		got := MarkdownToLines(text)
+		same := len(got) == len(lines)
+		for idx := 0; same && idx < len(lines); idx++ {
+			same = reflect.DeepEqual(got[idx], mdExpected(kind, lines[idx].Spans))
+		}
+		if !same {
+			text = mdParagraph(lines, true)
+		}
+		sb.WriteString(text)
+	default:
+		sb.WriteString(strings.Repeat("#", int(kind[1]-'0')))
+		if len(lines[0].Spans) > 0 {
+			sb.WriteString(" " + mdLine(lines[0].Spans, true))
+		}
+	}
+}
+
+// mdParagraph: lines separated with hard line breaks, 'tags' to write all
+// the emphasis as HTML elements.
+func mdParagraph(lines []Line, tags bool) string {
+	var sb strings.Builder
+	for idx, line := range lines {
+		if idx > 0 {
+			sb.WriteString("\\\n")
+		}
+		if line.Block == "blockquote" {
+			sb.WriteString("> ")
+		}
+		if tags {
+			spans, lead, trail := mdSpaces(line.Spans)
+			sb.WriteString(mdInline(spans, lead, trail, false, true))
+		} else {
+			sb.WriteString(mdLine(line.Spans, false))
+		}
+	}
+	return sb.String()
+}
+
+func maxRun(text string, c byte) (max int) {
+	for idx, run := 0, 0; idx < len(text); idx++ {
+		if text[idx] == c {
+			if run++; run > max {
+				max = run
+			}
+		} else {
+			run = 0
+		}
+	}
+	return
+}
+
+// mdLine: inline content of a line, 'heading' to escape the '#'. The
+// emphasis delimiters are replaced with HTML elements where they
+// would not be recognized, i.e: "**a.**b".
+func mdLine(spans []Span, heading bool) string {
+	want := mdExpected("", spans)
+	spans, lead, trail := mdSpaces(spans)
+	text := mdInline(spans, lead, trail, heading, false)
+	var got Line
+	if lines := MarkdownToLines(text); len(lines) == 1 {
+		got = lines[0]
+	}
+	if !reflect.DeepEqual(got.Spans, want.Spans) {
+		text = mdInline(spans, lead, trail, heading, true)
+	}
+	return text
+}
+
+// mdExpected: line read back from its Markdown, the spaces are moved out
+// of the delimiters (see mdSpaces).
+func mdExpected(kind string, spans []Span) (line Line) {
+	spans, lead, trail := mdSpaces(spans)
+	line.Block = kind
+	line.add(html.UnescapeString(lead), nil)
+	for _, span := range spans {
+		line.add(span.Text, sortMarks(span.Marks))
+	}
+	line.add(html.UnescapeString(trail), nil)
+	return
+}
+
+// mdInline: 'tags' to write the emphasis as HTML elements.
+func mdInline(spans []Span, lead, trail string, heading, tags bool) string {
+	var sb, code strings.Builder
+	inCode, inLink, lineStart := false, false, true
+	next := 0 // Index of the next span
+	sb.WriteString(lead)
+	walkMarks(spans,
+		func(mark string) {
+			switch kind, value := markKind(mark); kind {
+			case "code":
+				inCode = true
+			case "a":
+				sb.WriteString("[")
+				inLink = true
+			case "style":
+				sb.WriteString(`<span style="` + strings.ReplaceAll(value, `"`, "&quot;") + `">`)
+			default:
+				if delim, ok := mdDelimiters[kind]; ok && !tags {
+					sb.WriteString(delim)
+				} else {
+					sb.WriteString("<" + kind + ">")
+				}
+			}
+		},
+		func(mark string) {
+			switch kind, value := markKind(mark); kind {
+			case "code":
+				if inLink && strings.Contains(code.String(), "]") {
+					// The bracket would end the label of a link reference definition.
+					sb.WriteString("<code>" + mdEscape(code.String(), false, heading) + "</code>")
+				} else {
+					sb.WriteString(mdCode(code.String()))
+				}
+				code.Reset()
+				inCode = false
+			case "a":
+				inLink = false
+				if strings.ContainsAny(value, " ()<>") {
+					value = "<" + strings.NewReplacer("<", "%3C", ">", "%3E").Replace(value) + ">"
+				}
+				sb.WriteString("](" + value + ")")
+			case "style":
+				sb.WriteString("</span>")
+			default:
+				if delim, ok := mdDelimiters[kind]; ok && !tags {
+					sb.WriteString(delim)
+				} else {
+					sb.WriteString("</" + kind + ">")
+				}
+			}
+		},
+		func(text string, marks []string) {
+			next++
+			if inCode {
+				code.WriteString(text)
+				lineStart = false
+				return
+			}
+			text = mdEscape(text, lineStart, heading)
+			if len(marks) == 0 && next < len(spans) && strings.HasSuffix(text, "!") && mdLink(spans[next].Marks) {
+				// Not an image.
+				text = text[:len(text)-1] + "\\!"
+			}
+			sb.WriteString(text)
+			lineStart = lineStart && len(text) == 0
+		})
+	sb.WriteString(trail)
+	return sb.String()
+}
+
+// mdLink: the marks hold a link.
+func mdLink(marks []string) bool {
+	for _, mark := range marks {
+		if kind, _ := markKind(mark); kind == "a" {
+			return true
+		}
+	}
+	return false
+}
+
+// mdSpaces: move the spaces out of the delimiters, the leading and trailing
+// ones of the line are returned as entities, they would be trimmed.
+func mdSpaces(spans []Span) (out []Span, lead, trail string) {
+	for _, span := range spans {
+		var plain []string
+		for _, mark := range span.Marks {
+			if _, ok := mdDelimiters[mark]; !ok {
+				plain = append(plain, mark)
+			}
+		}
+		if len(plain) == len(span.Marks) {
+			out = append(out, span)
+			continue
+		}
+		text := strings.TrimLeft(span.Text, " \t")
+		if n := len(span.Text) - len(text); n > 0 {
+			out = append(out, Span{Text: span.Text[:n], Marks: plain})
+		}
+		trimmed := strings.TrimRight(text, " \t")
+		if len(trimmed) > 0 {
+			out = append(out, Span{Text: trimmed, Marks: span.Marks})
+		}
+		if n := len(text) - len(trimmed); n > 0 {
+			out = append(out, Span{Text: text[len(trimmed):], Marks: plain})
+		}
+	}
+	entity := func(text string) string {
+		return strings.NewReplacer(" ", "&#32;", "\t", "&#9;").Replace(text)
+	}
+	for len(out) > 0 {
+		text := strings.TrimLeft(out[0].Text, " \t")
+		lead += entity(out[0].Text[:len(out[0].Text)-len(text)])
+		if len(text) > 0 {
+			out[0].Text = text
+			break
+		}
+		out = out[1:]
+	}
+	for len(out) > 0 {
+		last := &out[len(out)-1]
+		text := strings.TrimRight(last.Text, " \t")
+		trail = entity(last.Text[len(text):]) + trail
+		if len(text) > 0 {
+			last.Text = text
+			break
+		}
+		out = out[:len(out)-1]
+	}
+	return
+}
+
+// mdCode: code span, the delimiter is longer than the backticks of the code.
+func mdCode(code string) string {
+	fence := strings.Repeat("`", maxRun(code, '`')+1)
+	if strings.HasPrefix(code, "`") || strings.HasSuffix(code, "`") ||
+		(strings.HasPrefix(code, " ") && strings.HasSuffix(code, " ") && len(strings.TrimSpace(code)) > 0) {
+		code = " " + code + " "
+	}
+	return fence + code + fence
+}
+
+// mdEscape: backslash the characters that would be taken as markup.
+func mdEscape(text string, lineStart, heading bool) string {
+	var sb strings.Builder
+	for idx := 0; idx < len(text); idx++ {
+		c := text[idx]
+		switch {
+		case strings.IndexByte("\\`*_[]<>~&", c) >= 0,
+			c == '#' && (heading || (lineStart && idx == 0)),
+			lineStart && idx == 0 && strings.IndexByte("-+=|:", c) >= 0:
+			sb.WriteByte('\\')
+		case lineStart && (c == '.' || c == ')') && idx > 0 && idx < 10 &&
+			strings.Trim(text[:idx], "0123456789") == "":
+			// Ordered list marker.
+			sb.WriteByte('\\')
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
+
+/*
+ * Reader
+ */
+
+// mdReader: build the lines from the blocks.
+type mdReader struct {
+	doc   *gitvmd.Document
+	lines []Line
+	cur   *Line
+	html  []openMark // Inline HTML elements.
+}
+
+// MarkdownToLines: read a Markdown document.
+func MarkdownToLines(text string) []Line {
+	r := &mdReader{doc: gitvmd.Parse(text)}
+	var brs int
+	var blank, started, content bool
+	for _, block := range r.doc.Root.Children {
+		if content && !started {
+			blank, started = block.Blank, true
+		}
+		if block.Kind == gitvmd.BLOCK_HTML {
+			if isBreak(block.Text) {
+				brs++
+				continue
+			}
+			if len(HTMLToLines(block.Text)) == 0 {
+				continue
+			}
+		}
+		if blank {
+			brs++
+		}
+		for ; brs > 0; brs-- {
+			r.lines = append(r.lines, Line{})
+		}
+		r.block(block, "", 0)
+		blank, started, content = false, false, true
+	}
+	for ; brs > 0; brs-- {
+		r.lines = append(r.lines, Line{})
+	}
+	return r.lines
+}
+
+// isBreak: "<br>" block, an empty line.
+func isBreak(text string) bool {
+	switch strings.ToLower(strings.TrimSpace(text)) {
+	case "<br>", "<br/>", "<br />":
+		return true
+	}
+	return false
+}
+
+func (r *mdReader) newLine(kind string) {
+	r.lines = append(r.lines, Line{Block: kind})
+	r.cur = &r.lines[len(r.lines)-1]
+}
+
+// block: add the lines of the block, 'kind' is "" or "blockquote".
+func (r *mdReader) block(block *gitvmd.Block, kind string, depth int) {
+	switch block.Kind {
+	case gitvmd.BLOCK_PARAGRAPH:
+		r.newLine(kind)
+		r.html = nil
+		r.inline(r.doc.ParseInline(block.Text), nil)
+	case gitvmd.BLOCK_HEADING:
+		if len(kind) == 0 {
+			kind = "h" + strconv.Itoa(block.Level)
+		}
+		r.newLine(kind)
+		r.html = nil
+		r.inline(r.doc.ParseInline(block.Text), nil)
+	case gitvmd.BLOCK_CODE:
+		if len(kind) == 0 {
+			kind = "pre"
+		}
+		for _, text := range strings.Split(strings.TrimSuffix(block.Text, "\n"), "\n") {
+			r.newLine(kind)
+			r.cur.add(text, nil)
+		}
+	case gitvmd.BLOCK_QUOTE:
+		for _, child := range block.Children {
+			r.block(child, "blockquote", depth)
+		}
+	case gitvmd.BLOCK_LIST:
+		for idx, item := range block.Children {
+			prefix := strings.Repeat("  ", depth) + "• "
+			if block.Ordered {
+				prefix = strings.Repeat("  ", depth) + strconv.Itoa(block.Start+idx) + ". "
+			}
+			first := len(r.lines)
+			for _, child := range item.Children {
+				r.block(child, kind, depth+1)
+			}
+			if first == len(r.lines) {
+				r.newLine(kind)
+			}
+			if line := &r.lines[first]; len(line.Spans) > 0 && len(line.Spans[0].Marks) == 0 {
+				line.Spans[0].Text = prefix + line.Spans[0].Text
+			} else {
+				line.Spans = append([]Span{{Text: prefix}}, line.Spans...)
+			}
+		}
+	case gitvmd.BLOCK_RULE:
+		r.newLine(kind)
+		r.cur.add(strings.Repeat("─", gitvmd.MARKDOWN_RULE_WIDTH), nil)
+	case gitvmd.BLOCK_TABLE:
+		for _, row := range block.Rows {
+			r.newLine(kind)
+			r.html = nil
+			for idx, cell := range row {
+				if idx > 0 {
+					r.cur.add(" | ", nil)
+				}
+				r.inline(r.doc.ParseInline(cell), nil)
+			}
+		}
+	case gitvmd.BLOCK_HTML:
+		for _, line := range HTMLToLines(block.Text) {
+			if len(line.Block) == 0 {
+				line.Block = kind
+			}
+			r.lines = append(r.lines, line)
+		}
+	}
+}
+
+// inline: add the inline nodes to the current line.
+func (r *mdReader) inline(nodes []*gitvmd.Inline, marks []string) {
+	add := func(text string, extra ...string) {
+		all := append(append([]string{}, marks...), extra...)
+		for _, m := range r.html {
+			if len(m.mark) > 0 {
+				all = append(all, m.mark)
+			}
+		}
+		r.cur.add(text, sortMarks(all))
+	}
+	with := func(mark string) []string {
+		return append(append([]string{}, marks...), mark)
+	}
+	for _, node := range nodes {
+		switch node.Kind {
+		case gitvmd.INLINE_TEXT:
+			add(node.Text)
+		case gitvmd.INLINE_CODE:
+			add(node.Text, "code")
+		case gitvmd.INLINE_EMPHASIS:
+			r.inline(node.Children, with("em"))
+		case gitvmd.INLINE_STRONG:
+			r.inline(node.Children, with("strong"))
+		case gitvmd.INLINE_STRIKE:
+			r.inline(node.Children, with("s"))
+		case gitvmd.INLINE_LINK:
+			r.inline(node.Children, with("a:"+node.Dest))
+		case gitvmd.INLINE_IMAGE:
+			add(gitvmd.PlainText(node.Children))
+		case gitvmd.INLINE_BREAK:
+			r.newLine(r.cur.Block)
+		case gitvmd.INLINE_SOFTBREAK:
+			add(" ")
+		case gitvmd.INLINE_HTML:
+			for _, token := range tokenizeHTML(node.Text) {
+				switch {
+				case len(token.name) == 0:
+				case token.name == "br":
+					r.newLine(r.cur.Block)
+				case token.end:
+					for idx := len(r.html) - 1; idx >= 0; idx-- {
+						if r.html[idx].name == token.name {
+							r.html = append(r.html[:idx], r.html[idx+1:]...)
+							break
+						}
+					}
+				default:
+					if mark, ok := htmlMark(token); ok && !token.closing {
+						r.html = append(r.html, openMark{token.name, mark})
+					}
+				}
+			}
+		}
+	}
+}
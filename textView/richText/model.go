@@ -0,0 +1,285 @@
+// model.go
+
+/*
+	Copyright ©2019 H.F.M - Rich text library "https//github/hfmrow"
+	This program comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+
+	Intermediate representation shared by the serializers: the text is a list of lines,
+	each one holds a block element and spans of text carrying the same inline elements.
+*/
+
+package richText
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Line: line of the buffer.
+type Line struct {
+	// Block: "" (paragraph), "h1" ... "h6", "pre" or "blockquote".
+	Block string
+	Spans []Span
+}
+
+// Span: text with the same inline elements.
+type Span struct {
+	Text string
+	// Marks: "strong", "em", "u", "s", "mark", "sup", "sub", "code",
+	// "a:<uri>" or "style:<css>".
+	Marks []string
+}
+
+// Text: text of the line.
+func (l *Line) Text() string {
+	var sb strings.Builder
+	for _, span := range l.Spans {
+		sb.WriteString(span.Text)
+	}
+	return sb.String()
+}
+
+// IsEmpty: paragraph line without text, the lines of the other blocks
+// are never empty.
+func (l *Line) IsEmpty() bool {
+	return len(l.Block) == 0 && len(l.Text()) == 0
+}
+
+// add: append the text, merged with the last span if the marks are the same.
+func (l *Line) add(text string, marks []string) {
+	if len(text) == 0 {
+		return
+	}
+	if n := len(l.Spans); n > 0 && sameMarks(l.Spans[n-1].Marks, marks) {
+		l.Spans[n-1].Text += text
+		return
+	}
+	l.Spans = append(l.Spans, Span{Text: text, Marks: append([]string(nil), marks...)})
+}
+
+// blockElements: elements applied to whole lines.
+var blockElements = map[string]bool{
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"pre": true, "blockquote": true,
+}
+
+// markRanks: nesting order of the inline elements, the first one is the outermost.
+var markRanks = map[string]int{
+	"a": 0, "style": 1, "strong": 2, "em": 3, "u": 4, "s": 5,
+	"mark": 6, "sup": 7, "sub": 8, "code": 9,
+}
+
+// markKind: element of the mark, "a" and "style" hold a value.
+func markKind(mark string) (kind, value string) {
+	if idx := strings.Index(mark, ":"); idx > 0 {
+		return mark[:idx], mark[idx+1:]
+	}
+	return mark, ""
+}
+
+// sortMarks: canonical order, without duplicates.
+func sortMarks(marks []string) (out []string) {
+	out = append(out, marks...)
+	sort.SliceStable(out, func(i, j int) bool {
+		ki, _ := markKind(out[i])
+		kj, _ := markKind(out[j])
+		if markRanks[ki] != markRanks[kj] {
+			return markRanks[ki] < markRanks[kj]
+		}
+		return out[i] < out[j]
+	})
+	for idx := 1; idx < len(out); idx++ {
+		if out[idx] == out[idx-1] {
+			out = append(out[:idx], out[idx+1:]...)
+			idx--
+		}
+	}
+	return
+}
+
+func sameMarks(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for idx := range a {
+		if a[idx] != b[idx] {
+			return false
+		}
+	}
+	return true
+}
+
+// walkMarks: write the spans, 'open' and 'close' are called to nest the
+// elements, the ones shared by consecutive spans are kept open.
+func walkMarks(spans []Span, open, close func(mark string), text func(text string, marks []string)) {
+	var stack []string
+	for _, span := range spans {
+		marks := sortMarks(span.Marks)
+		keep := 0
+		for keep < len(stack) && keep < len(marks) && stack[keep] == marks[keep] {
+			keep++
+		}
+		for idx := len(stack) - 1; idx >= keep; idx-- {
+			close(stack[idx])
+		}
+		stack = stack[:keep]
+		for _, mark := range marks[keep:] {
+			open(mark)
+			stack = append(stack, mark)
+		}
+		text(span.Text, stack)
+	}
+	for idx := len(stack) - 1; idx >= 0; idx-- {
+		close(stack[idx])
+	}
+}
+
+/*
+ * Inline styles
+ */
+
+// style: inline style of a tag without element, the empty fields are unset.
+type style struct {
+	color,
+	background,
+	weight, // "bold", "normal" or a number
+	fontStyle, // "italic", "oblique" or "normal"
+	decoration, // "underline", "line-through" or both
+	family,
+	size string // "1.2em" or "12pt"
+}
+
+// String: canonical CSS declarations.
+func (s style) String() string {
+	var decls []string
+	for _, d := range [][2]string{
+		{"color", s.color}, {"background-color", s.background},
+		{"font-weight", s.weight}, {"font-style", s.fontStyle},
+		{"text-decoration", s.decoration}, {"font-family", s.family},
+		{"font-size", s.size}} {
+		if len(d[1]) > 0 {
+			decls = append(decls, d[0]+": "+d[1])
+		}
+	}
+	return strings.Join(decls, "; ")
+}
+
+// parseCSS: read the supported declarations of a "style" attribute.
+func parseCSS(css string) (s style) {
+	for _, decl := range strings.Split(css, ";") {
+		idx := strings.Index(decl, ":")
+		if idx < 0 {
+			continue
+		}
+		name := strings.ToLower(strings.TrimSpace(decl[:idx]))
+		value := strings.TrimSpace(decl[idx+1:])
+		value = strings.TrimSpace(strings.TrimSuffix(value, "!important"))
+		lower := strings.ToLower(value)
+		switch name {
+		case "color":
+			s.color = cssColour(lower)
+		case "background-color", "background":
+			s.background = cssColour(lower)
+		case "font-weight":
+			switch lower {
+			case "bold", "bolder":
+				s.weight = "bold"
+			case "normal", "lighter":
+				s.weight = "normal"
+			default:
+				if n, err := strconv.Atoi(lower); err == nil && n > 0 {
+					s.weight = cssWeight(n)
+				}
+			}
+		case "font-style":
+			if lower == "italic" || lower == "oblique" || lower == "normal" {
+				s.fontStyle = lower
+			}
+		case "text-decoration", "text-decoration-line":
+			var decos []string
+			for _, word := range strings.Fields(lower) {
+				if word == "underline" || word == "line-through" {
+					decos = append(decos, word)
+				}
+			}
+			s.decoration = strings.Join(decos, " ")
+		case "font-family":
+			s.family = strings.Trim(value, `"' `)
+		case "font-size":
+			s.size = cssSize(lower)
+		}
+	}
+	return
+}
+
+// cssWeight: "bold", "normal" or the number.
+func cssWeight(n int) string {
+	switch n {
+	case 700:
+		return "bold"
+	case 400:
+		return "normal"
+	}
+	return strconv.Itoa(n)
+}
+
+// cssColour: "#rrggbb" for the hexadecimal and rgb() notations, the names are kept.
+func cssColour(value string) string {
+	switch {
+	case strings.HasPrefix(value, "#") && len(value) == 4:
+		return "#" + strings.Repeat(value[1:2], 2) + strings.Repeat(value[2:3], 2) + strings.Repeat(value[3:4], 2)
+	case strings.HasPrefix(value, "rgb"):
+		start, end := strings.Index(value, "("), strings.Index(value, ")")
+		if start < 0 || end < start {
+			return ""
+		}
+		var rgb []int
+		for _, f := range strings.Split(value[start+1:end], ",") {
+			f = strings.TrimSpace(f)
+			var v float64
+			if strings.HasSuffix(f, "%") {
+				p, _ := strconv.ParseFloat(strings.TrimSuffix(f, "%"), 64)
+				v = p * 255 / 100
+			} else {
+				v, _ = strconv.ParseFloat(f, 64)
+			}
+			rgb = append(rgb, int(v+0.5))
+		}
+		if len(rgb) < 3 {
+			return ""
+		}
+		return fmt.Sprintf("#%02x%02x%02x", clamp(rgb[0]), clamp(rgb[1]), clamp(rgb[2]))
+	}
+	return value
+}
+
+func clamp(v int) int {
+	if v < 0 {
+		return 0
+	} else if v > 255 {
+		return 255
+	}
+	return v
+}
+
+// cssSize: "em" for the relative sizes, "pt" for the absolute ones.
+func cssSize(value string) string {
+	units := []struct {
+		suffix string
+		factor float64
+		unit   string
+	}{{"rem", 1, "em"}, {"em", 1, "em"}, {"%", 0.01, "em"}, {"pt", 1, "pt"}, {"px", 0.75, "pt"}}
+	for _, u := range units {
+		if strings.HasSuffix(value, u.suffix) {
+			if v, err := strconv.ParseFloat(strings.TrimSuffix(value, u.suffix), 64); err == nil && v > 0 {
+				return strconv.FormatFloat(math.Round(v*u.factor*100)/100, 'f', -1, 64) + u.unit
+			}
+			return ""
+		}
+	}
+	return ""
+}
@@ -0,0 +1,453 @@
+// richText.go
+
+/*
+	This software use gotk3 that is licensed under the ISC License:
+	https://github.com/gotk3/gotk3/blob/master/LICENSE
+
+	Copyright ©2019 H.F.M - Rich text library "https//github/hfmrow"
+	This program comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+
+	Rich text serialization of a GtkTextBuffer to HTML or Markdown. The tag toggles are
+	walked line by line, the known tags are mapped to semantic elements (Elements), the
+	other ones (Tags) are written as inline styles built from their properties and the
+	"link:<uri>" tags as links. The readers recreate the tags with TagCreateIfNotExists,
+	the existing ones are kept as is, the missing ones get the properties of the style
+	sheet (RICH_TEXT_STYLE_SHEET). The HTML and Markdown readers accept documents that
+	are not produced by the writers, the unsupported markup is dropped.
+
+Usage:
+	rt, err := RichTextNew(textView.GetBuffer())
+	rt.AddLink(start, end, "https://github.com/hfmrow")
+	md := rt.ToMarkdown(nil, nil) // Whole buffer
+	...
+	rt.SetMarkdown(md)
+*/
+
+package richText
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/gtk"
+	"github.com/gotk3/gotk3/pango"
+
+	gitvtt "github.com/hfmrow/gtk3_import/textView/textTag"
+
+	"github.com/hfmrow/gotk3_gtksource/source"
+)
+
+const (
+	// RICH_TEXT_LINK_PREFIX: prefix of the links tags names, followed by the URI.
+	RICH_TEXT_LINK_PREFIX = "link:"
+	// RICH_TEXT_STYLE_PREFIX: prefix of the tags created for the inline
+	// styles, followed by the CSS declarations.
+	RICH_TEXT_STYLE_PREFIX = "style:"
+)
+
+// RICH_TEXT_STYLE_SHEET: properties of the tags created by the readers,
+// see textTag.StyleSheet, "link" is used by the links tags.
+const RICH_TEXT_STYLE_SHEET = gitvtt.TEXT_TAG_DEFAULT_SHEET + `
+h1 { weight: bold; scale: xx-large }
+h2 { weight: bold; scale: x-large }
+h3 { weight: bold; scale: large }
+h4 { weight: bold; scale: medium }
+h5 { weight: bold; scale: small }
+h6 { weight: bold; scale: x-small }
+pre { family: monospace; paragraph-background: #F4F4F4 }
+blockquote { left-margin: 24; foreground: #606060; style: italic }
+mark { background: #FFFF80 }
+link { foreground: #3050FF; underline: single }
+`
+
+// RichText: serializer of a TextBuffer.
+type RichText struct {
+	Buff *gtk.TextBuffer
+
+	// Elements: tag name -> element, "" to ignore the tag. The block elements
+	// are "h1" ... "h6", "pre" and "blockquote", the inline ones "strong",
+	// "em", "u", "s", "mark", "sup", "sub" and "code".
+	Elements map[string]string
+	// ElementTags: element -> name of the tag created by the readers.
+	ElementTags map[string]string
+	// Sheet: properties of the tags created by the readers.
+	Sheet *gitvtt.StyleSheet
+	// Tags: other tags, written as inline styles or links. The tags
+	// created after RichTextNew are added automatically.
+	Tags []string
+	// IgnorePrefixes: tags never added to Tags.
+	IgnorePrefixes []string
+}
+
+// tagMark: tag of the buffer and its mark.
+type tagMark struct {
+	tag  *gtk.TextTag
+	mark string
+}
+
+// RichTextNew: 'buff' is a *gtk.TextBuffer or a *source.SourceBuffer.
+func RichTextNew(buff interface{}) (rt *RichText, err error) {
+	rt = &RichText{
+		Elements: map[string]string{
+			"bold": "strong", "italic": "em", "oblique": "em", "underline": "u",
+			"double_underline": "u", "strikethrough": "s", "monospace": "code",
+			"superscript": "sup", "subscript": "sub", "heading": "h2",
+			"h1": "h1", "h2": "h2", "h3": "h3", "h4": "h4", "h5": "h5", "h6": "h6",
+			"pre": "pre", "blockquote": "blockquote", "mark": "mark",
+			// markdown.Renderer
+			"md-h1": "h1", "md-h2": "h2", "md-h3": "h3", "md-h4": "h4", "md-h5": "h5", "md-h6": "h6",
+			"md-emphasis": "em", "md-strong": "strong", "md-strike": "s", "md-code": "code",
+			"md-code-block": "pre", "md-quote": "blockquote", "md-link": "", "md-image": "",
+			"md-block": "", "md-bullet": "", "md-table": "", "md-rule": "", "md-html": "",
+		},
+		ElementTags: map[string]string{
+			"strong": "bold", "em": "italic", "u": "underline", "s": "strikethrough",
+			"code": "monospace", "sup": "superscript", "sub": "subscript", "mark": "mark",
+			"h1": "h1", "h2": "h2", "h3": "h3", "h4": "h4", "h5": "h5", "h6": "h6",
+			"pre": "pre", "blockquote": "blockquote",
+		},
+		IgnorePrefixes: []string{"chroma:", "md-chroma:", "md-indent-", "md-hanging"},
+	}
+	switch b := buff.(type) {
+	case *gtk.TextBuffer:
+		rt.Buff = b
+	case *source.SourceBuffer:
+		rt.Buff = &b.TextBuffer
+	default:
+		return nil, fmt.Errorf("RichTextNew: unsupported buffer type %T", buff)
+	}
+	if rt.Sheet, err = gitvtt.StyleSheetParse([]byte(RICH_TEXT_STYLE_SHEET), "richText"); err != nil {
+		return nil, err
+	}
+
+	var table *gtk.TextTagTable
+	if table, err = rt.Buff.GetTagTable(); err != nil {
+		return nil, err
+	}
+	table.Connect("tag-added", func(table *gtk.TextTagTable, tag *gtk.TextTag) {
+		if name := tagName(tag); len(name) > 0 && !rt.ignored(name) {
+			rt.Tags = append(rt.Tags, name)
+		}
+	})
+	table.Connect("tag-removed", func(table *gtk.TextTagTable, tag *gtk.TextTag) {
+		name := tagName(tag)
+		for idx := len(rt.Tags) - 1; idx >= 0; idx-- {
+			if rt.Tags[idx] == name {
+				rt.Tags = append(rt.Tags[:idx], rt.Tags[idx+1:]...)
+			}
+		}
+	})
+	return
+}
+
+// ToHTML: HTML fragment of the range, nil iters for the whole buffer.
+func (rt *RichText) ToHTML(start, end *gtk.TextIter) string {
+	return LinesToHTML(rt.Lines(start, end))
+}
+
+// ToMarkdown: Markdown of the range, nil iters for the whole buffer.
+func (rt *RichText) ToMarkdown(start, end *gtk.TextIter) string {
+	return LinesToMarkdown(rt.Lines(start, end))
+}
+
+// InsertHTML: insert the HTML at 'iter', revalidated to the end of the
+// inserted text.
+func (rt *RichText) InsertHTML(iter *gtk.TextIter, text string) {
+	rt.InsertLines(iter, HTMLToLines(text))
+}
+
+// InsertMarkdown: insert the Markdown at 'iter', revalidated to the end
+// of the inserted text.
+func (rt *RichText) InsertMarkdown(iter *gtk.TextIter, text string) {
+	rt.InsertLines(iter, MarkdownToLines(text))
+}
+
+// SetHTML: replace the content of the buffer.
+func (rt *RichText) SetHTML(text string) {
+	rt.set(HTMLToLines(text))
+}
+
+// SetMarkdown: replace the content of the buffer.
+func (rt *RichText) SetMarkdown(text string) {
+	rt.set(MarkdownToLines(text))
+}
+
+func (rt *RichText) set(lines []Line) {
+	rt.Buff.Delete(rt.Buff.GetStartIter(), rt.Buff.GetEndIter())
+	rt.InsertLines(rt.Buff.GetStartIter(), lines)
+}
+
+// AddLink: apply the tag of the link to the range.
+func (rt *RichText) AddLink(start, end *gtk.TextIter, uri string) {
+	if tag := rt.markTag("a:" + uri); tag != nil {
+		rt.Buff.ApplyTag(tag, start, end)
+	}
+}
+
+// Lines: read the range, nil iters for the whole buffer. The block of a
+// line is given by the tags of its first character, the line feed
+// included, the embedded images and widgets are dropped.
+func (rt *RichText) Lines(start, end *gtk.TextIter) (lines []Line) {
+	if start == nil || end == nil {
+		start, end = rt.Buff.GetBounds()
+	}
+	tags := rt.tagMarks()
+	lines = []Line{{}}
+	blockSet := false
+	last := end.GetOffset()
+	for offset := start.GetOffset(); offset < last; {
+		iter := rt.Buff.GetIterAtOffset(offset)
+		next := rt.Buff.GetIterAtOffset(offset)
+		if !next.ForwardToTagToggle(nil) || next.GetOffset() > last {
+			next = rt.Buff.GetIterAtOffset(last)
+		}
+		var block string
+		var marks []string
+		for _, tm := range tags {
+			if iter.HasTag(tm.tag) {
+				if blockElements[tm.mark] {
+					block = tm.mark
+				} else {
+					marks = append(marks, tm.mark)
+				}
+			}
+		}
+		marks = sortMarks(marks)
+
+		text, _ := rt.Buff.GetText(iter, next, true)
+		parts := strings.Split(text, "\n")
+		for idx, part := range parts {
+			if idx > 0 {
+				lines = append(lines, Line{})
+				blockSet = false
+			}
+			cur := &lines[len(lines)-1]
+			if !blockSet && (len(part) > 0 || idx < len(parts)-1) {
+				cur.Block, blockSet = block, true
+			}
+			cur.add(strings.ReplaceAll(part, "\uFFFC", ""), marks)
+		}
+		offset = next.GetOffset()
+	}
+	return
+}
+
+// InsertLines: insert the lines at 'iter', revalidated to the end of the
+// inserted text.
+func (rt *RichText) InsertLines(iter *gtk.TextIter, lines []Line) {
+	for idx, line := range lines {
+		lineStart := iter.GetOffset()
+		for _, span := range line.Spans {
+			start := iter.GetOffset()
+			rt.Buff.Insert(iter, span.Text)
+			for _, mark := range span.Marks {
+				rt.applyMark(mark, start, iter)
+			}
+		}
+		if idx < len(lines)-1 {
+			rt.Buff.Insert(iter, "\n")
+		}
+		if len(line.Block) > 0 {
+			rt.applyMark(line.Block, lineStart, iter)
+		}
+	}
+}
+
+// applyMark: apply the tag of the mark from 'start' to 'iter'.
+func (rt *RichText) applyMark(mark string, start int, iter *gtk.TextIter) {
+	if tag := rt.markTag(mark); tag != nil {
+		end := iter.GetOffset()
+		rt.Buff.ApplyTag(tag, rt.Buff.GetIterAtOffset(start), iter)
+		*iter = *rt.Buff.GetIterAtOffset(end)
+	}
+}
+
+// markTag: get or create the tag of the mark.
+func (rt *RichText) markTag(mark string) *gtk.TextTag {
+	var name string
+	var props map[string]interface{}
+	switch kind, value := markKind(mark); kind {
+	case "a":
+		name, props = RICH_TEXT_LINK_PREFIX+value, rt.sheetProps("link")
+	case "style":
+		name, props = RICH_TEXT_STYLE_PREFIX+value, styleProps(parseCSS(value))
+	default:
+		if name = rt.ElementTags[mark]; len(name) == 0 {
+			name = mark
+		}
+		props = rt.sheetProps(name)
+	}
+	if tag, ok := gitvtt.TagLookupIfExists(rt.Buff, name); ok {
+		return tag
+	}
+	return gitvtt.TagCreateIfNotExists(rt.Buff, name, props)
+}
+
+func (rt *RichText) sheetProps(name string) map[string]interface{} {
+	if rt.Sheet != nil {
+		if props, err := rt.Sheet.Props(name); err == nil {
+			return props
+		}
+	}
+	return nil
+}
+
+func (rt *RichText) ignored(name string) bool {
+	if _, ok := rt.Elements[name]; ok {
+		return true
+	}
+	for _, prefix := range rt.IgnorePrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// tagMarks: tags of the buffer to serialize, in a stable order.
+func (rt *RichText) tagMarks() (tags []tagMark) {
+	names := make([]string, 0, len(rt.Elements))
+	for name, element := range rt.Elements {
+		if len(element) > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if tag, ok := gitvtt.TagLookupIfExists(rt.Buff, name); ok {
+			tags = append(tags, tagMark{tag, rt.Elements[name]})
+		}
+	}
+	for _, name := range rt.Tags {
+		if rt.ignored(name) {
+			continue
+		}
+		tag, ok := gitvtt.TagLookupIfExists(rt.Buff, name)
+		if !ok {
+			continue
+		}
+		if strings.HasPrefix(name, RICH_TEXT_LINK_PREFIX) {
+			tags = append(tags, tagMark{tag, "a:" + strings.TrimPrefix(name, RICH_TEXT_LINK_PREFIX)})
+		} else if css := tagStyle(tag).String(); len(css) > 0 {
+			tags = append(tags, tagMark{tag, "style:" + css})
+		}
+	}
+	return
+}
+
+func tagName(tag *gtk.TextTag) string {
+	if value, err := tag.GetProperty("name"); err == nil {
+		if name, ok := value.(string); ok {
+			return name
+		}
+	}
+	return ""
+}
+
+/*
+ * Inline styles
+ */
+
+// tagStyle: style of the properties set in the tag.
+func tagStyle(tag *gtk.TextTag) (s style) {
+	// The "*-set" property tells whether the value is used.
+	get := func(name, setName string) interface{} {
+		if set, err := tag.GetProperty(setName); err == nil && set == true {
+			if value, err := tag.GetProperty(name); err == nil {
+				return value
+			}
+		}
+		return nil
+	}
+	colour := func(name, setName string) string {
+		if rgba, ok := get(name, setName).(*gdk.RGBA); ok && rgba != nil {
+			f := rgba.Floats()
+			return fmt.Sprintf("#%02x%02x%02x", int(f[0]*255+0.5), int(f[1]*255+0.5), int(f[2]*255+0.5))
+		}
+		return ""
+	}
+	s.color = colour("foreground-rgba", "foreground-set")
+	s.background = colour("background-rgba", "background-set")
+	if weight, ok := get("weight", "weight-set").(int); ok {
+		s.weight = cssWeight(weight)
+	}
+	if fontStyle, ok := get("style", "style-set").(int); ok {
+		switch pango.Style(fontStyle) {
+		case pango.STYLE_ITALIC:
+			s.fontStyle = "italic"
+		case pango.STYLE_OBLIQUE:
+			s.fontStyle = "oblique"
+		default:
+			s.fontStyle = "normal"
+		}
+	}
+	var decos []string
+	if underline, ok := get("underline", "underline-set").(int); ok && pango.Underline(underline) != pango.UNDERLINE_NONE {
+		decos = append(decos, "underline")
+	}
+	if strike, ok := get("strikethrough", "strikethrough-set").(bool); ok && strike {
+		decos = append(decos, "line-through")
+	}
+	s.decoration = strings.Join(decos, " ")
+	if family, ok := get("family", "family-set").(string); ok {
+		s.family = family
+	}
+	if scale, ok := get("scale", "scale-set").(float64); ok {
+		s.size = strconv.FormatFloat(scale, 'f', 2, 64) + "em"
+	} else if points, ok := get("size-points", "size-set").(float64); ok {
+		s.size = strconv.FormatFloat(points, 'f', -1, 64) + "pt"
+	}
+	s.size = cssSize(s.size)
+	return
+}
+
+// styleProps: properties of the tag of the style.
+func styleProps(s style) map[string]interface{} {
+	props := make(map[string]interface{})
+	if len(s.color) > 0 && gdk.NewRGBA().Parse(s.color) {
+		props["foreground"] = s.color
+	}
+	if len(s.background) > 0 && gdk.NewRGBA().Parse(s.background) {
+		props["background"] = s.background
+	}
+	switch s.weight {
+	case "":
+	case "bold":
+		props["weight"] = int(pango.WEIGHT_BOLD)
+	case "normal":
+		props["weight"] = int(pango.WEIGHT_NORMAL)
+	default:
+		if weight, err := strconv.Atoi(s.weight); err == nil {
+			props["weight"] = weight
+		}
+	}
+	switch s.fontStyle {
+	case "italic":
+		props["style"] = int(pango.STYLE_ITALIC)
+	case "oblique":
+		props["style"] = int(pango.STYLE_OBLIQUE)
+	case "normal":
+		props["style"] = int(pango.STYLE_NORMAL)
+	}
+	if strings.Contains(s.decoration, "underline") {
+		props["underline"] = int(pango.UNDERLINE_SINGLE)
+	}
+	if strings.Contains(s.decoration, "line-through") {
+		props["strikethrough"] = true
+	}
+	if len(s.family) > 0 {
+		props["family"] = s.family
+	}
+	if value, err := strconv.ParseFloat(strings.TrimRight(s.size, "emptx"), 64); err == nil {
+		if strings.HasSuffix(s.size, "em") {
+			props["scale"] = value
+		} else {
+			props["size-points"] = value
+		}
+	}
+	return props
+}
@@ -0,0 +1,96 @@
+// richText_test.go
+
+/*
+	Copyright ©2019 H.F.M - Rich text library "https//github/hfmrow"
+	This program comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+*/
+
+package richText
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// text: line of plain text.
+func text(block, text string) Line {
+	return Line{Block: block, Spans: []Span{{Text: text}}}
+}
+
+// spans: line of spans, the texts alternate with their marks, separated
+// with commas.
+func spans(block string, args ...string) (line Line) {
+	line.Block = block
+	for idx := 0; idx+1 < len(args); idx += 2 {
+		var marks []string
+		if len(args[idx+1]) > 0 {
+			marks = strings.Split(args[idx+1], ",")
+		}
+		line.add(args[idx], sortMarks(marks))
+	}
+	return
+}
+
+var roundTripCases = map[string][]Line{
+	"inline": {
+		spans("", "plain ", "", "bold", "strong", " and ", "", "both", "strong,em", ".", ""),
+		spans("", "u", "u", "s", "s", "m", "mark", "2", "sup", "i", "sub", "c`d", "code")},
+	"headings": {
+		text("h1", "Title #1"), text("", "text"), text("h3", "# not a heading")},
+	"empty lines": {
+		{}, {}, text("", "x"), {}, {}, {}, text("", "y"), {}},
+	"code": {
+		text("pre", "code ``` here"), {Block: "pre"}, text("pre", "\tindented\twith tabs"),
+		text("pre", "  spaces")},
+	"quote": {
+		text("blockquote", "quote"), text("blockquote", "two"), text("", "after")},
+	"markup characters": {
+		text("", "* not a list"), text("", "1. nor this"), text("", "-"), text("", "==="),
+		text("", "<&>_~\\[x](y)"), text("", "> no quote")},
+	"table": {
+		text("", "a|b"), text("", ":-|-")},
+	"spaces": {
+		spans("", "  lead ", "", "u", "u", " trail  ", ""), text("", "\ttab")},
+	"links and styles": {
+		spans("", "link", "a:http://example.org/a b", " ", "", "red", "style:color: #ff0000; font-weight: bold")},
+	"emphasis fallback": {
+		spans("", "a.", "strong", "b", ""),
+		spans("", "1.y", "strong,em", "xé…", ""),
+		text("pre", "y~"),
+		spans("", "x", "em", "<y>", "")},
+	"links": {
+		spans("", "wow!", "", "not an image", "a:http://example.org"),
+		spans("", "]: label", "a:http://example.org,code", " end", ""),
+		spans("", "é```", "code")},
+	"leading tags": {
+		spans("", "u", "u"), spans("", "sup", "sup", " text", ""), text("pre", "code")},
+	"trailing empty code line": {
+		text("pre", "x"), {Block: "pre"}},
+	"empty code lines": {
+		{Block: "pre"}, text("", "x"), {Block: "pre"}, {Block: "pre"}},
+	"empty quote lines": {
+		text("blockquote", "a"), {Block: "blockquote"}, text("blockquote", "b"), {Block: "blockquote"},
+		text("", "x"), {Block: "blockquote"}},
+	"empty headings": {
+		{Block: "h1"}, text("", "x"), {Block: "h2"}, {Block: "h6"}, {}, text("h3", "y"), {Block: "h3"}},
+}
+
+func TestMarkdownRoundTrip(t *testing.T) {
+	for name, lines := range roundTripCases {
+		md := LinesToMarkdown(lines)
+		if got := MarkdownToLines(md); !reflect.DeepEqual(got, lines) {
+			t.Errorf("%s:\n%s\ngot:  %#v\nwant: %#v", name, md, got, lines)
+		}
+	}
+}
+
+func TestHTMLRoundTrip(t *testing.T) {
+	for name, lines := range roundTripCases {
+		html := LinesToHTML(lines)
+		if got := HTMLToLines(html); !reflect.DeepEqual(got, lines) {
+			t.Errorf("%s:\n%s\ngot:  %#v\nwant: %#v", name, html, got, lines)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+// backends.go
+
+/*
+	This software use gotk3 that is licensed under the ISC License:
+	https://github.com/gotk3/gotk3/blob/master/LICENSE
+
+	Copyright ©2019 H.F.M - TextView Numbered  library "https//github/hfmrow"
+	This program comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+
+	SearchBackend implementations for SourceViewStruct (GtkSource search context) and
+	TextViewNumbered (textView.TextSearch).
+*/
+
+package searchBar
+
+import (
+	"github.com/gotk3/gotk3/gtk"
+
+	gitv "github.com/hfmrow/gtk3_import/textView"
+	gitvsv "github.com/hfmrow/gtk3_import/textView/sourceView"
+)
+
+// searchFrom: get the iter where the search starts, the
+// selection bounds or the cursor position.
+func searchFrom(buff *gtk.TextBuffer, backward, keep bool) *gtk.TextIter {
+	if start, end, ok := buff.GetSelectionBounds(); ok {
+		if backward || keep {
+			return start
+		}
+		return end
+	}
+	return buff.GetIterAtMark(buff.GetInsert())
+}
+
+/*
+ * SourceViewStruct
+ */
+
+type sourceViewBackend struct {
+	svs *gitvsv.SourceViewStruct
+}
+
+// SourceViewBackendNew: search backend using the GtkSource search context.
+func SourceViewBackendNew(svs *gitvsv.SourceViewStruct) SearchBackend {
+	return &sourceViewBackend{svs: svs}
+}
+
+func (b *sourceViewBackend) SetOptions(opts SearchOptions) error {
+	b.svs.TextSearch = opts.Text
+	b.svs.CaseSensitive = opts.CaseSensitive
+	b.svs.UseRegexp = opts.UseRegexp
+	b.svs.WordBoundaries = opts.WordBoundaries
+	b.svs.WrapAround = opts.WrapAround
+	b.svs.HighlightFound = true
+	return b.svs.UpdateSearch()
+}
+
+func (b *sourceViewBackend) Find(backward, keep bool) (found bool, err error) {
+	if err = b.svs.Search(searchFrom(&b.svs.Buffer.TextBuffer, backward, keep), backward); err == nil {
+		if found = b.svs.HasFound; found {
+			b.svs.Buffer.SelectRange(b.svs.IterStart, b.svs.IterEnd)
+			b.svs.ScrollToIter(b.svs.IterStart)
+		}
+	}
+	return
+}
+
+func (b *sourceViewBackend) Occurences(callback func(position, count int)) {
+	var position int
+	if start, end, ok := b.svs.Buffer.GetSelectionBounds(); ok {
+		position = b.svs.SearchCtx.GetOccurencePosition(start, end)
+	}
+	b.svs.GetOccurences(func(count int) {
+		callback(position, count)
+	})
+}
+
+func (b *sourceViewBackend) Replace(replace string) (bool, error) {
+	b.svs.TextReplace = replace
+	return b.svs.Replace()
+}
+
+func (b *sourceViewBackend) ReplaceAll(replace string) (int, error) {
+	b.svs.TextReplace = replace
+	return b.svs.ReplaceAll()
+}
+
+func (b *sourceViewBackend) Close() {
+	if b.svs.SearchCtx != nil {
+		b.svs.SearchCtx.SetHighLight(false)
+	}
+	b.svs.View.GrabFocus()
+}
+
+/*
+ * TextViewNumbered
+ */
+
+type textViewBackend struct {
+	tvn *gitv.TextViewNumbered
+}
+
+// TextViewBackendNew: search backend using the textView.TextSearch
+// of the TextViewNumbered.
+func TextViewBackendNew(tvn *gitv.TextViewNumbered) SearchBackend {
+	return &textViewBackend{tvn: tvn}
+}
+
+func (b *textViewBackend) SetOptions(opts SearchOptions) error {
+	ts := b.tvn.Search()
+	ts.Text = opts.Text
+	ts.CaseSensitive = opts.CaseSensitive
+	ts.UseRegexp = opts.UseRegexp
+	ts.WordBoundaries = opts.WordBoundaries
+	ts.WrapAround = opts.WrapAround
+	return ts.Update()
+}
+
+func (b *textViewBackend) Find(backward, keep bool) (found bool, err error) {
+	var start, end *gtk.TextIter
+
+	ts := b.tvn.Search()
+	if err = ts.Update(); err != nil {
+		return
+	}
+	iter := searchFrom(b.tvn.BuffTxt, backward, keep)
+	if backward {
+		start, end, _, found = ts.Backward(iter)
+	} else {
+		start, end, _, found = ts.Forward(iter)
+	}
+	if found {
+		b.tvn.UnfoldLine(start.GetLine())
+		b.tvn.BuffTxt.SelectRange(start, end)
+		b.tvn.TextView.ScrollToIter(start, 0.0, true, 0.5, 0.5)
+	}
+	return
+}
+
+func (b *textViewBackend) Occurences(callback func(position, count int)) {
+	var position int
+	ts := b.tvn.Search()
+	if start, end, ok := b.tvn.BuffTxt.GetSelectionBounds(); ok {
+		position = ts.GetOccurencePosition(start, end)
+	}
+	callback(position, ts.GetOccurencesCount())
+}
+
+func (b *textViewBackend) Replace(replace string) (replaced bool, err error) {
+	ts := b.tvn.Search()
+	if start, end, ok := b.tvn.BuffTxt.GetSelectionBounds(); ok {
+		if replaced, err = ts.Replace(start, end, replace); err != nil {
+			return
+		}
+		if replaced {
+			b.tvn.BuffTxt.PlaceCursor(end)
+		}
+	}
+	_, err = b.Find(false, false)
+	return
+}
+
+func (b *textViewBackend) ReplaceAll(replace string) (int, error) {
+	return b.tvn.Search().ReplaceAll(replace)
+}
+
+func (b *textViewBackend) Close() {
+	b.tvn.Search().Clear()
+	b.tvn.TextView.GrabFocus()
+}
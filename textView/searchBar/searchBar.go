@@ -0,0 +1,360 @@
+// searchBar.go
+
+/*
+	This software use gotk3 that is licensed under the ISC License:
+	https://github.com/gotk3/gotk3/blob/master/LICENSE
+
+	Copyright ©2019 H.F.M - TextView Numbered  library "https//github/hfmrow"
+	This program comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+
+	Ready-made search & replace bar: a revealer containing the search entry, the options
+	toggles, the occurrences counter, the navigation buttons and the replace entry. It works
+	with any text view through the SearchBackend interface, see backends.go for the
+	SourceViewStruct and TextViewNumbered ones.
+
+	Keys: Enter / Shift+Enter next / previous match, Ctrl+G / Ctrl+Shift+G too, Esc closes
+	the bar.
+*/
+
+package searchBar
+
+import (
+	"fmt"
+
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// SearchOptions: pattern and options given to the backend.
+type SearchOptions struct {
+	Text string
+	CaseSensitive,
+	UseRegexp,
+	WordBoundaries,
+	WrapAround bool
+}
+
+// SearchBackend: search engine of a text view.
+type SearchBackend interface {
+	// SetOptions: returns an error (i.e *textView.RegexError) when
+	// the pattern is not valid.
+	SetOptions(opts SearchOptions) error
+	// Find: select and show the next or previous match. When 'keep' is set
+	// the search starts at the beginning of the selection, so the current
+	// match stays selected while the pattern is typed.
+	Find(backward, keep bool) (found bool, err error)
+	// Occurences: 'callback' is called with the position (1 based) of the
+	// selected match, 0 if the selection isn't a match, and the count of
+	// matches, -1 while it's not known. It may be called more than once.
+	Occurences(callback func(position, count int))
+	// Replace: replace the selected match and select the next one.
+	Replace(replace string) (replaced bool, err error)
+	// ReplaceAll: replace all the matches as a single user action.
+	ReplaceAll(replace string) (count int, err error)
+	// Close: the bar is closed, remove the highlighting.
+	Close()
+}
+
+// SearchBar: the widget, 'Revealer' is added to the container.
+type SearchBar struct {
+	Revealer     *gtk.Revealer
+	Entry        *gtk.SearchEntry
+	ReplaceEntry *gtk.Entry
+	Occurences   *gtk.Label
+
+	CaseSensitive,
+	UseRegexp,
+	WordBoundaries,
+	WrapAround *gtk.ToggleButton
+
+	// ErrorCallback: called when an operation fails, the error
+	// is also displayed in the occurrences label.
+	ErrorCallback func(err error)
+
+	backend    SearchBackend
+	replaceBox *gtk.Box
+}
+
+// SearchBarNew: create the bar and add it to the container, it's hidden
+// until Show is called.
+func SearchBarNew(container gtk.Container, backend SearchBackend) (sb *SearchBar, err error) {
+	sb = new(SearchBar)
+	err = sb.Init(container, backend)
+	return
+}
+
+// Init: build the widgets.
+func (sb *SearchBar) Init(container gtk.Container, backend SearchBackend) (err error) {
+	var vBox, searchBox *gtk.Box
+	var prev, next, closeBtn, replace, replaceAll *gtk.Button
+
+	sb.backend = backend
+	if sb.Revealer, err = gtk.RevealerNew(); err != nil {
+		return
+	}
+	sb.Revealer.SetTransitionType(gtk.REVEALER_TRANSITION_TYPE_SLIDE_DOWN)
+
+	if vBox, err = gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 2); err != nil {
+		return
+	}
+	if searchBox, err = gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 2); err != nil {
+		return
+	}
+	if sb.replaceBox, err = gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 2); err != nil {
+		return
+	}
+	vBox.SetBorderWidth(2)
+
+	// Search row
+	if sb.Entry, err = gtk.SearchEntryNew(); err != nil {
+		return
+	}
+	sb.Entry.SetHExpand(true)
+	sb.Entry.SetPlaceholderText("Search")
+	searchBox.PackStart(sb.Entry, true, true, 0)
+
+	for _, b := range []struct {
+		btn           **gtk.Button
+		icon, tooltip string
+	}{
+		{&prev, "go-up-symbolic", "Previous match (Shift+Enter)"},
+		{&next, "go-down-symbolic", "Next match (Enter)"},
+	} {
+		if *b.btn, err = gtk.ButtonNewFromIconName(b.icon, gtk.ICON_SIZE_BUTTON); err != nil {
+			return
+		}
+		(*b.btn).SetTooltipText(b.tooltip)
+		searchBox.PackStart(*b.btn, false, false, 0)
+	}
+
+	for _, t := range []struct {
+		btn            **gtk.ToggleButton
+		label, tooltip string
+		active         bool
+	}{
+		{&sb.CaseSensitive, "Aa", "Case sensitive", false},
+		{&sb.UseRegexp, ".*", "Regular expression", false},
+		{&sb.WordBoundaries, "\\b", "Whole words", false},
+		{&sb.WrapAround, "⟲", "Wrap around", true},
+	} {
+		if *t.btn, err = gtk.ToggleButtonNewWithLabel(t.label); err != nil {
+			return
+		}
+		(*t.btn).SetTooltipText(t.tooltip)
+		(*t.btn).SetActive(t.active)
+		(*t.btn).Connect("toggled", sb.update)
+		searchBox.PackStart(*t.btn, false, false, 0)
+	}
+
+	if sb.Occurences, err = gtk.LabelNew(""); err != nil {
+		return
+	}
+	sb.Occurences.SetWidthChars(12)
+	searchBox.PackStart(sb.Occurences, false, false, 4)
+
+	if closeBtn, err = gtk.ButtonNewFromIconName("window-close-symbolic", gtk.ICON_SIZE_BUTTON); err != nil {
+		return
+	}
+	closeBtn.SetRelief(gtk.RELIEF_NONE)
+	closeBtn.SetTooltipText("Close (Esc)")
+	searchBox.PackEnd(closeBtn, false, false, 0)
+
+	// Replace row
+	if sb.ReplaceEntry, err = gtk.EntryNew(); err != nil {
+		return
+	}
+	sb.ReplaceEntry.SetHExpand(true)
+	sb.ReplaceEntry.SetPlaceholderText("Replace")
+	sb.replaceBox.PackStart(sb.ReplaceEntry, true, true, 0)
+	if replace, err = gtk.ButtonNewWithLabel("Replace"); err != nil {
+		return
+	}
+	if replaceAll, err = gtk.ButtonNewWithLabel("Replace all"); err != nil {
+		return
+	}
+	sb.replaceBox.PackStart(replace, false, false, 0)
+	sb.replaceBox.PackStart(replaceAll, false, false, 0)
+
+	vBox.PackStart(searchBox, false, false, 0)
+	vBox.PackStart(sb.replaceBox, false, false, 0)
+	sb.Revealer.Add(vBox)
+	vBox.ShowAll()
+	sb.replaceBox.Hide()
+	sb.replaceBox.SetNoShowAll(true)
+	container.Add(sb.Revealer)
+
+	// Signals
+	sb.Entry.Connect("search-changed", sb.update)
+	sb.Entry.Connect("activate", sb.Next)
+	sb.Entry.Connect("next-match", sb.Next)
+	sb.Entry.Connect("previous-match", sb.Prev)
+	sb.Entry.Connect("stop-search", sb.Hide)
+	sb.ReplaceEntry.Connect("activate", sb.Replace)
+	vBox.Connect("key-press-event", sb.keyPressed)
+	prev.Connect("clicked", sb.Prev)
+	next.Connect("clicked", sb.Next)
+	closeBtn.Connect("clicked", sb.Hide)
+	replace.Connect("clicked", sb.Replace)
+	replaceAll.Connect("clicked", sb.ReplaceAll)
+	return
+}
+
+// SetBackend: use another text view.
+func (sb *SearchBar) SetBackend(backend SearchBackend) {
+	if sb.backend != nil && sb.Revealer.GetRevealChild() {
+		sb.backend.Close()
+	}
+	sb.backend = backend
+	if sb.Revealer.GetRevealChild() {
+		sb.update()
+	}
+}
+
+// Show: reveal the bar with or without the replace row
+// and give the focus to the search entry.
+func (sb *SearchBar) Show(withReplace bool) {
+	sb.replaceBox.SetVisible(withReplace)
+	sb.Revealer.Show()
+	sb.Revealer.SetRevealChild(true)
+	sb.Entry.GrabFocus()
+	sb.update()
+}
+
+// Hide: close the bar.
+func (sb *SearchBar) Hide() {
+	sb.Revealer.SetRevealChild(false)
+	if sb.backend != nil {
+		sb.backend.Close()
+	}
+}
+
+// Next: select the next match.
+func (sb *SearchBar) Next() {
+	sb.find(false, false)
+}
+
+// Prev: select the previous match.
+func (sb *SearchBar) Prev() {
+	sb.find(true, false)
+}
+
+// Replace: replace the selected match.
+func (sb *SearchBar) Replace() {
+	if sb.backend != nil {
+		text, _ := sb.ReplaceEntry.GetText()
+		if _, err := sb.backend.Replace(text); err != nil {
+			sb.showError(err)
+			return
+		}
+		sb.showOccurences()
+	}
+}
+
+// ReplaceAll: replace all the matches.
+func (sb *SearchBar) ReplaceAll() {
+	if sb.backend != nil {
+		text, _ := sb.ReplaceEntry.GetText()
+		count, err := sb.backend.ReplaceAll(text)
+		if err != nil {
+			sb.showError(err)
+			return
+		}
+		sb.Occurences.SetText(fmt.Sprintf("%d replaced", count))
+	}
+}
+
+// Options: current pattern and options.
+func (sb *SearchBar) Options() (opts SearchOptions) {
+	opts.Text, _ = sb.Entry.GetText()
+	opts.CaseSensitive = sb.CaseSensitive.GetActive()
+	opts.UseRegexp = sb.UseRegexp.GetActive()
+	opts.WordBoundaries = sb.WordBoundaries.GetActive()
+	opts.WrapAround = sb.WrapAround.GetActive()
+	return
+}
+
+// update: the pattern or the options have changed.
+func (sb *SearchBar) update() {
+	if sb.backend == nil {
+		return
+	}
+	opts := sb.Options()
+	if err := sb.backend.SetOptions(opts); err != nil {
+		sb.showError(err)
+		return
+	}
+	if len(opts.Text) == 0 {
+		sb.setErrorStyle(false)
+		sb.Occurences.SetText("")
+		return
+	}
+	sb.find(false, true)
+}
+
+// find: search and refresh the counter.
+func (sb *SearchBar) find(backward, keep bool) {
+	if sb.backend == nil {
+		return
+	}
+	if _, err := sb.backend.Find(backward, keep); err != nil {
+		sb.showError(err)
+		return
+	}
+	sb.showOccurences()
+}
+
+// showOccurences: display "3 of 17".
+func (sb *SearchBar) showOccurences() {
+	sb.setErrorStyle(false)
+	sb.backend.Occurences(func(position, count int) {
+		switch {
+		case count < 0:
+			sb.Occurences.SetText("…")
+		case count == 0:
+			sb.Occurences.SetText("No results")
+		case position > 0:
+			sb.Occurences.SetText(fmt.Sprintf("%d of %d", position, count))
+		default:
+			sb.Occurences.SetText(fmt.Sprintf("%d matches", count))
+		}
+	})
+}
+
+// showError: display the error in the label and its tooltip.
+func (sb *SearchBar) showError(err error) {
+	sb.setErrorStyle(true)
+	sb.Occurences.SetText("Error")
+	sb.Occurences.SetTooltipText(err.Error())
+	if sb.ErrorCallback != nil {
+		sb.ErrorCallback(err)
+	}
+}
+
+// setErrorStyle: toggle the "error" style class of the search entry.
+func (sb *SearchBar) setErrorStyle(set bool) {
+	if ctx, err := sb.Entry.GetStyleContext(); err == nil {
+		if set {
+			ctx.AddClass("error")
+		} else {
+			ctx.RemoveClass("error")
+			sb.Occurences.SetTooltipText("")
+		}
+	}
+}
+
+// keyPressed: Esc closes the bar, Shift+Enter finds the previous match.
+func (sb *SearchBar) keyPressed(box *gtk.Box, event *gdk.Event) bool {
+	ev := gdk.EventKeyNewFromEvent(event)
+	switch ev.KeyVal() {
+	case gdk.KEY_Escape:
+		sb.Hide()
+		return true
+	case gdk.KEY_Return, gdk.KEY_KP_Enter:
+		if gdk.ModifierType(ev.State())&gdk.SHIFT_MASK != 0 {
+			sb.Prev()
+			return true
+		}
+	}
+	return false
+}
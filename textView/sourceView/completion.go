@@ -0,0 +1,529 @@
+// completion.go
+
+/*
+	This software use gotk3 that is licensed under the ISC License:
+	https://github.com/gotk3/gotk3/blob/master/LICENSE
+
+	Copyright ©2019 H.F.M - TextView Numbered  library "https//github/hfmrow"
+	This program comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+
+	Completion for SourceViewStruct with providers written in Go. GtkSourceCompletion
+	providers are GObject interfaces that can't be implemented from Go with the bindings,
+	so the proposals are displayed in a popover at the cursor.
+
+	Providers get a snapshot of the buffer (CompletionContext) and return their proposals,
+	the ones implementing AsyncCompletionProvider are run on a goroutine and their results
+	are delivered through the main loop, stale results are dropped. See completionProviders.go
+	for the built-in providers: buffer words, keywords by language id and file paths.
+
+	Keys: Ctrl+Space shows the proposals, Up/Down/PageUp/PageDown select, Return or Tab
+	inserts, Esc closes.
+*/
+
+package sourceView
+
+import (
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+	"github.com/gotk3/gotk3/pango"
+
+	"github.com/hfmrow/gotk3_gtksource/source"
+)
+
+const (
+	COMPLETION_MIN_PREFIX    = 2
+	COMPLETION_DELAY         = 150 * time.Millisecond
+	COMPLETION_MAX_PROPOSALS = 200
+)
+
+// Proposal: a completion proposal.
+type Proposal struct {
+	Label, // Displayed, 'Text' when empty
+	Text, // Inserted
+	Kind, // Displayed dimmed at the right side: "keyword", "file" ...
+	Info string // Tooltip
+	// Prefix: text before the cursor replaced by 'Text',
+	// the prefix of the context when empty.
+	Prefix string
+}
+
+// CompletionContext: snapshot of the buffer given to the providers,
+// it may be used from a goroutine.
+type CompletionContext struct {
+	Text, // Whole buffer
+	LineText, // Line of the cursor, up to the cursor
+	Prefix, // Word before the cursor
+	LanguageId string
+	Line, // 0 based
+	Column, // 0 based, in characters
+	Offset int // Cursor offset in characters
+	// Interactive: triggered while typing, otherwise requested by the user.
+	Interactive bool
+
+	done chan struct{}
+}
+
+// Done: closed when the context is outdated, async
+// providers may use it to abort their work.
+func (ctx *CompletionContext) Done() <-chan struct{} {
+	return ctx.done
+}
+
+// Canceled: the context is outdated.
+func (ctx *CompletionContext) Canceled() bool {
+	select {
+	case <-ctx.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// CompletionProvider: source of proposals.
+type CompletionProvider interface {
+	Name() string
+	Populate(ctx *CompletionContext) []Proposal
+}
+
+// AsyncCompletionProvider: 'Populate' is run on a goroutine when 'Async'
+// returns true, it must not use GTK.
+type AsyncCompletionProvider interface {
+	CompletionProvider
+	Async() bool
+}
+
+// Completion: completion popup of a SourceViewStruct.
+type Completion struct {
+	Providers []CompletionProvider
+
+	// Interactive: show the proposals while typing, after 'Delay' when the
+	// prefix has at least 'MinPrefix' characters.
+	Interactive  bool
+	MinPrefix    int
+	Delay        time.Duration
+	MaxProposals int
+
+	// Popup widgets
+	Popover  *gtk.Popover
+	List     *gtk.ListBox
+	Scrolled *gtk.ScrolledWindow
+
+	svs       *SourceViewStruct
+	ctx       *CompletionContext
+	results   [][]Proposal
+	pending   int
+	proposals []Proposal
+	rows      []*gtk.ListBoxRow
+	timer     glib.SourceHandle
+	enabled,
+	connected,
+	inserting bool
+}
+
+// CompletionEnable: enable or disable the completion, the Completion
+// is created on the first call with the buffer words provider.
+func (svs *SourceViewStruct) CompletionEnable(enable bool) (c *Completion, err error) {
+	if svs.Completion == nil {
+		c = &Completion{
+			svs:          svs,
+			Interactive:  true,
+			MinPrefix:    COMPLETION_MIN_PREFIX,
+			Delay:        COMPLETION_DELAY,
+			MaxProposals: COMPLETION_MAX_PROPOSALS,
+			Providers:    []CompletionProvider{WordsProviderNew()}}
+		if err = c.init(); err != nil {
+			return
+		}
+		svs.Completion = c
+	}
+	c = svs.Completion
+	if enable && !c.connected {
+		c.connected = true
+		svs.View.Connect("key-press-event", c.keyPressed)
+		svs.View.Connect("button-press-event", c.Hide)
+		svs.View.Connect("focus-out-event", c.Hide)
+		svs.Buffer.Connect("changed", c.changed)
+	}
+	if c.enabled = enable; !enable {
+		c.Hide()
+	}
+	return
+}
+
+// AddProvider: add a provider, or replace the one with the same name.
+func (c *Completion) AddProvider(provider CompletionProvider) {
+	for idx, p := range c.Providers {
+		if p.Name() == provider.Name() {
+			c.Providers[idx] = provider
+			return
+		}
+	}
+	c.Providers = append(c.Providers, provider)
+}
+
+// RemoveProvider: remove the provider by name.
+func (c *Completion) RemoveProvider(name string) {
+	for idx, p := range c.Providers {
+		if p.Name() == name {
+			c.Providers = append(c.Providers[:idx], c.Providers[idx+1:]...)
+			return
+		}
+	}
+}
+
+// Show: request the proposals at the cursor.
+func (c *Completion) Show() {
+	c.populate(false)
+}
+
+// Hide: close the popup and drop the pending results.
+func (c *Completion) Hide() {
+	c.cancel()
+	c.stopTimer()
+	if c.Popover.GetVisible() {
+		c.Popover.Popdown()
+	}
+}
+
+// Visible: the popup is displayed.
+func (c *Completion) Visible() bool {
+	return c.Popover.GetVisible()
+}
+
+// Selected: the selected proposal.
+func (c *Completion) Selected() (proposal Proposal, ok bool) {
+	if row := c.List.GetSelectedRow(); row != nil {
+		if idx := row.GetIndex(); idx >= 0 && idx < len(c.proposals) {
+			return c.proposals[idx], true
+		}
+	}
+	return
+}
+
+// Activate: insert the selected proposal.
+func (c *Completion) Activate() bool {
+	proposal, ok := c.Selected()
+	if ok {
+		c.insert(proposal)
+	}
+	c.Hide()
+	return ok
+}
+
+// init: build the popup.
+func (c *Completion) init() (err error) {
+	if c.Popover, err = gtk.PopoverNew(c.svs.View); err != nil {
+		return
+	}
+	c.Popover.SetModal(false)
+	c.Popover.SetPosition(gtk.POS_BOTTOM)
+	if c.Scrolled, err = gtk.ScrolledWindowNew(nil, nil); err != nil {
+		return
+	}
+	c.Scrolled.SetPolicy(gtk.POLICY_NEVER, gtk.POLICY_AUTOMATIC)
+	c.Scrolled.SetPropagateNaturalHeight(true)
+	c.Scrolled.SetMaxContentHeight(240)
+	c.Scrolled.SetMinContentWidth(240)
+	if c.List, err = gtk.ListBoxNew(); err != nil {
+		return
+	}
+	c.List.SetSelectionMode(gtk.SELECTION_BROWSE)
+	c.List.Connect("row-activated", func() { c.Activate() })
+	c.Scrolled.Add(c.List)
+	c.Popover.Add(c.Scrolled)
+	c.Scrolled.ShowAll()
+	return
+}
+
+// changed: the buffer has been modified, update or schedule the proposals.
+func (c *Completion) changed() {
+	if !c.enabled || c.inserting {
+		return
+	}
+	c.stopTimer()
+	if c.Visible() {
+		c.populate(true)
+		return
+	}
+	if c.Interactive && len([]rune(c.prefix())) >= c.MinPrefix {
+		c.timer = glib.TimeoutAdd(uint(c.Delay/time.Millisecond), func() bool {
+			c.timer = 0
+			c.populate(true)
+			return false
+		})
+	}
+}
+
+// stopTimer: cancel the scheduled interactive populate.
+func (c *Completion) stopTimer() {
+	if c.timer != 0 {
+		glib.SourceRemove(c.timer)
+		c.timer = 0
+	}
+}
+
+// cancel: the current context is outdated.
+func (c *Completion) cancel() {
+	if c.ctx != nil {
+		close(c.ctx.done)
+		c.ctx = nil
+	}
+}
+
+// prefix: word before the cursor.
+func (c *Completion) prefix() string {
+	iter := c.svs.Buffer.GetIterAtMark(c.svs.Buffer.GetInsert())
+	start := c.svs.Buffer.GetIterAtLine(iter.GetLine())
+	text, _ := c.svs.Buffer.GetText(start, iter, false)
+	return wordPrefix(text)
+}
+
+// wordPrefix: trailing word of the text.
+func wordPrefix(text string) string {
+	runes := []rune(text)
+	idx := len(runes)
+	for idx > 0 && isWordRune(runes[idx-1]) {
+		idx--
+	}
+	return string(runes[idx:])
+}
+
+// isWordRune: letters, digits and '_'.
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// context: snapshot of the buffer at the cursor.
+func (c *Completion) context(interactive bool) *CompletionContext {
+	buff := c.svs.Buffer
+	iter := buff.GetIterAtMark(buff.GetInsert())
+	ctx := &CompletionContext{
+		Text:        c.svs.GetText(),
+		Line:        iter.GetLine(),
+		Column:      iter.GetLineOffset(),
+		Offset:      iter.GetOffset(),
+		Interactive: interactive,
+		done:        make(chan struct{})}
+	ctx.LineText, _ = buff.GetText(buff.GetIterAtLine(ctx.Line), iter, false)
+	ctx.Prefix = wordPrefix(ctx.LineText)
+	if lang, err := buff.GetLanguage(); err == nil && lang != nil {
+		ctx.LanguageId = lang.GetId()
+	}
+	return ctx
+}
+
+// populate: query the providers, the async ones deliver their
+// results through the main loop.
+func (c *Completion) populate(interactive bool) {
+	if !c.enabled {
+		return
+	}
+	c.cancel()
+	ctx := c.context(interactive)
+	c.ctx = ctx
+	c.results = make([][]Proposal, len(c.Providers))
+	c.pending = 0
+	for idx, provider := range c.Providers {
+		if async, ok := provider.(AsyncCompletionProvider); ok && async.Async() {
+			c.pending++
+			go func(idx int, provider CompletionProvider) {
+				proposals := provider.Populate(ctx)
+				glib.IdleAdd(func() {
+					if ctx == c.ctx {
+						c.pending--
+						c.results[idx] = proposals
+						c.update()
+					}
+				})
+			}(idx, provider)
+			continue
+		}
+		c.results[idx] = provider.Populate(ctx)
+	}
+	c.update()
+}
+
+// update: display the results in the providers order.
+func (c *Completion) update() {
+	var proposals []Proposal
+	seen := make(map[string]bool)
+	for _, results := range c.results {
+		for _, p := range results {
+			if len(proposals) >= c.MaxProposals {
+				break
+			}
+			if key := p.Text + "\x00" + p.Prefix; !seen[key] {
+				seen[key] = true
+				proposals = append(proposals, p)
+			}
+		}
+	}
+	if len(proposals) == 0 {
+		if c.pending == 0 && c.Visible() {
+			c.Popover.Popdown()
+		}
+		return
+	}
+	c.setProposals(proposals)
+}
+
+// setProposals: fill the list and show the popup at the cursor.
+func (c *Completion) setProposals(proposals []Proposal) {
+	for _, row := range c.rows {
+		c.List.Remove(row)
+	}
+	c.rows = c.rows[:0]
+	c.proposals = proposals
+	for _, p := range proposals {
+		row, err := completionRow(p)
+		if err != nil {
+			break
+		}
+		c.List.Add(row)
+		c.rows = append(c.rows, row)
+	}
+	c.List.ShowAll()
+	c.selectRow(0)
+
+	iter := c.svs.Buffer.GetIterAtMark(c.svs.Buffer.GetInsert())
+	x, y, height := c.svs.iterLocation(iter)
+	wx, wy := c.svs.View.BufferToWindowCoords(gtk.TEXT_WINDOW_WIDGET, x, y)
+	c.Popover.SetPointingTo(*gdk.RectangleNew(wx, wy, 1, height))
+	if !c.Visible() {
+		c.Popover.Popup()
+	}
+}
+
+// completionRow: label and kind of the proposal.
+func completionRow(p Proposal) (row *gtk.ListBoxRow, err error) {
+	var box *gtk.Box
+	var label, kind *gtk.Label
+
+	if row, err = gtk.ListBoxRowNew(); err != nil {
+		return
+	}
+	if box, err = gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 8); err != nil {
+		return
+	}
+	text := p.Label
+	if len(text) == 0 {
+		text = p.Text
+	}
+	if label, err = gtk.LabelNew(text); err != nil {
+		return
+	}
+	label.SetXAlign(0)
+	label.SetEllipsize(pango.ELLIPSIZE_END)
+	box.PackStart(label, true, true, 0)
+	if len(p.Kind) > 0 {
+		if kind, err = gtk.LabelNew(p.Kind); err != nil {
+			return
+		}
+		kind.SetSensitive(false)
+		box.PackEnd(kind, false, false, 0)
+	}
+	if len(p.Info) > 0 {
+		row.SetTooltipText(p.Info)
+	}
+	row.Add(box)
+	return
+}
+
+// selectRow: select and scroll to the row.
+func (c *Completion) selectRow(idx int) {
+	if len(c.rows) == 0 {
+		return
+	}
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(c.rows) {
+		idx = len(c.rows) - 1
+	}
+	row := c.rows[idx]
+	c.List.SelectRow(row)
+	adj := c.Scrolled.GetVAdjustment()
+	alloc := row.GetAllocation()
+	switch {
+	case float64(alloc.GetY()) < adj.GetValue():
+		adj.SetValue(float64(alloc.GetY()))
+	case float64(alloc.GetY()+alloc.GetHeight()) > adj.GetValue()+adj.GetPageSize():
+		adj.SetValue(float64(alloc.GetY()+alloc.GetHeight()) - adj.GetPageSize())
+	}
+}
+
+// insert: replace the prefix with the proposal.
+func (c *Completion) insert(p Proposal) {
+	prefix := p.Prefix
+	if len(prefix) == 0 && c.ctx != nil {
+		prefix = c.ctx.Prefix
+	}
+	buff := c.svs.Buffer
+	end := buff.GetIterAtMark(buff.GetInsert())
+	start := buff.GetIterAtMark(buff.GetInsert())
+	start.BackwardChars(len([]rune(prefix)))
+
+	c.inserting = true
+	buff.BeginUserAction()
+	if text, _ := buff.GetText(start, end, false); text == prefix && !start.Equal(end) {
+		buff.Delete(start, end)
+	}
+	buff.InsertAtCursor(p.Text)
+	buff.EndUserAction()
+	c.inserting = false
+	c.svs.View.ScrollMarkOnscreen(buff.GetInsert())
+}
+
+// keyPressed: popup navigation, Ctrl+Space shows the proposals.
+func (c *Completion) keyPressed(view *source.SourceView, event *gdk.Event) bool {
+	if !c.enabled {
+		return false
+	}
+	ev := gdk.EventKeyNewFromEvent(event)
+	state := gdk.ModifierType(ev.State()) & (gdk.SHIFT_MASK | gdk.CONTROL_MASK | gdk.MOD1_MASK)
+	key := ev.KeyVal()
+	if key == gdk.KEY_space && state == gdk.CONTROL_MASK {
+		c.Show()
+		return true
+	}
+	if !c.Visible() {
+		return false
+	}
+	idx := -1
+	if row := c.List.GetSelectedRow(); row != nil {
+		idx = row.GetIndex()
+	}
+	switch key {
+	case gdk.KEY_Escape:
+		c.Hide()
+	case gdk.KEY_Up:
+		c.selectRow(idx - 1)
+	case gdk.KEY_Down:
+		c.selectRow(idx + 1)
+	case gdk.KEY_Page_Up:
+		c.selectRow(idx - 10)
+	case gdk.KEY_Page_Down:
+		c.selectRow(idx + 10)
+	case gdk.KEY_Return, gdk.KEY_KP_Enter, gdk.KEY_Tab:
+		return c.Activate()
+	case gdk.KEY_Left, gdk.KEY_Right, gdk.KEY_Home, gdk.KEY_End:
+		c.Hide()
+		return false
+	default:
+		return false
+	}
+	return true
+}
+
+// hasPrefixFold: case insensitive strings.HasPrefix, an exact
+// match is not a proposal.
+func hasPrefixFold(s, prefix string) bool {
+	rs, rp := []rune(s), []rune(prefix)
+	return len(rs) > len(rp) && strings.EqualFold(string(rs[:len(rp)]), prefix)
+}
@@ -0,0 +1,212 @@
+// completionProviders.go
+
+/*
+	This software use gotk3 that is licensed under the ISC License:
+	https://github.com/gotk3/gotk3/blob/master/LICENSE
+
+	Copyright ©2019 H.F.M - TextView Numbered  library "https//github/hfmrow"
+	This program comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+
+	Built-in completion providers, see completion.go.
+*/
+
+package sourceView
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+/*
+ * Buffer words
+ */
+
+// WordsProvider: words of the buffer starting with the prefix,
+// the most frequent first.
+type WordsProvider struct {
+	MinLength     int
+	CaseSensitive bool
+}
+
+// WordsProviderNew:
+func WordsProviderNew() *WordsProvider {
+	return &WordsProvider{MinLength: 3}
+}
+
+func (wp *WordsProvider) Name() string {
+	return "words"
+}
+
+func (wp *WordsProvider) Populate(ctx *CompletionContext) (proposals []Proposal) {
+	if len(ctx.Prefix) == 0 {
+		return
+	}
+	count := make(map[string]int)
+	var current string // Word at the cursor, not a proposal
+	runes := []rune(ctx.Text)
+	for start, idx := 0, 0; idx <= len(runes); idx++ {
+		if idx < len(runes) && isWordRune(runes[idx]) {
+			continue
+		}
+		if idx-start >= wp.MinLength {
+			word := string(runes[start:idx])
+			if ctx.Offset >= start && ctx.Offset <= idx {
+				current = word
+			}
+			count[word]++
+		}
+		start = idx + 1
+	}
+	if count[current]--; count[current] <= 0 {
+		delete(count, current)
+	}
+
+	words := make([]string, 0, len(count))
+	for word := range count {
+		if wp.CaseSensitive && strings.HasPrefix(word, ctx.Prefix) && word != ctx.Prefix ||
+			!wp.CaseSensitive && hasPrefixFold(word, ctx.Prefix) {
+			words = append(words, word)
+		}
+	}
+	sort.Slice(words, func(i, j int) bool {
+		if count[words[i]] != count[words[j]] {
+			return count[words[i]] > count[words[j]]
+		}
+		return words[i] < words[j]
+	})
+	for _, word := range words {
+		proposals = append(proposals, Proposal{Text: word})
+	}
+	return
+}
+
+/*
+ * Keywords
+ */
+
+// DefaultKeywords: keywords by GtkSourceView language id.
+var DefaultKeywords = map[string][]string{
+	"go": {"break", "case", "chan", "const", "continue", "default", "defer", "else",
+		"fallthrough", "for", "func", "go", "goto", "if", "import", "interface", "map",
+		"package", "range", "return", "select", "struct", "switch", "type", "var",
+		"append", "bool", "byte", "cap", "close", "complex", "copy", "delete", "error",
+		"false", "float32", "float64", "int", "int16", "int32", "int64", "int8", "len",
+		"make", "new", "nil", "panic", "print", "println", "recover", "rune", "string",
+		"true", "uint", "uint16", "uint32", "uint64", "uint8", "uintptr"},
+	"c": {"auto", "break", "case", "char", "const", "continue", "default", "do", "double",
+		"else", "enum", "extern", "float", "for", "goto", "if", "inline", "int", "long",
+		"register", "restrict", "return", "short", "signed", "sizeof", "static", "struct",
+		"switch", "typedef", "union", "unsigned", "void", "volatile", "while"},
+	"python3": {"False", "None", "True", "and", "as", "assert", "async", "await", "break",
+		"class", "continue", "def", "del", "elif", "else", "except", "finally", "for",
+		"from", "global", "if", "import", "in", "is", "lambda", "nonlocal", "not", "or",
+		"pass", "raise", "return", "try", "while", "with", "yield"},
+	"js": {"async", "await", "break", "case", "catch", "class", "const", "continue",
+		"debugger", "default", "delete", "do", "else", "export", "extends", "false",
+		"finally", "for", "function", "if", "import", "in", "instanceof", "let", "new",
+		"null", "return", "super", "switch", "this", "throw", "true", "try", "typeof",
+		"undefined", "var", "void", "while", "yield"},
+	"sh": {"case", "do", "done", "echo", "elif", "else", "esac", "exit", "export", "fi",
+		"for", "function", "if", "in", "local", "read", "return", "select", "shift",
+		"then", "until", "while"},
+}
+
+// KeywordsProvider: static keywords list for the language of the buffer.
+type KeywordsProvider struct {
+	Keywords map[string][]string
+}
+
+// KeywordsProviderNew: a nil map uses the default keywords.
+func KeywordsProviderNew(keywords map[string][]string) *KeywordsProvider {
+	if keywords == nil {
+		keywords = DefaultKeywords
+	}
+	return &KeywordsProvider{Keywords: keywords}
+}
+
+func (kp *KeywordsProvider) Name() string {
+	return "keywords"
+}
+
+func (kp *KeywordsProvider) Populate(ctx *CompletionContext) (proposals []Proposal) {
+	if len(ctx.Prefix) == 0 {
+		return
+	}
+	keywords := kp.Keywords[ctx.LanguageId]
+	if len(keywords) == 0 && ctx.LanguageId == "python" {
+		keywords = kp.Keywords["python3"]
+	}
+	for _, keyword := range keywords {
+		if strings.HasPrefix(keyword, ctx.Prefix) && keyword != ctx.Prefix {
+			proposals = append(proposals, Proposal{Text: keyword, Kind: "keyword"})
+		}
+	}
+	return
+}
+
+/*
+ * File paths
+ */
+
+// FilePathProvider: entries of the directory typed before the cursor,
+// "~/" is the home directory, relative paths start at 'BaseDir' (the
+// working directory when empty). The directory is read on a goroutine.
+type FilePathProvider struct {
+	BaseDir    string
+	ShowHidden bool
+}
+
+// FilePathProviderNew:
+func FilePathProviderNew(baseDir string) *FilePathProvider {
+	return &FilePathProvider{BaseDir: baseDir}
+}
+
+func (fp *FilePathProvider) Name() string {
+	return "paths"
+}
+
+func (fp *FilePathProvider) Async() bool {
+	return true
+}
+
+func (fp *FilePathProvider) Populate(ctx *CompletionContext) (proposals []Proposal) {
+	path := ctx.LineText
+	if idx := strings.LastIndexAny(path, " \t\"'`()[]{}<>=,;:"); idx >= 0 {
+		path = path[idx+1:]
+	}
+	if !strings.Contains(path, "/") {
+		return
+	}
+	dir, base := path[:strings.LastIndex(path, "/")+1], path[strings.LastIndex(path, "/")+1:]
+	switch {
+	case strings.HasPrefix(dir, "~/"):
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return
+		}
+		dir = filepath.Join(home, dir[2:])
+	case !filepath.IsAbs(dir):
+		dir = filepath.Join(fp.BaseDir, dir)
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil || ctx.Canceled() {
+		return
+	}
+	for _, info := range infos {
+		name := info.Name()
+		if !strings.HasPrefix(name, base) || name[0] == '.' && !fp.ShowHidden && !strings.HasPrefix(base, ".") {
+			continue
+		}
+		p := Proposal{Text: name, Prefix: base, Kind: "file"}
+		if info.IsDir() {
+			p.Text += "/"
+			p.Kind = "dir"
+		}
+		proposals = append(proposals, p)
+	}
+	return
+}
@@ -0,0 +1,643 @@
+// documents.go
+
+/*
+	This software use gotk3 that is licensed under the ISC License:
+	https://github.com/gotk3/gotk3/blob/master/LICENSE
+
+	Copyright ©2019 H.F.M - TextView Numbered  library "https//github/hfmrow"
+	This program comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+
+	Multi-document editor: a SourceViewStruct per page of a gtk.Notebook. The file, the
+	modified state, the format and the language of each document are tracked, the user
+	is asked to save the changes when a document is closed and the files modified on disk
+	are reloaded. The open files, the cursors and the scroll positions can be saved as a
+	session and restored.
+
+Usage:
+	dm, err := DocumentsNew(notebook, mainWindow)
+	dm.DocumentAddedFunc = func(doc *Document) {
+		doc.Svs.SetStyleScheme("classic")
+	}
+	dm.RestoreSession(sessionFile)
+	...
+	if dm.CloseAll() { // false if the user canceled
+		dm.SaveSession(sessionFile)
+		dm.Destroy()
+	}
+*/
+
+package sourceView
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+	"github.com/gotk3/gotk3/pango"
+
+	gidg "github.com/hfmrow/gtk3_import/dialog"
+	gidgc "github.com/hfmrow/gtk3_import/dialog/chooser"
+	gitv "github.com/hfmrow/gtk3_import/textView"
+
+	"github.com/hfmrow/gotk3_gtksource/source"
+)
+
+// DOCUMENT_UNTITLED: title of the documents without file.
+const DOCUMENT_UNTITLED = "Untitled"
+
+// Document: a page of the notebook.
+type Document struct {
+	Svs *SourceViewStruct
+	// Filename: absolute name of the file, empty for a new document.
+	Filename string
+
+	Page     *gtk.Box
+	Scrolled *gtk.ScrolledWindow
+	Label    *gtk.Label
+
+	dm       *Documents
+	untitled int
+	// State of the file when it was loaded or saved, used to
+	// ignore the notifications of our own writes.
+	exists  bool
+	size    int64
+	modTime time.Time
+}
+
+// Title: base name of the file or "Untitled n".
+func (doc *Document) Title() string {
+	if len(doc.Filename) == 0 {
+		return fmt.Sprintf("%s %d", DOCUMENT_UNTITLED, doc.untitled)
+	}
+	return filepath.Base(doc.Filename)
+}
+
+// Dirty: the buffer has been modified since it was loaded or saved.
+func (doc *Document) Dirty() bool {
+	return doc.Svs.Buffer.GetModified()
+}
+
+// Encoding: encoding used to save the file, see also Svs.SetFormat.
+func (doc *Document) Encoding() gitv.TextEncoding {
+	return doc.Svs.Format.Encoding
+}
+
+// Language: id of the language, empty if none.
+func (doc *Document) Language() string {
+	if doc.Svs.Language != nil {
+		return doc.Svs.Language.GetId()
+	}
+	return ""
+}
+
+// Cursor: line and column (in characters) of the cursor.
+func (doc *Document) Cursor() (line, column int) {
+	iter := doc.Svs.Buffer.GetIterAtMark(doc.Svs.Buffer.GetInsert())
+	return iter.GetLine(), iter.GetLineOffset()
+}
+
+// SetCursor: place the cursor, the position is clamped to the text.
+func (doc *Document) SetCursor(line, column int) {
+	buff := doc.Svs.Buffer
+	if count := buff.GetLineCount(); line >= count {
+		line = count - 1
+	}
+	if line < 0 {
+		line = 0
+	}
+	iter, end := buff.GetIterAtLine(line), buff.GetIterAtLine(line)
+	if !end.EndsLine() {
+		end.ForwardToLineEnd()
+	}
+	if length := end.GetLineOffset(); column > length {
+		column = length
+	}
+	iter.SetLineOffset(column)
+	buff.PlaceCursor(iter)
+}
+
+// Scroll: vertical position of the view.
+func (doc *Document) Scroll() float64 {
+	return doc.Scrolled.GetVAdjustment().GetValue()
+}
+
+// SetScroll: set the vertical position once the text is laid out.
+func (doc *Document) SetScroll(value float64) {
+	glib.IdleAdd(func() {
+		doc.Scrolled.GetVAdjustment().SetValue(value)
+	})
+}
+
+// snapshot: store the state of the file.
+func (doc *Document) snapshot() {
+	doc.exists, doc.size, doc.modTime = false, 0, time.Time{}
+	if info, err := os.Stat(doc.Filename); err == nil {
+		doc.exists, doc.size, doc.modTime = true, info.Size(), info.ModTime()
+	}
+}
+
+// changedOnDisk: the file differs from the snapshot.
+func (doc *Document) changedOnDisk() bool {
+	info, err := os.Stat(doc.Filename)
+	if err != nil {
+		return doc.exists
+	}
+	return !doc.exists || info.Size() != doc.size || !info.ModTime().Equal(doc.modTime)
+}
+
+// guessLanguage: set the language from the name of the file.
+func (doc *Document) guessLanguage() {
+	if doc.Svs.initLanguageAndStyleScheme() == nil {
+		if lang, err := doc.Svs.LanguageManager.GetGuessLanguage(doc.Filename, ""); err == nil {
+			doc.Svs.SetLanguage(lang.GetId())
+		}
+	}
+}
+
+// updateLabel: title with a star when modified, the file
+// and its format as tooltip.
+func (doc *Document) updateLabel() {
+	title := doc.Title()
+	if doc.Dirty() {
+		title = "*" + title
+	}
+	doc.Label.SetText(title)
+	tooltip := doc.Title()
+	if len(doc.Filename) > 0 {
+		tooltip = doc.Filename
+	}
+	doc.Label.SetTooltipText(tooltip + "\n" + doc.Svs.Format.String())
+	doc.dm.Notebook.SetMenuLabelText(doc.Page, title)
+	if doc.dm.ChangedFunc != nil {
+		doc.dm.ChangedFunc(doc)
+	}
+}
+
+// Documents: the document manager.
+type Documents struct {
+	Notebook *gtk.Notebook
+	Window   *gtk.Window
+
+	// DocumentAddedFunc: called with each new document, before the
+	// file is loaded, to set the style, enable the completion...
+	DocumentAddedFunc func(doc *Document)
+	// ClosedFunc: called when a document has been closed.
+	ClosedFunc func(doc *Document)
+	// ChangedFunc: the title, the modified state or the format changed.
+	ChangedFunc func(doc *Document)
+	// SaveAsFunc: ask for a file name, a file chooser is used if not set.
+	SaveAsFunc func(doc *Document) (filename string, ok bool)
+	// ErrorFunc: report the errors of the actions started by the user
+	// (close, reload), an error dialog is displayed if not set.
+	ErrorFunc func(doc *Document, err error)
+
+	docs     []*Document
+	watcher  *gitv.FileWatcher
+	untitled int
+}
+
+// DocumentsNew: manage the pages of the notebook.
+func DocumentsNew(notebook *gtk.Notebook, window *gtk.Window) (dm *Documents, err error) {
+	dm = &Documents{Notebook: notebook, Window: window}
+	dm.watcher, err = gitv.FileWatcherNew(func(filename string) {
+		glib.IdleAdd(func() {
+			dm.fileChanged(filename)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	notebook.SetScrollable(true)
+	notebook.PopupEnable()
+	return
+}
+
+// Destroy: stop watching the files, the documents are left as is.
+func (dm *Documents) Destroy() {
+	dm.watcher.Close()
+}
+
+// New: add an empty document.
+func (dm *Documents) New() (doc *Document, err error) {
+	var view *source.SourceView
+	var srcMap *source.SourceMap
+	var tab *gtk.Box
+	var button *gtk.Button
+
+	if view, err = source.SourceViewNew(); err != nil {
+		return
+	}
+	if srcMap, err = source.SourceMapNew(); err != nil {
+		return
+	}
+	doc = &Document{dm: dm}
+	if doc.Svs, err = SourceViewStructNew(view, srcMap, dm.Window); err != nil {
+		return nil, err
+	}
+	srcMap.SetView(view)
+
+	if doc.Scrolled, err = gtk.ScrolledWindowNew(nil, nil); err != nil {
+		return nil, err
+	}
+	doc.Scrolled.Add(view)
+	if doc.Page, err = gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 0); err != nil {
+		return nil, err
+	}
+	doc.Page.PackStart(doc.Scrolled, true, true, 0)
+	doc.Page.PackStart(srcMap, false, false, 0)
+
+	// Tab: title & close button
+	if tab, err = gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 4); err != nil {
+		return nil, err
+	}
+	if doc.Label, err = gtk.LabelNew(""); err != nil {
+		return nil, err
+	}
+	doc.Label.SetEllipsize(pango.ELLIPSIZE_MIDDLE)
+	doc.Label.SetMaxWidthChars(32)
+	if button, err = gtk.ButtonNewFromIconName("window-close-symbolic", gtk.ICON_SIZE_MENU); err != nil {
+		return nil, err
+	}
+	button.SetRelief(gtk.RELIEF_NONE)
+	button.SetFocusOnClick(false)
+	button.Connect("clicked", func() { dm.Close(doc) })
+	tab.PackStart(doc.Label, true, true, 0)
+	tab.PackStart(button, false, false, 0)
+	tab.ShowAll()
+
+	dm.untitled++
+	doc.untitled = dm.untitled
+	dm.docs = append(dm.docs, doc)
+
+	doc.Svs.Buffer.Connect("modified-changed", func() { doc.updateLabel() })
+	if dm.DocumentAddedFunc != nil {
+		dm.DocumentAddedFunc(doc)
+	}
+	doc.updateLabel()
+
+	page := dm.Notebook.AppendPage(doc.Page, tab)
+	dm.Notebook.SetTabReorderable(doc.Page, true)
+	doc.Page.ShowAll()
+	dm.Notebook.SetCurrentPage(page)
+	view.GrabFocus()
+	return
+}
+
+// Open: open the file in a new document, or show it if it's already
+// opened. The encoding is detected unless 'enc' is given. When the file
+// contains invalid byte sequences, the document is created and a
+// *gitv.DecodeError is returned.
+func (dm *Documents) Open(filename string, enc ...gitv.TextEncoding) (doc *Document, err error) {
+	var decErr *gitv.DecodeError
+
+	if filename, err = filepath.Abs(filename); err != nil {
+		return
+	}
+	if doc = dm.Find(filename); doc != nil {
+		dm.Notebook.SetCurrentPage(dm.Notebook.PageNum(doc.Page))
+		return
+	}
+	if _, err = os.Stat(filename); err != nil {
+		return
+	}
+	if doc, err = dm.New(); err != nil {
+		return
+	}
+	doc.Filename = filename
+	doc.guessLanguage()
+	if err = doc.Svs.LoadFile(filename, enc...); err != nil && !errors.As(err, &decErr) {
+		dm.remove(doc)
+		return nil, err
+	}
+	doc.snapshot()
+	dm.watcher.Add(filename)
+	doc.Svs.SetCursorAtLine(0)
+	doc.updateLabel()
+	return
+}
+
+// Find: the document of the file, nil if not opened.
+func (dm *Documents) Find(filename string) *Document {
+	if abs, err := filepath.Abs(filename); err == nil {
+		filename = abs
+	}
+	for _, doc := range dm.docs {
+		if doc.Filename == filename {
+			return doc
+		}
+	}
+	return nil
+}
+
+// Documents: the documents in the order of the tabs.
+func (dm *Documents) Documents() (docs []*Document) {
+	for idx := 0; idx < dm.Notebook.GetNPages(); idx++ {
+		if doc := dm.atPage(idx); doc != nil {
+			docs = append(docs, doc)
+		}
+	}
+	return
+}
+
+// Current: the document of the current page, nil if none.
+func (dm *Documents) Current() *Document {
+	return dm.atPage(dm.Notebook.GetCurrentPage())
+}
+
+// atPage: document of the page.
+func (dm *Documents) atPage(idx int) *Document {
+	if idx >= 0 {
+		if widget, err := dm.Notebook.GetNthPage(idx); err == nil {
+			native := widget.ToWidget().Native()
+			for _, doc := range dm.docs {
+				if doc.Page.Native() == native {
+					return doc
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Save: save the document, the file name is asked for a new one.
+// A *gitv.EncodeError is returned when some characters can't be
+// represented in the encoding of the document, see Svs.SaveFile.
+func (dm *Documents) Save(doc *Document) (err error) {
+	if len(doc.Filename) == 0 {
+		return dm.SaveAs(doc, "")
+	}
+	err = doc.Svs.SaveFile(doc.Filename)
+	doc.snapshot()
+	doc.updateLabel()
+	return
+}
+
+// SaveAs: save the document in another file, the file name is
+// asked if 'filename' is empty. Nothing is done if the user cancel.
+func (dm *Documents) SaveAs(doc *Document, filename string) (err error) {
+	var ok bool
+	if len(filename) == 0 {
+		if dm.SaveAsFunc != nil {
+			filename, ok = dm.SaveAsFunc(doc)
+		} else {
+			filename, ok, err = gidgc.FileChooserN(dm.Window, "", doc.Filename, gidgc.FC_DLG_SAVE)
+		}
+		if err != nil || !ok {
+			return
+		}
+	}
+	if filename, err = filepath.Abs(filename); err != nil {
+		return
+	}
+	if other := dm.Find(filename); other != nil && other != doc {
+		return fmt.Errorf("%s is opened in another document", filename)
+	}
+	if err = doc.Svs.SaveFile(filename); err != nil {
+		return
+	}
+	if len(doc.Filename) > 0 {
+		dm.watcher.Remove(doc.Filename)
+	}
+	doc.Filename = filename
+	doc.snapshot()
+	dm.watcher.Add(filename)
+	if doc.Svs.Language == nil {
+		doc.guessLanguage()
+	}
+	doc.updateLabel()
+	return
+}
+
+// SaveAll: save the modified documents, stop at the first error.
+func (dm *Documents) SaveAll() (err error) {
+	for _, doc := range dm.Documents() {
+		if doc.Dirty() {
+			if err = dm.Save(doc); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// Close: close the document, the user is asked to save it when it has
+// been modified. Return false if the user canceled or the save failed.
+func (dm *Documents) Close(doc *Document) bool {
+	if doc.Dirty() {
+		dm.Notebook.SetCurrentPage(dm.Notebook.PageNum(doc.Page))
+		switch gidg.DialogMessage(dm.Window,
+			"Close document",
+			fmt.Sprintf("Save the changes to \"%s\" before closing?", doc.Title()),
+			nil,
+			gidg.DLG_QUESTION,
+			"Cancel",
+			"Close without saving",
+			"Save") {
+		case 1:
+		case 2:
+			if err := dm.Save(doc); err != nil {
+				dm.error(doc, err)
+				return false
+			}
+			if doc.Dirty() { // Save as canceled
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	dm.remove(doc)
+	if dm.ClosedFunc != nil {
+		dm.ClosedFunc(doc)
+	}
+	return true
+}
+
+// CloseAll: close all documents, false if the user canceled.
+func (dm *Documents) CloseAll() bool {
+	for _, doc := range dm.Documents() {
+		if !dm.Close(doc) {
+			return false
+		}
+	}
+	return true
+}
+
+// remove: remove the page of the document.
+func (dm *Documents) remove(doc *Document) {
+	if len(doc.Filename) > 0 {
+		dm.watcher.Remove(doc.Filename)
+	}
+	if page := dm.Notebook.PageNum(doc.Page); page >= 0 {
+		dm.Notebook.RemovePage(page)
+	}
+	for idx, d := range dm.docs {
+		if d == doc {
+			dm.docs = append(dm.docs[:idx], dm.docs[idx+1:]...)
+			break
+		}
+	}
+}
+
+// Reload: load the file again, with the same encoding. The
+// cursor and the scroll position are kept.
+func (dm *Documents) Reload(doc *Document) (err error) {
+	var decErr *gitv.DecodeError
+
+	if len(doc.Filename) == 0 {
+		return
+	}
+	line, column := doc.Cursor()
+	scroll := doc.Scroll()
+	if err = doc.Svs.LoadFile(doc.Filename, doc.Svs.Format.Encoding); err == nil || errors.As(err, &decErr) {
+		doc.SetCursor(line, column)
+		doc.SetScroll(scroll)
+	}
+	doc.snapshot()
+	doc.updateLabel()
+	return
+}
+
+// fileChanged: a watched file has been modified, replaced or removed.
+// The unmodified documents are reloaded, the user is asked for the
+// others. A removed file leaves its document modified.
+func (dm *Documents) fileChanged(filename string) {
+	doc := dm.Find(filename)
+	if doc == nil || !doc.changedOnDisk() {
+		return
+	}
+	doc.snapshot()
+	switch {
+	case !doc.exists:
+		doc.Svs.Buffer.SetModified(true)
+	case !doc.Dirty():
+		if err := dm.Reload(doc); err != nil {
+			dm.error(doc, err)
+		}
+	case gidg.DialogMessage(dm.Window,
+		"File changed",
+		fmt.Sprintf("\"%s\" has been modified by another program.\nReload it and lose your changes?", doc.Filename),
+		nil,
+		gidg.DLG_WARNING,
+		"Keep my version",
+		"Reload") == 1:
+		if err := dm.Reload(doc); err != nil {
+			dm.error(doc, err)
+		}
+	}
+}
+
+// error: report an error.
+func (dm *Documents) error(doc *Document, err error) {
+	if dm.ErrorFunc != nil {
+		dm.ErrorFunc(doc, err)
+		return
+	}
+	gidg.DialogError(dm.Window, doc.Title(), "", err, false)
+}
+
+/*
+ * Session
+ */
+
+// SessionFile: state of an opened file.
+type SessionFile struct {
+	Filename string            `json:"filename"`
+	Encoding gitv.TextEncoding `json:"encoding"`
+	Language string            `json:"language,omitempty"`
+	Line     int               `json:"line"`
+	Column   int               `json:"column"`
+	Scroll   float64           `json:"scroll"`
+}
+
+// Session: the opened files, in the order of the tabs, and the
+// index of the current one. The new documents aren't saved.
+type Session struct {
+	Files   []SessionFile `json:"files"`
+	Current int           `json:"current"`
+}
+
+// Session: get the current session.
+func (dm *Documents) Session() (session Session) {
+	current := dm.Current()
+	session.Current = -1
+	for _, doc := range dm.Documents() {
+		if len(doc.Filename) == 0 {
+			continue
+		}
+		if doc == current {
+			session.Current = len(session.Files)
+		}
+		line, column := doc.Cursor()
+		session.Files = append(session.Files, SessionFile{
+			Filename: doc.Filename,
+			Encoding: doc.Encoding(),
+			Language: doc.Language(),
+			Line:     line,
+			Column:   column,
+			Scroll:   doc.Scroll()})
+	}
+	return
+}
+
+// SaveSession: write the session as JSON.
+func (dm *Documents) SaveSession(filename string) (err error) {
+	var data []byte
+	if data, err = json.MarshalIndent(dm.Session(), "", "\t"); err != nil {
+		return
+	}
+	if err = os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return
+	}
+	return ioutil.WriteFile(filename, data, 0644)
+}
+
+// RestoreSession: open the files of the session, the missing ones are
+// skipped. A missing session file isn't an error. The first error
+// encountered is returned once all the files have been processed.
+func (dm *Documents) RestoreSession(filename string) (err error) {
+	var data []byte
+	var session Session
+
+	if data, err = ioutil.ReadFile(filename); err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	if err = json.Unmarshal(data, &session); err != nil {
+		return
+	}
+	var current *Document
+	for idx, file := range session.Files {
+		if _, e := os.Stat(file.Filename); os.IsNotExist(e) {
+			continue
+		}
+		doc, e := dm.Open(file.Filename, file.Encoding)
+		if doc == nil {
+			if err == nil {
+				err = e
+			}
+			continue
+		}
+		if len(file.Language) > 0 {
+			doc.Svs.SetLanguage(file.Language)
+		}
+		doc.SetCursor(file.Line, file.Column)
+		doc.SetScroll(file.Scroll)
+		if idx == session.Current {
+			current = doc
+		}
+	}
+	if current != nil {
+		dm.Notebook.SetCurrentPage(dm.Notebook.PageNum(current.Page))
+	}
+	return
+}
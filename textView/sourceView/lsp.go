@@ -0,0 +1,466 @@
+// lsp.go
+
+/*
+	This software use gotk3 that is licensed under the ISC License:
+	https://github.com/gotk3/gotk3/blob/master/LICENSE
+
+	Copyright ©2019 H.F.M - TextView Numbered  library "https//github/hfmrow"
+	This program comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+
+	Language server integration, see textView/lsp for the client. The buffer is sent to the
+	server after each modification (delayed by LSP_SYNC_DELAY), the diagnostics are shown
+	as underlined text with an icon in the gutter, the hover text and the diagnostics
+	messages are displayed in the tooltip of the view and the completion items are given
+	through a CompletionProvider.
+
+	The hover is requested when the pointer rests on a word, the tooltip is displayed at
+	the next pointer motion once the server has replied.
+*/
+
+package sourceView
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+	"github.com/gotk3/gotk3/pango"
+
+	"github.com/hfmrow/gtk3_import/textView/lsp"
+	gitvtt "github.com/hfmrow/gtk3_import/textView/textTag"
+
+	"github.com/hfmrow/gotk3_gtksource/source"
+)
+
+// LSP_SYNC_DELAY: delay between a modification and the synchronization.
+const LSP_SYNC_DELAY = 300 * time.Millisecond
+
+// lspSeverities: tag and gutter mark category, icon, underline
+// style by severity, index 0 is used for an unknown one.
+var lspSeverities = []struct {
+	category, icon string
+	underline      pango.Underline
+}{
+	{"lsp:error", "dialog-error-symbolic", pango.UNDERLINE_ERROR},
+	{"lsp:error", "dialog-error-symbolic", pango.UNDERLINE_ERROR},
+	{"lsp:warning", "dialog-warning-symbolic", pango.UNDERLINE_ERROR},
+	{"lsp:information", "dialog-information-symbolic", pango.UNDERLINE_SINGLE},
+	{"lsp:hint", "dialog-information-symbolic", pango.UNDERLINE_LOW},
+}
+
+// LspDocument: buffer of a SourceViewStruct opened on a language server.
+type LspDocument struct {
+	Client *lsp.Client
+	URI,
+	LanguageId string
+
+	// OpenLocation: called by GotoDefinition when the definition is in
+	// another file, 'line' is 0 based and 'column' is in UTF-16 code
+	// units, see lsp.RuneColumn.
+	OpenLocation func(filename string, line, column int)
+	// ErrorCallback: errors of the requests made in the background.
+	ErrorCallback func(err error)
+
+	svs         *SourceViewStruct
+	diagnostics []lsp.Diagnostic
+	marks       []*source.SourceMark
+	handlers    [2]glib.SignalHandle // Buffer "changed", View "query-tooltip"
+	timer       glib.SourceHandle
+	cancelHover context.CancelFunc
+	hover       lspHover
+
+	mu      sync.Mutex // version & sent, used by the completion goroutine
+	version int
+	sent    string
+}
+
+// lspHover: hover text of the word at 'offset' for the 'version'.
+type lspHover struct {
+	offset,
+	version int
+	text string
+}
+
+// LspAttach: open the buffer on the server, 'languageId' is the LSP one
+// ("go", "python", ...), the language id of the buffer when empty.
+func (svs *SourceViewStruct) LspAttach(client *lsp.Client, filename, languageId string) (doc *LspDocument, err error) {
+	if len(languageId) == 0 {
+		if lang, err := svs.Buffer.GetLanguage(); err == nil && lang != nil {
+			languageId = lang.GetId()
+		}
+	}
+	doc = &LspDocument{
+		Client:     client,
+		URI:        lsp.FileURI(filename),
+		LanguageId: languageId,
+		svs:        svs,
+		version:    1,
+		sent:       svs.GetText(),
+		hover:      lspHover{offset: -1}}
+	if err = client.DidOpen(doc.URI, doc.LanguageId, doc.version, doc.sent); err != nil {
+		return nil, err
+	}
+
+	for _, s := range lspSeverities[1:] {
+		if attrs, err := source.SourceMarkAttributesNew(); err == nil {
+			attrs.SetIconName(s.icon)
+			svs.View.SetMarkAttributes(s.category, attrs, 0)
+		}
+		gitvtt.TagCreateIfNotExists(svs.Buffer, s.category,
+			map[string]interface{}{"underline": s.underline})
+	}
+	svs.View.SetShowLineMarks(true)
+	svs.View.SetProperty("has-tooltip", true)
+
+	doc.handlers[0] = svs.Buffer.Connect("changed", doc.changed)
+	doc.handlers[1] = svs.View.Connect("query-tooltip", doc.queryTooltip)
+	client.WatchDiagnostics(doc.URI, func(diagnostics []lsp.Diagnostic) {
+		glib.IdleAdd(func() {
+			doc.SetDiagnostics(diagnostics)
+		})
+	})
+	return
+}
+
+// Detach: close the document on the server and remove the diagnostics.
+func (doc *LspDocument) Detach() error {
+	doc.stopTimer()
+	if doc.cancelHover != nil {
+		doc.cancelHover()
+	}
+	doc.Client.WatchDiagnostics(doc.URI, nil)
+	doc.svs.Buffer.HandlerDisconnect(doc.handlers[0])
+	doc.svs.View.HandlerDisconnect(doc.handlers[1])
+	doc.SetDiagnostics(nil)
+	return doc.Client.DidClose(doc.URI)
+}
+
+// Sync: send the pending modifications now.
+func (doc *LspDocument) Sync() {
+	doc.stopTimer()
+	doc.syncText(doc.svs.GetText())
+}
+
+// Saved: tell the server that the file has been saved.
+func (doc *LspDocument) Saved() error {
+	doc.Sync()
+	return doc.Client.DidSave(doc.URI)
+}
+
+// Diagnostics: the last published diagnostics.
+func (doc *LspDocument) Diagnostics() []lsp.Diagnostic {
+	return doc.diagnostics
+}
+
+// SetDiagnostics: display the diagnostics, must be called from the main loop.
+func (doc *LspDocument) SetDiagnostics(diagnostics []lsp.Diagnostic) {
+	buff := doc.svs.Buffer
+	for _, s := range lspSeverities[1:] {
+		gitvtt.TagRemoveIfExists(buff, s.category)
+	}
+	// Deleted one by one, the gotk3_gtksource wrappers ignore the category
+	// (RemoveSourceMarks would remove the marks of any category).
+	for _, mark := range doc.marks {
+		buff.DeleteMark(&mark.TextMark)
+	}
+	doc.marks = doc.marks[:0]
+	doc.diagnostics = diagnostics
+	for idx, d := range diagnostics {
+		s := lspSeverities[0]
+		if int(d.Severity) > 0 && int(d.Severity) < len(lspSeverities) {
+			s = lspSeverities[d.Severity]
+		}
+		ds, de := doc.iterAt(d.Range.Start), doc.iterAt(d.Range.End)
+		if ds.Equal(de) && !de.EndsLine() {
+			de.ForwardChar() // Make the empty ranges visible
+		}
+		if tag, ok := gitvtt.TagLookupIfExists(buff, s.category); ok {
+			buff.ApplyTag(tag, ds, de)
+		}
+		// Unique names, gotk3 gives "" instead of NULL for an anonymous mark.
+		if mark, err := buff.CreateSourceMark(fmt.Sprintf("lsp:diagnostic-%d", idx), s.category, ds); err == nil {
+			doc.marks = append(doc.marks, mark)
+		}
+	}
+}
+
+// GotoDefinition: request the definition of the symbol at the cursor and
+// go to it, 'OpenLocation' is called when it's in another file.
+func (doc *LspDocument) GotoDefinition() {
+	doc.Sync()
+	pos := doc.position(doc.svs.Buffer.GetIterAtMark(doc.svs.Buffer.GetInsert()))
+	go func() {
+		locations, err := doc.Client.Definition(context.Background(), doc.URI, pos)
+		glib.IdleAdd(func() {
+			switch {
+			case err != nil:
+				doc.error(err)
+			case len(locations) == 0:
+			case locations[0].URI == doc.URI:
+				iter := doc.iterAt(locations[0].Range.Start)
+				doc.svs.Buffer.PlaceCursor(iter)
+				doc.svs.ScrollToIter(iter)
+			case doc.OpenLocation != nil:
+				filename, err := lsp.URIToPath(locations[0].URI)
+				if err != nil {
+					doc.error(err)
+					return
+				}
+				start := locations[0].Range.Start
+				doc.OpenLocation(filename, start.Line, start.Character)
+			}
+		})
+	}()
+}
+
+// CompletionProvider: provider for the Completion of the view,
+// see completion.go.
+func (doc *LspDocument) CompletionProvider() CompletionProvider {
+	return &lspCompletionProvider{doc: doc}
+}
+
+// changed: delay the synchronization, the hover is outdated.
+func (doc *LspDocument) changed() {
+	doc.hover = lspHover{offset: -1}
+	doc.stopTimer()
+	doc.timer = glib.TimeoutAdd(uint(LSP_SYNC_DELAY/time.Millisecond), func() bool {
+		doc.timer = 0
+		doc.syncText(doc.svs.GetText())
+		return false
+	})
+}
+
+func (doc *LspDocument) stopTimer() {
+	if doc.timer != 0 {
+		glib.SourceRemove(doc.timer)
+		doc.timer = 0
+	}
+}
+
+// syncText: send the text if it has changed since the last time,
+// it may be called from a goroutine.
+func (doc *LspDocument) syncText(text string) {
+	doc.mu.Lock()
+	defer doc.mu.Unlock()
+	if text != doc.sent {
+		doc.version++
+		doc.sent = text
+		if err := doc.Client.DidChange(doc.URI, doc.version, text); err != nil {
+			glib.IdleAdd(func() { doc.error(err) })
+		}
+	}
+}
+
+// error: report an error, canceled requests are not errors.
+func (doc *LspDocument) error(err error) {
+	if err != context.Canceled && doc.ErrorCallback != nil {
+		doc.ErrorCallback(err)
+	}
+}
+
+// iterAt: convert a LSP position.
+func (doc *LspDocument) iterAt(pos lsp.Position) (iter *gtk.TextIter) {
+	buff := doc.svs.Buffer
+	if pos.Line >= buff.GetLineCount() {
+		return buff.GetEndIter()
+	}
+	iter = buff.GetIterAtLine(pos.Line)
+	end := buff.GetIterAtLine(pos.Line)
+	if !end.EndsLine() {
+		end.ForwardToLineEnd()
+	}
+	line, _ := buff.GetText(iter, end, false)
+	iter.SetLineOffset(lsp.RuneColumn(line, pos.Character))
+	return
+}
+
+// position: convert to a LSP position.
+func (doc *LspDocument) position(iter *gtk.TextIter) lsp.Position {
+	start := doc.svs.Buffer.GetIterAtLine(iter.GetLine())
+	text, _ := doc.svs.Buffer.GetText(start, iter, false)
+	return lsp.Position{Line: iter.GetLine(), Character: lsp.UTF16Column(text)}
+}
+
+// queryTooltip: the diagnostics and the hover text under the pointer.
+func (doc *LspDocument) queryTooltip(view *source.SourceView, x, y int, keyboardMode bool, tooltip *gtk.Tooltip) bool {
+	var iter *gtk.TextIter
+	if keyboardMode {
+		iter = doc.svs.Buffer.GetIterAtMark(doc.svs.Buffer.GetInsert())
+	} else {
+		bx, by := view.WindowToBufferCoords(gtk.TEXT_WINDOW_WIDGET, x, y)
+		var trailing int
+		if iter, trailing = view.GetIterAtPosition(bx, by); trailing == 0 && iter.EndsLine() {
+			return false // After the end of the line
+		}
+	}
+
+	var parts []string
+	pos := doc.position(iter)
+	for _, d := range doc.diagnostics {
+		if lspContains(d.Range, pos) {
+			parts = append(parts, d.Message)
+		}
+	}
+	if text := doc.hoverAt(iter); len(text) > 0 {
+		parts = append(parts, text)
+	}
+	if len(parts) == 0 {
+		return false
+	}
+	tooltip.SetText(strings.Join(parts, "\n\n"))
+	return true
+}
+
+// hoverAt: hover text of the word at the iter, requested
+// in the background when not known yet.
+func (doc *LspDocument) hoverAt(iter *gtk.TextIter) string {
+	if !doc.Client.HasCapability("hoverProvider") || !iter.InsideWord() && !iter.EndsWord() {
+		return ""
+	}
+	start := doc.svs.Buffer.GetIterAtOffset(iter.GetOffset())
+	for !start.StartsWord() && start.BackwardChar() {
+	}
+	doc.mu.Lock()
+	version := doc.version
+	doc.mu.Unlock()
+	if doc.hover.offset == start.GetOffset() && doc.hover.version == version {
+		return doc.hover.text // Known or pending
+	}
+
+	if doc.cancelHover != nil {
+		doc.cancelHover()
+	}
+	var ctx context.Context
+	ctx, doc.cancelHover = context.WithCancel(context.Background())
+	hover := lspHover{offset: start.GetOffset(), version: version}
+	doc.hover = hover
+	pos := doc.position(iter)
+	go func() {
+		text, err := doc.Client.Hover(ctx, doc.URI, pos)
+		glib.IdleAdd(func() {
+			if err != nil {
+				doc.error(err)
+			} else if doc.hover == hover {
+				doc.hover.text = text
+			}
+		})
+	}()
+	return ""
+}
+
+// lspContains: the position is inside the range, bounds included.
+func lspContains(r lsp.Range, pos lsp.Position) bool {
+	after := pos.Line > r.Start.Line || pos.Line == r.Start.Line && pos.Character >= r.Start.Character
+	before := pos.Line < r.End.Line || pos.Line == r.End.Line && pos.Character <= r.End.Character
+	return after && before
+}
+
+/*
+ * Completion
+ */
+
+type lspCompletionProvider struct {
+	doc *LspDocument
+}
+
+func (p *lspCompletionProvider) Name() string {
+	return "lsp"
+}
+
+func (p *lspCompletionProvider) Async() bool {
+	return true
+}
+
+func (p *lspCompletionProvider) Populate(ctx *CompletionContext) (proposals []Proposal) {
+	p.doc.syncText(ctx.Text)
+
+	reqCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-ctx.Done():
+			cancel()
+		case <-reqCtx.Done():
+		}
+	}()
+
+	pos := lsp.Position{Line: ctx.Line, Character: lsp.UTF16Column(ctx.LineText)}
+	items, _, err := p.doc.Client.Completion(reqCtx, p.doc.URI, pos)
+	if err != nil {
+		return
+	}
+	for _, item := range items {
+		filter := item.FilterText
+		if len(filter) == 0 {
+			filter = item.Label
+		}
+		proposal := Proposal{
+			Label: item.Label,
+			Text:  item.InsertText,
+			Kind:  lsp.CompletionKindName(item.Kind),
+			Info:  strings.TrimSpace(item.Detail + "\n\n" + item.Doc())}
+		filtered := false
+		if item.TextEdit != nil {
+			proposal.Text = item.TextEdit.NewText
+			// Replaced text, from the start of the edit to the cursor,
+			// the server has already filtered the item.
+			if item.TextEdit.Range.Start.Line == ctx.Line {
+				col := lsp.RuneColumn(ctx.LineText, item.TextEdit.Range.Start.Character)
+				proposal.Prefix = string([]rune(ctx.LineText)[col:])
+				filtered = true
+			}
+		}
+		if len(proposal.Text) == 0 {
+			proposal.Text = item.Label
+		}
+		if item.InsertTextFormat == lsp.INSERT_TEXT_SNIPPET {
+			proposal.Text = snippetText(proposal.Text)
+		}
+		if filtered || len(ctx.Prefix) == 0 || hasPrefixFold(filter, ctx.Prefix) {
+			proposals = append(proposals, proposal)
+		}
+	}
+	return
+}
+
+// snippetText: remove the placeholders of a snippet, "${1:name}" gives "name".
+func snippetText(snippet string) string {
+	var b strings.Builder
+	var depth int // Opened placeholders
+	runes := []rune(snippet)
+	for idx := 0; idx < len(runes); idx++ {
+		switch {
+		case runes[idx] == '\\' && idx+1 < len(runes):
+			idx++
+			b.WriteRune(runes[idx])
+		case runes[idx] == '$' && idx+1 < len(runes) && runes[idx+1] == '{':
+			// "${N:default}" or "${N}"
+			end := idx + 2
+			for end < len(runes) && runes[end] >= '0' && runes[end] <= '9' {
+				end++
+			}
+			if end < len(runes) && runes[end] == ':' {
+				idx = end
+				depth++
+			} else {
+				for idx < len(runes) && runes[idx] != '}' {
+					idx++
+				}
+			}
+		case runes[idx] == '$' && idx+1 < len(runes) && runes[idx+1] >= '0' && runes[idx+1] <= '9':
+			for idx+1 < len(runes) && runes[idx+1] >= '0' && runes[idx+1] <= '9' {
+				idx++
+			}
+		case runes[idx] == '}' && depth > 0:
+			depth--
+		default:
+			b.WriteRune(runes[idx])
+		}
+	}
+	return b.String()
+}
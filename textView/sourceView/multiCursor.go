@@ -0,0 +1,521 @@
+// multiCursor.go
+
+/*
+	This software use gotk3 that is licensed under the ISC License:
+	https://github.com/gotk3/gotk3/blob/master/LICENSE
+
+	Copyright ©2019 H.F.M - TextView Numbered  library "https//github/hfmrow"
+	This program comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+
+	Multiple cursors and rectangular (block) selection for SourceViewStruct. The primary
+	cursor is the one of the buffer, the extra cursors are tracked with marks so they
+	follow the edits. Typed text, Return, Tab, BackSpace, Delete and paste are applied at
+	all the cursors as a single user action, so one undo reverts them together. The typed
+	text is the one committed by the input method of the view (dead keys, compose ...),
+	it's inserted again at the extra cursors.
+
+	Ctrl+click: add a cursor, Alt+drag: block selection (visual columns, clamped to the
+	lines length), Esc or a click: remove the extra cursors. AddNextOccurrence may be
+	bound to a shortcut by the application.
+*/
+
+package sourceView
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gotk3/gotk3/cairo"
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/gtk"
+
+	gitvtt "github.com/hfmrow/gtk3_import/textView/textTag"
+
+	"github.com/hfmrow/gotk3_gtksource/source"
+)
+
+// MULTI_CURSOR_WIDTH: width of the extra cursors in pixels.
+const MULTI_CURSOR_WIDTH = 2
+
+// MultiCursor: extra cursors of a SourceViewStruct.
+type MultiCursor struct {
+	CursorCol,
+	SelectionBgCol string
+
+	svs       *SourceViewStruct
+	cursors   []*extraCursor
+	seq       int
+	enabled   bool
+	connected bool
+	editing   bool
+	typing    bool // A key has been given to the input method.
+	// Block selection anchor while Alt+dragging.
+	blockLine,
+	blockCol int
+	blockDrag bool
+}
+
+// extraCursor: 'insert' and 'bound' are the same as the buffer
+// "insert" & "selection_bound" marks, which are the ones of the
+// 'primary' cursor.
+type extraCursor struct {
+	insert,
+	bound *gtk.TextMark
+	primary bool
+}
+
+// MultiCursorEnable: enable or disable the multiple cursors, the
+// MultiCursor is created on the first call.
+func (svs *SourceViewStruct) MultiCursorEnable(enable bool) *MultiCursor {
+	if svs.MultiCursor == nil {
+		svs.MultiCursor = &MultiCursor{svs: svs, CursorCol: svs.TxtFgCol, SelectionBgCol: svs.SelBgCol}
+	}
+	mc := svs.MultiCursor
+	if enable && !mc.connected {
+		mc.connected = true
+		svs.View.AddEvents(int(gdk.BUTTON1_MOTION_MASK))
+		svs.View.Connect("key-press-event", mc.keyPressed)
+		svs.View.Connect("button-press-event", mc.buttonPressed)
+		svs.View.Connect("motion-notify-event", mc.motion)
+		svs.View.Connect("button-release-event", func() { mc.blockDrag = false })
+		svs.View.Connect("paste-clipboard", mc.paste)
+		svs.View.ConnectAfter("draw", mc.draw)
+		svs.Buffer.Connect("changed", func() {
+			if len(mc.cursors) > 0 && !mc.editing {
+				mc.refresh()
+			}
+		})
+		svs.Buffer.ConnectAfter("insert-text", mc.inserted)
+		svs.Buffer.Connect("end-user-action", func() {
+			if !mc.editing {
+				mc.typing = false
+			}
+		})
+	}
+	if mc.enabled = enable; !enable {
+		mc.Clear()
+	}
+	return mc
+}
+
+// Count: number of cursors, including the primary one.
+func (mc *MultiCursor) Count() int {
+	return len(mc.cursors) + 1
+}
+
+// AddCursor: add an extra cursor, nothing is done if there
+// is already one at this position.
+func (mc *MultiCursor) AddCursor(iter *gtk.TextIter) {
+	mc.addSelection(iter, iter)
+	mc.refresh()
+}
+
+// Clear: remove the extra cursors.
+func (mc *MultiCursor) Clear() {
+	for _, c := range mc.cursors {
+		mc.svs.Buffer.DeleteMark(c.insert)
+		mc.svs.Buffer.DeleteMark(c.bound)
+	}
+	mc.cursors = mc.cursors[:0]
+	mc.refresh()
+}
+
+// AddNextOccurrence: select the word at the cursor if there is no
+// selection, otherwise add a cursor selecting the next occurrence of the
+// selected text after the last cursor. Returns false when not found.
+func (mc *MultiCursor) AddNextOccurrence() bool {
+	buff := &mc.svs.Buffer.TextBuffer
+	start, end, ok := buff.GetSelectionBounds()
+	if !ok {
+		start = buff.GetIterAtMark(buff.GetInsert())
+		end = buff.GetIterAtMark(buff.GetInsert())
+		if !start.InsideWord() && !start.EndsWord() {
+			return false
+		}
+		// gotk3 has no BackwardWordStart.
+		for !start.StartsWord() && start.BackwardChar() {
+		}
+		if !end.EndsWord() {
+			end.ForwardWordEnd()
+		}
+		buff.SelectRange(end, start)
+		return true
+	}
+	text, _ := buff.GetText(start, end, false)
+
+	// Search after the last cursor, then from the start.
+	from := end
+	for _, c := range mc.cursors {
+		if _, e := mc.bounds(c); e.Compare(from) > 0 {
+			from = e
+		}
+	}
+	for _, iter := range []*gtk.TextIter{from, buff.GetStartIter()} {
+		for s, e, ok := iter.ForwardSearch(text, gtk.TEXT_SEARCH_TEXT_ONLY, nil); ok; s, e, ok = e.ForwardSearch(text, gtk.TEXT_SEARCH_TEXT_ONLY, nil) {
+			if mc.addSelection(e, s) {
+				mc.svs.View.ScrollToIter(e, 0.1, false, 0, 0)
+				mc.refresh()
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// BlockSelect: rectangular selection between the visual columns on the
+// lines range, one cursor per line, the primary one is on 'endLine'.
+func (mc *MultiCursor) BlockSelect(startLine, startCol, endLine, endCol int) {
+	mc.Clear()
+	lo, hi := startLine, endLine
+	if lo > hi {
+		lo, hi = hi, lo
+	}
+	for line := lo; line <= hi; line++ {
+		anchor := mc.iterAtVisualColumn(line, startCol)
+		cursor := mc.iterAtVisualColumn(line, endCol)
+		if line == endLine {
+			mc.svs.Buffer.SelectRange(cursor, anchor)
+		} else {
+			mc.addSelection(cursor, anchor)
+		}
+	}
+	mc.refresh()
+}
+
+// InsertText: insert at all the cursors, replacing the selections. When
+// the text has as many lines as there are cursors, each cursor gets a line.
+func (mc *MultiCursor) InsertText(text string) {
+	var lines []string
+	cursors := mc.sorted()
+	if parts := strings.Split(strings.TrimSuffix(text, "\n"), "\n"); len(parts) == len(cursors) && len(cursors) > 1 {
+		lines = parts
+	}
+	mc.edit(func(idx int, c *extraCursor) {
+		buff := &mc.svs.Buffer.TextBuffer
+		if start, end := mc.bounds(c); !start.Equal(end) {
+			buff.Delete(start, end)
+		}
+		if lines != nil {
+			buff.Insert(buff.GetIterAtMark(c.insert), lines[idx])
+		} else {
+			buff.Insert(buff.GetIterAtMark(c.insert), text)
+		}
+	})
+}
+
+// Delete: delete the selections, or the previous (backward)
+// or next character at all the cursors.
+func (mc *MultiCursor) Delete(backward bool) {
+	mc.edit(func(idx int, c *extraCursor) {
+		start, end := mc.bounds(c)
+		if start.Equal(end) {
+			if backward {
+				start.BackwardChar()
+			} else {
+				end.ForwardChar()
+			}
+		}
+		mc.svs.Buffer.Delete(start, end)
+	})
+}
+
+// edit: apply the function at each cursor, the primary one included,
+// sorted by position, as a single user action.
+func (mc *MultiCursor) edit(fn func(idx int, c *extraCursor)) {
+	// The cursors are merged once all the edits are done.
+	mc.editing = true
+	mc.svs.Buffer.BeginUserAction()
+	for idx, c := range mc.sorted() {
+		fn(idx, c)
+		// Collapse the selection at the cursor, the view handles the primary one.
+		if !c.primary {
+			mc.setMarks(c, mc.svs.Buffer.GetIterAtMark(c.insert), nil)
+		}
+	}
+	mc.svs.Buffer.EndUserAction()
+	mc.editing = false
+	mc.svs.View.ScrollMarkOnscreen(mc.svs.Buffer.GetInsert())
+	mc.refresh()
+}
+
+// sorted: all the cursors, the primary one included, by position.
+func (mc *MultiCursor) sorted() (cursors []*extraCursor) {
+	cursors = append(cursors, &extraCursor{
+		insert:  mc.svs.Buffer.GetInsert(),
+		bound:   mc.svs.Buffer.GetSelectionBound(),
+		primary: true})
+	cursors = append(cursors, mc.cursors...)
+	sort.SliceStable(cursors, func(i, j int) bool {
+		return mc.svs.Buffer.GetIterAtMark(cursors[i].insert).Compare(
+			mc.svs.Buffer.GetIterAtMark(cursors[j].insert)) < 0
+	})
+	return
+}
+
+// bounds: selection of the cursor, ordered.
+func (mc *MultiCursor) bounds(c *extraCursor) (start, end *gtk.TextIter) {
+	start, end = mc.svs.Buffer.GetIterAtMark(c.insert), mc.svs.Buffer.GetIterAtMark(c.bound)
+	if start.Compare(end) > 0 {
+		start, end = end, start
+	}
+	return
+}
+
+// addSelection: add an extra cursor at 'insert' with a selection up
+// to 'bound', false if there is already a cursor at this position.
+func (mc *MultiCursor) addSelection(insert, bound *gtk.TextIter) bool {
+	for _, c := range mc.sorted() {
+		if mc.svs.Buffer.GetIterAtMark(c.insert).Equal(insert) {
+			return false
+		}
+	}
+	c := new(extraCursor)
+	mc.setMarks(c, insert, bound)
+	mc.cursors = append(mc.cursors, c)
+	return true
+}
+
+// setMarks: (re)create the marks of an extra cursor, gotk3 has no MoveMark.
+// Both have a right gravity, like the marks of the buffer, a nil 'bound'
+// collapses the selection.
+func (mc *MultiCursor) setMarks(c *extraCursor, insert, bound *gtk.TextIter) {
+	if bound == nil {
+		bound = insert
+	}
+	if c.insert != nil {
+		mc.svs.Buffer.DeleteMark(c.insert)
+		mc.svs.Buffer.DeleteMark(c.bound)
+	}
+	mc.seq++
+	c.insert = mc.svs.Buffer.CreateMark(fmt.Sprintf("sourceView:cursor-%d-insert", mc.seq), insert, false)
+	c.bound = mc.svs.Buffer.CreateMark(fmt.Sprintf("sourceView:cursor-%d-bound", mc.seq), bound, false)
+}
+
+// merge: remove the extra cursors that have reached another one.
+func (mc *MultiCursor) merge() {
+	seen := map[int]bool{mc.svs.Buffer.GetIterAtMark(mc.svs.Buffer.GetInsert()).GetOffset(): true}
+	kept := mc.cursors[:0]
+	for _, c := range mc.cursors {
+		if offset := mc.svs.Buffer.GetIterAtMark(c.insert).GetOffset(); seen[offset] {
+			mc.svs.Buffer.DeleteMark(c.insert)
+			mc.svs.Buffer.DeleteMark(c.bound)
+		} else {
+			seen[offset] = true
+			kept = append(kept, c)
+		}
+	}
+	mc.cursors = kept
+}
+
+// refresh: highlight the selections of the extra cursors and redraw.
+func (mc *MultiCursor) refresh() {
+	buff := &mc.svs.Buffer.TextBuffer
+	mc.merge()
+	tag := gitvtt.TagCreateIfNotExists(buff, "sourceView:cursor-selection",
+		map[string]interface{}{"background": mc.SelectionBgCol})
+	buff.RemoveTag(tag, buff.GetStartIter(), buff.GetEndIter())
+	for _, c := range mc.cursors {
+		if start, end := mc.bounds(c); !start.Equal(end) {
+			buff.ApplyTag(tag, start, end)
+		}
+	}
+	mc.svs.View.QueueDraw()
+}
+
+// move: move the extra cursors, the primary one is moved by the view.
+func (mc *MultiCursor) move(key uint) {
+	for _, c := range mc.cursors {
+		iter := mc.svs.Buffer.GetIterAtMark(c.insert)
+		switch key {
+		case gdk.KEY_Left:
+			iter.BackwardChar()
+		case gdk.KEY_Right:
+			iter.ForwardChar()
+		case gdk.KEY_Home:
+			iter.SetLineOffset(0)
+		case gdk.KEY_End:
+			if !iter.EndsLine() {
+				iter.ForwardToLineEnd()
+			}
+		case gdk.KEY_Up, gdk.KEY_Down:
+			line := iter.GetLine() - 1
+			if key == gdk.KEY_Down {
+				line += 2
+			}
+			if line >= 0 && line < mc.svs.Buffer.GetLineCount() {
+				iter = mc.iterAtVisualColumn(line, int(mc.svs.View.GetVisualColumn(iter)))
+			}
+		}
+		mc.setMarks(c, iter, nil)
+	}
+	mc.refresh()
+}
+
+// iterAtVisualColumn: get the iter at the visual column of the line
+// (tabs expanded), or at the end of the line if it's shorter.
+func (mc *MultiCursor) iterAtVisualColumn(line, col int) (iter *gtk.TextIter) {
+	tabWidth := int(mc.svs.View.GetTabWidth())
+	iter = mc.svs.Buffer.GetIterAtLine(line)
+	for v := 0; !iter.EndsLine(); iter.ForwardChar() {
+		next := v + 1
+		if iter.GetChar() == '\t' && tabWidth > 0 {
+			next = v + tabWidth - v%tabWidth
+		}
+		if next > col {
+			break
+		}
+		v = next
+	}
+	return
+}
+
+// iterAtEvent: get the iter under the pointer.
+func (mc *MultiCursor) iterAtEvent(x, y float64) *gtk.TextIter {
+	bx, by := mc.svs.View.WindowToBufferCoords(gtk.TEXT_WINDOW_TEXT, int(x), int(y))
+	iter, trailing := mc.svs.View.GetIterAtPosition(bx, by)
+	if trailing > 0 && !iter.EndsLine() {
+		iter.ForwardChar()
+	}
+	return iter
+}
+
+// keyPressed: apply the edits at all the cursors.
+func (mc *MultiCursor) keyPressed(view *source.SourceView, event *gdk.Event) bool {
+	if !mc.enabled || len(mc.cursors) == 0 {
+		return false
+	}
+	ev := gdk.EventKeyNewFromEvent(event)
+	state := gdk.ModifierType(ev.State()) & (gdk.SHIFT_MASK | gdk.CONTROL_MASK | gdk.MOD1_MASK)
+	key := ev.KeyVal()
+	mc.typing = false
+	switch {
+	case key == gdk.KEY_Escape:
+		mc.Clear()
+	case key == gdk.KEY_BackSpace && state == 0:
+		mc.Delete(true)
+	case key == gdk.KEY_Delete && state == 0:
+		mc.Delete(false)
+	case key == gdk.KEY_Return || key == gdk.KEY_KP_Enter:
+		mc.InsertText("\n")
+	case key == gdk.KEY_Tab && state == 0:
+		if view.GetInsertSpacesInsteadOfTabs() {
+			mc.InsertText(strings.Repeat(" ", int(view.GetTabWidth())))
+		} else {
+			mc.InsertText("\t")
+		}
+	case state == 0 && (key == gdk.KEY_Left || key == gdk.KEY_Right || key == gdk.KEY_Up ||
+		key == gdk.KEY_Down || key == gdk.KEY_Home || key == gdk.KEY_End):
+		mc.move(key)
+		return false
+	case state&(gdk.CONTROL_MASK|gdk.MOD1_MASK) == 0 && textKey(key):
+		// Given to the input method, its text is inserted at the extra cursors.
+		mc.typing = true
+		return false
+	case state&gdk.CONTROL_MASK != 0 || gdk.KeyvalToUnicode(key) == 0 && state != 0:
+		return false // Shortcuts: copy, paste, undo ...
+	default:
+		mc.Clear()
+		return false
+	}
+	return true
+}
+
+// textKey: the key types text, or is a part of a sequence composed by the
+// input method (dead keys, compose, modifiers).
+func textKey(key uint) bool {
+	return gdk.KeyvalToUnicode(key) != 0 || key == gdk.KEY_Multi_key ||
+		(key >= gdk.KEY_ISO_Lock && key <= 0xfeff) || // ISO and dead keys
+		(key >= gdk.KEY_Shift_L && key <= gdk.KEY_Hyper_R)
+}
+
+// inserted: text committed by the input method at the primary cursor, it's
+// inserted at the extra cursors, replacing their selections, in the same
+// user action. The buffer is a GtkSourceBuffer.
+func (mc *MultiCursor) inserted(buffer interface{}, iter *gtk.TextIter, text string) {
+	buff := &mc.svs.Buffer.TextBuffer
+	if !mc.typing || mc.editing || len(mc.cursors) == 0 || !iter.Equal(buff.GetIterAtMark(buff.GetInsert())) {
+		return
+	}
+	mc.editing = true
+	for _, c := range mc.cursors {
+		if start, end := mc.bounds(c); !start.Equal(end) {
+			buff.Delete(start, end)
+		}
+		buff.Insert(buff.GetIterAtMark(c.insert), text)
+		mc.setMarks(c, buff.GetIterAtMark(c.insert), nil)
+	}
+	mc.editing = false
+	mc.refresh()
+	// Revalidated for the next handlers, like the default handler does.
+	*iter = *buff.GetIterAtMark(buff.GetInsert())
+}
+
+// buttonPressed: Ctrl+click adds a cursor, Alt+click starts a block selection.
+func (mc *MultiCursor) buttonPressed(view *source.SourceView, event *gdk.Event) bool {
+	ev := gdk.EventButtonNewFromEvent(event)
+	if !mc.enabled || ev.Button() != gdk.BUTTON_PRIMARY || ev.Type() != gdk.EVENT_BUTTON_PRESS {
+		return false
+	}
+	state := gdk.ModifierType(ev.State())
+	iter := mc.iterAtEvent(ev.X(), ev.Y())
+	switch {
+	case state&gdk.CONTROL_MASK != 0:
+		mc.AddCursor(iter)
+	case state&gdk.MOD1_MASK != 0:
+		mc.blockDrag = true
+		mc.blockLine, mc.blockCol = iter.GetLine(), int(view.GetVisualColumn(iter))
+		mc.BlockSelect(mc.blockLine, mc.blockCol, mc.blockLine, mc.blockCol)
+		view.GrabFocus()
+	default:
+		if len(mc.cursors) > 0 {
+			mc.Clear()
+		}
+		return false
+	}
+	return true
+}
+
+// motion: update the block selection.
+func (mc *MultiCursor) motion(view *source.SourceView, event *gdk.Event) bool {
+	if !mc.blockDrag {
+		return false
+	}
+	ev := gdk.EventMotionNewFromEvent(event)
+	x, y := ev.MotionVal()
+	iter := mc.iterAtEvent(x, y)
+	mc.BlockSelect(mc.blockLine, mc.blockCol, iter.GetLine(), int(view.GetVisualColumn(iter)))
+	return true
+}
+
+// paste: insert the clipboard at all the cursors.
+func (mc *MultiCursor) paste(view *source.SourceView) {
+	if !mc.enabled || len(mc.cursors) == 0 {
+		return
+	}
+	if clipboard, err := gtk.ClipboardGet(gdk.SELECTION_CLIPBOARD); err == nil {
+		if text, err := clipboard.WaitForText(); err == nil {
+			view.StopEmission("paste-clipboard")
+			mc.InsertText(text)
+		}
+	}
+}
+
+// draw: draw the extra cursors over the text.
+func (mc *MultiCursor) draw(view *source.SourceView, cr *cairo.Context) {
+	if len(mc.cursors) == 0 {
+		return
+	}
+	rgba := gdk.NewRGBA()
+	if !rgba.Parse(mc.CursorCol) {
+		rgba.Parse("black")
+	}
+	cr.SetSourceRGBA(rgba.GetRed(), rgba.GetGreen(), rgba.GetBlue(), rgba.GetAlpha())
+	for _, c := range mc.cursors {
+		x, y, height := mc.svs.iterLocation(mc.svs.Buffer.GetIterAtMark(c.insert))
+		wx, wy := view.BufferToWindowCoords(gtk.TEXT_WINDOW_WIDGET, x, y)
+		cr.Rectangle(float64(wx), float64(wy), MULTI_CURSOR_WIDTH, float64(height))
+	}
+	cr.Fill()
+}
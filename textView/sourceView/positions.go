@@ -0,0 +1,207 @@
+// positions.go
+
+/*
+	This software use gotk3 that is licensed under the ISC License:
+	https://github.com/gotk3/gotk3/blob/master/LICENSE
+
+	Copyright ©2019 H.F.M - TextView Numbered  library "https//github/hfmrow"
+	This program comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+
+	Bookmarks and per-file cursor memory for SourceViewStruct, the positions are kept
+	in a gitv.PositionStore (see textView/positions.go). GtkSourceView has no folding,
+	only the cursor, the scroll position and the bookmarks are stored.
+
+	The bookmarks are source marks kept in a list, the category arguments of the
+	gotk3_gtksource wrappers (GetSourceMarksAtLine, RemoveSourceMarks ...) are ignored
+	and would mix them with the other marks.
+*/
+
+package sourceView
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+
+	gitv "github.com/hfmrow/gtk3_import/textView"
+
+	"github.com/hfmrow/gotk3_gtksource/source"
+)
+
+// SOURCE_BOOKMARK_CATEGORY: category of the bookmarks source marks.
+const SOURCE_BOOKMARK_CATEGORY = "sourceView:bookmark"
+
+// StorePosition: store the cursor, the scroll position and the bookmarks of
+// the file loaded with LoadSource or LoadFile. Nothing is done if
+// 'Positions' isn't set.
+func (svs *SourceViewStruct) StorePosition() error {
+	if svs.Positions == nil || len(svs.filename) == 0 {
+		return nil
+	}
+	iter := svs.Buffer.GetIterAtMark(svs.Buffer.GetInsert())
+	pos := gitv.FilePosition{
+		Hash:      gitv.ContentHash(svs.GetText()),
+		Line:      iter.GetLine(),
+		Column:    iter.GetLineOffset(),
+		Bookmarks: svs.Bookmarks()}
+	if hAdj, vAdj := svs.adjustments(); vAdj != nil {
+		pos.HScroll, pos.VScroll = hAdj.GetValue(), vAdj.GetValue()
+	}
+	return svs.Positions.Set(svs.filename, pos)
+}
+
+// RestorePosition: restore the bookmarks, the cursor and the scroll
+// position. Return false if there is no stored position matching the
+// content, the bookmarks are kept in this case. LoadSource and LoadFile
+// clear them before, they belong to the previous file.
+func (svs *SourceViewStruct) RestorePosition() bool {
+	if svs.Positions == nil || len(svs.filename) == 0 {
+		return false
+	}
+	pos, ok := svs.Positions.Get(svs.filename, gitv.ContentHash(svs.GetText()))
+	if !ok {
+		return false
+	}
+	count := svs.Buffer.GetLineCount()
+	svs.ClearBookmarks()
+	for _, line := range pos.Bookmarks {
+		if line < count {
+			svs.addBookmark(line)
+		}
+	}
+	if pos.Line < count {
+		iter, end := svs.Buffer.GetIterAtLine(pos.Line), svs.Buffer.GetIterAtLine(pos.Line)
+		if !end.EndsLine() {
+			end.ForwardToLineEnd()
+		}
+		if pos.Column <= end.GetLineOffset() {
+			iter.SetLineOffset(pos.Column)
+		}
+		svs.Buffer.PlaceCursor(iter)
+		// The text must be laid out first, same as TextViewNumbered.ScrollToLine.
+		seq := svs.scrollSeq
+		glib.IdleAdd(func() {
+			var count int
+			glib.TimeoutAdd(uint(64), func() bool {
+				if count++; seq != svs.scrollSeq {
+					return false
+				}
+				if hAdj, vAdj := svs.adjustments(); vAdj != nil {
+					hAdj.SetValue(pos.HScroll)
+					vAdj.SetValue(pos.VScroll)
+				}
+				return count <= 5
+			})
+		})
+	}
+	return true
+}
+
+// adjustments: scroll adjustments of the view, nil if it isn't scrollable.
+func (svs *SourceViewStruct) adjustments() (hAdj, vAdj *gtk.Adjustment) {
+	scrollable := &gtk.Scrollable{Object: svs.View.Object}
+	if h, err := scrollable.GetHAdjustment(); err == nil {
+		if v, err := scrollable.GetVAdjustment(); err == nil {
+			hAdj, vAdj = h, v
+		}
+	}
+	return
+}
+
+// Bookmarks: lines of the bookmarks, sorted.
+func (svs *SourceViewStruct) Bookmarks() (lines []int) {
+	seen := make(map[int]bool)
+	for _, mark := range svs.bookmarks {
+		line := svs.Buffer.GetIterAtMark(&mark.TextMark).GetLine()
+		if !seen[line] {
+			seen[line] = true
+			lines = append(lines, line)
+		}
+	}
+	sort.Ints(lines)
+	return
+}
+
+// ToggleBookmark: add or remove a bookmark at the line, true if added.
+func (svs *SourceViewStruct) ToggleBookmark(line int) bool {
+	removed := false
+	for idx := len(svs.bookmarks) - 1; idx >= 0; idx-- {
+		mark := svs.bookmarks[idx]
+		if svs.Buffer.GetIterAtMark(&mark.TextMark).GetLine() == line {
+			svs.Buffer.DeleteMark(&mark.TextMark)
+			svs.bookmarks = append(svs.bookmarks[:idx], svs.bookmarks[idx+1:]...)
+			removed = true
+		}
+	}
+	if !removed {
+		svs.addBookmark(line)
+	}
+	return !removed
+}
+
+// ClearBookmarks: remove all bookmarks.
+func (svs *SourceViewStruct) ClearBookmarks() {
+	for _, mark := range svs.bookmarks {
+		svs.Buffer.DeleteMark(&mark.TextMark)
+	}
+	svs.bookmarks = nil
+}
+
+// NextBookmark: move the cursor to the next bookmark, the search wraps
+// around the end of the text. Return the line, -1 if there is no bookmark.
+func (svs *SourceViewStruct) NextBookmark() int {
+	return svs.gotoBookmark(false)
+}
+
+// PrevBookmark: same as NextBookmark, backward.
+func (svs *SourceViewStruct) PrevBookmark() int {
+	return svs.gotoBookmark(true)
+}
+
+func (svs *SourceViewStruct) gotoBookmark(backward bool) int {
+	lines := svs.Bookmarks()
+	if len(lines) == 0 {
+		return -1
+	}
+	current := svs.Buffer.GetIterAtMark(svs.Buffer.GetInsert()).GetLine()
+	line := lines[0]
+	if backward {
+		line = lines[len(lines)-1]
+		for idx := len(lines) - 1; idx >= 0; idx-- {
+			if lines[idx] < current {
+				line = lines[idx]
+				break
+			}
+		}
+	} else {
+		for _, l := range lines {
+			if l > current {
+				line = l
+				break
+			}
+		}
+	}
+	svs.ScrollToIter(svs.SetCursorAtLine(line))
+	return line
+}
+
+// addBookmark: create the source mark, the icon is set up on first use.
+func (svs *SourceViewStruct) addBookmark(line int) {
+	if !svs.bookmarkAttrs {
+		if attrs, err := source.SourceMarkAttributesNew(); err == nil {
+			attrs.SetIconName("user-bookmarks-symbolic")
+			svs.View.SetMarkAttributes(SOURCE_BOOKMARK_CATEGORY, attrs, 0)
+		}
+		svs.View.SetShowLineMarks(true)
+		svs.bookmarkAttrs = true
+	}
+	svs.bookmarkSeq++
+	// Unique names, gotk3 gives "" instead of NULL for an anonymous mark.
+	name := fmt.Sprintf("%s-%d", SOURCE_BOOKMARK_CATEGORY, svs.bookmarkSeq)
+	if mark, err := svs.Buffer.CreateSourceMark(name, SOURCE_BOOKMARK_CATEGORY, svs.Buffer.GetIterAtLine(line)); err == nil {
+		svs.bookmarks = append(svs.bookmarks, mark)
+	}
+}
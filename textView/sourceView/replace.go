@@ -0,0 +1,204 @@
+// replace.go
+
+/*
+	This software use gotk3 that is licensed under the ISC License:
+	https://github.com/gotk3/gotk3/blob/master/LICENSE
+
+	Copyright ©2019 H.F.M - TextView Numbered  library "https//github/hfmrow"
+	This program comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+
+	Replace operations using the GtkSource search context, so the matches are the same
+	as the ones found by Search/SearchAsync. With regular expressions, the replacement
+	text may contain references to the captured groups: "\1" or "${1}" by number,
+	"${name}" or "\g<name>" by name, "\0" is the whole match.
+*/
+
+package sourceView
+
+import (
+	"regexp"
+
+	"github.com/gotk3/gotk3/gtk"
+
+	gitv "github.com/hfmrow/gtk3_import/textView"
+
+	"github.com/hfmrow/gotk3_gtksource/source"
+)
+
+// RegexError, ReplaceError: see textView/textSearch.go
+type (
+	RegexError   = gitv.RegexError
+	ReplaceError = gitv.ReplaceError
+)
+
+// SearchMatch: a match and its replacement, 'Line' and
+// 'Column' are 0 based, the column is in characters.
+type SearchMatch struct {
+	Line,
+	Column int
+	Text,
+	Replacement string
+}
+
+// Replace: Replace the current match (the selection) if any, then
+// search and select the next one. 'replaced' is false when the
+// selection is not a match.
+func (svs *SourceViewStruct) Replace() (replaced bool, err error) {
+	if err = svs.initSearch(); err != nil {
+		return
+	}
+	if err = svs.regexError(); err != nil {
+		return
+	}
+
+	iter := svs.Buffer.GetIterAtMark(svs.Buffer.GetInsert())
+	if start, end, ok := svs.Buffer.GetSelectionBounds(); ok {
+		iter = end
+		if replaced, err = svs.SearchCtx.Replace(start, end, svs.replaceText()); err != nil {
+			return false, &ReplaceError{Replace: svs.TextReplace, Err: err}
+		}
+	}
+
+	if err = svs.Search(iter, false); err == nil && svs.HasFound {
+		svs.Buffer.SelectRange(svs.IterStart, svs.IterEnd)
+		svs.ScrollToIter(svs.IterStart)
+	}
+	return
+}
+
+// ReplaceAll: Replace all the matches, or the ones inside the selection
+// when 'ReplaceInSelection' is set, as a single undoable action.
+func (svs *SourceViewStruct) ReplaceAll() (count int, err error) {
+	if err = svs.initSearch(); err != nil {
+		return
+	}
+	if err = svs.regexError(); err != nil {
+		return
+	}
+
+	replace := svs.replaceText()
+	svs.Buffer.BeginUserAction()
+	defer svs.Buffer.EndUserAction()
+
+	if start, end, ok := svs.Buffer.GetSelectionBounds(); ok && svs.ReplaceInSelection {
+		count, err = forEachMatch(svs.Buffer, svs.SearchCtx, start.GetOffset(), end.GetOffset(), &replace, nil)
+	} else {
+		count, err = svs.SearchCtx.ReplaceAll(replace)
+	}
+	if err != nil {
+		err = &ReplaceError{Replace: svs.TextReplace, Err: err}
+	}
+	return
+}
+
+// ReplacePreview: List the matches and their replacement, inside the
+// selection when 'ReplaceInSelection' is set. The buffer is not modified,
+// the replacements are made on a copy.
+func (svs *SourceViewStruct) ReplacePreview() (matches []SearchMatch, err error) {
+	var copyBuff *source.SourceBuffer
+	var copyCtx *source.SourceSearchContext
+
+	if err = svs.initSearch(); err != nil {
+		return
+	}
+	if err = svs.regexError(); err != nil {
+		return
+	}
+
+	start, end := svs.Buffer.GetStartIter().GetOffset(), svs.Buffer.GetEndIter().GetOffset()
+	if s, e, ok := svs.Buffer.GetSelectionBounds(); ok && svs.ReplaceInSelection {
+		start, end = s.GetOffset(), e.GetOffset()
+	}
+
+	if _, err = forEachMatch(svs.Buffer, svs.SearchCtx, start, end, nil,
+		func(ms, me *gtk.TextIter) {
+			text, _ := svs.Buffer.GetText(ms, me, false)
+			matches = append(matches, SearchMatch{
+				Line:   ms.GetLine(),
+				Column: ms.GetLineOffset(),
+				Text:   text})
+		}); err != nil || len(matches) == 0 {
+		return
+	}
+
+	// Replacements are done in the same order on a copy of the text
+	// to get the expanded groups.
+	if copyBuff, err = source.SourceBufferNew(nil); err == nil {
+		copyBuff.SetText(svs.GetText())
+		if copyCtx, err = source.SourceSearchContextNew(copyBuff, svs.SearchSet); err == nil {
+			copyCtx.SetHighLight(false)
+			replace := svs.replaceText()
+			var idx int
+			if _, err = forEachMatch(copyBuff, copyCtx, start, end, &replace,
+				func(ms, me *gtk.TextIter) {
+					if idx < len(matches) {
+						matches[idx].Replacement, _ = copyBuff.GetText(ms, me, false)
+					}
+					idx++
+				}); err != nil {
+				err = &ReplaceError{Replace: svs.TextReplace, Err: err}
+			}
+		}
+	}
+	return
+}
+
+// regexError: get the error of the search pattern as a *RegexError.
+func (svs *SourceViewStruct) regexError() error {
+	if svs.UseRegexp {
+		if err := svs.SearchCtx.GetRegexError(); err != nil {
+			return &RegexError{Pattern: svs.TextSearch, Err: err}
+		}
+	}
+	return nil
+}
+
+var replaceGroupRegexp = regexp.MustCompile(`\\\\|\$\{(\w+)\}`)
+
+// replaceText: convert the "${...}" references of 'TextReplace'
+// to the GRegex syntax "\g<...>".
+func (svs *SourceViewStruct) replaceText() string {
+	if !svs.UseRegexp {
+		return svs.TextReplace
+	}
+	return replaceGroupRegexp.ReplaceAllStringFunc(svs.TextReplace, func(ref string) string {
+		if ref == `\\` {
+			return ref // Escaped backslash
+		}
+		return `\g<` + ref[2:len(ref)-1] + `>`
+	})
+}
+
+// forEachMatch: find the matches between the 'start' and 'end' offsets,
+// replace them if 'replace' is not nil. 'fn' is called with the bounds
+// of each match, or of each replacement.
+func forEachMatch(buff *source.SourceBuffer, ctx *source.SourceSearchContext, start, end int,
+	replace *string, fn func(ms, me *gtk.TextIter)) (count int, err error) {
+
+	// The end of the scope moves with the replacements.
+	endMark := buff.CreateMark("sourceView:replace-end", buff.GetIterAtOffset(end), false)
+	defer buff.DeleteMark(endMark)
+
+	iter := buff.GetIterAtOffset(start)
+	for {
+		ms, me, wrapped, found := ctx.Forward(iter)
+		if !found || wrapped || ms.Compare(iter) < 0 || me.Compare(buff.GetIterAtMark(endMark)) > 0 {
+			return
+		}
+		empty := ms.Equal(me)
+		if replace != nil {
+			if _, err = ctx.Replace(ms, me, *replace); err != nil {
+				return
+			}
+		}
+		count++
+		if fn != nil {
+			fn(ms, me)
+		}
+		// Avoid looping on empty matches ("^", "$" ...).
+		if iter = me; empty && !iter.ForwardChar() {
+			return
+		}
+	}
+}
@@ -23,15 +23,21 @@
 package sourceView
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"sort"
 
 	"github.com/gotk3/gotk3/glib"
 	"github.com/gotk3/gotk3/gtk"
 
 	gimc "github.com/hfmrow/gtk3_import/misc"
+	gitv "github.com/hfmrow/gtk3_import/textView"
+	gitvch "github.com/hfmrow/gtk3_import/textView/chromaHighlight"
+	gitvhs "github.com/hfmrow/gtk3_import/textView/hunspell"
 	gitvtt "github.com/hfmrow/gtk3_import/textView/textTag"
 
 	"github.com/hfmrow/gotk3_gtksource/source"
@@ -72,6 +78,13 @@ type SourceViewStruct struct {
 
 	langAndStyleInitialized bool
 
+	// Extra cursors & block selection, see multiCursor.go
+	MultiCursor *MultiCursor
+	// Completion popup, see completion.go
+	Completion *Completion
+	// Per-file cursor, scroll and bookmarks memory, see positions.go
+	Positions *gitv.PositionStore
+
 	/*
 	 * Search settings
 	 */
@@ -84,7 +97,8 @@ type SourceViewStruct struct {
 	WrapAround,
 	CaseSensitive,
 	WordBoundaries,
-	HighlightFound bool
+	HighlightFound,
+	ReplaceInSelection bool // ReplaceAll & ReplacePreview scope, see replace.go
 
 	// Search results
 	IterStart,
@@ -97,6 +111,15 @@ type SourceViewStruct struct {
 
 	SearchError error
 
+	// Format of the file, see textView/textFile.go
+	Format gitv.TextFormat
+
+	filename      string
+	bookmarks     []*source.SourceMark
+	bookmarkSeq   int
+	bookmarkAttrs bool
+	scrollSeq     int // Changed to cancel the scroll of RestorePosition.
+
 	styleSchemeChooserWidget *source.SourceStyleSchemeChooserWidget
 	dialog                   *gtk.Dialog
 }
@@ -280,6 +303,29 @@ func (svs *SourceViewStruct) initLanguageAndStyleScheme() (err error) {
 	return
 }
 
+// InstallChromaStyle: convert a Chroma style (i.e: "hfmrow") to style-scheme,
+// write it into the 'UserStylePath' directory and make it available to the
+// StyleSchemeManager. Return the scheme id to be used with SetStyleScheme.
+func (svs *SourceViewStruct) InstallChromaStyle(styleName string) (id string, err error) {
+
+	if len(svs.UserStylePath) == 0 {
+		return "", fmt.Errorf("InstallChromaStyle: 'UserStylePath' is not defined")
+	}
+
+	if id, err = gitvch.InstallSourceScheme(styleName, svs.UserStylePath); err == nil {
+		if err = svs.initLanguageAndStyleScheme(); err == nil {
+
+			// The directory may have been created by the previous call.
+			if !isExistSlice(svs.StyleSchemeManager.GetSearchPath(), svs.UserStylePath) {
+				svs.StyleSchemeManager.AppendSearchPath(svs.UserStylePath)
+			}
+			svs.StyleSchemeManager.ForceRescan()
+			svs.StyleShemeIds = svs.StyleSchemeManager.GetShemeIds()
+		}
+	}
+	return
+}
+
 // StyleChooserDialog: I don't know how to get result from a SourceStyleSchemeChooserButton object,
 // so i made my own dialog who can give me a result that permit to set new styleScheme.
 func (svs *SourceViewStruct) StyleChooserDialog() string {
@@ -349,12 +395,25 @@ func (svs *SourceViewStruct) initSearch() (err error) {
 	return
 }
 
+// UpdateSearch: Apply the search options, a *RegexError
+// is returned when the pattern is not valid.
+func (svs *SourceViewStruct) UpdateSearch() (err error) {
+	if err = svs.initSearch(); err == nil {
+		err = svs.regexError()
+	}
+	return
+}
+
 // Search: Simple search method.
 func (svs *SourceViewStruct) Search(iter *gtk.TextIter, backward bool) (err error) {
 
 	// Init search engine
 	if err = svs.initSearch(); err == nil {
 
+		if err = svs.regexError(); err != nil {
+			return
+		}
+
 		switch {
 
 		case !backward:
@@ -395,8 +454,8 @@ func (svs *SourceViewStruct) SearchAsync(callback func(), iter *gtk.TextIter, ba
 						svs.HasFound,
 						svs.SearchError = svs.SearchCtx.ForwardFinish(res); svs.SearchError != nil {
 
-						if errIn := svs.SearchCtx.GetRegexError(); errIn != nil {
-							svs.SearchError = fmt.Errorf("[%v][%v]", svs.SearchError, errIn)
+						if errIn := svs.regexError(); errIn != nil {
+							svs.SearchError = errIn
 						}
 
 					} else {
@@ -423,8 +482,8 @@ func (svs *SourceViewStruct) SearchAsync(callback func(), iter *gtk.TextIter, ba
 						svs.HasFound,
 						svs.SearchError = svs.SearchCtx.BackwardFinish(res); svs.SearchError != nil {
 
-						if errIn := svs.SearchCtx.GetRegexError(); errIn != nil {
-							svs.SearchError = fmt.Errorf("[%v][%v]", svs.SearchError, errIn)
+						if errIn := svs.regexError(); errIn != nil {
+							svs.SearchError = errIn
 						}
 
 					} else {
@@ -444,7 +503,8 @@ func (svs *SourceViewStruct) SearchAsync(callback func(), iter *gtk.TextIter, ba
 	return
 }
 
-// LoadSource: Load file and search if requested.
+// LoadSource: Load file and search if requested. The stored position
+// is restored when 'Positions' is set, see positions.go.
 func (svs *SourceViewStruct) LoadSource(filename string, doSearch ...bool) (err error) {
 	var data []byte
 	var search bool
@@ -455,6 +515,9 @@ func (svs *SourceViewStruct) LoadSource(filename string, doSearch ...bool) (err
 
 	if data, err = ioutil.ReadFile(filename); err == nil {
 		svs.SetText(string(data))
+		svs.filename = filename
+		svs.ClearBookmarks()
+		svs.RestorePosition()
 
 		if search {
 			err = svs.SearchAsync(nil, svs.Buffer.GetStartIter(), false)
@@ -463,6 +526,109 @@ func (svs *SourceViewStruct) LoadSource(filename string, doSearch ...bool) (err
 	return
 }
 
+// LoadFile: Load a file, the encoding is detected unless 'enc' is given.
+// The format of the file is stored in 'Format' to be used by SaveFile. When
+// the file contains invalid byte sequences, the text is loaded and a
+// *gitv.DecodeError is returned. The stored position is restored when
+// 'Positions' is set.
+func (svs *SourceViewStruct) LoadFile(filename string, enc ...gitv.TextEncoding) (err error) {
+	var text string
+	var format gitv.TextFormat
+	var decErr *gitv.DecodeError
+
+	e := gitv.ENC_AUTO
+	if len(enc) > 0 {
+		e = enc[0]
+	}
+	if text, format, err = gitv.ReadTextFile(filename, e); err == nil || errors.As(err, &decErr) {
+		svs.Format = format
+		svs.Buffer.BeginNotUndoableAction()
+		svs.SetText(text)
+		svs.Buffer.EndNotUndoableAction()
+		svs.Buffer.SetModified(false)
+		svs.filename = filename
+		svs.ClearBookmarks()
+		svs.RestorePosition()
+	}
+	return
+}
+
+// SaveFile: Save the text using 'Format'. When some characters can't be
+// represented in the encoding, nothing is written and a *gitv.EncodeError
+// is returned, unless 'lossy' is set.
+func (svs *SourceViewStruct) SaveFile(filename string, lossy ...bool) (err error) {
+	if err = gitv.WriteTextFile(filename, svs.GetText(), svs.Format, len(lossy) > 0 && lossy[0]); err == nil {
+		svs.Buffer.SetModified(false)
+	}
+	return
+}
+
+// SetFormat: Convert the text to another format on the next save. A
+// *gitv.EncodeError is returned with the offsets of the characters that
+// can't be represented in the new encoding, the format is changed anyway.
+func (svs *SourceViewStruct) SetFormat(format gitv.TextFormat) (err error) {
+	svs.Format = format
+	_, err = gitv.EncodeText(svs.GetText(), format)
+	return
+}
+
+// LoadSourceStream: Load a large file in chunks using a StreamLoader, see
+// textView/streamLoader.go. The buffer is detached from the view and the undo
+// manager is disabled while loading. When 'follow' is set, the view becomes
+// read-only and the new lines are appended as the file grows (tail -f).
+// Set the callbacks then call Start.
+func (svs *SourceViewStruct) LoadSourceStream(filename string, follow bool) (sl *gitv.StreamLoader, err error) {
+	var file *os.File
+	var info os.FileInfo
+
+	if file, err = os.Open(filename); err != nil {
+		return
+	}
+	if info, err = file.Stat(); err != nil {
+		file.Close()
+		return
+	}
+
+	svs.UpdateCss()
+	svs.Buffer.SetText("")
+	svs.ClearBookmarks()
+
+	sl = gitv.StreamLoaderNew(&svs.Buffer.TextBuffer, file, info.Size())
+	sl.Follow = follow
+	sl.DetachFunc = func() {
+		svs.Buffer.BeginNotUndoableAction()
+		svs.Buffer.Ref()
+		svs.View.TextView.SetBuffer(nil)
+	}
+	sl.AttachFunc = func() {
+		svs.Format = sl.Format()
+		svs.View.SetBuffer(svs.Buffer)
+		svs.Buffer.Unref()
+		svs.Buffer.EndNotUndoableAction()
+	}
+	// The view is read-only while following, its previous state is restored.
+	var editable bool
+	sl.FollowFunc = func(following bool) {
+		if following {
+			editable = svs.View.GetEditable()
+			svs.View.SetEditable(false)
+		} else {
+			svs.View.SetEditable(editable)
+		}
+		if following && sl.AppendFunc != nil {
+			sl.AppendFunc()
+		}
+	}
+	sl.AppendFunc = func() {
+		mark := svs.Buffer.GetMark("sourceView:stream-end")
+		if mark == nil {
+			mark = svs.Buffer.CreateMark("sourceView:stream-end", svs.Buffer.GetEndIter(), false)
+		}
+		svs.View.ScrollToMark(mark, 0, false, 0, 1)
+	}
+	return
+}
+
 /*
  * These methods below are not really part of GtkSource and don't
  * require special attention unless you want them to.
@@ -498,6 +664,66 @@ func (svs *SourceViewStruct) ScrollToLine(line int) (iter *gtk.TextIter) {
 	return
 }
 
+// GotoFileLine: load the file if it isn't the current one, then place the
+// cursor. 'line' and 'column' are 1 based, 0 to keep the restored position.
+// It's the OpenFileFunc of the Linkifier created by Linkify.
+func (svs *SourceViewStruct) GotoFileLine(filename string, line, column int) bool {
+	var decErr *gitv.DecodeError
+	current, _ := filepath.Abs(svs.filename)
+	if target, _ := filepath.Abs(filename); len(svs.filename) == 0 || target != current {
+		svs.StorePosition()
+		if err := svs.LoadFile(filename); err != nil && !errors.As(err, &decErr) {
+			return false
+		}
+	}
+	if line > 0 && line <= svs.Buffer.GetLineCount() {
+		iter := svs.Buffer.GetIterAtLine(line - 1)
+		if column > 1 && column-1 < iter.GetCharsInLine() {
+			iter.SetLineOffset(column - 1)
+		}
+		svs.Buffer.PlaceCursor(iter)
+		// Replace the scroll of RestorePosition, the view scrolls to the
+		// mark once the text is laid out.
+		svs.scrollSeq++
+		glib.IdleAdd(func() {
+			svs.View.ScrollToMark(svs.Buffer.GetInsert(), 0.0, true, 0.5, 0.5)
+		})
+	}
+	svs.View.GrabFocus()
+	return true
+}
+
+// Linkify: tag the links of the view, the files are opened with GotoFileLine.
+func (svs *SourceViewStruct) Linkify() (lk *gitv.Linkifier, err error) {
+	if lk, err = gitv.LinkifierNew(&svs.View.TextView); err == nil {
+		lk.OpenFileFunc = svs.GotoFileLine
+		lk.Scan()
+	}
+	return
+}
+
+// SpellCheck: underline the misspelled words. When a language is set,
+// only the comments and the strings are checked, they are checked again
+// when the highlighting is updated.
+func (svs *SourceViewStruct) SpellCheck(dict *gitvhs.Dictionary) (sc *gitv.SpellChecker, err error) {
+	if sc, err = gitv.SpellCheckerNew(&svs.View.TextView, dict); err == nil {
+		sc.TextFunc = func(iter *gtk.TextIter) bool {
+			if lang, err := svs.Buffer.GetLanguage(); err != nil || lang == nil || !svs.Buffer.GetHighlightSyntax() {
+				return true
+			}
+			return svs.Buffer.HasContextClass(iter, "comment") || svs.Buffer.HasContextClass(iter, "string")
+		}
+		handle := svs.Buffer.Connect("highlight-updated", func(buff *source.SourceBuffer, start, end *gtk.TextIter) {
+			sc.Invalidate(start.GetLine(), end.GetLine())
+		})
+		sc.DetachFunc = func() {
+			svs.Buffer.HandlerDisconnect(handle)
+		}
+		sc.CheckAll()
+	}
+	return
+}
+
 // ScrollToIter: Scroll to iter and return the corresponding line
 func (svs *SourceViewStruct) ScrollToIter(iter *gtk.TextIter) int {
 
@@ -511,6 +737,30 @@ func (svs *SourceViewStruct) ScrollToIter(iter *gtk.TextIter) int {
 	return iter.GetLine()
 }
 
+// iterLocation: location of the cursor at 'iter' in buffer coordinates, found by
+// bisection using GetIterAtLocation. TextView.GetIterLocation is not
+// used, gotk3 returns a dangling rectangle.
+func (svs *SourceViewStruct) iterLocation(iter *gtk.TextIter) (x, y, height int) {
+	view := &svs.View.TextView
+	offset := iter.GetOffset()
+	top, lineHeight := view.GetLineYrange(iter)
+	rowStart := func(y int) int {
+		return view.GetIterAtLocation(0, y).GetOffset()
+	}
+	// Display row of the iter for wrapped lines.
+	bottom := top + sort.Search(lineHeight, func(i int) bool { return rowStart(top+i) > offset }) - 1
+	if bottom < top {
+		bottom = top
+	}
+	start := rowStart(bottom)
+	y = top + sort.Search(lineHeight, func(i int) bool { return rowStart(top+i) >= start })
+	height = bottom - y + 1
+	x = sort.Search(1<<15, func(x int) bool {
+		return view.GetIterAtLocation(x, y).GetOffset() >= offset
+	})
+	return
+}
+
 // GetLineNumber: Get current line number at the cursor position
 func (svs *SourceViewStruct) GetCurrentLineNb() int {
 
@@ -0,0 +1,312 @@
+// spellChecker.go
+
+/*
+	This software use gotk3 that is licensed under the ISC License:
+	https://github.com/gotk3/gotk3/blob/master/LICENSE
+
+	Copyright ©2019 H.F.M - TextView Numbered  library "https//github/hfmrow"
+	This program comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+
+	Spell checking of a TextView using the Hunspell dictionaries (see hunspell/hunspell.go).
+	The misspelled words are underlined with SPELL_TAG, the modified lines are checked
+	again after 'Delay'. The context menu offers the suggestions for the word under the
+	pointer, "Add to dictionary" (stored in the personal dictionary) and "Ignore all"
+	(for the session). TextFunc restricts the checking, i.e: to the comments and the
+	strings of the source code, see TextViewNumbered.SpellCheck and
+	SourceViewStruct.SpellCheck in sourceView/sourceView.go.
+
+Usage:
+	aff, dic, err := hunspell.FindDictionary("en_US")
+	dict, err := hunspell.DictionaryNew(aff, dic)
+	err = dict.LoadPersonal(filepath.Join(configDir, "personal.dic"))
+	sc, err := tvn.SpellCheck(dict)
+*/
+
+package textView
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+	"github.com/gotk3/gotk3/pango"
+
+	gimc "github.com/hfmrow/gtk3_import/misc"
+	gitvhs "github.com/hfmrow/gtk3_import/textView/hunspell"
+	gitvtt "github.com/hfmrow/gtk3_import/textView/textTag"
+)
+
+const (
+	// SPELL_TAG: name of the tag of the misspelled words.
+	SPELL_TAG = "spell:error"
+	// SPELL_DELAY: delay between a modification and the check of the lines.
+	SPELL_DELAY = 500 * time.Millisecond
+	// SPELL_CHUNK_LINES: lines checked per idle call by CheckAll.
+	SPELL_CHUNK_LINES = 200
+)
+
+// SpellChecker: spell checking of a TextView.
+type SpellChecker struct {
+	View *gtk.TextView
+	Buff *gtk.TextBuffer
+	Tag  *gtk.TextTag
+	Dict *gitvhs.Dictionary
+
+	// Delay: between a modification and the check of the modified lines.
+	Delay time.Duration
+	// MaxSuggestions: in the context menu.
+	MaxSuggestions int
+	// TextFunc: the word starting at 'iter' must be checked, nil to check
+	// all the words.
+	TextFunc func(iter *gtk.TextIter) bool
+	// ErrorFunc: errors of the personal dictionary.
+	ErrorFunc func(err error)
+	// DetachFunc: called by Detach, i.e to disconnect the handlers
+	// that call Invalidate.
+	DetachFunc func()
+
+	// Context menu labels
+	AddLabel, // "%s" is replaced with the word
+	IgnoreLabel,
+	NoSuggestionsLabel string
+
+	ignored  map[string]bool
+	lines    lineUpdater
+	viewHdls []glib.SignalHandle // View: button-press-event, populate-popup
+	idle     glib.SourceHandle
+
+	// Position of the last right click, used by the context menu.
+	clickLine,
+	clickOffset int
+	clicked bool
+}
+
+// SpellCheckerNew: the misspelled words are tagged with SPELL_TAG, use
+// CheckAll to check the current text.
+func SpellCheckerNew(view *gtk.TextView, dict *gitvhs.Dictionary) (sc *SpellChecker, err error) {
+	sc = &SpellChecker{
+		View:               view,
+		Dict:               dict,
+		Delay:              SPELL_DELAY,
+		MaxSuggestions:     8,
+		AddLabel:           `Add "%s" to dictionary`,
+		IgnoreLabel:        "Ignore all",
+		NoSuggestionsLabel: "(no suggestions)",
+		ignored:            make(map[string]bool)}
+	if sc.Buff, err = view.GetBuffer(); err != nil {
+		return nil, err
+	}
+	sc.Tag = gitvtt.TagCreateIfNotExists(sc.Buff, SPELL_TAG, map[string]interface{}{
+		"underline": int(pango.UNDERLINE_ERROR)})
+
+	sc.lines.connect(sc.Buff, func() time.Duration { return sc.Delay }, sc.CheckLines)
+	sc.viewHdls = []glib.SignalHandle{
+		view.Connect("button-press-event", sc.buttonPressed),
+		view.Connect("populate-popup", sc.populatePopup)}
+	return
+}
+
+// Detach: stop the checking and remove the underlines.
+func (sc *SpellChecker) Detach() {
+	sc.lines.disconnect()
+	if sc.idle != 0 {
+		glib.SourceRemove(sc.idle)
+		sc.idle = 0
+	}
+	for _, handle := range sc.viewHdls {
+		sc.View.HandlerDisconnect(handle)
+	}
+	sc.viewHdls = nil
+	if sc.DetachFunc != nil {
+		sc.DetachFunc()
+		sc.DetachFunc = nil
+	}
+	sc.Buff.RemoveTag(sc.Tag, sc.Buff.GetStartIter(), sc.Buff.GetEndIter())
+}
+
+// CheckAll: check the whole buffer, SPELL_CHUNK_LINES at a time when the
+// application is idle.
+func (sc *SpellChecker) CheckAll() {
+	if sc.idle != 0 {
+		glib.SourceRemove(sc.idle)
+	}
+	var line int
+	sc.idle = glib.IdleAdd(func() bool {
+		sc.CheckLines(line, line+SPELL_CHUNK_LINES-1)
+		if line += SPELL_CHUNK_LINES; line < sc.Buff.GetLineCount() {
+			return true
+		}
+		sc.idle = 0
+		return false
+	})
+}
+
+// CheckLines: check the lines, 0 based.
+func (sc *SpellChecker) CheckLines(first, last int) {
+	if count := sc.Buff.GetLineCount(); last >= count {
+		last = count - 1
+	}
+	if first < 0 {
+		first = 0
+	}
+	if first > last {
+		return
+	}
+	start, end := sc.Buff.GetIterAtLine(first), sc.Buff.GetIterAtLine(last)
+	if !end.EndsLine() {
+		end.ForwardToLineEnd()
+	}
+	sc.Buff.RemoveTag(sc.Tag, start, end)
+	text := start.GetSlice(end)
+	for idx, line := range strings.Split(text, "\n") {
+		offset := -1
+		for _, word := range sc.misspelled(line) {
+			if offset < 0 {
+				offset = sc.Buff.GetIterAtLine(first + idx).GetOffset()
+			}
+			wStart := sc.Buff.GetIterAtOffset(offset + word.Start)
+			if sc.TextFunc == nil || sc.TextFunc(wStart) {
+				sc.Buff.ApplyTag(sc.Tag, wStart, sc.Buff.GetIterAtOffset(offset+word.End))
+			}
+		}
+	}
+}
+
+// Invalidate: check the lines again after 'Delay', i.e: when the
+// highlighting of the source code has changed.
+func (sc *SpellChecker) Invalidate(first, last int) {
+	sc.lines.setDirty(first, last)
+}
+
+// Ignore: the word is no more checked during the session.
+func (sc *SpellChecker) Ignore(word string) {
+	sc.ignored[word] = true
+	sc.CheckAll()
+}
+
+// AddWord: add the word to the personal dictionary.
+func (sc *SpellChecker) AddWord(word string) {
+	if err := sc.Dict.AddWord(word); err != nil && sc.ErrorFunc != nil {
+		sc.ErrorFunc(err)
+	}
+	sc.CheckAll()
+}
+
+// misspelled: misspelled words of a line of text.
+func (sc *SpellChecker) misspelled(line string) (words []gitvhs.Word) {
+	for _, word := range sc.Dict.Words(line) {
+		if !sc.ignored[word.Text] && !sc.Dict.Check(word.Text) {
+			words = append(words, word)
+		}
+	}
+	return
+}
+
+// WordAt: misspelled word at 'iter', the offsets are the ones of the line.
+func (sc *SpellChecker) WordAt(iter *gtk.TextIter) (word gitvhs.Word, ok bool) {
+	start := sc.Buff.GetIterAtLine(iter.GetLine())
+	end := sc.Buff.GetIterAtLine(iter.GetLine())
+	if !end.EndsLine() {
+		end.ForwardToLineEnd()
+	}
+	text := start.GetSlice(end)
+	column := iter.GetLineOffset()
+	for _, word = range sc.misspelled(text) {
+		if column >= word.Start && column <= word.End {
+			wStart := sc.Buff.GetIterAtLineOffset(iter.GetLine(), word.Start)
+			return word, wStart.HasTag(sc.Tag)
+		}
+	}
+	return gitvhs.Word{}, false
+}
+
+/*
+ * Context menu
+ */
+
+// buttonPressed: store the position of the right click, the cursor
+// isn't moved by the context menu. The view is a GtkTextView or a GtkSourceView.
+func (sc *SpellChecker) buttonPressed(view interface{}, event *gdk.Event) bool {
+	ev := gdk.EventButtonNewFromEvent(event)
+	sc.clicked = false
+	if ev.Button() == gdk.BUTTON_SECONDARY {
+		bx, by := sc.View.WindowToBufferCoords(gtk.TEXT_WINDOW_WIDGET, int(ev.X()), int(ev.Y()))
+		iter, _ := sc.View.GetIterAtPosition(bx, by)
+		sc.clickLine, sc.clickOffset, sc.clicked = iter.GetLine(), iter.GetLineOffset(), true
+	}
+	return false
+}
+
+// populatePopup: the suggestions for the word under the pointer, or
+// under the cursor when the menu is opened with the keyboard.
+func (sc *SpellChecker) populatePopup(view interface{}, w *gtk.Widget) {
+	if !w.IsA(glib.TypeFromName("GtkMenu")) {
+		return
+	}
+	iter := sc.Buff.GetIterAtMark(sc.Buff.GetInsert())
+	if sc.clicked {
+		iter = sc.Buff.GetIterAtLineOffset(sc.clickLine, sc.clickOffset)
+		sc.clicked = false
+	}
+	word, ok := sc.WordAt(iter)
+	if !ok {
+		return
+	}
+	line := iter.GetLine()
+
+	pop := gimc.PopupMenuStructNew()
+	pop.AddItem("", nil, pop.OPT_SEPARATOR)
+	suggestions := sc.Dict.Suggest(word.Text, sc.MaxSuggestions)
+	for _, suggestion := range suggestions {
+		suggestion := suggestion
+		pop.AddItem(suggestion, func() {
+			sc.replace(line, word, suggestion)
+		}, pop.OPT_NO_MNEMONIC)
+	}
+	if len(suggestions) == 0 {
+		pop.AddItem(sc.NoSuggestionsLabel, nil, pop.OPT_NO_MNEMONIC)
+		pop.GetMenuItemCurrent().SetSensitive(false)
+	}
+	pop.AddItem("", nil, pop.OPT_SEPARATOR)
+	pop.AddItem(strings.Replace(sc.AddLabel, "%s", word.Text, 1), func() {
+		sc.AddWord(word.Text)
+	}, pop.OPT_NO_MNEMONIC)
+	pop.AddItem(sc.IgnoreLabel, func() {
+		sc.Ignore(word.Text)
+	})
+
+	menu := &gtk.Menu{gtk.MenuShell{gtk.Container{*w}}}
+	pop.AppendToExistingMenu(menu)
+}
+
+// replace: replace the word of the line with the suggestion, the text must
+// not have changed since the word has been found.
+func (sc *SpellChecker) replace(line int, word gitvhs.Word, suggestion string) {
+	if line >= sc.Buff.GetLineCount() {
+		return
+	}
+	start := sc.Buff.GetIterAtLineOffset(line, word.Start)
+	end := sc.Buff.GetIterAtLineOffset(line, word.End)
+	if start.GetSlice(end) != word.Text {
+		return
+	}
+	sc.Buff.BeginUserAction()
+	sc.Buff.Delete(start, end)
+	sc.Buff.Insert(start, suggestion)
+	sc.Buff.EndUserAction()
+}
+
+// SpellCheck: underline the misspelled words. When a Highlighter is set,
+// only its comments and strings are checked.
+func (tvn *TextViewNumbered) SpellCheck(dict *gitvhs.Dictionary) (sc *SpellChecker, err error) {
+	if sc, err = SpellCheckerNew(tvn.TextView, dict); err == nil {
+		sc.TextFunc = func(iter *gtk.TextIter) bool {
+			return tvn.Highlighter == nil || tvn.Highlighter.IsCommentOrString(iter)
+		}
+		sc.CheckAll()
+	}
+	return
+}
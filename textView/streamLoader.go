@@ -0,0 +1,351 @@
+// streamLoader.go
+
+/*
+	This software use gotk3 that is licensed under the ISC License:
+	https://github.com/gotk3/gotk3/blob/master/LICENSE
+
+	Copyright ©2019 H.F.M - TextView Numbered  library "https//github/hfmrow"
+	This program comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+
+	Chunked loading of large texts. The data is read by a goroutine, each chunk
+	is decoded and inserted at the end of the buffer by an idle callback in the
+	main loop, while the buffer is detached from its view, so the UI stays
+	responsive. In "follow" mode (tail -f), the buffer is attached back once the
+	end of the data is reached and the new data is appended as it comes.
+*/
+
+package textView
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+const (
+	STREAM_CHUNK_SIZE      = 256 << 10
+	STREAM_FOLLOW_INTERVAL = 500 * time.Millisecond
+)
+
+// ErrLoadCanceled: given to the DoneCallback when Cancel has been called.
+var ErrLoadCanceled = errors.New("StreamLoader: canceled")
+
+// streamChunk: data sent by the reading goroutine, 'eof' is set
+// when the end of the data is reached.
+type streamChunk struct {
+	data []byte
+	eof  bool
+	err  error
+}
+
+// StreamLoader: fill a TextBuffer from an io.Reader. Callbacks are
+// always called in the main loop. The encoding and the line-ending
+// style are detected using the first chunk. The reader is closed at
+// the end if it's an io.Closer.
+type StreamLoader struct {
+	ChunkSize      int
+	Follow         bool
+	FollowInterval time.Duration
+
+	// ProgressCallback: called after each chunk, 'total' is
+	// the size given at creation, -1 if unknown.
+	ProgressCallback func(read, total int64)
+	// DoneCallback: called once, at the end of the data (or at the end of
+	// the initial load in follow mode), on error or on cancellation.
+	DoneCallback func(err error)
+	// DetachFunc, AttachFunc: detach the buffer from its view while loading.
+	DetachFunc,
+	AttachFunc func()
+	// FollowFunc: called when the follow mode starts and stops.
+	FollowFunc func(following bool)
+	// AppendFunc: called after new data is appended in follow mode.
+	AppendFunc func()
+
+	Encoding TextEncoding
+	EOL      EOLStyle
+
+	buff    *gtk.TextBuffer
+	reader  io.Reader
+	total   int64
+	read    int64
+	decoder *textDecoder
+	chunks  chan streamChunk
+	stop    chan struct{}
+
+	detected,
+	eolDetected,
+	finalNewline,
+	running,
+	detached,
+	following,
+	done bool
+}
+
+// StreamLoaderNew: create a loader that fills 'buff' with the content of
+// 'reader', 'total' is the size of the data if known, or -1. Set the options
+// and the callbacks then call Start.
+func StreamLoaderNew(buff *gtk.TextBuffer, reader io.Reader, total int64) *StreamLoader {
+	return &StreamLoader{
+		ChunkSize:      STREAM_CHUNK_SIZE,
+		FollowInterval: STREAM_FOLLOW_INTERVAL,
+		buff:           buff,
+		reader:         reader,
+		total:          total,
+	}
+}
+
+// Start: begin loading, the content is appended to the buffer.
+func (sl *StreamLoader) Start() {
+	if sl.running {
+		return
+	}
+	sl.running = true
+	sl.chunks = make(chan streamChunk, 2)
+	sl.stop = make(chan struct{})
+	sl.decoder = new(textDecoder)
+	if sl.ChunkSize <= 0 {
+		sl.ChunkSize = STREAM_CHUNK_SIZE
+	}
+	if sl.DetachFunc != nil {
+		sl.DetachFunc()
+		sl.detached = true
+	}
+	go sl.readLoop(sl.chunks, sl.stop)
+}
+
+// Cancel: stop loading or following, the data already read stays in
+// the buffer.
+func (sl *StreamLoader) Cancel() {
+	if !sl.running {
+		return
+	}
+	sl.finish(ErrLoadCanceled)
+}
+
+// Running: loading or following.
+func (sl *StreamLoader) Running() bool {
+	return sl.running
+}
+
+// Following: the initial load is done and new data is being appended.
+func (sl *StreamLoader) Following() bool {
+	return sl.following
+}
+
+// Format: detected format of the data, used to save it, see textFile.go.
+func (sl *StreamLoader) Format() TextFormat {
+	format := TextFormat{Encoding: sl.Encoding, EOL: sl.EOL, FinalNewline: sl.finalNewline}
+	if sl.decoder != nil && sl.decoder.started {
+		format.setBOM(sl.decoder.bom)
+	}
+	return format
+}
+
+// Invalid: the invalid byte sequences found so far, they have been
+// replaced by U+FFFD.
+func (sl *StreamLoader) Invalid() []InvalidSequence {
+	if sl.decoder == nil {
+		return nil
+	}
+	return sl.decoder.invalid
+}
+
+// readLoop: goroutine, read the chunks and post them to the main loop.
+func (sl *StreamLoader) readLoop(chunks chan streamChunk, stop chan struct{}) {
+	var eofSent bool
+	var send = func(chunk streamChunk) bool {
+		select {
+		case chunks <- chunk:
+			glib.IdleAdd(sl.pump)
+			return true
+		case <-stop:
+			return false
+		}
+	}
+	for {
+		buf := make([]byte, sl.ChunkSize)
+		n, err := io.ReadFull(sl.reader, buf)
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		if n > 0 && !send(streamChunk{data: buf[:n]}) {
+			return
+		}
+		switch {
+		case err == io.EOF:
+			if !sl.Follow {
+				send(streamChunk{eof: true})
+				return
+			}
+			if !eofSent {
+				if eofSent = send(streamChunk{eof: true}); !eofSent {
+					return
+				}
+			}
+			// Wait for the data to grow.
+			select {
+			case <-time.After(sl.FollowInterval):
+			case <-stop:
+				return
+			}
+		case err != nil:
+			send(streamChunk{err: err})
+			return
+		}
+	}
+}
+
+// pump: idle callback, one call for each chunk sent.
+func (sl *StreamLoader) pump() {
+	var chunk streamChunk
+	select {
+	case chunk = <-sl.chunks:
+	default:
+		return
+	}
+	if !sl.running {
+		return // Canceled, remaining chunks are dropped.
+	}
+	switch {
+	case chunk.err != nil:
+		sl.finish(chunk.err)
+	case chunk.eof:
+		if sl.Follow {
+			sl.startFollowing()
+		} else {
+			sl.finish(nil)
+		}
+	default:
+		sl.insert(chunk.data, false)
+		sl.read += int64(len(chunk.data))
+		if sl.ProgressCallback != nil {
+			sl.ProgressCallback(sl.read, sl.total)
+		}
+		if sl.following && sl.AppendFunc != nil {
+			sl.AppendFunc()
+		}
+	}
+}
+
+// insert: decode and append data at the end of the buffer.
+func (sl *StreamLoader) insert(data []byte, final bool) {
+	if !sl.detected && len(data) > 0 {
+		sl.Encoding = DetectEncoding(data, !final)
+		sl.decoder.encoding = sl.Encoding
+		sl.detected = true
+	}
+	text := sl.decoder.decodeRaw(data, final)
+	if !sl.eolDetected && strings.ContainsAny(text, "\r\n") {
+		sl.EOL = DetectEOL(text)
+		sl.eolDetected = true
+	}
+	if len(text) > 0 {
+		sl.finalNewline = strings.ContainsAny(text[len(text)-1:], "\r\n")
+	}
+	if text = sl.decoder.normalizeEOL(text, final); len(text) > 0 {
+		sl.buff.Insert(sl.buff.GetEndIter(), text)
+	}
+}
+
+// startFollowing: the initial load is done, the buffer is attached back.
+func (sl *StreamLoader) startFollowing() {
+	sl.attach()
+	sl.following = true
+	if sl.FollowFunc != nil {
+		sl.FollowFunc(true)
+	}
+	sl.callDone(nil)
+}
+
+// finish: flush the decoder, attach the buffer and stop the goroutine,
+// the reader is closed if it's an io.Closer.
+func (sl *StreamLoader) finish(err error) {
+	sl.insert(nil, true)
+	sl.attach()
+	sl.running = false
+	close(sl.stop)
+	if c, ok := sl.reader.(io.Closer); ok {
+		c.Close()
+	}
+	if sl.following {
+		sl.following = false
+		if sl.FollowFunc != nil {
+			sl.FollowFunc(false)
+		}
+	}
+	sl.callDone(err)
+}
+
+// attach: give the buffer back to its view.
+func (sl *StreamLoader) attach() {
+	if sl.detached {
+		sl.detached = false
+		if sl.AttachFunc != nil {
+			sl.AttachFunc()
+		}
+	}
+}
+
+// callDone: DoneCallback is called only once.
+func (sl *StreamLoader) callDone(err error) {
+	if !sl.done {
+		sl.done = true
+		if sl.DoneCallback != nil {
+			sl.DoneCallback(err)
+		}
+	}
+}
+
+// FromFileStream: load a file using a StreamLoader, useful for large files.
+// When 'follow' is set, the TextView becomes read-only and the new lines are
+// appended as the file grows (tail -f). Set the callbacks then call Start.
+func (tvn *TextViewNumbered) FromFileStream(filename string, follow bool) (sl *StreamLoader, err error) {
+	var file *os.File
+	var info os.FileInfo
+
+	if file, err = os.Open(filename); err == nil {
+		if info, err = file.Stat(); err == nil {
+			sl = tvn.LoadStream(file, info.Size(), follow)
+		} else {
+			file.Close()
+		}
+	}
+	return
+}
+
+// LoadStream: replace the content of the buffer with the data of 'reader'
+// using a StreamLoader, 'size' is the size of the data, -1 if unknown.
+func (tvn *TextViewNumbered) LoadStream(reader io.Reader, size int64, follow bool) (sl *StreamLoader) {
+	tvn.Clear()
+	tvn.lastMd5 = ""
+
+	sl = StreamLoaderNew(tvn.BuffTxt, reader, size)
+	sl.Follow = follow
+	sl.DetachFunc = func() { tvn.detachBuffers() }
+	sl.AttachFunc = func() {
+		tvn.Format = sl.Format()
+		tvn.attachBuffers()
+	}
+	sl.FollowFunc = func(following bool) {
+		tvn.TextView.SetEditable(tvn.Editable && !following)
+		if following && sl.AppendFunc != nil {
+			sl.AppendFunc()
+		}
+	}
+	// Keep the end of the text visible, the mark has a right
+	// gravity, it stays at the end when text is appended.
+	sl.AppendFunc = func() {
+		mark := tvn.BuffTxt.GetMark("textViewNumbered:stream-end")
+		if mark == nil {
+			mark = tvn.BuffTxt.CreateMark("textViewNumbered:stream-end", tvn.BuffTxt.GetEndIter(), false)
+		}
+		tvn.TextView.ScrollToMark(mark, 0, false, 0, 1)
+	}
+	return
+}
@@ -0,0 +1,225 @@
+// textFile.go
+
+/*
+	Copyright ©2019 H.F.M - TextView Numbered  library "https//github/hfmrow"
+	This program comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+
+	Encoding & line-ending aware conversion between files and buffers. The format
+	of the file (encoding, line-ending, trailing newline) is kept when it's loaded,
+	so the file is saved the same way unless an explicit conversion is requested.
+*/
+
+package textView
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"unicode/utf16"
+)
+
+// ENC_AUTO: detect the encoding when decoding.
+const ENC_AUTO TextEncoding = -1
+
+// TextFormat: how a text is stored in a file.
+type TextFormat struct {
+	Encoding     TextEncoding
+	EOL          EOLStyle
+	FinalNewline bool // Add a line-ending at the end of the text if missing.
+	NoBOM        bool // UTF-16 without byte order mark.
+}
+
+// String: i.e "UTF-8, CRLF".
+func (f TextFormat) String() string {
+	return f.Encoding.String() + ", " + f.EOL.String()
+}
+
+// DecodeError: the text contains invalid byte sequences,
+// they have been replaced by U+FFFD.
+type DecodeError struct {
+	Encoding TextEncoding
+	Invalid  []InvalidSequence
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("%s: %d invalid byte sequence(s), first at offset %d",
+		e.Encoding, len(e.Invalid), e.Invalid[0].Offset)
+}
+
+// EncodeError: some characters can't be represented in the target
+// encoding, 'Offsets' are their character offsets in the text.
+// They are replaced by '?'.
+type EncodeError struct {
+	Encoding TextEncoding
+	Offsets  []int
+}
+
+func (e *EncodeError) Error() string {
+	return fmt.Sprintf("%s: %d character(s) can't be encoded, first at offset %d",
+		e.Encoding, len(e.Offsets), e.Offsets[0])
+}
+
+// DecodeText: convert data to UTF-8 text with "\n" line-endings, the
+// encoding is detected when 'enc' is ENC_AUTO. The returned text is
+// always usable, 'err' is a *DecodeError when invalid sequences were
+// found.
+func DecodeText(data []byte, enc TextEncoding) (text string, format TextFormat, err error) {
+	if enc == ENC_AUTO {
+		enc = DetectEncoding(data)
+	}
+	d := &textDecoder{encoding: enc}
+	raw := d.decodeRaw(data, true)
+	format = TextFormat{
+		Encoding:     enc,
+		EOL:          DetectEOL(raw),
+		FinalNewline: strings.HasSuffix(raw, "\n") || strings.HasSuffix(raw, "\r")}
+	// A BOM, or its absence, is kept when the text is saved.
+	format.setBOM(d.bom)
+	text = d.normalizeEOL(raw, true)
+	if len(d.invalid) > 0 {
+		err = &DecodeError{Encoding: enc, Invalid: d.invalid}
+	}
+	return
+}
+
+// setBOM: record whether the data started with a BOM.
+func (f *TextFormat) setBOM(bom bool) {
+	switch f.Encoding {
+	case ENC_UTF8:
+		if bom {
+			f.Encoding = ENC_UTF8_BOM
+		}
+	case ENC_UTF16LE, ENC_UTF16BE:
+		f.NoBOM = !bom
+	}
+}
+
+// EncodeText: convert the text to the format, 'err' is an *EncodeError
+// when some characters can't be represented, the data is still returned.
+func EncodeText(text string, format TextFormat) (data []byte, err error) {
+	text = strings.ReplaceAll(strings.ReplaceAll(text, "\r\n", "\n"), "\r", "\n")
+	if format.FinalNewline && len(text) > 0 && !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	// Offsets are computed before changing the line-endings.
+	var offsets []int
+	if format.Encoding == ENC_LATIN1 {
+		var idx int
+		for _, r := range text {
+			if r > 0xFF {
+				offsets = append(offsets, idx)
+			}
+			idx++
+		}
+	}
+	if format.EOL != EOL_LF {
+		text = strings.ReplaceAll(text, "\n", format.EOL.Chars())
+	}
+
+	switch format.Encoding {
+	case ENC_UTF8_BOM:
+		data = append(append([]byte{}, bomUTF8...), text...)
+
+	case ENC_UTF16LE, ENC_UTF16BE:
+		units := utf16.Encode([]rune(text))
+		data = make([]byte, 0, 2+len(units)*2)
+		if !format.NoBOM {
+			data = append(data, encodingBOM(format.Encoding)...)
+		}
+		for _, u := range units {
+			if format.Encoding == ENC_UTF16LE {
+				data = append(data, byte(u), byte(u>>8))
+			} else {
+				data = append(data, byte(u>>8), byte(u))
+			}
+		}
+
+	case ENC_LATIN1:
+		data = make([]byte, 0, len(text))
+		for _, r := range text {
+			if r > 0xFF {
+				r = '?'
+			}
+			data = append(data, byte(r))
+		}
+
+	default:
+		data = []byte(text)
+	}
+	if len(offsets) > 0 {
+		err = &EncodeError{Encoding: format.Encoding, Offsets: offsets}
+	}
+	return
+}
+
+// ReadTextFile: read and decode a file, see DecodeText.
+func ReadTextFile(filename string, enc TextEncoding) (text string, format TextFormat, err error) {
+	var data []byte
+	if data, err = ioutil.ReadFile(filename); err == nil {
+		text, format, err = DecodeText(data, enc)
+	}
+	return
+}
+
+// WriteTextFile: encode and write a file, nothing is written when some
+// characters can't be represented unless 'lossy' is set. The permissions
+// of an existing file are kept.
+func WriteTextFile(filename, text string, format TextFormat, lossy bool) (err error) {
+	var data []byte
+	perm := os.FileMode(0644)
+	if info, err := os.Stat(filename); err == nil {
+		perm = info.Mode().Perm()
+	}
+	if data, err = EncodeText(text, format); err == nil || lossy {
+		err = ioutil.WriteFile(filename, data, perm)
+	}
+	return
+}
+
+// LoadFile: load a file, the encoding is detected unless 'enc' is given.
+// The format of the file is stored in 'Format' to be used by SaveFile. When
+// the file contains invalid byte sequences, the text is loaded and a
+// *DecodeError is returned. The stored position is restored when
+// 'Positions' is set, see positions.go.
+func (tvn *TextViewNumbered) LoadFile(filename string, enc ...TextEncoding) (err error) {
+	var text string
+	var format TextFormat
+	var decErr *DecodeError
+
+	e := ENC_AUTO
+	if len(enc) > 0 {
+		e = enc[0]
+	}
+	if text, format, err = ReadTextFile(filename, e); err == nil || errors.As(err, &decErr) {
+		tvn.Format = format
+		tvn.lastMd5 = ""
+		tvn.SetText(text)
+		tvn.BuffTxt.SetModified(false)
+		tvn.filename = filename
+		tvn.clearBookmarks()
+		tvn.RestorePosition(true)
+	}
+	return
+}
+
+// SaveFile: save the text using 'Format'. When some characters can't be
+// represented in the encoding, nothing is written and an *EncodeError is
+// returned, unless 'lossy' is set.
+func (tvn *TextViewNumbered) SaveFile(filename string, lossy ...bool) (err error) {
+	if err = WriteTextFile(filename, tvn.GetText(), tvn.Format, len(lossy) > 0 && lossy[0]); err == nil {
+		tvn.BuffTxt.SetModified(false)
+	}
+	return
+}
+
+// SetFormat: convert the text to another format on the next save. An
+// *EncodeError is returned with the offsets of the characters that can't
+// be represented in the new encoding, the format is changed anyway.
+func (tvn *TextViewNumbered) SetFormat(format TextFormat) (err error) {
+	tvn.Format = format
+	_, err = EncodeText(tvn.GetText(), format)
+	return
+}
@@ -0,0 +1,410 @@
+// textSearch.go
+
+/*
+	This software use gotk3 that is licensed under the ISC License:
+	https://github.com/gotk3/gotk3/blob/master/LICENSE
+
+	Copyright ©2019 H.F.M - TextView Numbered  library "https//github/hfmrow"
+	This program comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+
+	Search & replace for a plain gtk.TextView using the Go regexp package, the methods
+	follow the GtkSource search context ones. Matches are computed once for the whole
+	text and again after the buffer has changed. The text is read with a U+FFFC for each
+	embedded object (images, widgets), so the columns of the matches are line offsets.
+	The replacement text may contain "\1", "${1}", "${name}" or "\g<name>" references.
+*/
+
+package textView
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gotk3/gotk3/gtk"
+
+	gitvtt "github.com/hfmrow/gtk3_import/textView/textTag"
+)
+
+// RegexError: the search pattern is not a valid regular expression.
+type RegexError struct {
+	Pattern string
+	Err     error
+}
+
+func (e *RegexError) Error() string {
+	return fmt.Sprintf("Invalid regular expression %q: %v", e.Pattern, e.Err)
+}
+
+func (e *RegexError) Unwrap() error {
+	return e.Err
+}
+
+// ReplaceError: the replacement text is not valid, i.e a reference to
+// a group that does not exist.
+type ReplaceError struct {
+	Replace string
+	Err     error
+}
+
+func (e *ReplaceError) Error() string {
+	return fmt.Sprintf("Invalid replacement text %q: %v", e.Replace, e.Err)
+}
+
+func (e *ReplaceError) Unwrap() error {
+	return e.Err
+}
+
+// textMatch: bounds of a match, 'sub' are the byte indexes of
+// the groups in the searched text.
+type textMatch struct {
+	startLine, startCol,
+	endLine, endCol int
+	sub []int
+}
+
+// TextSearch: search engine for a gtk.TextView.
+type TextSearch struct {
+	Text string
+	CaseSensitive,
+	UseRegexp,
+	WordBoundaries,
+	WrapAround,
+	HighlightFound bool
+	FoundBgCol string
+
+	view     *gtk.TextView
+	buff     *gtk.TextBuffer
+	re       *regexp.Regexp
+	reErr    error
+	pattern  string
+	text     string
+	matches  []textMatch
+	dirty    bool
+	tagName  string
+	watching map[uintptr]bool
+
+	changedFunc func() // The matches or their highlighting have changed, i.e: minimap.
+}
+
+// TextSearchNew: create a search engine for the buffer of the view,
+// the buffer may be replaced.
+func TextSearchNew(view *gtk.TextView) *TextSearch {
+	return &TextSearch{
+		view:           view,
+		WrapAround:     true,
+		HighlightFound: true,
+		FoundBgCol:     "#FFF38A",
+		tagName:        "textSearch:found",
+		dirty:          true,
+		watching:       make(map[uintptr]bool)}
+}
+
+// Update: compile the pattern, find the matches and highlight them if
+// requested. Called by the other methods when the options or the text
+// have changed, returns a *RegexError if the pattern is not valid.
+func (ts *TextSearch) Update() (err error) {
+	var buff *gtk.TextBuffer
+	if buff, err = ts.view.GetBuffer(); err != nil || buff == nil {
+		return
+	}
+	ts.watch(buff)
+
+	pattern := ts.Text
+	if !ts.UseRegexp {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if ts.WordBoundaries {
+		pattern = `\b(?:` + pattern + `)\b`
+	}
+	pattern = "(?m)" + pattern
+	if !ts.CaseSensitive {
+		pattern = "(?i)" + pattern
+	}
+	if pattern != ts.pattern {
+		ts.pattern, ts.re, ts.reErr, ts.dirty = pattern, nil, nil, true
+		if len(ts.Text) > 0 {
+			if ts.re, ts.reErr = regexp.Compile(pattern); ts.reErr != nil {
+				ts.reErr = &RegexError{Pattern: ts.Text, Err: ts.reErr}
+			}
+		}
+	}
+	if err = ts.reErr; !ts.dirty {
+		return
+	}
+	ts.dirty = false
+	ts.matches = ts.matches[:0]
+	ts.text = buff.GetStartIter().GetSlice(buff.GetEndIter())
+	if ts.re != nil {
+		ts.findAll()
+	}
+	ts.highlight()
+	return
+}
+
+// findAll: convert the byte indexes of the matches to lines/columns.
+func (ts *TextSearch) findAll() {
+	var lineStarts = []int{0}
+	for idx, r := range ts.text {
+		if r == '\n' {
+			lineStarts = append(lineStarts, idx+1)
+		}
+	}
+	var position = func(idx int) (line, col int) {
+		line = sort.Search(len(lineStarts), func(i int) bool { return lineStarts[i] > idx }) - 1
+		return line, utf8.RuneCountInString(ts.text[lineStarts[line]:idx])
+	}
+	for _, sub := range ts.re.FindAllStringSubmatchIndex(ts.text, -1) {
+		m := textMatch{sub: sub}
+		m.startLine, m.startCol = position(sub[0])
+		m.endLine, m.endCol = position(sub[1])
+		ts.matches = append(ts.matches, m)
+	}
+}
+
+// highlight: apply the tag to the matches.
+func (ts *TextSearch) highlight() {
+	ts.removeTag()
+	if ts.HighlightFound && len(ts.matches) > 0 {
+		tag := gitvtt.TagCreateIfNotExists(ts.buff, ts.tagName, map[string]interface{}{"background": ts.FoundBgCol})
+		for idx := range ts.matches {
+			start, end := ts.iters(idx)
+			ts.buff.ApplyTag(tag, start, end)
+		}
+	}
+	if ts.changedFunc != nil {
+		ts.changedFunc()
+	}
+}
+
+// Clear: remove the highlighting, it's restored on the next update.
+func (ts *TextSearch) Clear() {
+	ts.removeTag()
+	ts.dirty = true
+	if ts.changedFunc != nil {
+		ts.changedFunc()
+	}
+}
+
+// removeTag: remove the highlight tag from the whole buffer.
+func (ts *TextSearch) removeTag() {
+	if ts.buff != nil {
+		if table, err := ts.buff.GetTagTable(); err == nil {
+			if tag, err := table.Lookup(ts.tagName); err == nil && tag != nil {
+				ts.buff.RemoveTag(tag, ts.buff.GetStartIter(), ts.buff.GetEndIter())
+			}
+		}
+	}
+}
+
+// watch: the matches are computed again when the buffer changes.
+func (ts *TextSearch) watch(buff *gtk.TextBuffer) {
+	if !ts.watching[buff.Native()] {
+		ts.watching[buff.Native()] = true
+		buff.Connect("changed", func() { ts.dirty = true })
+	}
+	if ts.buff == nil || ts.buff.Native() != buff.Native() {
+		ts.buff, ts.dirty = buff, true
+	}
+}
+
+// iters: get the bounds of the match.
+func (ts *TextSearch) iters(idx int) (start, end *gtk.TextIter) {
+	m := ts.matches[idx]
+	return ts.buff.GetIterAtLineOffset(m.startLine, m.startCol),
+		ts.buff.GetIterAtLineOffset(m.endLine, m.endCol)
+}
+
+// matchAfter: index of the first match starting at or after 'iter'.
+func (ts *TextSearch) matchAfter(iter *gtk.TextIter) int {
+	line, col := iter.GetLine(), iter.GetLineOffset()
+	return sort.Search(len(ts.matches), func(i int) bool {
+		m := ts.matches[i]
+		return m.startLine > line || (m.startLine == line && m.startCol >= col)
+	})
+}
+
+// Forward: find the next match from 'iter'.
+func (ts *TextSearch) Forward(iter *gtk.TextIter) (start, end *gtk.TextIter, wrapped, found bool) {
+	if ts.Update() != nil || len(ts.matches) == 0 {
+		return
+	}
+	idx := ts.matchAfter(iter)
+	if idx == len(ts.matches) {
+		if !ts.WrapAround {
+			return
+		}
+		idx, wrapped = 0, true
+	}
+	start, end = ts.iters(idx)
+	return start, end, wrapped, true
+}
+
+// Backward: find the previous match ending before 'iter'.
+func (ts *TextSearch) Backward(iter *gtk.TextIter) (start, end *gtk.TextIter, wrapped, found bool) {
+	if ts.Update() != nil || len(ts.matches) == 0 {
+		return
+	}
+	idx := ts.matchAfter(iter) - 1
+	if idx < 0 {
+		if !ts.WrapAround {
+			return
+		}
+		idx, wrapped = len(ts.matches)-1, true
+	}
+	start, end = ts.iters(idx)
+	return start, end, wrapped, true
+}
+
+// GetOccurencesCount: number of matches, -1 if the pattern is not valid.
+func (ts *TextSearch) GetOccurencesCount() int {
+	if ts.Update() != nil {
+		return -1
+	}
+	return len(ts.matches)
+}
+
+// GetOccurencePosition: position (1 based) of the match bounded
+// by 'start' and 'end', 0 if it's not a match.
+func (ts *TextSearch) GetOccurencePosition(start, end *gtk.TextIter) int {
+	if ts.Update() == nil {
+		if idx := ts.matchAfter(start); idx < len(ts.matches) {
+			if s, e := ts.iters(idx); s.Equal(start) && e.Equal(end) {
+				return idx + 1
+			}
+		}
+	}
+	return 0
+}
+
+// Replace: replace the match bounded by 'start' and 'end', 'replaced'
+// is false if it's not a match. The iters are moved to the bounds of
+// the replacement.
+func (ts *TextSearch) Replace(start, end *gtk.TextIter, replace string) (replaced bool, err error) {
+	if err = ts.Update(); err != nil {
+		return
+	}
+	var text string
+	if idx := ts.GetOccurencePosition(start, end) - 1; idx >= 0 {
+		if text, err = ts.expand(idx, replace); err == nil {
+			ts.buff.BeginUserAction()
+			offset := start.GetOffset()
+			ts.buff.Delete(start, end)
+			ts.buff.Insert(start, text)
+			ts.buff.EndUserAction()
+			*end = *start
+			*start = *ts.buff.GetIterAtOffset(offset)
+			replaced = true
+		}
+	}
+	return
+}
+
+// ReplaceAll: replace all the matches as a single user action.
+func (ts *TextSearch) ReplaceAll(replace string) (count int, err error) {
+	if err = ts.Update(); err != nil {
+		return
+	}
+	texts := make([]string, len(ts.matches))
+	for idx := range ts.matches {
+		if texts[idx], err = ts.expand(idx, replace); err != nil {
+			return
+		}
+	}
+	ts.buff.BeginUserAction()
+	defer ts.buff.EndUserAction()
+	// From the end, so the positions of the remaining matches stay valid.
+	for idx := len(ts.matches) - 1; idx >= 0; idx-- {
+		start, end := ts.iters(idx)
+		ts.buff.Delete(start, end)
+		ts.buff.Insert(start, texts[idx])
+		count++
+	}
+	return
+}
+
+// expand: get the replacement text of a match.
+func (ts *TextSearch) expand(idx int, replace string) (text string, err error) {
+	if !ts.UseRegexp {
+		return replace, nil
+	}
+	var template string
+	if template, err = ts.template(replace); err != nil {
+		return "", &ReplaceError{Replace: replace, Err: err}
+	}
+	return string(ts.re.ExpandString(nil, template, ts.text, ts.matches[idx].sub)), nil
+}
+
+// template: convert the replacement text to the regexp.Expand
+// syntax, references to unknown groups are reported.
+func (ts *TextSearch) template(replace string) (template string, err error) {
+	var sb strings.Builder
+	var group = func(name string) {
+		if n := ts.groupIndex(name); n < 0 {
+			if err == nil {
+				err = fmt.Errorf("unknown group %q", name)
+			}
+		}
+		sb.WriteString("${" + name + "}")
+	}
+	for idx := 0; idx < len(replace); idx++ {
+		c := replace[idx]
+		switch {
+		case c == '\\' && idx+1 < len(replace):
+			idx++
+			switch n := replace[idx]; {
+			case n >= '0' && n <= '9':
+				group(string(n))
+			case n == 'g' && strings.HasPrefix(replace[idx+1:], "<") && strings.Contains(replace[idx:], ">"):
+				end := idx + strings.Index(replace[idx:], ">")
+				group(replace[idx+2 : end])
+				idx = end
+			case n == 'n':
+				sb.WriteByte('\n')
+			case n == 't':
+				sb.WriteByte('\t')
+			case n == '$':
+				sb.WriteString("$$")
+			default:
+				sb.WriteByte(n)
+			}
+		case c == '$' && strings.HasPrefix(replace[idx+1:], "{") && strings.Contains(replace[idx:], "}"):
+			end := idx + strings.Index(replace[idx:], "}")
+			group(replace[idx+2 : end])
+			idx = end
+		case c == '$':
+			sb.WriteString("$$")
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String(), err
+}
+
+// groupIndex: get the index of the group by number or by name, -1 if unknown.
+func (ts *TextSearch) groupIndex(name string) int {
+	var n int
+	if _, err := fmt.Sscanf(name, "%d", &n); err == nil && fmt.Sprint(n) == name {
+		if n <= ts.re.NumSubexp() {
+			return n
+		}
+		return -1
+	}
+	return ts.re.SubexpIndex(name)
+}
+
+// GetRegexError: the error of the current pattern, if any.
+func (ts *TextSearch) GetRegexError() error {
+	return ts.Update()
+}
+
+// Search: get the TextSearch of the TextViewNumbered, created on the first call.
+func (tvn *TextViewNumbered) Search() *TextSearch {
+	if tvn.search == nil {
+		tvn.search = TextSearchNew(tvn.TextView)
+	}
+	return tvn.search
+}
@@ -0,0 +1,62 @@
+// textSearch_test.go
+
+/*
+	Copyright ©2019 H.F.M - TextView Numbered  library "https//github/hfmrow"
+	This program comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+*/
+
+package textView
+
+import (
+	"testing"
+
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+func TestTextSearchEmbeddedObjects(t *testing.T) {
+	if err := gtk.InitCheck(nil); err != nil {
+		t.Skip(err)
+	}
+	view, err := gtk.TextViewNew()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buff, _ := view.GetBuffer()
+	buff.SetText("ab ab\nab\nab")
+	pixbuf, err := gdk.PixbufNew(gdk.COLORSPACE_RGB, false, 8, 4, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// "a<image>b <image>ab", "<anchor>ab", "ab"
+	buff.InsertPixbuf(buff.GetIterAtLineOffset(0, 3), pixbuf)
+	buff.InsertPixbuf(buff.GetIterAtLineOffset(0, 1), pixbuf)
+	buff.CreateChildAnchor(buff.GetIterAtLineOffset(1, 0))
+
+	ts := TextSearchNew(view)
+	ts.Text = "ab"
+	if err = ts.Update(); err != nil {
+		t.Fatal(err)
+	}
+	want := [][2]int{{0, 5}, {1, 1}, {2, 0}}
+	if got := ts.GetOccurencesCount(); got != len(want) {
+		t.Fatalf("count: got %d, want %d", got, len(want))
+	}
+	for idx, pos := range want {
+		start, end := ts.iters(idx)
+		if line, col := start.GetLine(), start.GetLineOffset(); line != pos[0] || col != pos[1] {
+			t.Errorf("match %d: got %d:%d, want %d:%d", idx, line, col, pos[0], pos[1])
+		}
+		if text := start.GetSlice(end); text != "ab" {
+			t.Errorf("match %d: got %q, want %q", idx, text, "ab")
+		}
+	}
+
+	if count, err := ts.ReplaceAll("xyz"); err != nil || count != 3 {
+		t.Fatalf("ReplaceAll: got %d, %v", count, err)
+	}
+	if text := buff.GetStartIter().GetSlice(buff.GetEndIter()); text != "a￼b ￼xyz\n￼xyz\nxyz" {
+		t.Errorf("ReplaceAll: got %q", text)
+	}
+}
@@ -0,0 +1,762 @@
+// styleSheet.go
+
+/*
+	This software use gotk3 that is licensed under the ISC License:
+	https://github.com/gotk3/gotk3/blob/master/LICENSE
+
+	Copyright ©2019 H.F.M - TextTag structure
+	This program comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+
+	Declarative tag style sheets: the tags are defined in a small text format or in JSON,
+	validated against the properties of GtkTextTag, and applied to a *gtk.TextBuffer or a
+	*source.SourceBuffer. The file can be watched, the tags of the attached buffers are
+	updated when it changes. The tags are created in the order of the sheet, the last
+	ones have the highest priority.
+
+Text format ('#' comments at the beginning of a line, '//' comments anywhere):
+	# Headings
+	heading {
+		weight: bold;
+		scale: x-large;
+		spacing-below: 6;
+	}
+	link : heading {        // inherit the properties of "heading"
+		color: #3050FF
+		underline: single
+		family: "Liberation Sans"
+	}
+
+JSON format, "name" and "inherit" are reserved:
+	[
+		{"name": "heading", "weight": "bold", "scale": 1.44},
+		{"name": "link", "inherit": "heading", "foreground": "#3050FF"}
+	]
+
+Properties: the GtkTextTag ones (https://developer.gnome.org/gtk3/stable/GtkTextTag.html)
+with names for the enums: weight (thin ... heavy or 100-1000), style (normal, oblique,
+italic), underline (none, single, double, low, error), scale (xx-small ... xx-large or
+a number), justification (left, right, center, fill), wrap-mode (none, char, word,
+word-char), variant (normal, small-caps), stretch. Aliases: color, font-family,
+spacing-above, spacing-below, spacing-inside.
+
+Usage:
+	ss, err := StyleSheetLoad("tags.css")
+	err = ss.Apply(buffer)
+	ss.ErrorFunc = func(err error) { log.Println(err) }
+	ss.Watch(1000) // hot reload
+*/
+
+package textTag
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+	"github.com/gotk3/gotk3/pango"
+
+	"github.com/hfmrow/gotk3_gtksource/source"
+)
+
+// StyleProp: property of a rule as written in the sheet.
+type StyleProp struct {
+	Name,
+	Value string
+	Line int // 0 for JSON
+}
+
+// StyleRule: definition of a tag.
+type StyleRule struct {
+	Name    string
+	Inherit string
+	Props   []StyleProp
+	Line    int
+}
+
+// StyleError: error of a sheet, with its location.
+type StyleError struct {
+	Filename,
+	Tag,
+	Property string
+	Line int
+	Msg  string
+}
+
+func (e *StyleError) Error() string {
+	var b strings.Builder
+	if len(e.Filename) > 0 {
+		b.WriteString(e.Filename + ":")
+	}
+	if e.Line > 0 {
+		fmt.Fprintf(&b, "%d:", e.Line)
+	}
+	if b.Len() > 0 {
+		b.WriteString(" ")
+	}
+	if len(e.Tag) > 0 {
+		fmt.Fprintf(&b, "tag %q: ", e.Tag)
+	}
+	if len(e.Property) > 0 {
+		fmt.Fprintf(&b, "property %q: ", e.Property)
+	}
+	b.WriteString(e.Msg)
+	return b.String()
+}
+
+// StyleErrors: all the errors of a sheet, one per line.
+type StyleErrors []*StyleError
+
+func (e StyleErrors) Error() string {
+	lines := make([]string, len(e))
+	for idx, err := range e {
+		lines[idx] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// StyleSheet:
+type StyleSheet struct {
+	Filename string
+	Rules    []StyleRule
+
+	// ErrorFunc: errors of the hot reload, the previous rules are kept.
+	ErrorFunc func(err error)
+	// ReloadedFunc: the sheet has been reloaded and applied.
+	ReloadedFunc func()
+
+	buffers []*styleBuffer
+	timer   glib.SourceHandle
+	modTime time.Time
+}
+
+// styleBuffer: buffer the sheet is applied to, with the
+// properties set on each tag.
+type styleBuffer struct {
+	buff    interface{}
+	native  uintptr
+	applied map[string][]string
+}
+
+// styleTag: tag resolved from a rule.
+type styleTag struct {
+	name  string
+	names []string // Properties names, in order
+	props map[string]interface{}
+}
+
+// StyleSheetParse: parse a sheet, JSON if it starts with '['. The
+// 'filename' is only used in the error messages.
+func StyleSheetParse(data []byte, filename string) (ss *StyleSheet, err error) {
+	ss = &StyleSheet{Filename: filename}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		ss.Rules, err = parseStyleJSON(data, filename)
+	} else {
+		ss.Rules, err = parseStyleText(string(data), filename)
+	}
+	if err == nil {
+		_, err = ss.resolve()
+	}
+	if err != nil {
+		ss = nil
+	}
+	return
+}
+
+// StyleSheetLoad: load and parse a sheet file.
+func StyleSheetLoad(filename string) (ss *StyleSheet, err error) {
+	var data []byte
+	var info os.FileInfo
+	if info, err = os.Stat(filename); err != nil {
+		return
+	}
+	if data, err = ioutil.ReadFile(filename); err != nil {
+		return
+	}
+	if ss, err = StyleSheetParse(data, filename); err == nil {
+		ss.modTime = info.ModTime()
+	}
+	return
+}
+
+// Rule: get the rule of the tag.
+func (ss *StyleSheet) Rule(name string) (rule StyleRule, ok bool) {
+	for _, r := range ss.Rules {
+		if r.Name == name {
+			return r, true
+		}
+	}
+	return
+}
+
+// Names: the tags names, in the order of the sheet.
+func (ss *StyleSheet) Names() (names []string) {
+	for _, r := range ss.Rules {
+		names = append(names, r.Name)
+	}
+	return
+}
+
+// Props: properties of the tag, inherited ones included, as
+// accepted by TagCreateIfNotExists.
+func (ss *StyleSheet) Props(name string) (props map[string]interface{}, err error) {
+	var tags []styleTag
+	if tags, err = ss.resolve(); err == nil {
+		for _, tag := range tags {
+			if tag.name == name {
+				return tag.props, nil
+			}
+		}
+		err = &StyleError{Filename: ss.Filename, Tag: name, Msg: "not defined"}
+	}
+	return
+}
+
+// Apply: create or update the tags in the buffer, *gtk.TextBuffer or
+// *source.SourceBuffer. The buffer is updated on Reload until Detach.
+func (ss *StyleSheet) Apply(buff interface{}) (err error) {
+	var tags []styleTag
+	var sb *styleBuffer
+
+	if tags, err = ss.resolve(); err != nil {
+		return
+	}
+	native := bufferNative(buff)
+	if native == 0 {
+		return fmt.Errorf("StyleSheet: unsupported buffer type %T", buff)
+	}
+	for _, b := range ss.buffers {
+		if b.native == native {
+			sb = b
+		}
+	}
+	if sb == nil {
+		sb = &styleBuffer{buff: buff, native: native, applied: make(map[string][]string)}
+		ss.buffers = append(ss.buffers, sb)
+	}
+	sb.apply(tags)
+	return
+}
+
+// Detach: stop updating the buffer, the tags are left as is.
+func (ss *StyleSheet) Detach(buff interface{}) {
+	native := bufferNative(buff)
+	for idx, b := range ss.buffers {
+		if b.native == native {
+			ss.buffers = append(ss.buffers[:idx], ss.buffers[idx+1:]...)
+			break
+		}
+	}
+}
+
+// Reload: read the file again and update the attached buffers. On
+// error, the previous rules are kept.
+func (ss *StyleSheet) Reload() (err error) {
+	var newSs *StyleSheet
+	var tags []styleTag
+
+	if newSs, err = StyleSheetLoad(ss.Filename); err != nil {
+		return
+	}
+	ss.Rules, ss.modTime = newSs.Rules, newSs.modTime
+	if tags, err = ss.resolve(); err != nil {
+		return
+	}
+	for _, sb := range ss.buffers {
+		sb.apply(tags)
+	}
+	if ss.ReloadedFunc != nil {
+		ss.ReloadedFunc()
+	}
+	return
+}
+
+// Watch: reload the sheet when the file is modified, checked every
+// 'interval' ms from the main loop.
+func (ss *StyleSheet) Watch(interval uint) {
+	ss.StopWatch()
+	ss.timer = glib.TimeoutAdd(interval, func() bool {
+		if info, err := os.Stat(ss.Filename); err == nil && !info.ModTime().Equal(ss.modTime) {
+			ss.modTime = info.ModTime()
+			if err = ss.Reload(); err != nil && ss.ErrorFunc != nil {
+				ss.ErrorFunc(err)
+			}
+		}
+		return true
+	})
+}
+
+// StopWatch: stop watching the file.
+func (ss *StyleSheet) StopWatch() {
+	if ss.timer > 0 {
+		glib.SourceRemove(ss.timer)
+		ss.timer = 0
+	}
+}
+
+// apply: create/update the tags, the properties that are no longer set
+// are reset and the tags removed from the sheet are removed.
+func (sb *styleBuffer) apply(tags []styleTag) {
+	defined := make(map[string]bool)
+	for _, tag := range tags {
+		defined[tag.name] = true
+		if previous, ok := sb.applied[tag.name]; ok {
+			if t, ok := TagLookupIfExists(sb.buff, tag.name); ok {
+				for _, name := range previous {
+					if _, ok := tag.props[name]; !ok {
+						unsetTagProperty(t, name)
+					}
+				}
+			}
+		}
+		TagCreateIfNotExists(sb.buff, tag.name, tag.props)
+		sb.applied[tag.name] = tag.names
+	}
+	for name := range sb.applied {
+		if !defined[name] {
+			if tag, ok := TagLookupIfExists(sb.buff, name); ok {
+				if table, err := bufferTagTable(sb.buff); err == nil {
+					table.Remove(tag)
+				}
+			}
+			delete(sb.applied, name)
+		}
+	}
+}
+
+// tagSetProperties: "*-set" properties that don't follow the name of
+// the property, "font" sets the properties of its components.
+var tagSetProperties = map[string][]string{
+	"size-points": {"size-set"},
+	"font":        {"family-set", "style-set", "variant-set", "weight-set", "stretch-set", "size-set"},
+}
+
+// unsetTagProperty: clear the "*-set" properties that enable it, the
+// properties still defined are set again by apply.
+func unsetTagProperty(tag *gtk.TextTag, name string) {
+	sets, ok := tagSetProperties[name]
+	if !ok {
+		sets = []string{strings.TrimSuffix(name, "-rgba") + "-set"}
+	}
+	for _, set := range sets {
+		if _, err := tag.GetPropertyType(set); err == nil {
+			tag.SetProperty(set, false)
+		}
+	}
+}
+
+func bufferNative(buff interface{}) uintptr {
+	switch b := buff.(type) {
+	case *gtk.TextBuffer:
+		return b.Native()
+	case *source.SourceBuffer:
+		return b.Native()
+	}
+	return 0
+}
+
+func bufferTagTable(buff interface{}) (*gtk.TextTagTable, error) {
+	switch b := buff.(type) {
+	case *gtk.TextBuffer:
+		return b.GetTagTable()
+	case *source.SourceBuffer:
+		return b.GetTagTable()
+	}
+	return nil, fmt.Errorf("StyleSheet: unsupported buffer type %T", buff)
+}
+
+/*
+ * Validation
+ */
+
+// styleAliases: friendly names.
+var styleAliases = map[string]string{
+	"color":          "foreground",
+	"font-family":    "family",
+	"spacing-above":  "pixels-above-lines",
+	"spacing-below":  "pixels-below-lines",
+	"spacing-inside": "pixels-inside-wrap",
+}
+
+// styleEnums: names of the enums values.
+var styleEnums = map[string]map[string]int{
+	"weight": {
+		"thin": int(pango.WEIGHT_THIN), "ultralight": int(pango.WEIGHT_ULTRALIGHT),
+		"light": int(pango.WEIGHT_LIGHT), "semilight": int(pango.WEIGHT_SEMILIGHT),
+		"book": int(pango.WEIGHT_BOOK), "normal": int(pango.WEIGHT_NORMAL),
+		"medium": int(pango.WEIGHT_MEDIUM), "semibold": int(pango.WEIGHT_SEMIBOLD),
+		"bold": int(pango.WEIGHT_BOLD), "ultrabold": int(pango.WEIGHT_ULTRABOLD),
+		"heavy": int(pango.WEIGHT_HEAVY), "ultraheavy": int(pango.WEIGHT_ULTRAHEAVY)},
+	"style": {
+		"normal": int(pango.STYLE_NORMAL), "oblique": int(pango.STYLE_OBLIQUE),
+		"italic": int(pango.STYLE_ITALIC)},
+	"underline": {
+		"none": int(pango.UNDERLINE_NONE), "single": int(pango.UNDERLINE_SINGLE),
+		"double": int(pango.UNDERLINE_DOUBLE), "low": int(pango.UNDERLINE_LOW),
+		"error": int(pango.UNDERLINE_ERROR)},
+	"variant": {
+		"normal": int(pango.VARIANT_NORMAL), "small-caps": int(pango.VARIANT_SMALL_CAPS)},
+	"stretch": {
+		"ultra-condensed": 0, "extra-condensed": 1, "condensed": 2, "semi-condensed": 3,
+		"normal": 4, "semi-expanded": 5, "expanded": 6, "extra-expanded": 7, "ultra-expanded": 8},
+	"justification": {
+		"left": int(gtk.JUSTIFY_LEFT), "right": int(gtk.JUSTIFY_RIGHT),
+		"center": int(gtk.JUSTIFY_CENTER), "fill": int(gtk.JUSTIFY_FILL)},
+	"wrap-mode": {
+		"none": int(gtk.WRAP_NONE), "char": int(gtk.WRAP_CHAR),
+		"word": int(gtk.WRAP_WORD), "word-char": int(gtk.WRAP_WORD_CHAR)},
+	"direction": {
+		"none": int(gtk.TEXT_DIR_NONE), "ltr": int(gtk.TEXT_DIR_LTR), "rtl": int(gtk.TEXT_DIR_RTL)},
+}
+
+// styleScales: named values of "scale".
+var styleScales = map[string]float64{
+	"xx-small": float64(pango.SCALE_XX_SMALL), "x-small": float64(pango.SCALE_X_SMALL),
+	"small": float64(pango.SCALE_SMALL), "medium": float64(pango.SCALE_MEDIUM),
+	"large": float64(pango.SCALE_LARGE), "x-large": float64(pango.SCALE_X_LARGE),
+	"xx-large": float64(pango.SCALE_XX_LARGE),
+}
+
+// styleColours: properties holding a colour name.
+var styleColours = map[string]bool{
+	"foreground": true, "background": true, "paragraph-background": true,
+}
+
+// styleProbe: tag used to check the properties.
+var styleProbe *gtk.TextTag
+
+// convertStyleProp: check the property and convert its value to the
+// type of the GtkTextTag property.
+func convertStyleProp(name, value string) (prop string, result interface{}, err error) {
+	if alias, ok := styleAliases[name]; ok {
+		name = alias
+	}
+	prop = name
+	if styleProbe == nil {
+		if styleProbe, err = gtk.TextTagNew("textTag:style-probe"); err != nil {
+			return
+		}
+	}
+	var gtype glib.Type
+	if gtype, err = styleProbe.GetPropertyType(name); err != nil {
+		return prop, nil, fmt.Errorf("not a GtkTextTag property")
+	}
+
+	switch {
+	case styleColours[name]:
+		if !gdk.NewRGBA().Parse(value) {
+			err = fmt.Errorf("invalid colour %q", value)
+		}
+		result = value
+	case name == "scale":
+		if scale, ok := styleScales[value]; ok {
+			result = scale
+		} else if result, err = strconv.ParseFloat(value, 64); err != nil {
+			err = fmt.Errorf("expected a number or xx-small ... xx-large, got %q", value)
+		}
+	case styleEnums[name] != nil:
+		if v, ok := styleEnums[name][value]; ok {
+			result = v
+		} else if v, e := strconv.Atoi(value); e == nil {
+			result = v
+		} else {
+			err = fmt.Errorf("expected one of %s, got %q", enumNames(styleEnums[name]), value)
+		}
+	case gtype == glib.TYPE_STRING:
+		result = value
+	case gtype == glib.TYPE_BOOLEAN:
+		if result, err = strconv.ParseBool(value); err != nil {
+			err = fmt.Errorf("expected true or false, got %q", value)
+		}
+	case gtype == glib.TYPE_INT, gtype == glib.TYPE_UINT, gtype.IsA(glib.TYPE_ENUM):
+		var v int
+		if v, err = strconv.Atoi(value); err != nil {
+			err = fmt.Errorf("expected an integer, got %q", value)
+		}
+		result = v
+	case gtype == glib.TYPE_DOUBLE, gtype == glib.TYPE_FLOAT:
+		var v float64
+		if v, err = strconv.ParseFloat(value, 64); err != nil || math.IsNaN(v) {
+			err = fmt.Errorf("expected a number, got %q", value)
+		}
+		result = v
+	default:
+		err = fmt.Errorf("unsupported property type %s", gtype.Name())
+	}
+	return
+}
+
+func enumNames(values map[string]int) string {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// resolve: check the rules and merge the inherited properties.
+func (ss *StyleSheet) resolve() (tags []styleTag, err error) {
+	var errs StyleErrors
+	rules := make(map[string]int)
+	for idx, rule := range ss.Rules {
+		if prev, ok := rules[rule.Name]; ok {
+			errs = append(errs, &StyleError{Filename: ss.Filename, Line: rule.Line, Tag: rule.Name,
+				Msg: fmt.Sprintf("already defined at line %d", ss.Rules[prev].Line)})
+			continue
+		}
+		rules[rule.Name] = idx
+	}
+
+	for _, rule := range ss.Rules {
+		// Inheritance chain, the farthest parent first.
+		chain := []StyleRule{rule}
+		seen := map[string]bool{rule.Name: true}
+		for parent := rule.Inherit; len(parent) > 0; {
+			idx, ok := rules[parent]
+			if !ok {
+				errs = append(errs, &StyleError{Filename: ss.Filename, Line: rule.Line, Tag: rule.Name,
+					Msg: fmt.Sprintf("inherits from undefined tag %q", parent)})
+				break
+			}
+			if seen[parent] {
+				errs = append(errs, &StyleError{Filename: ss.Filename, Line: rule.Line, Tag: rule.Name,
+					Msg: fmt.Sprintf("inheritance loop through %q", parent)})
+				break
+			}
+			seen[parent] = true
+			chain = append([]StyleRule{ss.Rules[idx]}, chain...)
+			parent = ss.Rules[idx].Inherit
+		}
+
+		tag := styleTag{name: rule.Name, props: make(map[string]interface{})}
+		for _, r := range chain {
+			for _, p := range r.Props {
+				name, value, e := convertStyleProp(p.Name, p.Value)
+				if e != nil {
+					if r.Name == rule.Name { // Reported once, with the rule that defines it.
+						errs = append(errs, &StyleError{Filename: ss.Filename, Line: p.Line, Tag: r.Name,
+							Property: p.Name, Msg: e.Error()})
+					}
+					continue
+				}
+				if _, ok := tag.props[name]; !ok {
+					tag.names = append(tag.names, name)
+				}
+				tag.props[name] = value
+			}
+		}
+		tags = append(tags, tag)
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return
+}
+
+/*
+ * Parsers
+ */
+
+// parseStyleJSON: array of objects.
+func parseStyleJSON(data []byte, filename string) (rules []StyleRule, err error) {
+	var entries []map[string]interface{}
+	if err = json.Unmarshal(data, &entries); err != nil {
+		return nil, &StyleError{Filename: filename, Msg: err.Error()}
+	}
+	var errs StyleErrors
+	for idx, entry := range entries {
+		var rule StyleRule
+		var ok bool
+		if rule.Name, ok = entry["name"].(string); !ok || len(rule.Name) == 0 {
+			errs = append(errs, &StyleError{Filename: filename, Msg: fmt.Sprintf("entry %d: missing \"name\"", idx)})
+			continue
+		}
+		if inherit, found := entry["inherit"]; found {
+			if rule.Inherit, ok = inherit.(string); !ok {
+				errs = append(errs, &StyleError{Filename: filename, Tag: rule.Name, Msg: "\"inherit\" must be a string"})
+			}
+		}
+		names := make([]string, 0, len(entry))
+		for name := range entry {
+			if name != "name" && name != "inherit" {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			var value string
+			switch v := entry[name].(type) {
+			case string:
+				value = v
+			case float64:
+				value = strconv.FormatFloat(v, 'f', -1, 64)
+			case bool:
+				value = strconv.FormatBool(v)
+			default:
+				errs = append(errs, &StyleError{Filename: filename, Tag: rule.Name, Property: name,
+					Msg: "value must be a string, a number or a boolean"})
+				continue
+			}
+			rule.Props = append(rule.Props, StyleProp{Name: name, Value: value})
+		}
+		rules = append(rules, rule)
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return
+}
+
+// styleToken: token of the text format.
+type styleToken struct {
+	text   string
+	line   int
+	punct  rune // '{', '}', ':', ';', '\n' or 0 for a word
+	quoted bool
+}
+
+// tokenizeStyle: words, quoted strings and punctuation.
+func tokenizeStyle(text, filename string) (tokens []styleToken, err error) {
+	runes := []rune(text)
+	line := 1
+	lineStart := true
+	for idx := 0; idx < len(runes); idx++ {
+		r := runes[idx]
+		switch {
+		case r == '\n':
+			tokens = append(tokens, styleToken{punct: '\n', line: line})
+			line++
+			lineStart = true
+			continue
+		case unicode.IsSpace(r):
+			continue
+		case r == '#' && lineStart, r == '/' && idx+1 < len(runes) && runes[idx+1] == '/':
+			for idx+1 < len(runes) && runes[idx+1] != '\n' {
+				idx++
+			}
+		case strings.ContainsRune("{}:;", r):
+			tokens = append(tokens, styleToken{punct: r, line: line})
+		case r == '"' || r == '\'':
+			start := idx + 1
+			for idx++; idx < len(runes) && runes[idx] != r && runes[idx] != '\n'; idx++ {
+			}
+			if idx >= len(runes) || runes[idx] != r {
+				return nil, &StyleError{Filename: filename, Line: line, Msg: "unterminated string"}
+			}
+			tokens = append(tokens, styleToken{text: string(runes[start:idx]), line: line, quoted: true})
+		default:
+			start := idx
+			for idx+1 < len(runes) && !unicode.IsSpace(runes[idx+1]) && !strings.ContainsRune("{}:;\"'", runes[idx+1]) &&
+				!(runes[idx+1] == '/' && idx+2 < len(runes) && runes[idx+2] == '/') {
+				idx++
+			}
+			tokens = append(tokens, styleToken{text: string(runes[start : idx+1]), line: line})
+		}
+		lineStart = false
+	}
+	return
+}
+
+// parseStyleText: "name [: parent] { prop: value; ... }", a new line
+// ends a property like ';'.
+func parseStyleText(text, filename string) (rules []StyleRule, err error) {
+	var tokens []styleToken
+	if tokens, err = tokenizeStyle(text, filename); err != nil {
+		return
+	}
+	var errs StyleErrors
+	fail := func(line int, tag, msg string) {
+		errs = append(errs, &StyleError{Filename: filename, Line: line, Tag: tag, Msg: msg})
+	}
+	pos := 0
+	next := func() (tok styleToken, ok bool) {
+		for pos < len(tokens) {
+			tok = tokens[pos]
+			pos++
+			if tok.punct != '\n' {
+				return tok, true
+			}
+		}
+		return
+	}
+
+	for {
+		tok, ok := next()
+		if !ok {
+			break
+		}
+		if tok.punct != 0 {
+			fail(tok.line, "", fmt.Sprintf("expected a tag name, got %q", string(tok.punct)))
+			break
+		}
+		rule := StyleRule{Name: tok.text, Line: tok.line}
+		if tok, ok = next(); ok && tok.punct == ':' {
+			if tok, ok = next(); !ok || tok.punct != 0 {
+				fail(rule.Line, rule.Name, "expected the name of the inherited tag")
+				break
+			}
+			rule.Inherit = tok.text
+			tok, ok = next()
+		}
+		if !ok || tok.punct != '{' {
+			fail(rule.Line, rule.Name, "expected '{'")
+			break
+		}
+
+		// Properties
+		closed := false
+		for pos < len(tokens) && !closed {
+			tok = tokens[pos]
+			pos++
+			switch {
+			case tok.punct == '}':
+				closed = true
+			case tok.punct == ';' || tok.punct == '\n':
+			case tok.punct != 0:
+				fail(tok.line, rule.Name, fmt.Sprintf("expected a property name, got %q", string(tok.punct)))
+			default:
+				prop := StyleProp{Name: tok.text, Line: tok.line}
+				if pos >= len(tokens) || tokens[pos].punct != ':' {
+					fail(tok.line, rule.Name, fmt.Sprintf("expected ':' after %q", prop.Name))
+					for pos < len(tokens) && !strings.ContainsRune(";\n}", tokens[pos].punct) {
+						pos++
+					}
+					continue
+				}
+				pos++
+				var words []string
+				for pos < len(tokens) && tokens[pos].punct == 0 {
+					words = append(words, tokens[pos].text)
+					pos++
+				}
+				if len(words) == 0 {
+					fail(tok.line, rule.Name, fmt.Sprintf("missing value of %q", prop.Name))
+					continue
+				}
+				prop.Value = strings.Join(words, " ")
+				rule.Props = append(rule.Props, prop)
+			}
+		}
+		if !closed {
+			fail(rule.Line, rule.Name, "missing '}'")
+			break
+		}
+		rules = append(rules, rule)
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return
+}
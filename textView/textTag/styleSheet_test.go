@@ -0,0 +1,186 @@
+// styleSheet_test.go
+
+/*
+	Copyright ©2019 H.F.M - TextTag structure
+	This program comes with absolutely no warranty. See the The MIT License (MIT) for details:
+	https://opensource.org/licenses/mit-license.php
+*/
+
+package textTag
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gotk3/gotk3/gtk"
+	"github.com/gotk3/gotk3/pango"
+)
+
+func TestParseStyleText(t *testing.T) {
+	text := `# Headings
+heading {
+	weight: bold;
+	# indented comment
+	scale: x-large
+}
+link : heading {  // inherit
+	color: #3050FF // blue
+	family: "Liberation Sans"
+	background: #FFF;
+}
+`
+	want := []StyleRule{
+		{Name: "heading", Line: 2, Props: []StyleProp{
+			{Name: "weight", Value: "bold", Line: 3},
+			{Name: "scale", Value: "x-large", Line: 5}}},
+		{Name: "link", Inherit: "heading", Line: 7, Props: []StyleProp{
+			{Name: "color", Value: "#3050FF", Line: 8},
+			{Name: "family", Value: "Liberation Sans", Line: 9},
+			{Name: "background", Value: "#FFF", Line: 10}}},
+	}
+	if got, err := parseStyleText(text, "test.css"); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("parseStyleText: got %+v, %v, want %+v", got, err, want)
+	}
+
+	for text, want := range map[string]string{
+		"a {\n\tweight bold\n\tscale:\n}": "test.css:2: tag \"a\": expected ':' after \"weight\"\n" +
+			"test.css:3: tag \"a\": missing value of \"scale\"",
+		"a {\n\t: bold\n}": "test.css:2: tag \"a\": expected a property name, got \":\"\n" +
+			"test.css:2: tag \"a\": expected ':' after \"bold\"",
+		"a {\n\tfamily: \"Sans\n}": "test.css:2: unterminated string",
+		"a {\n\tweight: bold\n":    "test.css:1: tag \"a\": missing '}'",
+		"a : {\n}":                 "test.css:1: tag \"a\": expected the name of the inherited tag",
+		"a\nb {\n}":                "test.css:1: tag \"a\": expected '{'",
+		"# a {\n\n{\n}":            "test.css:3: expected a tag name, got \"{\"",
+	} {
+		if _, err := parseStyleText(text, "test.css"); err == nil || err.Error() != want {
+			t.Errorf("parseStyleText(%q): got %v, want %s", text, err, want)
+		}
+	}
+}
+
+func TestParseStyleJSON(t *testing.T) {
+	data := `[{"name":"h","weight":"bold","scale":1.5,"editable":false},
+		{"name":"l","inherit":"h","foreground":"#3050FF"}]`
+	want := []StyleRule{
+		{Name: "h", Props: []StyleProp{
+			{Name: "editable", Value: "false"}, {Name: "scale", Value: "1.5"}, {Name: "weight", Value: "bold"}}},
+		{Name: "l", Inherit: "h", Props: []StyleProp{{Name: "foreground", Value: "#3050FF"}}},
+	}
+	if got, err := parseStyleJSON([]byte(data), "test.json"); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("parseStyleJSON: got %+v, %v, want %+v", got, err, want)
+	}
+
+	for data, want := range map[string]string{
+		`[{"weight":"bold"},{"name":"a","inherit":1,"x":[1]}]`: "test.json: entry 0: missing \"name\"\n" +
+			"test.json: tag \"a\": \"inherit\" must be a string\n" +
+			"test.json: tag \"a\": property \"x\": value must be a string, a number or a boolean",
+		`[{`: "test.json: unexpected end of JSON input",
+	} {
+		if _, err := parseStyleJSON([]byte(data), "test.json"); err == nil || err.Error() != want {
+			t.Errorf("parseStyleJSON(%s): got %v, want %s", data, err, want)
+		}
+	}
+}
+
+// The properties are checked against GtkTextTag.
+func TestStyleSheetResolve(t *testing.T) {
+	if err := gtk.InitCheck(nil); err != nil {
+		t.Skip(err)
+	}
+	ss, err := StyleSheetParse([]byte("heading { weight: bold; scale: x-large }\n"+
+		"link : heading { weight: normal; color: #3050FF }\n"), "test.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"weight": int(pango.WEIGHT_NORMAL), "scale": float64(pango.SCALE_X_LARGE), "foreground": "#3050FF"}
+	if got, err := ss.Props("link"); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("Props: got %v, %v, want %v", got, err, want)
+	}
+
+	_, err = StyleSheetParse([]byte(`a : b {
+	weight: bold
+}
+b : a {
+	style: italic
+}
+c : missing {
+}
+c {
+}
+d {
+	colour: red
+	weight: fat
+}`), "test.css")
+	var got []string
+	if err != nil {
+		got = strings.Split(err.Error(), "\n")
+	}
+	wantErrs := []string{
+		`test.css:9: tag "c": already defined at line 7`,
+		`test.css:1: tag "a": inheritance loop through "a"`,
+		`test.css:4: tag "b": inheritance loop through "b"`,
+		`test.css:7: tag "c": inherits from undefined tag "missing"`,
+		`test.css:12: tag "d": property "colour": not a GtkTextTag property`,
+		`test.css:13: tag "d": property "weight": expected one of `,
+	}
+	if len(got) != len(wantErrs) {
+		t.Fatalf("StyleSheetParse: got %q, want %q", got, wantErrs)
+	}
+	for idx, want := range wantErrs {
+		if !strings.HasPrefix(got[idx], want) {
+			t.Errorf("StyleSheetParse: got %s, want %s", got[idx], want)
+		}
+	}
+}
+
+func TestStyleSheetApply(t *testing.T) {
+	if err := gtk.InitCheck(nil); err != nil {
+		t.Skip(err)
+	}
+	buff, err := gtk.TextBufferNew(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss, err := StyleSheetParse([]byte("a {\n\tweight: bold\n\tcolor: red\n\tfont: Sans Italic 10\n}\nb {\n\tunderline: single\n}\n"), "test.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	isSet := func(tagName string) map[string]interface{} {
+		values := make(map[string]interface{})
+		if tag, ok := TagLookupIfExists(buff, tagName); ok {
+			for _, set := range []string{"weight-set", "foreground-set", "family-set", "style-set", "size-set", "background-set"} {
+				values[set], _ = tag.GetProperty(set)
+			}
+		}
+		return values
+	}
+	if err = ss.Apply(buff); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"weight-set": true, "foreground-set": true, "family-set": true,
+		"style-set": true, "size-set": true, "background-set": false}
+	if got := isSet("a"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Apply: got %v, want %v", got, want)
+	}
+
+	// The removed properties and tags are reset.
+	modified, err := StyleSheetParse([]byte("a {\n\tbackground: blue\n}\n"), "test.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss.Rules = modified.Rules
+	if err = ss.Apply(buff); err != nil {
+		t.Fatal(err)
+	}
+	want = map[string]interface{}{"weight-set": false, "foreground-set": false, "family-set": false,
+		"style-set": false, "size-set": false, "background-set": true}
+	if got := isSet("a"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Apply, modified sheet: got %v, want %v", got, want)
+	}
+	if _, ok := TagLookupIfExists(buff, "b"); ok {
+		t.Error("Apply, modified sheet: tag \"b\" not removed")
+	}
+}
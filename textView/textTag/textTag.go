@@ -23,210 +23,238 @@ import (
 * Some pre-defined tags that could be used *
 *******************************************/
 
-// TextTag: Is a structure that own some methods to handle gtk.TextTag
+// TextTagList: Is a structure that own some methods to handle gtk.TextTag
 // and make more user-friendly the usage of it in a TextView. Some
 // explanations and definitions are availables trought the official
 // manual: https://developer.gnome.org/gtk3/stable/GtkTextTag.html
-// type TextTagList struct {
-// 	TagList  []tagStore
-// 	Buff     *gtk.TextBuffer
-// 	tagTable *gtk.TextTagTable
-// }
-
-// // TextTagProp: tag' properties record.
-// type TextTagProp struct {
-// 	Name  string
-// 	Value interface{}
-// }
-
-// // TextTagList: Complete tag record.
-// type TextTagRecord struct {
-// 	TagName string
-// 	Props   []TextTagProp
-// }
-
-// // tagStore: Used to track already added tags.
-// type tagStore struct {
-// 	Name string
-// 	Tag  *gtk.TextTag
-// }
-
-// // TextTagPropNew: Convenient function to create and fill a new TextTagProp struct.
-// // i.e: Modify("blue_foreground",
-// //         TextTagPropNew("foreground", "#0022FF"),
-// //         TextTagPropNew("strikethrough", true))
-// func TextTagPropNew(name string, value interface{}) (outProp map[string]interface{}) {
-// 	outProp = make(map[string]interface{})
-// 	outProp[name] = value
-// 	return
-// }
-
-// // TextTagNew: Create and initialize a new TextTagNew structure
-// func TextTagListNew(buff *gtk.TextBuffer) (tt *TextTagList, err error) {
-// 	tt = new(TextTagList)
-// 	err = tt.Init(buff)
-// 	return
-// }
-
-// // Add: Adding tag with property (could be multiple).
-// // ie: Add("theName", []TextTagProp{
-// //         {Name: "weight", Value: pango.WEIGHT_BOLD},
-// //         {Name: "size", Value: 15 * pango.SCALE}}...)
-// func (tt *TextTagList) Add(name string, tagProps ...TextTagProp) (tag *gtk.TextTag, err error) {
-
-// 	props := make([]TextTagProp, len(tagProps))
-// 	for idx, prop := range tagProps {
-// 		props[idx] = prop
-// 	}
-// 	return tt.createTag(name, props...)
-// }
-
-// // Remove: stored tag from TagTable
-// func (tt *TextTagList) Remove(name string) {
-// 	for idx, tag := range tt.TagList {
-// 		if tag.Name == name {
-// 			tt.tagTable.Remove(tag.Tag)                                  // Remove from buffer
-// 			tt.TagList = append(tt.TagList[:idx], tt.TagList[idx+1:]...) // Remove from store list
-// 			break
-// 		}
-// 	}
-// }
-
-// // RemoveAllTagsFromTagsList: remove all defaults and user defined tags,
-// // (contained into "TagsList")
-// func (tt *TextTagList) RemoveAllTagsFromTagsList() {
-// 	for _, tag := range tt.TagList {
-// 		tt.Buff.RemoveTagByName(tag.Name, tt.Buff.GetStartIter(), tt.Buff.GetEndIter())
-// 	}
-// }
-
-// // Modify: stored tag from TagTable
-// func (tt *TextTagList) Modify(name string, tagProps ...TextTagProp) (err error) {
-// 	for _, tag := range tt.TagList {
-// 		if tag.Name == name {
-// 			for _, prop := range tagProps {
-// 				if err = tag.Tag.SetProperty(prop.Name, prop.Value); err != nil {
-// 					return
-// 				}
-// 			}
-// 			break
-// 		}
-// 	}
-// 	return
-// }
-
-// // ApplyTagsByName: Apply one or more Tags to the previously initialized TextBuffer
-// func (tt *TextTagList) ApplyTagsByName(startIter, endIter *gtk.TextIter, tags ...string) {
-// 	for _, name := range tags {
-// 		tt.Buff.ApplyTagByName(name, startIter, endIter)
-// 	}
-// }
-
-// // ApplyTagsByNameAtOffets: Apply one or more Tags to the previously initialized TextBuffer
-// // At one or multiples offsets (character position)
-// func (tt *TextTagList) ApplyTagsByNameAtOffets(offsets [][]int, tags ...string) {
-// 	var startIter, endIter *gtk.TextIter
-// 	for _, offset := range offsets {
-// 		startIter = tt.Buff.GetIterAtOffset(offset[0])
-// 		endIter = tt.Buff.GetIterAtOffset(offset[1])
-// 		for _, name := range tags {
-// 			tt.Buff.ApplyTagByName(name, startIter, endIter)
-// 		}
-// 	}
-// }
-
-// // RemoveTagsByName: from TextBuffer (clear tags)
-// func (tt *TextTagList) RemoveTagsByName(startIter, endIter *gtk.TextIter, tags ...string) {
-// 	for _, name := range tags {
-// 		tt.Buff.RemoveTagByName(name, startIter, endIter)
-// 	}
-// }
-
-// // RemoveAllTags: from TextBuffer (clear tags)
-// func (tt *TextTagList) RemoveAllTags(startIter, endIter *gtk.TextIter) {
-// 	tt.Buff.RemoveAllTags(startIter, endIter)
-// }
-
-// // Init: initialize the default TextBuffer Tags set.
-// func (tt *TextTagList) Init(buff *gtk.TextBuffer) (err error) {
-// 	if tt.tagTable == nil { // Do it only if not previously done (only one time)
-// 		if tt.tagTable, err = buff.GetTagTable(); err == nil {
-// 			tt.Buff = buff
-
-// 			// got this issue when using it:
-// 			// panic: runtime error: cgo argument has Go pointer to Go pointer
-// 			// github.com/gotk3/gotk3/glib.(*Value).SetPointer.func1(0xc000198468, 0xc000198450)
-// 			// github.com/gotk3/gotk3/glib/glib.go:1365 +0x5a
-// 			// github.com/gotk3/gotk3/glib.(*Value).SetPointer(0xc000198468, 0xc000198450)
-// 			// github.com/gotk3/gotk3/glib/glib.go:1365 +0x35
-// 			// github.com/gotk3/gotk3/glib.GValue(0x8d4240, 0xc000198450, 0x7fe7d81145c0, 0x1, 0x0)
-// 			// github.com/gotk3/gotk3/glib/glib.go:1105 +0x4eb
-// 			// github.com/gotk3/gotk3/glib.(*Object).SetProperty(0xc000198458, 0x967332, 0xa, 0x8d4240, 0xc000198450, 0x0, 0x0)
-// 			// github.com/gotk3/gotk3/glib/glib.go:682 +0xba
-
-// 			// bgcRGBA := gdk.NewRGBA()
-// 			// if !bgcRGBA.Parse("#FFFF99") {
-// 			// 	log.Fatal("error parsing RGBA")
-// 			// }
-// 			// rgba := bgcRGBA.Floats()
-// 			// bgcRGBA.SetColors(rgba[0], rgba[1], rgba[2], 0.5)
-
-// 			list := []TextTagList{
-// 				// {TagName: "yellow_background", Props: []TextTagProp{{Name: "background", Value: bgcRGBA}}},
-
-// 				{TagName: "normal", Props: []TextTagProp{{Name: "style", Value: pango.STYLE_NORMAL}}},
-// 				{TagName: "oblique", Props: []TextTagProp{{Name: "style", Value: pango.STYLE_OBLIQUE}}},
-// 				{TagName: "italic", Props: []TextTagProp{{Name: "style", Value: pango.STYLE_ITALIC}}},
-// 				{TagName: "bold", Props: []TextTagProp{{Name: "weight", Value: pango.WEIGHT_BOLD}}},
-// 				{TagName: "underline", Props: []TextTagProp{{Name: "underline", Value: pango.UNDERLINE_SINGLE}}},
-// 				{TagName: "double_underline", Props: []TextTagProp{{Name: "underline", Value: pango.UNDERLINE_DOUBLE}}},
-// 				{TagName: "strikethrough", Props: []TextTagProp{{Name: "strikethrough", Value: true}}},
-// 				{TagName: "heading", Props: []TextTagProp{{Name: "weight", Value: pango.WEIGHT_BOLD}, {Name: "size", Value: 15 * pango.SCALE}}},
-// 				{TagName: "big", Props: []TextTagProp{{Name: "size", Value: 20 * pango.SCALE}}},
-// 				// Cannot use pango variables, ... unable to convert type ...
-// 				{TagName: "xx-small", Props: []TextTagProp{{Name: "scale", Value: 0.5787037037037}}}, /* pango.SCALE_XX_SMALL */
-// 				{TagName: "x-small", Props: []TextTagProp{{Name: "scale", Value: 0.6444444444444}}},  /* pango.SCALE_X_SMALL */
-// 				{TagName: "small", Props: []TextTagProp{{Name: "scale", Value: 0.8333333333333}}},    /* pango.SCALE_SMALL */
-// 				{TagName: "medium", Props: []TextTagProp{{Name: "scale", Value: 1.0}}},               /* pango.SCALE_MEDIUM */
-// 				{TagName: "large", Props: []TextTagProp{{Name: "scale", Value: 1.2}}},                /* pango.SCALE_LARGE */
-// 				{TagName: "x-large", Props: []TextTagProp{{Name: "scale", Value: 1.4399999999999}}},  /* pango.SCALE_X_LARGE */
-// 				{TagName: "xx-large", Props: []TextTagProp{{Name: "scale", Value: 1.728}}},           /* pango.SCALE_XX_LARGE */
-// 				{TagName: "superscript", Props: []TextTagProp{{Name: "rise", Value: 10 * pango.SCALE}, {Name: "size", Value: 8 * pango.SCALE}}},
-// 				{TagName: "subscript", Props: []TextTagProp{{Name: "rise", Value: -10 * pango.SCALE}, {Name: "size", Value: 8 * pango.SCALE}}},
-// 				{TagName: "monospace", Props: []TextTagProp{{Name: "family", Value: "monospace"}}},
-// 				{TagName: "blue_foreground", Props: []TextTagProp{{Name: "foreground", Value: "#3050FF"}}},   // soft blue
-// 				{TagName: "yellow_background", Props: []TextTagProp{{Name: "background", Value: "#FFFFAF"}}}, // light yellow
-// 				{TagName: "foreground_color", Props: []TextTagProp{{Name: "foreground", Value: "#0022DF"}}},  // deep blue
-// 				{TagName: "background_color", Props: []TextTagProp{{Name: "background", Value: "#AAFFAA"}}},  // light green
-// 			}
-// 			for _, tag := range list {
-// 				if _, err = tt.createTag(tag.TagName, tag.Props...); err != nil {
-// 					return
-// 				}
-// 			}
-// 		}
-// 	}
-// 	return
-// }
-
-// // createTag: create tag with properties and add it to buffer.
-// // I do not use the native gtk3' "TextBuffer.CreateTag" function
-// // because I need to use a structure with some methods instead
-// // of a map.
-// // TODO rewrite with version below
-// func (tt *TextTagList) createTag(name string, props ...TextTagProp) (tag *gtk.TextTag, err error) {
-// 	if tag, err = gtk.TextTagNew(name); err == nil {
-// 		tt.tagTable.Add(tag)
-// 		for _, prop := range props {
-// 			if err = tag.SetProperty(prop.Name, prop.Value); err != nil {
-// 				err = errors.New(fmt.Sprintf("%s, %s: %v\n", err.Error(), prop.Name, prop.Value))
-// 				break
-// 			}
-// 		}
-// 		tt.TagList = append(tt.TagList, tagStore{Name: name, Tag: tag})
-// 	}
-// 	return
-// }
+// The tags can be defined in a style sheet, see styleSheet.go.
+type TextTagList struct {
+	TagList []tagStore
+	Buff    *gtk.TextBuffer
+	Sheet   *StyleSheet
+
+	tagTable *gtk.TextTagTable
+}
+
+// TextTagProp: tag' properties record.
+type TextTagProp struct {
+	Name  string
+	Value interface{}
+}
+
+// TextTagRecord: Complete tag record.
+type TextTagRecord struct {
+	TagName string
+	Props   []TextTagProp
+}
+
+// tagStore: Used to track already added tags.
+type tagStore struct {
+	Name string
+	Tag  *gtk.TextTag
+}
+
+// TEXT_TAG_DEFAULT_SHEET: default tags set, created by Init.
+const TEXT_TAG_DEFAULT_SHEET = `
+normal { style: normal }
+oblique { style: oblique }
+italic { style: italic }
+bold { weight: bold }
+underline { underline: single }
+double_underline { underline: double }
+strikethrough { strikethrough: true }
+heading { weight: bold; size-points: 15 }
+big { size-points: 20 }
+xx-small { scale: xx-small }
+x-small { scale: x-small }
+small { scale: small }
+medium { scale: medium }
+large { scale: large }
+x-large { scale: x-large }
+xx-large { scale: xx-large }
+superscript { rise: 10240; size-points: 8 }
+subscript { rise: -10240; size-points: 8 }
+monospace { family: monospace }
+blue_foreground { foreground: #3050FF }   // soft blue
+yellow_background { background: #FFFFAF } // light yellow
+foreground_color { foreground: #0022DF }  // deep blue
+background_color { background: #AAFFAA }  // light green
+`
+
+// TextTagListNew: Create and initialize a new TextTagList structure,
+// 'buff' is a *gtk.TextBuffer or a *source.SourceBuffer.
+func TextTagListNew(buff interface{}) (tt *TextTagList, err error) {
+	tt = new(TextTagList)
+	err = tt.Init(buff)
+	return
+}
+
+// Add: Adding tag with property (could be multiple).
+// ie: Add("theName", []TextTagProp{
+//         {Name: "weight", Value: pango.WEIGHT_BOLD},
+//         {Name: "size", Value: 15 * pango.SCALE}}...)
+func (tt *TextTagList) Add(name string, tagProps ...TextTagProp) (tag *gtk.TextTag, err error) {
+	return tt.createTag(name, tagProps...)
+}
+
+// Remove: stored tag from TagTable
+func (tt *TextTagList) Remove(name string) {
+	for idx, tag := range tt.TagList {
+		if tag.Name == name {
+			tt.tagTable.Remove(tag.Tag)                                  // Remove from buffer
+			tt.TagList = append(tt.TagList[:idx], tt.TagList[idx+1:]...) // Remove from store list
+			break
+		}
+	}
+}
+
+// RemoveAllTagsFromTagsList: remove all defaults and user defined tags,
+// (contained into "TagsList")
+func (tt *TextTagList) RemoveAllTagsFromTagsList() {
+	for _, tag := range tt.TagList {
+		tt.Buff.RemoveTagByName(tag.Name, tt.Buff.GetStartIter(), tt.Buff.GetEndIter())
+	}
+}
+
+// Modify: stored tag from TagTable
+func (tt *TextTagList) Modify(name string, tagProps ...TextTagProp) (err error) {
+	for _, tag := range tt.TagList {
+		if tag.Name == name {
+			for _, prop := range tagProps {
+				if err = tag.Tag.SetProperty(prop.Name, prop.Value); err != nil {
+					return fmt.Errorf("%s, %s: %v", err.Error(), prop.Name, prop.Value)
+				}
+			}
+			break
+		}
+	}
+	return
+}
+
+// ApplyTagsByName: Apply one or more Tags to the previously initialized TextBuffer
+func (tt *TextTagList) ApplyTagsByName(startIter, endIter *gtk.TextIter, tags ...string) {
+	for _, name := range tags {
+		tt.Buff.ApplyTagByName(name, startIter, endIter)
+	}
+}
+
+// ApplyTagsByNameAtOffets: Apply one or more Tags to the previously initialized TextBuffer
+// At one or multiples offsets (character position)
+func (tt *TextTagList) ApplyTagsByNameAtOffets(offsets [][]int, tags ...string) {
+	var startIter, endIter *gtk.TextIter
+	for _, offset := range offsets {
+		startIter = tt.Buff.GetIterAtOffset(offset[0])
+		endIter = tt.Buff.GetIterAtOffset(offset[1])
+		for _, name := range tags {
+			tt.Buff.ApplyTagByName(name, startIter, endIter)
+		}
+	}
+}
+
+// RemoveTagsByName: from TextBuffer (clear tags)
+func (tt *TextTagList) RemoveTagsByName(startIter, endIter *gtk.TextIter, tags ...string) {
+	for _, name := range tags {
+		tt.Buff.RemoveTagByName(name, startIter, endIter)
+	}
+}
+
+// RemoveAllTags: from TextBuffer (clear tags)
+func (tt *TextTagList) RemoveAllTags(startIter, endIter *gtk.TextIter) {
+	tt.Buff.RemoveAllTags(startIter, endIter)
+}
+
+// Init: initialize the default TextBuffer Tags set.
+func (tt *TextTagList) Init(buff interface{}) (err error) {
+	if tt.tagTable == nil { // Do it only if not previously done (only one time)
+		switch b := buff.(type) {
+		case *gtk.TextBuffer:
+			tt.Buff = b
+		case *source.SourceBuffer:
+			tt.Buff = &b.TextBuffer
+		default:
+			return fmt.Errorf("TextTagList: unsupported buffer type %T", buff)
+		}
+		if tt.tagTable, err = tt.Buff.GetTagTable(); err == nil {
+			var ss *StyleSheet
+			if ss, err = StyleSheetParse([]byte(TEXT_TAG_DEFAULT_SHEET), "default"); err == nil {
+				err = tt.applySheet(ss)
+			}
+		}
+	}
+	return
+}
+
+// LoadStyleSheet: load the tags of a style sheet file, the sheet is
+// kept in 'Sheet', use Sheet.Watch to reload it on changes. TagList
+// follows the reloads through Sheet.ReloadedFunc.
+func (tt *TextTagList) LoadStyleSheet(filename string) (err error) {
+	var ss *StyleSheet
+	if ss, err = StyleSheetLoad(filename); err == nil {
+		if err = tt.applySheet(ss); err == nil {
+			if tt.Sheet != nil {
+				tt.Sheet.StopWatch()
+				tt.Sheet.Detach(tt.Buff)
+			}
+			tt.Sheet = ss
+			ss.ReloadedFunc = tt.syncSheet
+		}
+	}
+	return
+}
+
+// syncSheet: update TagList after a reload, the tags removed
+// from the table are dropped.
+func (tt *TextTagList) syncSheet() {
+	for idx := len(tt.TagList) - 1; idx >= 0; idx-- {
+		if _, ok := TagLookupIfExists(tt.Buff, tt.TagList[idx].Name); !ok {
+			tt.TagList = append(tt.TagList[:idx], tt.TagList[idx+1:]...)
+		}
+	}
+	for _, name := range tt.Sheet.Names() {
+		if tag, ok := TagLookupIfExists(tt.Buff, name); ok {
+			tt.store(name, tag)
+		}
+	}
+}
+
+// applySheet: create the tags of the sheet and store them.
+func (tt *TextTagList) applySheet(ss *StyleSheet) (err error) {
+	if err = ss.Apply(tt.Buff); err != nil {
+		return
+	}
+	for _, name := range ss.Names() {
+		if tag, ok := TagLookupIfExists(tt.Buff, name); ok {
+			tt.store(name, tag)
+		}
+	}
+	return
+}
+
+// createTag: create tag with properties and add it to buffer.
+func (tt *TextTagList) createTag(name string, props ...TextTagProp) (tag *gtk.TextTag, err error) {
+	if tag, err = gtk.TextTagNew(name); err == nil {
+		tt.tagTable.Add(tag)
+		for _, prop := range props {
+			if err = tag.SetProperty(prop.Name, prop.Value); err != nil {
+				err = fmt.Errorf("%s, %s: %v", err.Error(), prop.Name, prop.Value)
+				break
+			}
+		}
+		tt.store(name, tag)
+	}
+	return
+}
+
+// store: add or replace the tag in TagList.
+func (tt *TextTagList) store(name string, tag *gtk.TextTag) {
+	for idx := range tt.TagList {
+		if tt.TagList[idx].Name == name {
+			tt.TagList[idx].Tag = tag
+			return
+		}
+	}
+	tt.TagList = append(tt.TagList, tagStore{Name: name, Tag: tag})
+}
 
 // TextTagPropNew: Convenient function to create and fill a new TextTagProp struct.
 // i.e: Modify("blue_foreground",
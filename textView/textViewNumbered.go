@@ -13,11 +13,9 @@
 	Allow using a scrolled TextView with line numbers (left sided) with some formatting text
 	controls
 
-	There is a limitation regarding some types of text containing non-printable characters
-	(some fonts print Utf-8 codes instead of character), does not work properly, the height
-	of the line numbers is not correctly synchronized with the text. These characters print
-	an oversized entry in the textView column, so the numbers are shifted relative to the
-	lines of text.
+	The numbers are drawn in the gutter (see gutter.go) using the real positions and heights
+	of the lines in the TextView, so they stay aligned with wrapped lines, folded lines and
+	lines containing oversized characters.
 */
 
 package textView
@@ -28,12 +26,15 @@ import (
 	"log"
 	"strconv"
 
+	"github.com/gotk3/gotk3/cairo"
+	"github.com/gotk3/gotk3/gdk"
 	"github.com/gotk3/gotk3/glib"
 	"github.com/gotk3/gotk3/gtk"
 
 	glco "github.com/hfmrow/gen_lib/crypto"
 
 	gimc "github.com/hfmrow/gtk3_import/misc"
+	gitvch "github.com/hfmrow/gtk3_import/textView/chromaHighlight"
 	gitvtt "github.com/hfmrow/gtk3_import/textView/textTag"
 
 	"github.com/hfmrow/gotk3_gtksource/source"
@@ -222,9 +223,24 @@ type TextViewNumbered struct {
 
 	BufferChangeCallbackFunc func()
 
-	tVNum           *gtk.TextView
-	tVNumWidth      int
-	lastTVNumWidth  int
+	// Format of the file, see textFile.go
+	Format TextFormat
+
+	// Code folding, see fold.go
+	FoldMethod      FoldMethod
+	FoldFgCol       string
+	FoldPlaceholder string
+	Highlighter     *gitvch.ChromaHighlight // Tokens are used to find the foldable regions.
+
+	// Built-in gutter renderers, see gutter.go
+	Bookmarks,
+	Diagnostics,
+	Breakpoints *GutterMarks
+	DiffBars *GutterDiff
+
+	// Per-file cursor, scroll, bookmarks and folds memory, see positions.go
+	Positions *PositionStore
+
 	textViewLMargin int
 
 	scrTxt      *gtk.ScrolledWindow
@@ -234,14 +250,24 @@ type TextViewNumbered struct {
 	hValue      float64
 	vValue      float64
 	currentline int
+	filename    string
 
-	buffNum *gtk.TextBuffer
-
-	lastLineCount int
-	sigHdlBufTxt  glib.SignalHandle
+	sigHdlBufTxt glib.SignalHandle
 	// sigHdlscrTxt  glib.SignalHandle
 	lastMd5          string
 	colorBgRangeName string
+
+	box           *gtk.Box
+	gutter        *gtk.DrawingArea
+	gutterWidth   int
+	gutterPending bool
+	renderers     []GutterRenderer
+	numbers       *numbersRenderer
+	foldRegions   []FoldRegion
+	folds         []*fold
+	foldSeq       int
+	search        *TextSearch
+	minimap       *Minimap
 }
 
 // TextViewNumberedNew: Create and initialize a new TextViewNumbered structure
@@ -257,7 +283,6 @@ func (tvn *TextViewNumbered) Init(container gtk.Container) (err error) {
 	tvn.textViewLMargin = 5
 	tvn.ShowNumbers = true
 	tvn.Editable = true
-	tvn.lastLineCount = 0
 	tvn.BufferChangeCallbackFunc = func() {}
 
 	// Default colors for numbers
@@ -293,27 +318,17 @@ func (tvn *TextViewNumbered) Init(container gtk.Container) (err error) {
 			tvn.TextView.SetProperty("right-margin", 3)
 			tvn.TextView.SetProperty("editable", true)
 			tvn.scrTxt.Add(tvn.TextView)
-			// Setup numbers
-			if tvn.tVNum, err = gtk.TextViewNew(); err == nil {
-				tvn.tVNum.SetSensitive(false)
-				tvn.tVNum.SetProperty("visible", true)
-				tvn.tVNum.SetProperty("can-focus", false)
-				tvn.tVNum.SetProperty("hexpand", false)
-				tvn.tVNum.SetProperty("vexpand", true)
-				tvn.tVNum.SetProperty("left-margin", 2)
-				tvn.tVNum.SetProperty("right-margin", 3)
-				tvn.tVNum.SetProperty("editable", false)
-				tvn.tVNum.SetProperty("justification", gtk.JUSTIFY_RIGHT)
-				// Setup viewport
-				tvn.TextView.AddChildInWindow(tvn.tVNum, gtk.TEXT_WINDOW_LEFT, 0, 0)
-				tvn.container.Add(tvn.scrTxt)
-
-				if tvn.buffNum, err = tvn.tVNum.GetBuffer(); err == nil {
-					if tvn.BuffTxt, err = tvn.TextView.GetBuffer(); err == nil {
-						tvn.lastLineCount = tvn.BuffTxt.GetLineCount()
+			// Setup gutter (numbers), at the left of the scrolled window
+			if tvn.box, err = gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 0); err == nil {
+				tvn.initFolding()
+				if err = tvn.initGutter(); err == nil {
+					tvn.box.SetProperty("visible", true)
+					tvn.box.PackStart(tvn.gutter, false, true, 0)
+					tvn.box.PackStart(tvn.scrTxt, true, true, 0)
+					tvn.container.Add(tvn.box)
 
-						// tvn.TextView.Connect("realize", tvn.updateNumbers)
-						tvn.sigHdlBufTxt = tvn.BuffTxt.Connect("changed", tvn.updateNumbers)
+					if tvn.BuffTxt, err = tvn.TextView.GetBuffer(); err == nil {
+						tvn.sigHdlBufTxt = tvn.BuffTxt.Connect("changed", tvn.gutterChanged)
 						tvn.doCss()
 					}
 				}
@@ -336,23 +351,16 @@ func (tvn *TextViewNumbered) WaitForEventPending() {
 	}
 }
 
-// // scrolled: used to asjust left margin of the text if its necessary
-// func (tvn *TextViewNumbered) scrolled() {
-// 	if tvn.tVNumWidth != tvn.lastTVNumWidth {
-// 		tvn.autoSetMargin()
-// 		tvn.lastTVNumWidth = tvn.tVNumWidth
-// 	}
-// }
-
 // Update: refresh TextView.
 func (tvn *TextViewNumbered) Update() {
 	tvn.TextView.SetEditable(tvn.Editable)
 	tvn.doCss()
-	tvn.updateNumbers()
+	tvn.gutterChanged()
 }
 
 // FromFile: opens, loads the text file into the TextView and scrolls to
-// the position if it has been specified.
+// the position if it has been specified, otherwise the stored position
+// is restored when 'Positions' is set.
 func (tvn *TextViewNumbered) FromFile(filename string, position ...int) (err error) {
 	var data []byte
 	pos := 1
@@ -361,7 +369,11 @@ func (tvn *TextViewNumbered) FromFile(filename string, position ...int) (err err
 	}
 	if data, err = ioutil.ReadFile(filename); err == nil {
 		tvn.SetText(string(data))
-		tvn.ScrollToLine(pos)
+		tvn.filename = filename
+		tvn.clearBookmarks()
+		if !tvn.RestorePosition(len(position) == 0) || len(position) > 0 {
+			tvn.ScrollToLine(pos)
+		}
 	}
 	return
 }
@@ -386,20 +398,18 @@ func (tvn *TextViewNumbered) RestoreScrollPos() {
 	tvn.vAdj.SetValue(tvn.vValue)
 }
 
-// Clear: Create new buffers (txt & num) and assign it.
+// Clear: Create new buffer and assign it.
 // If you have made some signals callback, you must do it again.
 func (tvn *TextViewNumbered) Reset() {
+	tvn.resetGutter()
 	tvn.BuffTxt, _ = gtk.TextBufferNew(nil)
-	tvn.buffNum, _ = gtk.TextBufferNew(nil)
-	tvn.lastLineCount = tvn.BuffTxt.GetLineCount()
-	tvn.sigHdlBufTxt = tvn.BuffTxt.Connect("changed", tvn.updateNumbers)
+	tvn.sigHdlBufTxt = tvn.BuffTxt.Connect("changed", tvn.gutterChanged)
 }
 
-// Clear: Delete buffers content (txt & num)
+// Clear: Delete buffer content
 func (tvn *TextViewNumbered) Clear() {
+	tvn.resetGutter()
 	tvn.BuffTxt.Delete(tvn.BuffTxt.GetStartIter(), tvn.BuffTxt.GetEndIter())
-	tvn.buffNum.Delete(tvn.buffNum.GetStartIter(), tvn.buffNum.GetEndIter())
-	tvn.lastLineCount = tvn.BuffTxt.GetLineCount()
 }
 
 // SetTextMarkup: and scroll to line nb if given.
@@ -462,7 +472,9 @@ func (tvn *TextViewNumbered) GetCurrentLineNb() int {
 }
 
 // SetCursorAtLine: Set current line number & place cursor on it.
+// The line is unfolded if needed.
 func (tvn *TextViewNumbered) SetCursorAtLine(line int) (iter *gtk.TextIter) {
+	tvn.UnfoldLine(line)
 	iter = tvn.BuffTxt.GetIterAtLine(line)
 	tvn.BuffTxt.PlaceCursor(iter)
 	tvn.TextView.GrabFocus()
@@ -493,9 +505,10 @@ func (tvn *TextViewNumbered) ColorBgRange(startLine, endLine int) {
 	}
 }
 
-// ScrollToLine: Scroll to line
+// ScrollToLine: Scroll to line, unfold it if needed.
 func (tvn *TextViewNumbered) ScrollToLine(line int) (iter *gtk.TextIter) {
 	if line > 0 && line < tvn.BuffTxt.GetLineCount() {
+		tvn.UnfoldLine(line)
 
 		for gtk.EventsPending() {
 			gtk.MainIteration() // Wait for pending events (until the widget is redrawn)
@@ -518,71 +531,47 @@ func (tvn *TextViewNumbered) ScrollToLine(line int) (iter *gtk.TextIter) {
 	return
 }
 
-// updateNumbers: Build and store lines numbers to his textview...
-func (tvn *TextViewNumbered) updateNumbers() {
-
-	if tvn.TextView.GetWrapMode() == gtk.WRAP_NONE && tvn.ShowNumbers {
-		if !tvn.tVNum.GetVisible() {
-			tvn.tVNum.SetVisible(true)
-			tvn.autoSetMargin()
-		}
-		linesCount := tvn.BuffTxt.GetLineCount()
-		if linesCount != tvn.lastLineCount-1 {
-
-			// detachBuffer of numbers column
-			tvn.buffNum.Ref()
-			tvn.tVNum.SetBuffer(nil)
-
-			if linesCount < tvn.lastLineCount {
-				// Remove some numbers
-				tvn.lastLineCount = linesCount
-				tvn.buffNum.Delete(tvn.buffNum.GetIterAtLine(tvn.lastLineCount), tvn.buffNum.GetEndIter())
-			} else {
-				// Add numbers
-				var tmpLines string
-				for idx := tvn.lastLineCount; idx <= linesCount; idx++ {
-					tmpLines += strconv.Itoa(idx) + "\n"
-				}
-				tvn.buffNum.Insert(tvn.buffNum.GetEndIter(), tmpLines)
-			}
+// numbersRenderer: gutter column of the lines numbers, each number
+// is aligned with the first row of its line.
+type numbersRenderer struct {
+	tvn       *TextViewNumbered
+	charWidth float64 // width of a digit, measured when drawing
+}
 
-			// attachBuffer of numbers column
-			tvn.tVNum.SetBuffer(tvn.buffNum)
-			tvn.buffNum.Unref()
+const (
+	numbersLeftPadding  = 2
+	numbersRightPadding = 3
+)
 
-			tvn.autoSetMargin()
-			tvn.lastLineCount = linesCount + 1
-		}
-		return
+func (nr *numbersRenderer) Width() int {
+	if !nr.tvn.ShowNumbers || nr.tvn.BuffTxt == nil {
+		return 0
 	}
-	// If we have a Wrap method set to the textview, never display he column numbers
-	tvn.TextView.SetLeftMargin(tvn.textViewLMargin)
-	tvn.tVNum.SetVisible(false)
+	charWidth := nr.charWidth
+	if charWidth == 0 {
+		charWidth = float64(nr.tvn.FontSze) * 0.6 // until the first drawing
+	}
+	digits := len(strconv.Itoa(nr.tvn.BuffTxt.GetLineCount()))
+	return numbersLeftPadding + int(float64(digits)*charWidth+0.5) + numbersRightPadding
 }
 
-// autoSetMargin: used to align left margin of the text view with numbers column width
-func (tvn *TextViewNumbered) autoSetMargin() {
-	var count int
-
-	// fmt.Println("autoSetMargin")
-
-	glib.IdleAdd(func() {
+func (nr *numbersRenderer) Draw(cr *cairo.Context, line int, cell *GutterCell) {
+	nr.tvn.setCairoFont(cr)
+	// The font may have been changed, adjust the gutter width.
+	if charWidth := cr.TextExtents("0").XAdvance; charWidth != nr.charWidth {
+		nr.charWidth = charWidth
+		glib.IdleAdd(nr.tvn.QueueGutterDraw)
+	}
+	extents := cr.FontExtents()
+	number := strconv.Itoa(line + 1)
+	setCairoColour(cr, nr.tvn.NumFgCol)
+	cr.MoveTo(cell.X+cell.Width-numbersRightPadding-cr.TextExtents(number).XAdvance,
+		cell.Y+(cell.RowHeight-extents.Height)/2+extents.Ascent)
+	cr.ShowText(number)
+}
 
-		glib.TimeoutAdd(uint(64), func() bool {
-			count++
-			tvn.tVNumWidth = tvn.tVNum.GetVisibleRect().GetWidth()
-			// First display, to avoid having a large left margin on very large text files.
-			if tvn.tVNumWidth > 150 {
-				tvn.tVNumWidth = 55 // Default value if we haven't other possibility.
-			}
-			tvn.TextView.SetLeftMargin(tvn.textViewLMargin + tvn.tVNumWidth)
-			if tvn.TextView.GetLeftMargin() == tvn.textViewLMargin+tvn.tVNumWidth ||
-				count > 47 { // keep working during some seconds if there is no change
-				return false
-			}
-			return true
-		})
-	})
+func (nr *numbersRenderer) Activate(line int, button gdk.Button) bool {
+	return false
 }
 
 // doColored: Add some colors to the numbers column
@@ -604,12 +593,8 @@ func (tvn *TextViewNumbered) doCss() {
 	color: `+tvn.SelFgCol+`;
 }`, &tvn.TextView.Widget)
 
-	tvn.tVNum.SetName("tvnum")
-	gimc.CssWdgScnLoad(`
-#tvnum text {
-	color: `+tvn.NumFgCol+`;
-	background-color: `+tvn.NumBgCol+`;
-}`, &tvn.tVNum.Widget)
+	// Numbers colours & font
+	tvn.QueueGutterDraw()
 }
 
 // detachBuffers: and block emitting "changed" signal